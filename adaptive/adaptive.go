@@ -0,0 +1,194 @@
+// Package adaptive tunes how many requests run concurrently against an
+// upstream, AIMD-style: the limit grows by one per round of successful
+// requests and halves when the upstream rate-limits (429) or its latency
+// climbs well above the best observed, so exports and uploads settle at what
+// each Outline, wiki and OpenWebUI instance can take without hand-tuning.
+package adaptive
+
+import (
+	"log/slog"
+	"math"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+)
+
+// latencyTolerance is how far latency may rise above the baseline before it
+// counts as congestion.
+const latencyTolerance = 2.0
+
+// latencyWeight is the weight of a new sample in the latency average.
+const latencyWeight = 0.2
+
+// Limiter bounds the requests in flight against one upstream.
+type Limiter struct {
+	Name string
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    float64
+	max      int
+	fixed    bool
+	inFlight int
+	// latency is a moving average of request latency; baseline is the lowest
+	// average seen, drifting up slowly so a permanently slower upstream is
+	// eventually accepted.
+	latency      time.Duration
+	baseline     time.Duration
+	lastDecrease time.Time
+}
+
+// Stats is a snapshot of a limiter.
+type Stats struct {
+	Limit    int
+	Max      int
+	InFlight int
+	Latency  time.Duration
+	Baseline time.Duration
+}
+
+// OpenWebUI limits uploads.
+var OpenWebUI = newLimiter("openwebui")
+
+// sources holds the export limiters by upstream, see Source.
+var (
+	sourcesMu sync.Mutex
+	sources   = make(map[string]*Limiter)
+)
+
+func newLimiter(name string) *Limiter {
+	l := &Limiter{Name: name, limit: 1, max: 1}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// Init sets the ceilings from EXPORT_CONCURRENCY and UPLOAD_CONCURRENCY. With
+// ADAPTIVE_CONCURRENCY=false the limits stay at their ceiling.
+func Init() {
+	OpenWebUI.configure(config.ConfigInstance.UploadConcurrency, config.ConfigInstance.AdaptiveConcurrency)
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	for _, l := range sources {
+		l.configure(config.ConfigInstance.ExportConcurrency, config.ConfigInstance.AdaptiveConcurrency)
+	}
+}
+
+// Source returns the export limiter of the upstream at baseURL, any URL on
+// it: workspaces on the same host share one, while a slow or rate-limited
+// instance does not hold back exports from the others.
+func Source(baseURL string) *Limiter {
+	key := baseURL
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		key = u.Scheme + "://" + u.Host
+	}
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	l := sources[key]
+	if l == nil {
+		l = newLimiter(key)
+		l.configure(config.ConfigInstance.ExportConcurrency, config.ConfigInstance.AdaptiveConcurrency)
+		sources[key] = l
+	}
+	return l
+}
+
+// Limiters returns the upload limiter and the export limiters in use, by name.
+func Limiters() []*Limiter {
+	sourcesMu.Lock()
+	limiters := make([]*Limiter, 0, len(sources)+1)
+	for _, l := range sources {
+		limiters = append(limiters, l)
+	}
+	sourcesMu.Unlock()
+	sort.Slice(limiters, func(i, j int) bool { return limiters[i].Name < limiters[j].Name })
+	return append([]*Limiter{OpenWebUI}, limiters...)
+}
+
+func (l *Limiter) configure(max int, adaptive bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.max, l.fixed = max, !adaptive
+	l.limit = 1
+	if l.fixed {
+		l.limit = float64(max)
+	}
+	l.cond.Broadcast()
+}
+
+// Acquire blocks until a request may start.
+func (l *Limiter) Acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.inFlight >= int(l.limit) {
+		l.cond.Wait()
+	}
+	l.inFlight++
+}
+
+// Release ends a request started with Acquire.
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.cond.Broadcast()
+}
+
+// Observe records the latency of a request the upstream answered. Latency
+// well above the baseline shrinks the limit; otherwise it grows by one per
+// limit requests.
+func (l *Limiter) Observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.latency == 0 {
+		l.latency = d
+	} else {
+		l.latency += time.Duration(latencyWeight * float64(d-l.latency))
+	}
+	if l.baseline == 0 || l.latency < l.baseline {
+		l.baseline = l.latency
+	} else {
+		l.baseline += (l.latency - l.baseline) / 100
+	}
+	if l.fixed {
+		return
+	}
+	if float64(l.latency) > latencyTolerance*float64(l.baseline) {
+		l.decrease("latency " + l.latency.Round(time.Millisecond).String())
+		return
+	}
+	l.limit = math.Min(l.limit+1/l.limit, float64(l.max))
+	l.cond.Broadcast()
+}
+
+// Throttled records that the upstream rate-limited a request.
+func (l *Limiter) Throttled() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.fixed {
+		l.decrease("rate limited")
+	}
+}
+
+// decrease halves the limit, at most once per round trip, so a burst of
+// signals from requests already in flight counts once.
+func (l *Limiter) decrease(reason string) {
+	if time.Since(l.lastDecrease) < l.latency {
+		return
+	}
+	previous := int(l.limit)
+	l.limit = math.Max(l.limit/2, 1)
+	l.lastDecrease = time.Now()
+	if int(l.limit) != previous {
+		slog.Info("Concurrency lowered", "limiter", l.Name, "limit", int(l.limit), "reason", reason)
+	}
+}
+
+// Stats returns the current state of the limiter.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Stats{Limit: int(l.limit), Max: l.max, InFlight: l.inFlight, Latency: l.latency, Baseline: l.baseline}
+}
@@ -0,0 +1,149 @@
+// Package cache provides a TTL cache for metadata lookups (Outline
+// collections, OpenWebUI knowledge listings) so repeated syncs do not issue
+// the same API calls over and over. Entries live in memory, or in Redis when
+// CACHE_REDIS_URL is set so several instances share them.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+)
+
+// Store holds cached values as JSON.
+type Store interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+// store is the global cache; it defaults to memory until Init is called.
+var store Store = newMemoryStore()
+
+// Init selects the cache backend from the configuration.
+func Init() {
+	if config.ConfigInstance.CacheRedisURL == "" {
+		return
+	}
+	opts, err := redis.ParseURL(config.ConfigInstance.CacheRedisURL)
+	if err != nil {
+		logging.Fatal("CACHE_REDIS_URL is invalid", "error", err)
+	}
+	store = &redisStore{client: redis.NewClient(opts)}
+	slog.Info("Using Redis for the metadata cache")
+}
+
+// Get decodes the cached value for key into dest and reports whether it was found.
+func Get(key string, dest interface{}) bool {
+	if config.ConfigInstance.CacheTTL <= 0 {
+		return false
+	}
+	data, ok := store.Get(key)
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(data, dest) == nil
+}
+
+// Set caches value under key for the configured CACHE_TTL.
+func Set(key string, value interface{}) {
+	if config.ConfigInstance.CacheTTL <= 0 {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	store.Set(key, data, config.ConfigInstance.CacheTTL)
+}
+
+// Delete drops the cached value for key, e.g. after the underlying data changed.
+func Delete(key string) {
+	store.Delete(key)
+}
+
+// memoryStore keeps entries in process memory.
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string]memoryEntry)}
+}
+
+func (s *memoryStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(s.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (s *memoryStore) Set(key string, value []byte, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	// Sweep expired entries occasionally so the map does not grow unbounded.
+	if len(s.entries) > 0 && len(s.entries)%1000 == 0 {
+		for k, entry := range s.entries {
+			if now.After(entry.expires) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	s.entries[key] = memoryEntry{value: value, expires: now.Add(ttl)}
+}
+
+func (s *memoryStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// redisStore keeps entries in Redis. Errors are logged and treated as misses,
+// so an unavailable Redis only costs extra API calls.
+type redisStore struct {
+	client *redis.Client
+}
+
+func (s *redisStore) Get(key string) ([]byte, bool) {
+	data, err := s.client.Get(context.Background(), key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			slog.Warn("Error reading from the Redis cache", "key", key, "error", err)
+		}
+		return nil, false
+	}
+	return data, true
+}
+
+func (s *redisStore) Set(key string, value []byte, ttl time.Duration) {
+	if err := s.client.Set(context.Background(), key, value, ttl).Err(); err != nil {
+		slog.Warn("Error writing to the Redis cache", "key", key, "error", err)
+	}
+}
+
+func (s *redisStore) Delete(key string) {
+	if err := s.client.Del(context.Background(), key).Err(); err != nil {
+		slog.Warn("Error deleting from the Redis cache", "key", key, "error", err)
+	}
+}
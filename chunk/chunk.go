@@ -0,0 +1,217 @@
+// Package chunk splits exported Markdown into chunks before upload, so that
+// structures OpenWebUI's character-based splitter would cut apart stay whole.
+package chunk
+
+import (
+	"sort"
+	"strings"
+)
+
+// Chunk is one piece of a document.
+type Chunk struct {
+	Text string
+	// Languages lists the languages of the fenced code blocks in the chunk.
+	Languages []string
+	// Section is the heading path of the chunk, e.g. "Setup > Database",
+	// when split by heading.
+	Section string
+}
+
+// block is a unit of Markdown that is only split if it cannot fit a chunk.
+type block struct {
+	text  string
+	table bool
+	// code is set for fenced code blocks, which are never split.
+	code bool
+	// language is the info string of a fenced code block, e.g. "go".
+	language string
+}
+
+// Split divides markdown into chunks of at most size characters. Blocks
+// (paragraphs, tables and fenced code blocks) are never split unless they
+// alone exceed size. A table that does not fit is converted into key-value
+// lines, one per row, so every piece still carries its column names. A code
+// block that does not fit becomes a chunk of its own, even though it exceeds size.
+func Split(markdown string, size int) []Chunk {
+	return split(markdown, size, characters)
+}
+
+// split is Split with size measured in u.
+func split(markdown string, size int, u unit) []Chunk {
+	var chunks []Chunk
+	var current strings.Builder
+	currentLen := 0
+	languages := make(map[string]bool)
+	flush := func() {
+		if text := strings.TrimSpace(current.String()); text != "" {
+			c := Chunk{Text: text}
+			for language := range languages {
+				c.Languages = append(c.Languages, language)
+			}
+			sort.Strings(c.Languages)
+			chunks = append(chunks, c)
+		}
+		current.Reset()
+		currentLen = 0
+		languages = make(map[string]bool)
+	}
+	add := func(text string) {
+		n := u.length(text)
+		if current.Len() > 0 && currentLen+n+u.separator > size {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+			currentLen += u.separator
+		}
+		current.WriteString(text)
+		currentLen += n
+	}
+
+	for _, b := range splitBlocks(markdown) {
+		if b.code {
+			add(b.text)
+			if b.language != "" {
+				languages[b.language] = true
+			}
+			continue
+		}
+		if u.length(b.text) <= size {
+			add(b.text)
+			continue
+		}
+		var pieces []string
+		if b.table {
+			pieces = tableToKeyValue(b.text)
+		} else {
+			pieces = strings.Split(b.text, "\n")
+		}
+		for _, piece := range pieces {
+			for u.length(piece) > size {
+				head, tail := u.cut(piece, size)
+				add(head)
+				piece = tail
+			}
+			add(piece)
+		}
+	}
+	flush()
+	return chunks
+}
+
+// splitBlocks splits markdown at blank lines, keeping each table and each
+// fenced code block (including its blank lines) as one block.
+func splitBlocks(markdown string) []block {
+	var blocks []block
+	var lines []string
+	table := false
+	fence, language := "", ""
+	emit := func() {
+		if len(lines) > 0 {
+			blocks = append(blocks, block{
+				text:     strings.Join(lines, "\n"),
+				table:    table,
+				code:     fence != "",
+				language: language,
+			})
+		}
+		lines, table = nil, false
+	}
+	for _, line := range strings.Split(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			lines = append(lines, line)
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				emit()
+				fence, language = "", ""
+			}
+			continue
+		}
+		if marker := fenceMarker(trimmed); marker != "" {
+			emit()
+			fence = marker
+			if info := strings.Fields(strings.TrimLeft(trimmed, marker[:1])); len(info) > 0 {
+				language = strings.ToLower(info[0])
+			}
+			lines = append(lines, line)
+			continue
+		}
+		isTableLine := strings.HasPrefix(trimmed, "|")
+		switch {
+		case trimmed == "":
+			emit()
+			continue
+		case isTableLine != table && len(lines) > 0:
+			// A table starts or ends without a blank line in between.
+			emit()
+		}
+		table = isTableLine
+		lines = append(lines, line)
+	}
+	emit()
+	return blocks
+}
+
+// fenceMarker returns the fence (``` or ~~~, possibly longer) that opens a
+// code block on line, or "" if the line does not open one.
+func fenceMarker(line string) string {
+	for _, c := range []string{"`", "~"} {
+		marker := line[:len(line)-len(strings.TrimLeft(line, c))]
+		if len(marker) >= 3 {
+			return marker
+		}
+	}
+	return ""
+}
+
+// tableToKeyValue renders every data row of a Markdown table as
+// "Header: value; Header: value".
+func tableToKeyValue(table string) []string {
+	rows := strings.Split(table, "\n")
+	if len(rows) < 2 {
+		return rows
+	}
+	headers := tableCells(rows[0])
+	var lines []string
+	for _, row := range rows[1:] {
+		cells := tableCells(row)
+		if isSeparatorRow(cells) {
+			continue
+		}
+		var pairs []string
+		for i, cell := range cells {
+			if cell == "" {
+				continue
+			}
+			if i < len(headers) && headers[i] != "" {
+				pairs = append(pairs, headers[i]+": "+cell)
+			} else {
+				pairs = append(pairs, cell)
+			}
+		}
+		lines = append(lines, strings.Join(pairs, "; "))
+	}
+	return lines
+}
+
+// tableCells returns the trimmed cells of a Markdown table row.
+func tableCells(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	row = strings.TrimSuffix(row, "|")
+	cells := strings.Split(row, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// isSeparatorRow reports whether cells form the |---|:--:| row below the header.
+func isSeparatorRow(cells []string) bool {
+	for _, cell := range cells {
+		if strings.Trim(cell, "-: ") != "" {
+			return false
+		}
+	}
+	return true
+}
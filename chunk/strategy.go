@@ -0,0 +1,197 @@
+package chunk
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Options configure SplitWith.
+type Options struct {
+	// Strategy is "size" (blocks packed up to Size characters, the default),
+	// "tokens" (the same with Size counted in tokens) or "heading" (one chunk
+	// per section, sections longer than Size characters split further).
+	Strategy string
+	// Size bounds a chunk; zero means unbounded.
+	Size int
+	// Overlap repeats the end of the previous chunk, in the unit of Size, at
+	// the start of every chunk so context spanning a boundary is not lost.
+	// It is capped below Size.
+	Overlap int
+	// HeadingLevel is the deepest heading level starting a new chunk with
+	// the heading strategy (default 2).
+	HeadingLevel int
+}
+
+// SplitWith divides markdown into chunks as configured by opts.
+func SplitWith(markdown string, opts Options) []Chunk {
+	u := characters
+	if opts.Strategy == "tokens" {
+		u = tokens
+	}
+	size := opts.Size
+	if size <= 0 {
+		size = math.MaxInt
+	}
+	var chunks []Chunk
+	if opts.Strategy == "heading" {
+		level := opts.HeadingLevel
+		if level <= 0 {
+			level = 2
+		}
+		for _, s := range splitSections(markdown, level) {
+			for _, c := range split(s.text, size, u) {
+				c.Section = s.path
+				chunks = append(chunks, c)
+			}
+		}
+	} else {
+		chunks = split(markdown, size, u)
+	}
+	if opts.Overlap >= size {
+		opts.Overlap = size - 1
+	}
+	if opts.Overlap > 0 {
+		for i := len(chunks) - 1; i > 0; i-- {
+			// A tail cutting into a code fence would open a bogus code block.
+			tail := u.tail(chunks[i-1].Text, opts.Overlap)
+			if tail != "" && !strings.Contains(tail, "```") && !strings.Contains(tail, "~~~") {
+				chunks[i].Text = tail + "\n\n" + chunks[i].Text
+			}
+		}
+	}
+	return chunks
+}
+
+// unit measures and cuts text for a chunking strategy.
+type unit struct {
+	length func(string) int
+	// cut splits text after n units.
+	cut func(text string, n int) (head, tail string)
+	// tail returns roughly the last n units of text, starting at a word.
+	tail func(text string, n int) string
+	// separator is the cost of the blank line joining two blocks.
+	separator int
+}
+
+// characters counts runes, so multi-byte characters are never cut apart.
+var characters = unit{
+	length: utf8.RuneCountInString,
+	cut: func(text string, n int) (string, string) {
+		end := runeOffset(text, n)
+		// Cut at the last space unless that leaves the head less than half full.
+		if i := strings.LastIndexFunc(text[:end], unicode.IsSpace); i > 0 && utf8.RuneCountInString(text[:i]) >= n/2 {
+			return text[:i], strings.TrimLeftFunc(text[i:], unicode.IsSpace)
+		}
+		return text[:end], text[end:]
+	},
+	tail: func(text string, n int) string {
+		length := utf8.RuneCountInString(text)
+		if length <= n {
+			return ""
+		}
+		tail := text[runeOffset(text, length-n):]
+		// Start at a word boundary rather than mid-word.
+		if i := strings.IndexFunc(tail, unicode.IsSpace); i >= 0 {
+			tail = tail[i:]
+		}
+		return strings.TrimSpace(tail)
+	},
+	separator: 2,
+}
+
+// runeOffset returns the byte offset of the nth rune of text.
+func runeOffset(text string, n int) int {
+	for i := range text {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(text)
+}
+
+// tokens approximates tokens as whitespace-separated words, which is close
+// enough for staying below an embedding model's context window.
+var tokens = unit{
+	length: func(text string) int { return len(strings.Fields(text)) },
+	cut: func(text string, n int) (string, string) {
+		words := strings.Fields(text)
+		return strings.Join(words[:n], " "), strings.Join(words[n:], " ")
+	},
+	tail: func(text string, n int) string {
+		words := strings.Fields(text)
+		if len(words) <= n {
+			return ""
+		}
+		return strings.Join(words[len(words)-n:], " ")
+	},
+}
+
+// section is the text below a heading, including the heading itself.
+type section struct {
+	path string
+	text string
+}
+
+// splitSections splits markdown before every heading of at most level,
+// ignoring headings inside fenced code blocks. The path of each section
+// joins the headings above it, e.g. "Setup > Database".
+func splitSections(markdown string, level int) []section {
+	var sections []section
+	var lines []string
+	var headings []string
+	path := ""
+	fence := ""
+	emit := func() {
+		if text := strings.TrimSpace(strings.Join(lines, "\n")); text != "" {
+			sections = append(sections, section{path: path, text: text})
+		}
+		lines = nil
+	}
+	for _, line := range strings.Split(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			lines = append(lines, line)
+			continue
+		}
+		if marker := fenceMarker(trimmed); marker != "" {
+			fence = marker
+			lines = append(lines, line)
+			continue
+		}
+		if depth, title := heading(trimmed); depth > 0 && depth <= level {
+			emit()
+			if depth-1 < len(headings) {
+				headings = headings[:depth-1]
+			}
+			for len(headings) < depth-1 {
+				headings = append(headings, "")
+			}
+			headings = append(headings, title)
+			var parts []string
+			for _, h := range headings {
+				if h != "" {
+					parts = append(parts, h)
+				}
+			}
+			path = strings.Join(parts, " > ")
+		}
+		lines = append(lines, line)
+	}
+	emit()
+	return sections
+}
+
+// heading returns the level and text of an ATX heading line, or 0.
+func heading(line string) (int, string) {
+	depth := len(line) - len(strings.TrimLeft(line, "#"))
+	if depth == 0 || depth > 6 || (len(line) > depth && line[depth] != ' ') {
+		return 0, ""
+	}
+	return depth, strings.TrimSpace(strings.TrimRight(line[depth:], "# "))
+}
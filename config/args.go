@@ -0,0 +1,63 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// parseArgs splits a command line setting into arguments. It accepts a JSON
+// array of strings, e.g. ["-e", "ssh -i key"], or shell words, where single
+// and double quotes group words and a backslash escapes the next character,
+// e.g. -e "ssh -i key". No shell is involved.
+func parseArgs(value string) ([]string, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "[") {
+		var args []string
+		if err := json.Unmarshal([]byte(value), &args); err != nil {
+			return nil, err
+		}
+		return args, nil
+	}
+	var args []string
+	var word strings.Builder
+	inWord := false
+	quote := rune(0)
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case unicode.IsSpace(r):
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
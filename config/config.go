@@ -1,11 +1,51 @@
 package config
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/expr"
+	"github.com/mikeshootzz/outline-rag-scraper/i18n"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
 )
 
+// Workspace describes a wiki workspace to export from.
+type Workspace struct {
+	Name        string // Empty for the default workspace; otherwise used as a filename prefix.
+	Kind        string // Wiki the workspace lives in: "outline", "confluence", "git", "github-wiki" or "gitlab-wiki".
+	APIBaseURL  string
+	APIToken    string
+	DocsBaseURL string
+	Version     string // Outline version to assume when the server does not report one.
+	// Username is the account of APIToken, for wikis using basic auth
+	// (Confluence Cloud: the Atlassian account email).
+	Username string
+	// Spaces limits a Confluence workspace to these space keys; all spaces
+	// are exported when empty.
+	Spaces []string
+	// Branch is the branch of a git workspace to export; the remote's default
+	// branch when empty.
+	Branch string
+	// CheckoutDir is where a git workspace is cloned, or below which the
+	// wikis of a wiki workspace are.
+	CheckoutDir string
+	// Projects are the repositories (owner/repo) or projects (group/project)
+	// whose wikis a wiki workspace exports.
+	Projects []string
+}
+
+// IsOutline reports whether the workspace is an Outline workspace.
+func (w Workspace) IsOutline() bool {
+	return w.Kind == "outline"
+}
+
 // Config holds configuration values.
 type Config struct {
 	APIToken              string
@@ -17,7 +57,375 @@ type Config struct {
 	DocumentsDir          string
 	Limit                 int
 	Port                  string
+	// LogLevel (LOG_LEVEL: debug, info, warn or error; default info) and
+	// LogFormat (LOG_FORMAT: text or json; default text) configure the
+	// structured log output. Debug also logs every HTTP request.
+	LogLevel              string
+	LogFormat             string
 	DatabaseURL           string // New field for your PostgreSQL DSN.
+	ExportSort            string // documents.list sort field: updatedAt, createdAt or title.
+	ExportDirection       string // documents.list sort direction: ASC or DESC.
+	ExportTraversal       string // "paged" lists all documents, "collection" pages each collection separately.
+	ExportDriftProtection bool   // List all document IDs up front (re-listing until stable) before exporting.
+	UploadExtension       string // Default extension for uploaded files; mappings may override it.
+	UploadContentType     string // Default MIME type for uploaded files; mappings may override it.
+	UploadPlainText       bool   // Default for converting Markdown to plain text before upload.
+	AutoCreateKnowledge   bool   // Default for creating missing knowledge collections of mappings.
+	ExportSkipArchived    bool   // Skip archived documents (EXPORT_SKIP_ARCHIVED, default true).
+	ExportSkipDrafts      bool   // Skip unpublished drafts (EXPORT_SKIP_DRAFTS, default true).
+	ExportSkipTemplates   bool   // Skip document templates (EXPORT_SKIP_TEMPLATES, default true).
+	Workspaces            []Workspace
+	RemoteSyncMethod      string // "rsync" or "webdav"; used when RemoteSyncTarget is set.
+	RemoteSyncTarget      string // rsync destination (user@host:/path) or WebDAV collection URL.
+	RemoteSyncUser        string // WebDAV basic auth user.
+	RemoteSyncPassword    string // WebDAV basic auth password.
+	ServeCorpus           bool   // Serve DocumentsDir read-only over HTTP/WebDAV at /corpus/.
+	CorpusToken           string // Bearer token accepted for /corpus/.
+	CorpusUser            string // Basic auth user accepted for /corpus/.
+	CorpusPassword        string // Basic auth password accepted for /corpus/.
+	StaticSite            bool   // Render the corpus into a static HTML site served at /site/ to authenticated readers.
+	SiteDir               string // Output directory for the static site.
+	// RemoteSyncRsyncArgs are extra arguments passed to rsync
+	// (REMOTE_SYNC_RSYNC_ARGS): a JSON array such as ["-e", "ssh -p 2222"]
+	// or shell words such as -e "ssh -p 2222".
+	RemoteSyncRsyncArgs []string
+	// ExportFilter keeps only documents for which it is true (EXPORT_FILTER,
+	// e.g. `doc.collection != "Archive" && !("wip" in doc.tags)`).
+	ExportFilter *expr.Expr
+	// RoutingRules route files to knowledge collections by their metadata
+	// (ROUTING_RULES, e.g. `"public" in doc.tags => kid1,kid2`). The first
+	// matching rule wins over collection mappings.
+	RoutingRules []RoutingRule
+	// CanaryKnowledgeCollectionID receives a sample before every upload; the
+	// upload is aborted if the sample fails to upload or index.
+	CanaryKnowledgeCollectionID string
+	CanarySampleSize            int // Documents per collection synced to the canary.
+	// AdminAPIKey authorizes API key management and every mapping sync.
+	AdminAPIKey string
+	// RequireAPIKey rejects requests to every endpoint without ADMIN_API_KEY
+	// or an issued key holding the endpoint's scope (REQUIRE_API_KEY, default
+	// true once ADMIN_API_KEY is set), except PublicPaths (PUBLIC_PATHS, comma-separated, default /healthz; a trailing
+	// slash matches a prefix) and endpoints that authenticate themselves.
+	RequireAPIKey bool
+	PublicPaths   []string
+	// KnowledgeModels are the OpenWebUI model IDs the default knowledge
+	// collection is attached to after every upload (KNOWLEDGE_MODELS,
+	// comma-separated); mappings name their own models.
+	KnowledgeModels []string
+	// StatusPublic serves /status/collections/{name} without an API key
+	// (STATUS_PUBLIC), e.g. to link it from Outline collection descriptions.
+	StatusPublic bool
+	// TrustProxyHeaders takes client addresses from X-Forwarded-For.
+	TrustProxyHeaders bool
+	// DefaultClassification applies to documents and collections without a
+	// #public, #internal or #confidential tag.
+	DefaultClassification string
+	// KnowledgeMaxClassification is the most sensitive classification sent to
+	// knowledge collections whose mapping does not set one.
+	KnowledgeMaxClassification string
+	// ExtractAttachments extracts the text of PDF, docx and pptx attachments
+	// into companion documents.
+	ExtractAttachments bool
+	// CollectionOverviews writes the description of every collection to an
+	// _overview.md document in its directory (COLLECTION_OVERVIEWS=true), so
+	// the knowledge collection knows what the collection covers.
+	CollectionOverviews bool
+	// CollectionIndex writes a table of contents with the title, link and a
+	// one-line summary of every document to an _index.md document in each
+	// collection directory (COLLECTION_INDEX=true).
+	CollectionIndex bool
+	// AttachmentLinks rewrites links to Outline attachments, which OpenWebUI
+	// cannot resolve: "download" stores the files next to the Markdown and
+	// links them relatively, "inline" additionally embeds images of at most
+	// InlineImageMaxSize bytes (INLINE_IMAGE_MAX_SIZE, default 64 KiB) as
+	// data URIs. Empty keeps the links.
+	AttachmentLinks    string
+	InlineImageMaxSize int
+	// ExportFormat is the file format documents are exported in
+	// (EXPORT_FORMAT): markdown (default), html, text or json.
+	ExportFormat string
+	// InternalLinks rewrites links between Outline documents (INTERNAL_LINKS):
+	// "url" points them at DocsBaseURL, "file" at the exported file relative
+	// to the linking one, falling back to the URL for documents not exported.
+	// Empty keeps the links.
+	InternalLinks string
+	// OCRMethod enables OCR of embedded images: "tesseract" runs the local
+	// binary, "api" posts images to OCRAPIURL. Empty disables OCR.
+	OCRMethod   string
+	OCRLanguage string // Tesseract language, e.g. "eng" or "deu+eng".
+	OCRAPIURL   string // External OCR endpoint; answers with text or {"text": ...}.
+	OCRAPIToken string // Bearer token for OCRAPIURL.
+	// DiagramDescriptions turns Mermaid and PlantUML blocks into LLM-written
+	// descriptions: "replace" swaps the block for the description, "append"
+	// keeps both. Empty disables the stage.
+	DiagramDescriptions string
+	DiagramModel        string // OpenWebUI model used to describe diagrams.
+	// QuestionGeneration has an LLM write QuestionCount (QUESTION_COUNT,
+	// default 3) questions every document answers, which retrieval matches
+	// better than terse reference text: "metadata" adds them to the front
+	// matter and the chunk metadata of vector stores, "append" also adds
+	// them as a section at the end of the document. Empty disables the stage.
+	// Documents classified above KnowledgeMaxClassification are never sent.
+	QuestionGeneration string
+	QuestionModel      string // OpenWebUI model used to generate questions (QUESTION_MODEL).
+	QuestionCount      int
+	// ChunkSize pre-chunks documents into parts of at most this many
+	// characters before upload, keeping tables intact. Set it no larger than
+	// OpenWebUI's chunk size so OpenWebUI does not split the parts again.
+	// Zero leaves chunking to OpenWebUI.
+	ChunkSize int
+	// ChunkStrategy is "size" (default), "tokens" (ChunkSize and ChunkOverlap
+	// count tokens) or "heading" (one part per section up to
+	// ChunkHeadingLevel, default 2, split further beyond ChunkSize).
+	ChunkStrategy     string
+	ChunkOverlap      int // Repeated from the previous part (CHUNK_OVERLAP).
+	ChunkHeadingLevel int
+	// StripSections lists section headings (e.g. "Revision History") whose
+	// sections are removed before upload.
+	StripSections []string
+	// GlossaryFile or GlossaryDocumentID (an Outline document) provide term
+	// definitions. GlossaryMode "inline" expands acronyms on first use,
+	// "chunk" adds a glossary document to every collection.
+	GlossaryFile       string
+	GlossaryDocumentID string
+	GlossaryMode       string
+	// CacheTTL is how long metadata lookups are cached; zero disables caching.
+	CacheTTL time.Duration
+	// CacheRedisURL stores the cache in Redis (redis://host:6379/0) instead of memory.
+	CacheRedisURL string
+	// JobQueue dispatches background jobs: "postgres" (polling, default) or "redis".
+	JobQueue         string
+	JobQueueRedisURL string // Redis URL for JOB_QUEUE=redis; defaults to CACHE_REDIS_URL.
+	JobWorkers       int    // Number of concurrent job workers.
+	// PriorityWorkers are reserved for priority jobs such as webhook-triggered
+	// single-document syncs.
+	PriorityWorkers int
+	// JobLeaseTimeout is how long a running job and the sync lock stay owned
+	// without a heartbeat (JOB_LEASE_TIMEOUT, default 2m). Jobs of crashed
+	// workers are queued again once it passes.
+	JobLeaseTimeout time.Duration
+	// OutlineWebhookSecret verifies the signature of Outline webhook deliveries.
+	OutlineWebhookSecret string
+	// CommentBack posts a comment on Outline documents that failed to export
+	// CommentBackFailures times in a row (COMMENT_BACK_FAILURES, default 3) or
+	// are excluded for one of CommentBackExclusions (COMMENT_BACK_EXCLUSIONS,
+	// comma-separated, default filtered), telling their authors in Outline
+	// (COMMENT_BACK). The API token needs permission to comment.
+	CommentBack           bool
+	CommentBackFailures   int
+	CommentBackExclusions []string
+	// TicketSystem opens a ticket (TICKET_SYSTEM, jira or servicenow) when a
+	// document export or the uploads to a knowledge collection failed
+	// TicketFailures times in a row (TICKET_FAILURES, default 3). Tickets go
+	// to TicketURL (TICKET_URL) as TicketUsername (TICKET_USERNAME) with
+	// TicketToken (TICKET_TOKEN, an API token or password; a bearer token
+	// without username). Jira issues are created in TicketProject
+	// (TICKET_PROJECT) as TicketIssueType (TICKET_ISSUE_TYPE, default Task),
+	// ServiceNow records in TicketTable (TICKET_TABLE, default incident),
+	// optionally assigned to TicketAssignmentGroup (TICKET_ASSIGNMENT_GROUP).
+	TicketSystem          string
+	TicketFailures        int
+	TicketURL             string
+	TicketUsername        string
+	TicketToken           string
+	TicketProject         string
+	TicketIssueType       string
+	TicketTable           string
+	TicketAssignmentGroup string
+	// SyncGate holds staged sync runs before publishing: "" publishes right
+	// away, "manual" waits for approval, "rules" publishes runs that pass the
+	// automatic checks and holds the others for approval.
+	SyncGate string
+	// SyncGateMaxRemovedPercent is the share of the corpus a run may remove
+	// before the "rules" gate holds it (SYNC_GATE_MAX_REMOVED_PERCENT, default 10).
+	SyncGateMaxRemovedPercent int
+	// IntegritySampleSize is how many uploaded files per knowledge collection
+	// the post-publish integrity check downloads and hashes (default 5).
+	IntegritySampleSize int
+	// IntegritySigningKey signs integrity reports with an ed25519 key derived from it.
+	IntegritySigningKey string
+	// KnowledgeNameTemplate and KnowledgeDescriptionTemplate are text/template
+	// strings rendered into the name and description of every knowledge
+	// collection after an upload; empty templates leave them unchanged.
+	KnowledgeNameTemplate        string
+	KnowledgeDescriptionTemplate string
+	// TransformCommands are the external pipeline stages mappings may use,
+	// by name (TRANSFORM_COMMANDS, e.g. "redact=/opt/bin/redact --strict;tables=fix-tables").
+	// Arguments are split on whitespace; no shell is involved.
+	TransformCommands map[string][]string
+	// TransformModules are WASI modules usable as transforms, by name
+	// (TRANSFORM_WASM_MODULES, e.g. "redact=/opt/plugins/redact.wasm"). They
+	// run sandboxed in WasmRuntime (WASM_RUNTIME, default "wasmtime run")
+	// without file system or network access, limited to WasmMaxMemoryMB
+	// (WASM_MAX_MEMORY_MB, default 64) of memory, WasmFuel (WASM_FUEL,
+	// instructions; default 0, unlimited) and WasmTimeout (WASM_TIMEOUT,
+	// default TRANSFORM_TIMEOUT) per run.
+	TransformModules map[string]string
+	WasmRuntime      []string
+	WasmMaxMemoryMB  int
+	WasmFuel         uint64
+	WasmTimeout      time.Duration
+	// TransformTimeout bounds every transform run (TRANSFORM_TIMEOUT, default 30s).
+	TransformTimeout time.Duration
+	// Language is the language of messages when a request names none it
+	// supports (LANGUAGE: en, de or fr; default en).
+	Language string
+	// MaxFailurePercent aborts a run, before anything is removed, when more
+	// than this share of its exports or uploads fail (MAX_FAILURE_PERCENT,
+	// default 10; 100 disables the check).
+	MaxFailurePercent int
+	// TokenEncryptionKey is the master key encrypting the tokens stored in
+	// Postgres. It is read from TOKEN_ENCRYPTION_KEY or, to keep it in a KMS
+	// or secret manager, from the output of TOKEN_ENCRYPTION_KEY_COMMAND (e.g.
+	// "gcloud secrets versions access latest --secret=scraper-key"), run at
+	// startup without a shell.
+	TokenEncryptionKey string
+	// TokenEncryptionOldKeys are previous master keys (TOKEN_ENCRYPTION_OLD_KEYS,
+	// comma-separated). Tokens sealed with them stay readable until they are
+	// re-encrypted with the current key at startup or via /secrets/rotate.
+	TokenEncryptionOldKeys []string
+	// TokenCheckInterval is how often the Outline, OpenWebUI and user tokens
+	// are validated (TOKEN_CHECK_INTERVAL, default 6h; 0 disables the checks).
+	// Tokens expiring within TokenExpiryWarning (TOKEN_EXPIRY_WARNING, default
+	// 168h), revoked or failing their check are alerted on through the log
+	// and TokenAlertWebhookURL (TOKEN_ALERT_WEBHOOK_URL).
+	TokenCheckInterval   time.Duration
+	TokenExpiryWarning   time.Duration
+	TokenAlertWebhookURL string
+	// OutlineOAuthClientID and OutlineOAuthClientSecret identify an Outline
+	// OAuth app through which users connect their own account at
+	// /oauth/outline/connect instead of pasting an API token. The app must
+	// redirect to OutlineOAuthRedirectURL (OUTLINE_OAUTH_REDIRECT_URL, ending
+	// in /oauth/outline/callback) and is granted OutlineOAuthScope
+	// (OUTLINE_OAUTH_SCOPE, default "read").
+	OutlineOAuthClientID     string
+	OutlineOAuthClientSecret string
+	OutlineOAuthRedirectURL  string
+	OutlineOAuthScope        string
+	// OIDCIssuerURL enables single sign-on through an OpenID Connect provider
+	// (OIDC_ISSUER_URL) for OIDCProtectedPaths (OIDC_PROTECTED_PATHS,
+	// comma-separated, default the Swagger UI and the mapping endpoints; a
+	// trailing slash matches a prefix). The client (OIDC_CLIENT_ID,
+	// OIDC_CLIENT_SECRET) must redirect to OIDCRedirectURL
+	// (OIDC_REDIRECT_URL, ending in /oauth/oidc/callback). Only members of
+	// OIDCAdminGroup (OIDC_ADMIN_GROUP, required), read from the OIDCGroupsClaim of
+	// the ID token (OIDC_GROUPS_CLAIM, default "groups"), and users
+	// registered under /users are signed in, for OIDCSessionTTL
+	// (OIDC_SESSION_TTL, default 8h). Registered users hold their role's
+	// scope, unregistered group members are admins. Requests with a valid
+	// API key are let through as before.
+	OIDCIssuerURL      string
+	OIDCClientID       string
+	OIDCClientSecret   string
+	OIDCRedirectURL    string
+	OIDCScopes         string // OIDC_SCOPES, default "openid email profile".
+	OIDCAdminGroup     string
+	OIDCGroupsClaim    string
+	OIDCProtectedPaths []string
+	OIDCSessionTTL     time.Duration
+	// UserDocumentsDir holds one directory per registered user token with the
+	// documents that user may read.
+	UserDocumentsDir string
+	// FreezeWindows are recurring windows (FREEZE_WINDOWS, e.g. during demos)
+	// in which changes to the knowledge collections are queued instead of
+	// pushed, evaluated in FreezeLocation (FREEZE_TIMEZONE, default local).
+	FreezeWindows  []FreezeWindow
+	FreezeLocation *time.Location
+	// SyncSchedules start a sync at fixed local times (SYNC_SCHEDULE, e.g.
+	// "02:00;Sat 14:00 America/New_York"). Schedules without their own time
+	// zone use SyncLocation (SYNC_TZ, default local).
+	SyncSchedules []Schedule
+	SyncLocation  *time.Location
+	// SyncJitter delays every scheduled sync by a random duration up to this
+	// value (SYNC_JITTER, e.g. 10m), so deployments sharing a schedule do not
+	// hit Outline and OpenWebUI at the same second.
+	SyncJitter time.Duration
+	// HeartbeatURL is pinged when a scheduled sync succeeds (HEARTBEAT_URL),
+	// HeartbeatStartURL when it starts and HeartbeatFailURL when it fails
+	// (HEARTBEAT_START_URL and HEARTBEAT_FAIL_URL, default HEARTBEAT_URL with
+	// /start and /fail as Healthchecks.io expects; "none" skips the ping), so
+	// a dead man's switch alerts when the schedule stops firing.
+	HeartbeatURL      string
+	HeartbeatStartURL string
+	HeartbeatFailURL  string
+	// UpstreamProbeInterval is how often Outline and OpenWebUI are probed for
+	// availability (UPSTREAM_PROBE_INTERVAL, default 1m; 0 disables the
+	// probes). Results are reported on /healthz?details=true and /metrics.
+	UpstreamProbeInterval time.Duration
+	// Sinks are where uploads go (SINKS, comma-separated, or SINK for a single
+	// one): "openwebui" (default), "qdrant", "chroma" or "elasticsearch" (also
+	// "opensearch"). Every sync run feeds all of them.
+	// Vector store sinks chunk and embed documents themselves, so mappings and
+	// routing rules still apply. Qdrant upserts them into QdrantCollection
+	// (QDRANT_COLLECTION, default "outline") with the knowledge collection ID
+	// as payload; Chroma into one collection per knowledge ID, created in
+	// ChromaTenant and ChromaDatabase (CHROMA_TENANT, CHROMA_DATABASE,
+	// default "default_tenant" and "default_database"). Elasticsearch and
+	// OpenSearch index whole documents without embeddings into
+	// ElasticsearchIndex (ELASTICSEARCH_INDEX, default "outline"), whose index
+	// template is managed by the scraper.
+	Sinks            []string
+	QdrantURL        string
+	QdrantAPIKey     string
+	QdrantCollection string
+	ChromaURL        string
+	ChromaToken      string
+	ChromaTenant     string
+	ChromaDatabase   string
+	// ElasticsearchAPIKey is sent as "ApiKey"; OpenSearch uses
+	// ElasticsearchUsername and ElasticsearchPassword for basic auth instead.
+	ElasticsearchURL      string
+	ElasticsearchAPIKey   string
+	ElasticsearchUsername string
+	ElasticsearchPassword string
+	ElasticsearchIndex    string
+	// EmbeddingProvider generates the vectors for vector store sinks: "openai"
+	// (default, any OpenAI-compatible /embeddings endpoint) or "ollama".
+	// EmbeddingURL defaults to the provider's public or local endpoint.
+	EmbeddingProvider  string
+	EmbeddingURL       string
+	EmbeddingAPIKey    string
+	EmbeddingModel     string
+	EmbeddingBatchSize int // Texts per embedding request (EMBEDDING_BATCH_SIZE, default 32).
+	// SimulationFixtures is a directory of recorded exchanges (the exchanges/
+	// of a debug bundle, SIMULATION_FIXTURES). When set, every upstream call is
+	// answered from it and nothing reaches the network, so configuration,
+	// mappings and pipeline settings can be tried offline. git and rsync are
+	// answered from command fixtures in the same directory, e.g.
+	// {"command":"git","args":["fetch","origin"],"stdout":"","exit_code":0}.
+	// testdata/simulation/full-sync holds the fixtures of a complete sync.
+	SimulationFixtures string
+	// ExportConcurrency and UploadConcurrency cap the documents exported from
+	// Outline and uploaded to OpenWebUI at once (EXPORT_CONCURRENCY and
+	// UPLOAD_CONCURRENCY, default 4). Unless AdaptiveConcurrency is off
+	// (ADAPTIVE_CONCURRENCY=false), the actual concurrency starts at one and
+	// follows observed 429s and latency up to the cap, separately for every
+	// upstream host.
+	ExportConcurrency   int
+	UploadConcurrency   int
+	AdaptiveConcurrency bool
+	// DiskHeadroomPercent is added to the estimated corpus size when checking
+	// free space before a full export (DISK_HEADROOM_PERCENT, default 20).
+	DiskHeadroomPercent int
+	// CorpusDir, when set (CORPUS_DIR), is where consumers read the corpus:
+	// a symlink swapped to a snapshot of DocumentsDir whenever a sync run is
+	// published, or after every export when there is no SYNC_GATE. Snapshots are kept below CorpusRunsDir (CORPUS_RUNS_DIR,
+	// default CorpusDir + ".runs"), next to a "latest" symlink to the newest;
+	// CorpusRetention (CORPUS_RETENTION, default 5) is how many are kept for
+	// rollback and diffing.
+	CorpusDir       string
+	CorpusRunsDir   string
+	CorpusRetention int
+	// ReviewDiffLines holds the export of a document whose change adds and
+	// removes at least this many source lines until it is approved
+	// (REVIEW_DIFF_LINES, 0 disables reviews). ReviewCollections limits
+	// reviews to some collection directories (REVIEW_COLLECTIONS,
+	// comma-separated; all when empty).
+	ReviewDiffLines   int
+	ReviewCollections []string
+	// Mode is "all" (API and workers in one process), "api" (HTTP only; every
+	// export and upload is queued for workers) or "worker" (jobs only, no HTTP).
+	Mode string
 }
 
 // ConfigInstance is the global configuration instance.
@@ -34,7 +442,107 @@ func LoadConfig() {
 		OpenWebUIAPIURL:       os.Getenv("OPENWEBUI_API_URL"),
 		DocumentsDir:          os.Getenv("DOCUMENTS_DIR"),
 		Port:                  os.Getenv("PORT"),
+		LogLevel:              strings.ToLower(os.Getenv("LOG_LEVEL")),
+		LogFormat:             strings.ToLower(os.Getenv("LOG_FORMAT")),
 		DatabaseURL:           os.Getenv("DATABASE_URL"), // Load the database URL from your env.
+		ExportSort:            os.Getenv("EXPORT_SORT"),
+		ExportDirection:       strings.ToUpper(os.Getenv("EXPORT_DIRECTION")),
+		ExportTraversal:       os.Getenv("EXPORT_TRAVERSAL"),
+		ExportDriftProtection: os.Getenv("EXPORT_DRIFT_PROTECTION") == "true",
+		UploadExtension:       os.Getenv("UPLOAD_EXTENSION"),
+		UploadContentType:     os.Getenv("UPLOAD_CONTENT_TYPE"),
+		UploadPlainText:       os.Getenv("UPLOAD_PLAIN_TEXT") == "true",
+		AutoCreateKnowledge:   os.Getenv("AUTO_CREATE_KNOWLEDGE") == "true",
+		ExportSkipArchived:    os.Getenv("EXPORT_SKIP_ARCHIVED") != "false",
+		ExportSkipDrafts:      os.Getenv("EXPORT_SKIP_DRAFTS") != "false",
+		ExportSkipTemplates:   os.Getenv("EXPORT_SKIP_TEMPLATES") != "false",
+		RemoteSyncMethod:      os.Getenv("REMOTE_SYNC_METHOD"),
+		RemoteSyncTarget:      os.Getenv("REMOTE_SYNC_TARGET"),
+		RemoteSyncUser:        os.Getenv("REMOTE_SYNC_USER"),
+		RemoteSyncPassword:    os.Getenv("REMOTE_SYNC_PASSWORD"),
+		ServeCorpus:           os.Getenv("SERVE_CORPUS") == "true",
+		CorpusToken:           os.Getenv("CORPUS_TOKEN"),
+		CorpusUser:            os.Getenv("CORPUS_USER"),
+		CorpusPassword:        os.Getenv("CORPUS_PASSWORD"),
+		StaticSite:            os.Getenv("STATIC_SITE") == "true",
+		SiteDir:               os.Getenv("SITE_DIR"),
+
+		CanaryKnowledgeCollectionID:  os.Getenv("CANARY_KNOWLEDGE_COLLECTION_ID"),
+		AdminAPIKey:                  os.Getenv("ADMIN_API_KEY"),
+		StatusPublic:                 os.Getenv("STATUS_PUBLIC") == "true",
+		TrustProxyHeaders:            os.Getenv("TRUST_PROXY_HEADERS") == "true",
+		DefaultClassification:        strings.ToLower(os.Getenv("DEFAULT_CLASSIFICATION")),
+		KnowledgeMaxClassification:   strings.ToLower(os.Getenv("KNOWLEDGE_MAX_CLASSIFICATION")),
+		ExtractAttachments:           os.Getenv("EXTRACT_ATTACHMENTS") == "true",
+		CollectionOverviews:          os.Getenv("COLLECTION_OVERVIEWS") == "true",
+		CollectionIndex:              os.Getenv("COLLECTION_INDEX") == "true",
+		AttachmentLinks:              os.Getenv("ATTACHMENT_LINKS"),
+		InternalLinks:                os.Getenv("INTERNAL_LINKS"),
+		ExportFormat:                 os.Getenv("EXPORT_FORMAT"),
+		OCRMethod:                    os.Getenv("OCR_METHOD"),
+		OCRLanguage:                  os.Getenv("OCR_LANGUAGE"),
+		OCRAPIURL:                    os.Getenv("OCR_API_URL"),
+		OCRAPIToken:                  os.Getenv("OCR_API_TOKEN"),
+		DiagramDescriptions:          os.Getenv("DIAGRAM_DESCRIPTIONS"),
+		DiagramModel:                 os.Getenv("DIAGRAM_MODEL"),
+		QuestionGeneration:           os.Getenv("QUESTION_GENERATION"),
+		QuestionModel:                os.Getenv("QUESTION_MODEL"),
+		GlossaryFile:                 os.Getenv("GLOSSARY_FILE"),
+		GlossaryDocumentID:           os.Getenv("GLOSSARY_DOCUMENT_ID"),
+		GlossaryMode:                 os.Getenv("GLOSSARY_MODE"),
+		CacheRedisURL:                os.Getenv("CACHE_REDIS_URL"),
+		JobQueue:                     os.Getenv("JOB_QUEUE"),
+		JobQueueRedisURL:             os.Getenv("JOB_QUEUE_REDIS_URL"),
+		Mode:                         os.Getenv("MODE"),
+		OutlineWebhookSecret:         os.Getenv("OUTLINE_WEBHOOK_SECRET"),
+		CommentBack:                  os.Getenv("COMMENT_BACK") == "true",
+		TicketSystem:                 os.Getenv("TICKET_SYSTEM"),
+		TicketURL:                    strings.TrimSuffix(os.Getenv("TICKET_URL"), "/"),
+		TicketUsername:               os.Getenv("TICKET_USERNAME"),
+		TicketToken:                  os.Getenv("TICKET_TOKEN"),
+		TicketProject:                os.Getenv("TICKET_PROJECT"),
+		TicketIssueType:              os.Getenv("TICKET_ISSUE_TYPE"),
+		TicketTable:                  os.Getenv("TICKET_TABLE"),
+		TicketAssignmentGroup:        os.Getenv("TICKET_ASSIGNMENT_GROUP"),
+		TokenEncryptionKey:           os.Getenv("TOKEN_ENCRYPTION_KEY"),
+		SyncGate:                     os.Getenv("SYNC_GATE"),
+		IntegritySigningKey:          os.Getenv("INTEGRITY_SIGNING_KEY"),
+		Language:                     os.Getenv("LANGUAGE"),
+		KnowledgeNameTemplate:        os.Getenv("KNOWLEDGE_NAME_TEMPLATE"),
+		KnowledgeDescriptionTemplate: os.Getenv("KNOWLEDGE_DESCRIPTION_TEMPLATE"),
+		UserDocumentsDir:             os.Getenv("USER_DOCUMENTS_DIR"),
+		TokenAlertWebhookURL:         os.Getenv("TOKEN_ALERT_WEBHOOK_URL"),
+		OutlineOAuthClientID:         os.Getenv("OUTLINE_OAUTH_CLIENT_ID"),
+		OutlineOAuthClientSecret:     os.Getenv("OUTLINE_OAUTH_CLIENT_SECRET"),
+		OutlineOAuthRedirectURL:      os.Getenv("OUTLINE_OAUTH_REDIRECT_URL"),
+		OutlineOAuthScope:            os.Getenv("OUTLINE_OAUTH_SCOPE"),
+		OIDCIssuerURL:                strings.TrimSuffix(os.Getenv("OIDC_ISSUER_URL"), "/"),
+		OIDCClientID:                 os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret:             os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:              os.Getenv("OIDC_REDIRECT_URL"),
+		OIDCScopes:                   os.Getenv("OIDC_SCOPES"),
+		OIDCAdminGroup:               os.Getenv("OIDC_ADMIN_GROUP"),
+		OIDCGroupsClaim:              os.Getenv("OIDC_GROUPS_CLAIM"),
+		QdrantURL:                    strings.TrimSuffix(os.Getenv("QDRANT_URL"), "/"),
+		QdrantAPIKey:                 os.Getenv("QDRANT_API_KEY"),
+		QdrantCollection:             os.Getenv("QDRANT_COLLECTION"),
+		ChromaURL:                    strings.TrimSuffix(os.Getenv("CHROMA_URL"), "/"),
+		ChromaToken:                  os.Getenv("CHROMA_TOKEN"),
+		ChromaTenant:                 os.Getenv("CHROMA_TENANT"),
+		ChromaDatabase:               os.Getenv("CHROMA_DATABASE"),
+		ElasticsearchURL:             strings.TrimSuffix(os.Getenv("ELASTICSEARCH_URL"), "/"),
+		ElasticsearchAPIKey:          os.Getenv("ELASTICSEARCH_API_KEY"),
+		ElasticsearchUsername:        os.Getenv("ELASTICSEARCH_USERNAME"),
+		ElasticsearchPassword:        os.Getenv("ELASTICSEARCH_PASSWORD"),
+		ElasticsearchIndex:           os.Getenv("ELASTICSEARCH_INDEX"),
+		EmbeddingProvider:            os.Getenv("EMBEDDING_PROVIDER"),
+		EmbeddingURL:                 os.Getenv("EMBEDDING_URL"),
+		EmbeddingAPIKey:              os.Getenv("EMBEDDING_API_KEY"),
+		EmbeddingModel:               os.Getenv("EMBEDDING_MODEL"),
+		SimulationFixtures:           os.Getenv("SIMULATION_FIXTURES"),
+		AdaptiveConcurrency:          os.Getenv("ADAPTIVE_CONCURRENCY") != "false",
+		CorpusDir:                    os.Getenv("CORPUS_DIR"),
+		CorpusRunsDir:                os.Getenv("CORPUS_RUNS_DIR"),
 	}
 
 	if ConfigInstance.Port == "" {
@@ -43,6 +551,487 @@ func LoadConfig() {
 	if ConfigInstance.DocumentsDir == "" {
 		ConfigInstance.DocumentsDir = "./tmp-files"
 	}
+	if ConfigInstance.UserDocumentsDir == "" {
+		ConfigInstance.UserDocumentsDir = "./tmp-user-files"
+	}
+	ConfigInstance.CanarySampleSize = 1
+	if n, err := strconv.Atoi(os.Getenv("CANARY_SAMPLE_SIZE")); err == nil && n > 0 {
+		ConfigInstance.CanarySampleSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("CHUNK_SIZE")); err == nil && n > 0 {
+		ConfigInstance.ChunkSize = n
+	}
+	ConfigInstance.ChunkStrategy = os.Getenv("CHUNK_STRATEGY")
+	switch ConfigInstance.ChunkStrategy {
+	case "":
+		ConfigInstance.ChunkStrategy = "size"
+	case "size", "tokens", "heading":
+	default:
+		fatalf("CHUNK_STRATEGY must be size, tokens or heading, got %q", ConfigInstance.ChunkStrategy)
+	}
+	if v := os.Getenv("CHUNK_OVERLAP"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fatalf("CHUNK_OVERLAP must be a non-negative number, got %q", v)
+		}
+		if ConfigInstance.ChunkSize > 0 && n >= ConfigInstance.ChunkSize {
+			fatalf("CHUNK_OVERLAP must be smaller than CHUNK_SIZE, got %d", n)
+		}
+		ConfigInstance.ChunkOverlap = n
+	}
+	ConfigInstance.ChunkHeadingLevel = 2
+	if n, err := strconv.Atoi(os.Getenv("CHUNK_HEADING_LEVEL")); err == nil && n >= 1 && n <= 6 {
+		ConfigInstance.ChunkHeadingLevel = n
+	}
+	for _, id := range strings.Split(os.Getenv("KNOWLEDGE_MODELS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ConfigInstance.KnowledgeModels = append(ConfigInstance.KnowledgeModels, id)
+		}
+	}
+	for _, heading := range strings.Split(os.Getenv("STRIP_SECTIONS"), ",") {
+		if heading = strings.TrimSpace(heading); heading != "" {
+			ConfigInstance.StripSections = append(ConfigInstance.StripSections, heading)
+		}
+	}
+	ConfigInstance.CacheTTL = 5 * time.Minute
+	if ttl := os.Getenv("CACHE_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			fatalf("CACHE_TTL must be a duration such as 5m, got %q", ttl)
+		}
+		ConfigInstance.CacheTTL = d
+	}
+	windows, err := ParseFreezeWindows(os.Getenv("FREEZE_WINDOWS"))
+	if err != nil {
+		fatalf("FREEZE_WINDOWS: %v", err)
+	}
+	ConfigInstance.FreezeWindows = windows
+	ConfigInstance.FreezeLocation = time.Local
+	if tz := os.Getenv("FREEZE_TIMEZONE"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			fatalf("FREEZE_TIMEZONE must be an IANA time zone such as Europe/Zurich, got %q", tz)
+		}
+		ConfigInstance.FreezeLocation = loc
+	}
+	ConfigInstance.TransformCommands = make(map[string][]string)
+	for _, spec := range strings.Split(os.Getenv("TRANSFORM_COMMANDS"), ";") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		name, command, found := strings.Cut(spec, "=")
+		name = strings.TrimSpace(name)
+		args := strings.Fields(command)
+		if !found || name == "" || len(args) == 0 {
+			fatalf("TRANSFORM_COMMANDS must be name=command pairs separated by semicolons, got %q", spec)
+		}
+		ConfigInstance.TransformCommands[name] = args
+	}
+	ConfigInstance.TransformModules = make(map[string]string)
+	for _, spec := range strings.Split(os.Getenv("TRANSFORM_WASM_MODULES"), ";") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		name, module, found := strings.Cut(spec, "=")
+		name, module = strings.TrimSpace(name), strings.TrimSpace(module)
+		if !found || name == "" || module == "" {
+			fatalf("TRANSFORM_WASM_MODULES must be name=path pairs separated by semicolons, got %q", spec)
+		}
+		if _, ok := ConfigInstance.TransformCommands[name]; ok {
+			fatalf("TRANSFORM_WASM_MODULES: transform %q is already defined in TRANSFORM_COMMANDS", name)
+		}
+		ConfigInstance.TransformModules[name] = module
+	}
+	ConfigInstance.WasmRuntime = strings.Fields(os.Getenv("WASM_RUNTIME"))
+	if len(ConfigInstance.WasmRuntime) == 0 {
+		ConfigInstance.WasmRuntime = []string{"wasmtime", "run"}
+	}
+	ConfigInstance.WasmMaxMemoryMB = 64
+	if value := os.Getenv("WASM_MAX_MEMORY_MB"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			fatalf("WASM_MAX_MEMORY_MB must be a positive number of megabytes, got %q", value)
+		}
+		ConfigInstance.WasmMaxMemoryMB = n
+	}
+	if value := os.Getenv("WASM_FUEL"); value != "" {
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			fatalf("WASM_FUEL must be a number of instructions, got %q", value)
+		}
+		ConfigInstance.WasmFuel = n
+	}
+	ConfigInstance.TransformTimeout = 30 * time.Second
+	if timeout := os.Getenv("TRANSFORM_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			fatalf("TRANSFORM_TIMEOUT must be a duration such as 30s, got %q", timeout)
+		}
+		ConfigInstance.TransformTimeout = d
+	}
+	ConfigInstance.WasmTimeout = ConfigInstance.TransformTimeout
+	if timeout := os.Getenv("WASM_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			fatalf("WASM_TIMEOUT must be a duration such as 30s, got %q", timeout)
+		}
+		ConfigInstance.WasmTimeout = d
+	}
+	if filter := os.Getenv("EXPORT_FILTER"); strings.TrimSpace(filter) != "" {
+		parsed, err := expr.Parse(filter)
+		if err == nil {
+			err = parsed.Check(exportFilterVars)
+		}
+		if err != nil {
+			fatalf("EXPORT_FILTER: %v", err)
+		}
+		ConfigInstance.ExportFilter = parsed
+	}
+	rules, err := ParseRoutingRules(os.Getenv("ROUTING_RULES"))
+	if err != nil {
+		fatalf("ROUTING_RULES: %v", err)
+	}
+	ConfigInstance.RoutingRules = rules
+	ConfigInstance.SyncLocation = time.Local
+	if tz := os.Getenv("SYNC_TZ"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			fatalf("SYNC_TZ must be an IANA time zone such as Europe/Zurich, got %q", tz)
+		}
+		ConfigInstance.SyncLocation = loc
+	}
+	schedules, err := ParseSchedules(os.Getenv("SYNC_SCHEDULE"), ConfigInstance.SyncLocation)
+	if err != nil {
+		fatalf("SYNC_SCHEDULE: %v", err)
+	}
+	ConfigInstance.SyncSchedules = schedules
+	if jitter := os.Getenv("SYNC_JITTER"); jitter != "" {
+		d, err := time.ParseDuration(jitter)
+		if err != nil || d < 0 {
+			fatalf("SYNC_JITTER must be a duration such as 10m, got %q", jitter)
+		}
+		ConfigInstance.SyncJitter = d
+	}
+	ConfigInstance.HeartbeatURL = strings.TrimSuffix(os.Getenv("HEARTBEAT_URL"), "/")
+	heartbeatURL := func(name, suffix string) string {
+		switch value := os.Getenv(name); {
+		case value == "none":
+			return ""
+		case value != "":
+			return value
+		case ConfigInstance.HeartbeatURL != "":
+			return ConfigInstance.HeartbeatURL + suffix
+		}
+		return ""
+	}
+	ConfigInstance.HeartbeatStartURL = heartbeatURL("HEARTBEAT_START_URL", "/start")
+	ConfigInstance.HeartbeatFailURL = heartbeatURL("HEARTBEAT_FAIL_URL", "/fail")
+	ConfigInstance.UpstreamProbeInterval = time.Minute
+	if interval := os.Getenv("UPSTREAM_PROBE_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d < 0 {
+			fatalf("UPSTREAM_PROBE_INTERVAL must be a duration such as 1m, got %q", interval)
+		}
+		ConfigInstance.UpstreamProbeInterval = d
+	}
+	if ConfigInstance.LogLevel == "" {
+		ConfigInstance.LogLevel = "info"
+	}
+	switch ConfigInstance.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		fatalf("LOG_LEVEL must be debug, info, warn or error, got %q", ConfigInstance.LogLevel)
+	}
+	if ConfigInstance.LogFormat == "" {
+		ConfigInstance.LogFormat = "text"
+	}
+	if ConfigInstance.LogFormat != "text" && ConfigInstance.LogFormat != "json" {
+		fatalf("LOG_FORMAT must be text or json, got %q", ConfigInstance.LogFormat)
+	}
+	if ConfigInstance.Mode == "" {
+		ConfigInstance.Mode = "all"
+	}
+	if ConfigInstance.JobQueue == "" {
+		ConfigInstance.JobQueue = "postgres"
+	}
+	if ConfigInstance.JobQueueRedisURL == "" {
+		ConfigInstance.JobQueueRedisURL = ConfigInstance.CacheRedisURL
+	}
+	ConfigInstance.JobWorkers = 1
+	if n, err := strconv.Atoi(os.Getenv("JOB_WORKERS")); err == nil && n > 0 {
+		ConfigInstance.JobWorkers = n
+	}
+	ConfigInstance.JobLeaseTimeout = 2 * time.Minute
+	if timeout := os.Getenv("JOB_LEASE_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d < 10*time.Second {
+			fatalf("JOB_LEASE_TIMEOUT must be a duration of at least 10s, got %q", timeout)
+		}
+		ConfigInstance.JobLeaseTimeout = d
+	}
+	if gate := ConfigInstance.SyncGate; gate != "" && gate != "manual" && gate != "rules" {
+		fatalf("SYNC_GATE must be manual or rules, got %q", gate)
+	}
+	ConfigInstance.SyncGateMaxRemovedPercent = 10
+	if n, err := strconv.Atoi(os.Getenv("SYNC_GATE_MAX_REMOVED_PERCENT")); err == nil && n >= 0 && n <= 100 {
+		ConfigInstance.SyncGateMaxRemovedPercent = n
+	}
+	for name, text := range map[string]string{
+		"KNOWLEDGE_NAME_TEMPLATE":        ConfigInstance.KnowledgeNameTemplate,
+		"KNOWLEDGE_DESCRIPTION_TEMPLATE": ConfigInstance.KnowledgeDescriptionTemplate,
+	} {
+		if _, err := template.New(name).Parse(text); err != nil {
+			fatalf("%s: %v", name, err)
+		}
+	}
+	if ConfigInstance.Language == "" {
+		ConfigInstance.Language = i18n.Default
+	}
+	if !i18n.Supported(ConfigInstance.Language) {
+		fatalf("LANGUAGE must be en, de or fr, got %q", ConfigInstance.Language)
+	}
+	ConfigInstance.PublicPaths = []string{"/healthz"}
+	if paths := os.Getenv("PUBLIC_PATHS"); paths != "" {
+		ConfigInstance.PublicPaths = splitList(paths)
+	}
+	switch os.Getenv("REQUIRE_API_KEY") {
+	case "true":
+		ConfigInstance.RequireAPIKey = true
+	case "false":
+	default:
+		ConfigInstance.RequireAPIKey = ConfigInstance.AdminAPIKey != ""
+	}
+	if ConfigInstance.RequireAPIKey && ConfigInstance.AdminAPIKey == "" {
+		fatalf("REQUIRE_API_KEY requires ADMIN_API_KEY to issue keys")
+	}
+	if !ConfigInstance.RequireAPIKey {
+		slog.Warn("REQUIRE_API_KEY is off; every endpoint without its own check, including export, upload and sync, is open to anyone who can reach the service")
+	}
+	ConfigInstance.IntegritySampleSize = 5
+	if n, err := strconv.Atoi(os.Getenv("INTEGRITY_SAMPLE_SIZE")); err == nil && n >= 0 {
+		ConfigInstance.IntegritySampleSize = n
+	}
+	ConfigInstance.MaxFailurePercent = 10
+	if n, err := strconv.Atoi(os.Getenv("MAX_FAILURE_PERCENT")); err == nil && n >= 0 && n <= 100 {
+		ConfigInstance.MaxFailurePercent = n
+	}
+	ConfigInstance.ExportConcurrency = 4
+	if n, err := strconv.Atoi(os.Getenv("EXPORT_CONCURRENCY")); err == nil && n > 0 {
+		ConfigInstance.ExportConcurrency = n
+	}
+	ConfigInstance.UploadConcurrency = 4
+	if n, err := strconv.Atoi(os.Getenv("UPLOAD_CONCURRENCY")); err == nil && n > 0 {
+		ConfigInstance.UploadConcurrency = n
+	}
+	ConfigInstance.DiskHeadroomPercent = 20
+	if n, err := strconv.Atoi(os.Getenv("DISK_HEADROOM_PERCENT")); err == nil && n >= 0 {
+		ConfigInstance.DiskHeadroomPercent = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("REVIEW_DIFF_LINES")); err == nil && n > 0 {
+		ConfigInstance.ReviewDiffLines = n
+	}
+	ConfigInstance.ReviewCollections = splitList(os.Getenv("REVIEW_COLLECTIONS"))
+	ConfigInstance.CorpusRetention = 5
+	if n, err := strconv.Atoi(os.Getenv("CORPUS_RETENTION")); err == nil && n > 0 {
+		ConfigInstance.CorpusRetention = n
+	}
+	ConfigInstance.CommentBackFailures = 3
+	if n, err := strconv.Atoi(os.Getenv("COMMENT_BACK_FAILURES")); err == nil && n > 0 {
+		ConfigInstance.CommentBackFailures = n
+	}
+	ConfigInstance.CommentBackExclusions = []string{"filtered"}
+	if reasons := os.Getenv("COMMENT_BACK_EXCLUSIONS"); reasons != "" {
+		ConfigInstance.CommentBackExclusions = splitList(reasons)
+	}
+	for _, reason := range ConfigInstance.CommentBackExclusions {
+		if reason != "archived" && reason != "draft" && reason != "template" && reason != "filtered" {
+			fatalf("COMMENT_BACK_EXCLUSIONS must list archived, draft, template or filtered, got %q", reason)
+		}
+	}
+	ConfigInstance.TicketFailures = 3
+	if n, err := strconv.Atoi(os.Getenv("TICKET_FAILURES")); err == nil && n > 0 {
+		ConfigInstance.TicketFailures = n
+	}
+	switch ConfigInstance.TicketSystem {
+	case "":
+	case "jira":
+		if ConfigInstance.TicketIssueType == "" {
+			ConfigInstance.TicketIssueType = "Task"
+		}
+		if ConfigInstance.TicketProject == "" {
+			fatalf("TICKET_SYSTEM=jira requires TICKET_PROJECT")
+		}
+	case "servicenow":
+		if ConfigInstance.TicketTable == "" {
+			ConfigInstance.TicketTable = "incident"
+		}
+	default:
+		fatalf("TICKET_SYSTEM must be jira or servicenow, got %q", ConfigInstance.TicketSystem)
+	}
+	if ConfigInstance.TicketSystem != "" && (ConfigInstance.TicketURL == "" || ConfigInstance.TicketToken == "") {
+		fatalf("TICKET_SYSTEM requires TICKET_URL and TICKET_TOKEN")
+	}
+	ConfigInstance.PriorityWorkers = 1
+	if n, err := strconv.Atoi(os.Getenv("PRIORITY_WORKERS")); err == nil && n >= 0 {
+		ConfigInstance.PriorityWorkers = n
+	}
+	if ConfigInstance.SiteDir == "" {
+		ConfigInstance.SiteDir = "./tmp-site"
+	}
+	if command := strings.Fields(os.Getenv("TOKEN_ENCRYPTION_KEY_COMMAND")); len(command) > 0 {
+		if ConfigInstance.TokenEncryptionKey != "" {
+			logging.Fatal("Set either TOKEN_ENCRYPTION_KEY or TOKEN_ENCRYPTION_KEY_COMMAND, not both")
+		}
+		output, err := exec.Command(command[0], command[1:]...).Output()
+		if err != nil {
+			fatalf("TOKEN_ENCRYPTION_KEY_COMMAND failed: %v", err)
+		}
+		ConfigInstance.TokenEncryptionKey = strings.TrimSpace(string(output))
+		if ConfigInstance.TokenEncryptionKey == "" {
+			logging.Fatal("TOKEN_ENCRYPTION_KEY_COMMAND printed no key")
+		}
+	}
+	for _, key := range strings.Split(os.Getenv("TOKEN_ENCRYPTION_OLD_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			ConfigInstance.TokenEncryptionOldKeys = append(ConfigInstance.TokenEncryptionOldKeys, key)
+		}
+	}
+	if len(ConfigInstance.TokenEncryptionOldKeys) > 0 && ConfigInstance.TokenEncryptionKey == "" {
+		logging.Fatal("TOKEN_ENCRYPTION_OLD_KEYS requires a current TOKEN_ENCRYPTION_KEY")
+	}
+	ConfigInstance.TokenCheckInterval = 6 * time.Hour
+	if interval := os.Getenv("TOKEN_CHECK_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d < 0 {
+			fatalf("TOKEN_CHECK_INTERVAL must be a duration such as 6h, got %q", interval)
+		}
+		ConfigInstance.TokenCheckInterval = d
+	}
+	ConfigInstance.TokenExpiryWarning = 7 * 24 * time.Hour
+	if warning := os.Getenv("TOKEN_EXPIRY_WARNING"); warning != "" {
+		d, err := time.ParseDuration(warning)
+		if err != nil || d < 0 {
+			fatalf("TOKEN_EXPIRY_WARNING must be a duration such as 168h, got %q", warning)
+		}
+		ConfigInstance.TokenExpiryWarning = d
+	}
+	if ConfigInstance.OutlineOAuthScope == "" {
+		ConfigInstance.OutlineOAuthScope = "read"
+	}
+	if ConfigInstance.OutlineOAuthClientID != "" && (ConfigInstance.OutlineOAuthClientSecret == "" ||
+		ConfigInstance.OutlineOAuthRedirectURL == "" || ConfigInstance.TokenEncryptionKey == "") {
+		logging.Fatal("OUTLINE_OAUTH_CLIENT_ID requires OUTLINE_OAUTH_CLIENT_SECRET, OUTLINE_OAUTH_REDIRECT_URL and TOKEN_ENCRYPTION_KEY")
+	}
+	if ConfigInstance.OIDCScopes == "" {
+		ConfigInstance.OIDCScopes = "openid email profile"
+	}
+	if ConfigInstance.OIDCGroupsClaim == "" {
+		ConfigInstance.OIDCGroupsClaim = "groups"
+	}
+	ConfigInstance.OIDCProtectedPaths = []string{"/docs/", "/mappings", "/mappings/"}
+	if paths := os.Getenv("OIDC_PROTECTED_PATHS"); paths != "" {
+		ConfigInstance.OIDCProtectedPaths = splitList(paths)
+	}
+	ConfigInstance.OIDCSessionTTL = 8 * time.Hour
+	if ttl := os.Getenv("OIDC_SESSION_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			fatalf("OIDC_SESSION_TTL must be a duration such as 8h, got %q", ttl)
+		}
+		ConfigInstance.OIDCSessionTTL = d
+	}
+	if ConfigInstance.OIDCIssuerURL != "" && (ConfigInstance.OIDCClientID == "" || ConfigInstance.OIDCClientSecret == "" ||
+		ConfigInstance.OIDCRedirectURL == "" || ConfigInstance.TokenEncryptionKey == "") {
+		logging.Fatal("OIDC_ISSUER_URL requires OIDC_CLIENT_ID, OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL and TOKEN_ENCRYPTION_KEY")
+	}
+	// Without a group, everyone the provider signs in would be an admin.
+	if ConfigInstance.OIDCIssuerURL != "" && ConfigInstance.OIDCAdminGroup == "" {
+		logging.Fatal("OIDC_ISSUER_URL requires OIDC_ADMIN_GROUP")
+	}
+	sinks := os.Getenv("SINKS")
+	if sinks == "" {
+		sinks = os.Getenv("SINK")
+	}
+	for _, sink := range strings.Split(sinks, ",") {
+		if sink = strings.TrimSpace(sink); sink != "" {
+			ConfigInstance.Sinks = append(ConfigInstance.Sinks, sink)
+		}
+	}
+	if len(ConfigInstance.Sinks) == 0 {
+		ConfigInstance.Sinks = []string{"openwebui"}
+	}
+	seen := make(map[string]bool)
+	for _, sink := range ConfigInstance.Sinks {
+		if seen[sink] {
+			fatalf("SINKS lists %q twice", sink)
+		}
+		seen[sink] = true
+		switch sink {
+		case "openwebui":
+		case "qdrant", "chroma":
+			if sink == "qdrant" && ConfigInstance.QdrantURL == "" {
+				logging.Fatal("SINK=qdrant requires QDRANT_URL")
+			}
+			if sink == "chroma" && ConfigInstance.ChromaURL == "" {
+				logging.Fatal("SINK=chroma requires CHROMA_URL")
+			}
+			if ConfigInstance.EmbeddingModel == "" {
+				fatalf("SINK=%s requires EMBEDDING_MODEL", sink)
+			}
+		case "elasticsearch", "opensearch":
+			if ConfigInstance.ElasticsearchURL == "" {
+				fatalf("SINK=%s requires ELASTICSEARCH_URL", sink)
+			}
+		default:
+			fatalf("SINK must be openwebui, qdrant, chroma, elasticsearch or opensearch, got %q", sink)
+		}
+	}
+	if ConfigInstance.CanaryKnowledgeCollectionID != "" && !ConfigInstance.HasSink("openwebui") {
+		logging.Fatal("CANARY_KNOWLEDGE_COLLECTION_ID requires the openwebui sink")
+	}
+	if ConfigInstance.QdrantCollection == "" {
+		ConfigInstance.QdrantCollection = "outline"
+	}
+	if ConfigInstance.ElasticsearchIndex == "" {
+		ConfigInstance.ElasticsearchIndex = "outline"
+	}
+	if ConfigInstance.ChromaTenant == "" {
+		ConfigInstance.ChromaTenant = "default_tenant"
+	}
+	if ConfigInstance.ChromaDatabase == "" {
+		ConfigInstance.ChromaDatabase = "default_database"
+	}
+	switch ConfigInstance.EmbeddingProvider {
+	case "", "openai":
+		ConfigInstance.EmbeddingProvider = "openai"
+		if ConfigInstance.EmbeddingURL == "" {
+			ConfigInstance.EmbeddingURL = "https://api.openai.com/v1"
+		}
+	case "ollama":
+		if ConfigInstance.EmbeddingURL == "" {
+			ConfigInstance.EmbeddingURL = "http://localhost:11434"
+		}
+	default:
+		fatalf("EMBEDDING_PROVIDER must be openai or ollama, got %q", ConfigInstance.EmbeddingProvider)
+	}
+	ConfigInstance.EmbeddingBatchSize = 32
+	if n, err := strconv.Atoi(os.Getenv("EMBEDDING_BATCH_SIZE")); err == nil && n > 0 {
+		ConfigInstance.EmbeddingBatchSize = n
+	}
+	// Without UPLOAD_EXTENSION and UPLOAD_CONTENT_TYPE files are uploaded
+	// with the extension and type of their export format.
+	if ConfigInstance.UploadExtension != "" && !strings.HasPrefix(ConfigInstance.UploadExtension, ".") {
+		ConfigInstance.UploadExtension = "." + ConfigInstance.UploadExtension
+	}
+	if ConfigInstance.ExportSort == "" {
+		ConfigInstance.ExportSort = "updatedAt"
+	}
+	if ConfigInstance.ExportDirection == "" {
+		ConfigInstance.ExportDirection = "DESC"
+	}
+	if ConfigInstance.ExportTraversal == "" {
+		ConfigInstance.ExportTraversal = "paged"
+	}
 	limitStr := os.Getenv("LIMIT")
 	if limitStr != "" {
 		if l, err := strconv.Atoi(limitStr); err == nil {
@@ -54,8 +1043,311 @@ func LoadConfig() {
 		ConfigInstance.Limit = 100
 	}
 
+	if ConfigInstance.DefaultClassification == "" {
+		ConfigInstance.DefaultClassification = "internal"
+	}
+	if ConfigInstance.KnowledgeMaxClassification == "" {
+		ConfigInstance.KnowledgeMaxClassification = "internal"
+	}
+	if ConfigInstance.OCRLanguage == "" {
+		ConfigInstance.OCRLanguage = "eng"
+	}
+	if ConfigInstance.RemoteSyncMethod == "" {
+		ConfigInstance.RemoteSyncMethod = "rsync"
+	}
+	rsyncArgs, err := parseArgs(os.Getenv("REMOTE_SYNC_RSYNC_ARGS"))
+	if err != nil {
+		fatalf("REMOTE_SYNC_RSYNC_ARGS must be a JSON array or shell words: %v", err)
+	}
+	ConfigInstance.RemoteSyncRsyncArgs = rsyncArgs
+	ConfigInstance.Workspaces = loadWorkspaces()
+
 	// Optional: Ensure required values are set.
-	if ConfigInstance.APIBaseURL == "" {
-		log.Fatal("API_BASE_URL is not set. Please set it in your .env file.")
+	if len(ConfigInstance.Workspaces) == 0 {
+		logging.Fatal("None of API_BASE_URL, CONFLUENCE_BASE_URL, GIT_REPO_URL, GITHUB_WIKI_REPOS or GITLAB_WIKI_PROJECTS is set. Please set one in your .env file.")
+	}
+	switch ConfigInstance.ExportSort {
+	case "updatedAt", "createdAt", "title":
+	default:
+		fatalf("EXPORT_SORT must be one of updatedAt, createdAt or title, got %q", ConfigInstance.ExportSort)
+	}
+	if ConfigInstance.ExportDirection != "ASC" && ConfigInstance.ExportDirection != "DESC" {
+		fatalf("EXPORT_DIRECTION must be ASC or DESC, got %q", ConfigInstance.ExportDirection)
+	}
+	if ConfigInstance.ExportTraversal != "paged" && ConfigInstance.ExportTraversal != "collection" {
+		fatalf("EXPORT_TRAVERSAL must be paged or collection, got %q", ConfigInstance.ExportTraversal)
+	}
+	if ConfigInstance.CorpusDir != "" {
+		if ConfigInstance.CorpusRunsDir == "" {
+			ConfigInstance.CorpusRunsDir = strings.TrimRight(ConfigInstance.CorpusDir, "/") + ".runs"
+		}
+		if filepath.Clean(ConfigInstance.CorpusDir) == filepath.Clean(ConfigInstance.DocumentsDir) {
+			logging.Fatal("CORPUS_DIR must differ from DOCUMENTS_DIR, which is the working directory of exports.")
+		}
+	}
+	if ConfigInstance.ServeCorpus && ConfigInstance.CorpusToken == "" && ConfigInstance.CorpusUser == "" {
+		logging.Fatal("SERVE_CORPUS requires CORPUS_TOKEN or CORPUS_USER/CORPUS_PASSWORD to be set.")
+	}
+	if ConfigInstance.RemoteSyncMethod != "rsync" && ConfigInstance.RemoteSyncMethod != "webdav" {
+		fatalf("REMOTE_SYNC_METHOD must be rsync or webdav, got %q", ConfigInstance.RemoteSyncMethod)
+	}
+	switch ConfigInstance.AttachmentLinks {
+	case "", "download", "inline":
+	default:
+		fatalf("ATTACHMENT_LINKS must be download or inline, got %q", ConfigInstance.AttachmentLinks)
+	}
+	switch ConfigInstance.ExportFormat {
+	case "":
+		ConfigInstance.ExportFormat = "markdown"
+	case "markdown", "html", "text", "json":
+	default:
+		fatalf("EXPORT_FORMAT must be markdown, html, text or json, got %q", ConfigInstance.ExportFormat)
+	}
+	switch ConfigInstance.InternalLinks {
+	case "", "url", "file":
+	default:
+		fatalf("INTERNAL_LINKS must be url or file, got %q", ConfigInstance.InternalLinks)
+	}
+	ConfigInstance.InlineImageMaxSize = 64 << 10
+	if n, err := strconv.Atoi(os.Getenv("INLINE_IMAGE_MAX_SIZE")); err == nil && n >= 0 {
+		ConfigInstance.InlineImageMaxSize = n
+	}
+	switch ConfigInstance.OCRMethod {
+	case "", "tesseract":
+	case "api":
+		if ConfigInstance.OCRAPIURL == "" {
+			logging.Fatal("OCR_METHOD=api requires OCR_API_URL to be set.")
+		}
+	default:
+		fatalf("OCR_METHOD must be tesseract or api, got %q", ConfigInstance.OCRMethod)
+	}
+	switch ConfigInstance.DiagramDescriptions {
+	case "":
+	case "replace", "append":
+		if ConfigInstance.DiagramModel == "" {
+			logging.Fatal("DIAGRAM_DESCRIPTIONS requires DIAGRAM_MODEL to be set.")
+		}
+	default:
+		fatalf("DIAGRAM_DESCRIPTIONS must be replace or append, got %q", ConfigInstance.DiagramDescriptions)
+	}
+	switch ConfigInstance.QuestionGeneration {
+	case "":
+	case "metadata", "append":
+		if ConfigInstance.QuestionModel == "" {
+			logging.Fatal("QUESTION_GENERATION requires QUESTION_MODEL to be set.")
+		}
+	default:
+		fatalf("QUESTION_GENERATION must be metadata or append, got %q", ConfigInstance.QuestionGeneration)
+	}
+	ConfigInstance.QuestionCount = 3
+	if n, err := strconv.Atoi(os.Getenv("QUESTION_COUNT")); err == nil && n > 0 {
+		ConfigInstance.QuestionCount = n
+	}
+	if ConfigInstance.Mode != "all" && ConfigInstance.Mode != "api" && ConfigInstance.Mode != "worker" {
+		fatalf("MODE must be all, api or worker, got %q", ConfigInstance.Mode)
+	}
+	switch ConfigInstance.JobQueue {
+	case "postgres":
+	case "redis":
+		if ConfigInstance.JobQueueRedisURL == "" {
+			logging.Fatal("JOB_QUEUE=redis requires JOB_QUEUE_REDIS_URL or CACHE_REDIS_URL to be set.")
+		}
+	default:
+		fatalf("JOB_QUEUE must be postgres or redis, got %q", ConfigInstance.JobQueue)
+	}
+	if ConfigInstance.GlossaryMode == "" && (ConfigInstance.GlossaryFile != "" || ConfigInstance.GlossaryDocumentID != "") {
+		ConfigInstance.GlossaryMode = "inline"
+	}
+	if ConfigInstance.GlossaryMode != "" && ConfigInstance.GlossaryMode != "inline" && ConfigInstance.GlossaryMode != "chunk" {
+		fatalf("GLOSSARY_MODE must be inline or chunk, got %q", ConfigInstance.GlossaryMode)
+	}
+	for name, level := range map[string]string{
+		"DEFAULT_CLASSIFICATION":       ConfigInstance.DefaultClassification,
+		"KNOWLEDGE_MAX_CLASSIFICATION": ConfigInstance.KnowledgeMaxClassification,
+	} {
+		switch level {
+		case "public", "internal", "confidential":
+		default:
+			fatalf("%s must be public, internal or confidential, got %q", name, level)
+		}
+	}
+}
+
+// loadWorkspaces reads the workspaces to export from: the Outline workspaces
+// of loadOutlineWorkspaces, a Confluence Cloud site named "confluence" when
+// CONFLUENCE_BASE_URL is set, a Git repository named "git" when GIT_REPO_URL
+// is set and the project wikis of GitHub and GitLab, named "github-wiki" and
+// "gitlab-wiki", when GITHUB_WIKI_REPOS or GITLAB_WIKI_PROJECTS list some.
+func loadWorkspaces() []Workspace {
+	workspaces := loadOutlineWorkspaces()
+	if base := os.Getenv("CONFLUENCE_BASE_URL"); base != "" {
+		ws := Workspace{
+			Name:        "confluence",
+			Kind:        "confluence",
+			APIBaseURL:  strings.TrimRight(base, "/"),
+			APIToken:    os.Getenv("CONFLUENCE_API_TOKEN"),
+			DocsBaseURL: strings.TrimRight(base, "/"),
+			Username:    os.Getenv("CONFLUENCE_EMAIL"),
+			Spaces:      splitList(os.Getenv("CONFLUENCE_SPACES")),
+		}
+		if ws.APIToken == "" || ws.Username == "" {
+			logging.Fatal("CONFLUENCE_BASE_URL requires CONFLUENCE_EMAIL and CONFLUENCE_API_TOKEN")
+		}
+		workspaces = appendWorkspace(workspaces, ws)
+	}
+	if repo := os.Getenv("GIT_REPO_URL"); repo != "" {
+		ws := Workspace{
+			Name:        "git",
+			Kind:        "git",
+			APIBaseURL:  repo,
+			APIToken:    os.Getenv("GIT_TOKEN"),
+			DocsBaseURL: strings.TrimRight(os.Getenv("GIT_DOCS_BASE_URL"), "/"),
+			Username:    os.Getenv("GIT_USERNAME"),
+			Branch:      os.Getenv("GIT_BRANCH"),
+			CheckoutDir: os.Getenv("GIT_CHECKOUT_DIR"),
+		}
+		if ws.Username == "" {
+			ws.Username = "x-access-token"
+		}
+		if ws.CheckoutDir == "" {
+			ws.CheckoutDir = "./tmp-git"
+		}
+		workspaces = appendWorkspace(workspaces, ws)
+	}
+	if projects := splitList(os.Getenv("GITHUB_WIKI_REPOS")); len(projects) > 0 {
+		web := strings.TrimRight(os.Getenv("GITHUB_URL"), "/")
+		if web == "" {
+			web = "https://github.com"
+		}
+		api := strings.TrimRight(os.Getenv("GITHUB_API_URL"), "/")
+		if api == "" {
+			api = "https://api.github.com"
+		}
+		workspaces = appendWorkspace(workspaces, Workspace{
+			Name:        "github-wiki",
+			Kind:        "github-wiki",
+			APIBaseURL:  api,
+			APIToken:    os.Getenv("GITHUB_TOKEN"),
+			DocsBaseURL: web,
+			Username:    "x-access-token",
+			CheckoutDir: filepath.Join(wikiCheckoutDir(), "github"),
+			Projects:    projects,
+		})
+	}
+	if projects := splitList(os.Getenv("GITLAB_WIKI_PROJECTS")); len(projects) > 0 {
+		web := strings.TrimRight(os.Getenv("GITLAB_URL"), "/")
+		if web == "" {
+			web = "https://gitlab.com"
+		}
+		workspaces = appendWorkspace(workspaces, Workspace{
+			Name:        "gitlab-wiki",
+			Kind:        "gitlab-wiki",
+			APIBaseURL:  web + "/api/v4",
+			APIToken:    os.Getenv("GITLAB_TOKEN"),
+			DocsBaseURL: web,
+			Username:    "oauth2",
+			CheckoutDir: filepath.Join(wikiCheckoutDir(), "gitlab"),
+			Projects:    projects,
+		})
+	}
+	return workspaces
+}
+
+// appendWorkspace adds a workspace of another wiki to the Outline ones,
+// refusing Outline workspaces named like it.
+func appendWorkspace(workspaces []Workspace, ws Workspace) []Workspace {
+	for _, other := range workspaces {
+		if other.Name == ws.Name {
+			fatalf("Outline workspace %q collides with the %s workspace name", ws.Name, ws.Kind)
+		}
+	}
+	return append(workspaces, ws)
+}
+
+// wikiCheckoutDir is where the wikis of GitHub and GitLab are cloned
+// (WIKI_CHECKOUT_DIR, default ./tmp-wikis).
+func wikiCheckoutDir() string {
+	if dir := os.Getenv("WIKI_CHECKOUT_DIR"); dir != "" {
+		return dir
+	}
+	return "./tmp-wikis"
+}
+
+// fatalf reports an invalid setting and exits.
+func fatalf(format string, args ...interface{}) {
+	logging.Fatal(fmt.Sprintf(format, args...))
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// loadOutlineWorkspaces reads the Outline workspaces to export from.
+// OUTLINE_WORKSPACES holds a comma-separated list of names; each name NAME is
+// configured through OUTLINE_<NAME>_API_BASE_URL, OUTLINE_<NAME>_API_TOKEN,
+// OUTLINE_<NAME>_DOCS_BASE_URL and optionally OUTLINE_<NAME>_VERSION.
+// Without it, a single unnamed workspace is built from API_BASE_URL, API_TOKEN
+// and DOCS_BASE_URL.
+func loadOutlineWorkspaces() []Workspace {
+	names := os.Getenv("OUTLINE_WORKSPACES")
+	if names == "" {
+		if ConfigInstance.APIBaseURL == "" {
+			return nil
+		}
+		return []Workspace{{
+			Kind:        "outline",
+			APIBaseURL:  ConfigInstance.APIBaseURL,
+			APIToken:    ConfigInstance.APIToken,
+			DocsBaseURL: ConfigInstance.DocsBaseURL,
+			Version:     os.Getenv("OUTLINE_VERSION"),
+		}}
+	}
+
+	var workspaces []Workspace
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "OUTLINE_" + strings.ToUpper(name) + "_"
+		ws := Workspace{
+			Name:        name,
+			Kind:        "outline",
+			APIBaseURL:  os.Getenv(prefix + "API_BASE_URL"),
+			APIToken:    os.Getenv(prefix + "API_TOKEN"),
+			DocsBaseURL: os.Getenv(prefix + "DOCS_BASE_URL"),
+			Version:     os.Getenv(prefix + "VERSION"),
+		}
+		if ws.APIBaseURL == "" {
+			fatalf("%sAPI_BASE_URL is not set for workspace %q.", prefix, name)
+		}
+		workspaces = append(workspaces, ws)
+	}
+	return workspaces
+}
+
+// PublishedDir returns the directory consumers read the corpus from:
+// CorpusDir when exports are published as runs, DocumentsDir otherwise.
+func (c Config) PublishedDir() string {
+	if c.CorpusDir != "" {
+		return c.CorpusDir
+	}
+	return c.DocumentsDir
+}
+
+// HasSink reports whether uploads go to the named sink.
+func (c Config) HasSink(name string) bool {
+	for _, sink := range c.Sinks {
+		if sink == name {
+			return true
+		}
 	}
+	return false
 }
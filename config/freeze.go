@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FreezeWindow is a recurring time-of-day window during which no changes are
+// pushed to the knowledge collections. A window whose end is before its start
+// runs past midnight; its days refer to the day it starts on.
+type FreezeWindow struct {
+	Days  [7]bool       // Indexed by time.Weekday.
+	Start time.Duration // Offset from midnight.
+	End   time.Duration
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseFreezeWindows parses windows such as "Mon-Fri 09:00-10:30;Sun 22:00-02:00".
+// Windows are separated by semicolons; without days a window applies daily.
+func ParseFreezeWindows(value string) ([]FreezeWindow, error) {
+	var windows []FreezeWindow
+	for _, spec := range strings.Split(value, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		var window FreezeWindow
+		days, times, found := strings.Cut(spec, " ")
+		if !found {
+			days, times = "", spec
+		}
+		if err := parseDays(days, &window.Days); err != nil {
+			return nil, fmt.Errorf("invalid freeze window %q: %w", spec, err)
+		}
+		start, end, found := strings.Cut(strings.TrimSpace(times), "-")
+		if !found {
+			return nil, fmt.Errorf("invalid freeze window %q: expected HH:MM-HH:MM", spec)
+		}
+		var err error
+		if window.Start, err = parseClock(start); err != nil {
+			return nil, fmt.Errorf("invalid freeze window %q: %w", spec, err)
+		}
+		if window.End, err = parseClock(end); err != nil {
+			return nil, fmt.Errorf("invalid freeze window %q: %w", spec, err)
+		}
+		if window.Start == window.End {
+			return nil, fmt.Errorf("invalid freeze window %q: empty window", spec)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// parseDays parses a day ("Sat") or day range ("Mon-Fri"); empty means every day.
+func parseDays(days string, set *[7]bool) error {
+	if days == "" {
+		for i := range set {
+			set[i] = true
+		}
+		return nil
+	}
+	from, to, isRange := strings.Cut(strings.ToLower(days), "-")
+	first, ok := weekdays[from]
+	if !ok {
+		return fmt.Errorf("invalid day %q", from)
+	}
+	last := first
+	if isRange {
+		if last, ok = weekdays[to]; !ok {
+			return fmt.Errorf("invalid day %q", to)
+		}
+	}
+	for day := first; ; day = (day + 1) % 7 {
+		set[day] = true
+		if day == last {
+			return nil
+		}
+	}
+}
+
+// parseClock parses HH:MM into an offset from midnight.
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t (in the freeze time zone) falls into the window.
+func (w FreezeWindow) Contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if w.Start < w.End {
+		return w.Days[t.Weekday()] && offset >= w.Start && offset < w.End
+	}
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.Days[t.Weekday()] && offset >= w.Start) || (w.Days[yesterday] && offset < w.End)
+}
+
+// FrozenUntil reports whether t falls into a configured freeze window and,
+// if so, when the freeze ends.
+func FrozenUntil(t time.Time) (time.Time, bool) {
+	frozen := func(t time.Time) bool {
+		for _, window := range ConfigInstance.FreezeWindows {
+			if window.Contains(t.In(ConfigInstance.FreezeLocation)) {
+				return true
+			}
+		}
+		return false
+	}
+	if !frozen(t) {
+		return time.Time{}, false
+	}
+	// Overlapping windows can chain; a week is the longest possible freeze.
+	end := t.Truncate(time.Minute)
+	for i := 0; i < 7*24*60 && frozen(end); i++ {
+		end = end.Add(time.Minute)
+	}
+	return end, true
+}
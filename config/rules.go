@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/expr"
+)
+
+// routingRuleVars are sample values of the variables routing rules see, for
+// checking the rules at startup.
+var routingRuleVars = expr.Vars{"doc": map[string]interface{}{
+	"id": "", "title": "", "collection": "", "workspace": "", "classification": "", "tags": []string{},
+}}
+
+// exportFilterVars are sample values of the variables EXPORT_FILTER sees,
+// for checking the filter at startup.
+var exportFilterVars = expr.Vars{"doc": map[string]interface{}{
+	"id": "", "title": "", "collection": "", "workspace": "", "author": "", "tags": []string{},
+	"archived": false, "draft": false, "template": false,
+}}
+
+// RoutingRule sends documents matching Condition to KnowledgeIDs.
+type RoutingRule struct {
+	Condition    *expr.Expr
+	KnowledgeIDs []string
+}
+
+// ParseRoutingRules parses rules such as
+// `doc.collection == "Engineering" && "public" in doc.tags => kid1,kid2`.
+// Rules are separated by semicolons outside string literals.
+func ParseRoutingRules(value string) ([]RoutingRule, error) {
+	var rules []RoutingRule
+	for _, spec := range splitOutsideQuotes(value, ';') {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		i := strings.LastIndex(spec, "=>")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid rule %q: expected condition => knowledge IDs", spec)
+		}
+		condition, err := expr.Parse(spec[:i])
+		if err == nil {
+			err = condition.Check(routingRuleVars)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %w", spec, err)
+		}
+		rule := RoutingRule{Condition: condition}
+		for _, id := range strings.Split(spec[i+2:], ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				rule.KnowledgeIDs = append(rule.KnowledgeIDs, id)
+			}
+		}
+		if len(rule.KnowledgeIDs) == 0 {
+			return nil, fmt.Errorf("invalid rule %q: no knowledge IDs", spec)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// splitOutsideQuotes splits value at sep where it is not inside a quoted string.
+func splitOutsideQuotes(value string, sep rune) []string {
+	var parts []string
+	var quote rune
+	start := 0
+	for i, r := range value {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == sep:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule is a recurring time of day at which a sync is started, evaluated
+// in its own time zone so "02:00" means local night in every deployment.
+type Schedule struct {
+	Days     [7]bool       // Indexed by time.Weekday.
+	At       time.Duration // Offset from midnight.
+	Location *time.Location
+}
+
+// ParseSchedules parses schedules such as "02:00;Mon-Fri 12:30 Europe/Zurich".
+// Schedules are separated by semicolons; without days a schedule runs daily
+// and without a time zone it runs in defaultLocation.
+func ParseSchedules(value string, defaultLocation *time.Location) ([]Schedule, error) {
+	var schedules []Schedule
+	for _, spec := range strings.Split(value, ";") {
+		fields := strings.Fields(spec)
+		if len(fields) == 0 {
+			continue
+		}
+		schedule := Schedule{Location: defaultLocation}
+		// The time is the only field containing a colon; days precede it, the zone follows.
+		at := -1
+		for i, field := range fields {
+			if strings.Contains(field, ":") {
+				at = i
+				break
+			}
+		}
+		if at < 0 || at > 1 || len(fields) > at+2 {
+			return nil, fmt.Errorf("invalid schedule %q: expected [days] HH:MM [time zone]", spec)
+		}
+		days := ""
+		if at == 1 {
+			days = fields[0]
+		}
+		if err := parseDays(days, &schedule.Days); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		var err error
+		if schedule.At, err = parseClock(fields[at]); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		if len(fields) == at+2 {
+			if schedule.Location, err = time.LoadLocation(fields[at+1]); err != nil {
+				return nil, fmt.Errorf("invalid schedule %q: unknown time zone %q", spec, fields[at+1])
+			}
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
+// Next returns the first time after t the schedule is due. Times skipped by
+// a daylight saving change run at the equivalent time after the change.
+func (s Schedule) Next(t time.Time) time.Time {
+	local := t.In(s.Location)
+	for i := 0; i <= 7; i++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+i, 0, 0, 0, 0, s.Location)
+		if !s.Days[day.Weekday()] {
+			continue
+		}
+		next := time.Date(day.Year(), day.Month(), day.Day(), int(s.At/time.Hour), int(s.At%time.Hour/time.Minute), 0, 0, s.Location)
+		if next.After(t) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// String formats the schedule for logs, e.g. "02:00 Europe/Zurich".
+func (s Schedule) String() string {
+	return fmt.Sprintf("%02d:%02d %s", int(s.At/time.Hour), int(s.At%time.Hour/time.Minute), s.Location)
+}
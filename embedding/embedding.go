@@ -0,0 +1,108 @@
+// Package embedding turns text into vectors with the configured embedding
+// provider, for sinks that write to a vector store directly.
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// Embed returns one vector per text, in order, using EMBEDDING_PROVIDER.
+// Texts are sent in batches of EMBEDDING_BATCH_SIZE.
+func Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	cfg := config.ConfigInstance
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += cfg.EmbeddingBatchSize {
+		end := start + cfg.EmbeddingBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		var batch [][]float32
+		var err error
+		switch cfg.EmbeddingProvider {
+		case "openai":
+			batch, err = embedOpenAI(ctx, texts[start:end], cfg.EmbeddingURL, cfg.EmbeddingAPIKey, cfg.EmbeddingModel)
+		case "ollama":
+			batch, err = embedOllama(ctx, texts[start:end], cfg.EmbeddingURL, cfg.EmbeddingModel)
+		default:
+			return nil, fmt.Errorf("embedding: unsupported provider %q", cfg.EmbeddingProvider)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) != end-start {
+			return nil, fmt.Errorf("embedding: expected %d vectors, got %d", end-start, len(batch))
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+// embedOpenAI calls an OpenAI-compatible /embeddings endpoint, which also
+// covers Azure OpenAI deployments, LiteLLM, vLLM and LocalAI.
+func embedOpenAI(ctx context.Context, texts []string, baseURL, apiKey, model string) ([][]float32, error) {
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	payload := map[string]interface{}{"model": model, "input": texts}
+	if err := post(ctx, strings.TrimSuffix(baseURL, "/")+"/embeddings", apiKey, payload, &result); err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(result.Data))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding: index %d out of range", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
+
+// embedOllama calls Ollama's /api/embed endpoint.
+func embedOllama(ctx context.Context, texts []string, baseURL, model string) ([][]float32, error) {
+	var result struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	payload := map[string]interface{}{"model": model, "input": texts}
+	if err := post(ctx, strings.TrimSuffix(baseURL, "/")+"/api/embed", "", payload, &result); err != nil {
+		return nil, err
+	}
+	return result.Embeddings, nil
+}
+
+// post sends payload as JSON and decodes the JSON answer into result.
+func post(ctx context.Context, url, token string, payload, result interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := utils.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("embedding: %s returned %s: %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,630 @@
+// Package expr implements a small CEL-like expression language for filter
+// and routing rules over document metadata, e.g.
+//
+//	doc.collection == "Engineering" && "public" in doc.tags
+//
+// Supported are string, number, boolean and list literals; variables and
+// field access (doc.title); the operators ||, &&, !, ==, !=, <, <=, >, >= and
+// in (list membership or substring); the string methods contains,
+// startsWith, endsWith and matches (regular expression); and size(x).
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a parsed expression.
+type Expr struct {
+	source string
+	root   node
+}
+
+// Vars holds the variables an expression is evaluated with. Values are
+// strings, numbers (float64 or int), booleans, []string, []interface{} or
+// nested map[string]interface{}.
+type Vars map[string]interface{}
+
+// Parse parses an expression.
+func Parse(source string) (*Expr, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, fmt.Errorf("expr: %w", err)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("expr: %w", err)
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("expr: unexpected %q at offset %d", p.peek().text, p.peek().pos)
+	}
+	return &Expr{source: source, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression, which must yield a boolean.
+func (e *Expr) Eval(vars Vars) (bool, error) {
+	value, err := e.root.eval(vars)
+	if err != nil {
+		return false, fmt.Errorf("expr: %w", err)
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expr: %q yields %T, not a boolean", e.source, value)
+	}
+	return result, nil
+}
+
+// Check evaluates every part of the expression with sample vars, including
+// the branches Eval would skip, so unknown variables and fields, type errors
+// and invalid regular expressions are found before any document is seen.
+func (e *Expr) Check(vars Vars) error {
+	if err := check(e.root, vars); err != nil {
+		return fmt.Errorf("expr: %w", err)
+	}
+	_, err := e.Eval(vars)
+	return err
+}
+
+// check evaluates n and, first, every node below it.
+func check(n node, vars Vars) error {
+	var operands []node
+	switch n := n.(type) {
+	case fieldNode:
+		operands = []node{n.object}
+	case listNode:
+		operands = n.items
+	case notNode:
+		operands = []node{n.operand}
+	case compareNode:
+		operands = []node{n.left, n.right}
+	case callNode:
+		if n.receiver != nil {
+			operands = append(operands, n.receiver)
+		}
+		operands = append(operands, n.args...)
+	case logicalNode:
+		for _, operand := range []node{n.left, n.right} {
+			if err := check(operand, vars); err != nil {
+				return err
+			}
+			if _, err := evalBool(operand, vars, n.op); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, operand := range operands {
+		if err := check(operand, vars); err != nil {
+			return err
+		}
+	}
+	_, err := n.eval(vars)
+	return err
+}
+
+// Lexer.
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ",", "."}
+
+func lex(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			var text strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				text.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			tokens = append(tokens, token{tokString, text.String(), i})
+			i = j + 1
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, string(runes[i:j]), i})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, string(runes[i:j]), i})
+			i = j
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, token{tokOp, op, i})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", r, i)
+			}
+		}
+	}
+	return append(tokens, token{tokEOF, "end of expression", len(runes)}), nil
+}
+
+// Parser.
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(text string) bool {
+	if t := p.peek(); (t.kind == tokOp || t.kind == tokIdent) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("expected %q at offset %d, got %q", text, p.peek().pos, p.peek().text)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.accept(op) {
+			right, err := p.parsePostfix()
+			if err != nil {
+				return nil, err
+			}
+			return compareNode{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	value, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(".") {
+		name := p.next()
+		if name.kind != tokIdent {
+			return nil, fmt.Errorf("expected field or method name at offset %d", name.pos)
+		}
+		if p.accept("(") {
+			args, err := p.parseArgs(")")
+			if err != nil {
+				return nil, err
+			}
+			value = callNode{name: name.text, receiver: value, args: args}
+			continue
+		}
+		value = fieldNode{value, name.text}
+	}
+	return value, nil
+}
+
+func (p *parser) parseArgs(closing string) ([]node, error) {
+	var args []node
+	if p.accept(closing) {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.accept(closing) {
+			return args, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return literalNode{t.text}, nil
+	case tokNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at offset %d", t.text, t.pos)
+		}
+		return literalNode{n}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literalNode{true}, nil
+		case "false":
+			return literalNode{false}, nil
+		}
+		if p.accept("(") {
+			args, err := p.parseArgs(")")
+			if err != nil {
+				return nil, err
+			}
+			return callNode{name: t.text, args: args}, nil
+		}
+		return varNode{t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+		case "[":
+			items, err := p.parseArgs("]")
+			if err != nil {
+				return nil, err
+			}
+			return listNode{items}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+}
+
+// Evaluation.
+
+type node interface {
+	eval(vars Vars) (interface{}, error)
+}
+
+type literalNode struct{ value interface{} }
+
+func (n literalNode) eval(Vars) (interface{}, error) { return n.value, nil }
+
+type varNode struct{ name string }
+
+func (n varNode) eval(vars Vars) (interface{}, error) {
+	value, ok := vars[n.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown variable %q", n.name)
+	}
+	return normalize(value), nil
+}
+
+type fieldNode struct {
+	object node
+	name   string
+}
+
+func (n fieldNode) eval(vars Vars) (interface{}, error) {
+	object, err := n.object.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := object.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot read field %q of %T", n.name, object)
+	}
+	value, ok := fields[n.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", n.name)
+	}
+	return normalize(value), nil
+}
+
+type listNode struct{ items []node }
+
+func (n listNode) eval(vars Vars) (interface{}, error) {
+	list := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+type notNode struct{ operand node }
+
+func (n notNode) eval(vars Vars) (interface{}, error) {
+	value, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("! needs a boolean, got %T", value)
+	}
+	return !b, nil
+}
+
+type logicalNode struct {
+	op          string
+	left, right node
+}
+
+func (n logicalNode) eval(vars Vars) (interface{}, error) {
+	left, err := evalBool(n.left, vars, n.op)
+	if err != nil {
+		return nil, err
+	}
+	// Short-circuit like CEL, so guards such as size(x) > 0 && ... work.
+	if (n.op == "&&" && !left) || (n.op == "||" && left) {
+		return left, nil
+	}
+	return evalBool(n.right, vars, n.op)
+}
+
+func evalBool(n node, vars Vars, op string) (bool, error) {
+	value, err := n.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s needs booleans, got %T", op, value)
+	}
+	return b, nil
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n compareNode) eval(vars Vars) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		switch container := right.(type) {
+		case []interface{}:
+			for _, item := range container {
+				if equal(left, item) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case string:
+			s, ok := left.(string)
+			if !ok {
+				return nil, fmt.Errorf("in on a string needs a string, got %T", left)
+			}
+			return strings.Contains(container, s), nil
+		}
+		return nil, fmt.Errorf("in needs a list or string, got %T", right)
+	}
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare number with %T", right)
+		}
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare string with %T", right)
+		}
+		cmp = strings.Compare(l, r)
+	default:
+		return nil, fmt.Errorf("cannot order %T", left)
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+type callNode struct {
+	name     string
+	receiver node
+	args     []node
+}
+
+func (n callNode) eval(vars Vars) (interface{}, error) {
+	var args []interface{}
+	if n.receiver != nil {
+		receiver, err := n.receiver.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, receiver)
+	}
+	for _, arg := range n.args {
+		value, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	if n.name == "size" {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("size takes one argument")
+		}
+		switch v := args[0].(type) {
+		case string:
+			return float64(len([]rune(v))), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		}
+		return nil, fmt.Errorf("size needs a string or list, got %T", args[0])
+	}
+	if n.receiver == nil || len(args) != 2 {
+		return nil, fmt.Errorf("unknown function %s with %d arguments", n.name, len(args))
+	}
+	s, ok1 := args[0].(string)
+	arg, ok2 := args[1].(string)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("%s needs strings", n.name)
+	}
+	switch n.name {
+	case "contains":
+		return strings.Contains(s, arg), nil
+	case "startsWith":
+		return strings.HasPrefix(s, arg), nil
+	case "endsWith":
+		return strings.HasSuffix(s, arg), nil
+	case "matches":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("matches: %w", err)
+		}
+		return re.MatchString(s), nil
+	}
+	return nil, fmt.Errorf("unknown method %s", n.name)
+}
+
+// normalize converts Go values from Vars to the types the evaluator uses.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case []string:
+		list := make([]interface{}, len(v))
+		for i, s := range v {
+			list[i] = s
+		}
+		return list
+	case Vars:
+		return map[string]interface{}(v)
+	}
+	return value
+}
+
+func equal(a, b interface{}) bool {
+	la, aIsList := a.([]interface{})
+	lb, bIsList := b.([]interface{})
+	if aIsList || bIsList {
+		if !aIsList || !bIsList || len(la) != len(lb) {
+			return false
+		}
+		for i := range la {
+			if !equal(la[i], lb[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -0,0 +1,134 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+)
+
+var testVars = Vars{"doc": map[string]interface{}{
+	"title":      "Setup Guide",
+	"collection": "Engineering",
+	"tags":       []string{"public", "howto"},
+	"draft":      false,
+	"size":       3,
+}}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{`doc.collection == "Engineering"`, true},
+		{`doc.collection != "Engineering"`, false},
+		{`"public" in doc.tags`, true},
+		{`"internal" in doc.tags`, false},
+		{`"Guide" in doc.title`, true},
+		{`doc.collection in ["Engineering", "Ops"]`, true},
+		{`!doc.draft && "howto" in doc.tags`, true},
+		{`doc.draft || doc.collection == "Ops"`, false},
+		{`doc.size > 2 && doc.size <= 3`, true},
+		{`doc.size < 3 || doc.size >= 4`, false},
+		{`doc.title < "Z"`, true},
+		{`size(doc.tags) == 2`, true},
+		{`size(doc.title) == 11`, true},
+		{`doc.title.contains("up G")`, true},
+		{`doc.title.startsWith("Setup")`, true},
+		{`doc.title.endsWith("Setup")`, false},
+		{`doc.title.matches("^S.*e$")`, true},
+		{`doc.tags == ["public", "howto"]`, true},
+		{`(doc.draft || true) && !(false)`, true},
+		{`'single' == "single"`, true},
+		{`doc.draft && doc.missing`, false}, // short-circuits
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.source)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.source, err)
+			continue
+		}
+		got, err := e.Eval(testVars)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.source, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`doc.title == "open`, "unterminated string"},
+		{`doc.title = "x"`, "unexpected"},
+		{`doc.title == `, "unexpected"},
+		{`(doc.draft`, `expected ")"`},
+		{`doc.`, "expected field or method name"},
+		{`doc.draft doc.draft`, "unexpected"},
+		{`doc.title == #`, "unexpected character"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.source)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want it to contain %q", tt.source, err, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`dco.title == "x"`, `unknown variable "dco"`},
+		{`doc.titel == "x"`, `unknown field "titel"`},
+		{`doc.title`, "not a boolean"},
+		{`!doc.title`, "! needs a boolean"},
+		{`doc.title && true`, "&& needs booleans"},
+		{`doc.size > "2"`, "cannot compare number"},
+		{`doc.title.matches("(")`, "matches"},
+		{`doc.title.shout("x")`, "unknown method"},
+		{`size(doc.draft) == 1`, "size needs a string or list"},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.source)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.source, err)
+			continue
+		}
+		_, err = e.Eval(testVars)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Eval(%q) error = %v, want it to contain %q", tt.source, err, tt.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string // "" if the expression is valid
+	}{
+		{`doc.collection == "Engineering" && "public" in doc.tags`, ""},
+		{`doc.draft && doc.missing`, `unknown field "missing"`},
+		{`true || doc.title.matches("[")`, "matches"},
+		{`false && doc.title`, "&& needs booleans"},
+		{`doc.title`, "not a boolean"},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.source)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.source, err)
+			continue
+		}
+		err = e.Check(testVars)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("Check(%q): %v", tt.source, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("Check(%q) error = %v, want it to contain %q", tt.source, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Package extract turns binary attachments (PDF, Word and PowerPoint files)
+// into plain text so their content can be added to the RAG corpus.
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported reports whether text can be extracted from a file with the given name.
+func Supported(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pdf", ".docx", ".pptx":
+		return true
+	}
+	return false
+}
+
+// Text extracts the text of a file, choosing the extractor by file extension.
+func Text(name string, data []byte) (string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pdf":
+		return pdfText(data)
+	case ".docx":
+		return officeText(data, func(name string) bool { return name == "word/document.xml" })
+	case ".pptx":
+		return officeText(data, func(name string) bool { return slideName.MatchString(name) })
+	default:
+		return "", fmt.Errorf("extract: unsupported file type %q", filepath.Ext(name))
+	}
+}
+
+// pdfText runs pdftotext from poppler-utils, which handles the many encodings
+// PDF files use far better than a pure-Go parser.
+func pdfText(data []byte) (string, error) {
+	tmp, err := os.CreateTemp("", "attachment-*.pdf")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("pdftotext", "-layout", "-enc", "UTF-8", tmp.Name(), "-")
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("extract: pdftotext failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return string(output), nil
+}
+
+// slideName matches the slide parts of a pptx package, capturing the slide number.
+var slideName = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// officeText extracts the text runs of the Office Open XML parts selected by
+// include, in document (or slide) order. Paragraphs become lines.
+func officeText(data []byte, include func(string) bool) (string, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("extract: invalid office file: %w", err)
+	}
+	var parts []*zip.File
+	for _, f := range r.File {
+		if include(f.Name) {
+			parts = append(parts, f)
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool { return partOrder(parts[i].Name) < partOrder(parts[j].Name) })
+
+	var out strings.Builder
+	for _, part := range parts {
+		rc, err := part.Open()
+		if err != nil {
+			return "", err
+		}
+		err = xmlText(rc, &out)
+		rc.Close()
+		if err != nil {
+			return "", fmt.Errorf("extract: %s: %w", part.Name, err)
+		}
+		out.WriteString("\n")
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// partOrder sorts slides numerically (slide10 after slide9).
+func partOrder(name string) int {
+	if m := slideName.FindStringSubmatch(name); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return n
+	}
+	return 0
+}
+
+// xmlText writes the character data of <t> elements, ending each <p> with a newline.
+func xmlText(r io.Reader, out *strings.Builder) error {
+	dec := xml.NewDecoder(r)
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				out.WriteString("\t")
+			case "br":
+				out.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				out.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				out.Write(t)
+			}
+		}
+	}
+}
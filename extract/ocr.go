@@ -0,0 +1,86 @@
+package extract
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// IsImage reports whether a file name has an image extension OCR can handle.
+func IsImage(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".bmp", ".tif", ".tiff", ".webp":
+		return true
+	}
+	return false
+}
+
+// OCR recognizes the text in an image using the configured OCR_METHOD.
+func OCR(ctx context.Context, data []byte) (string, error) {
+	cfg := config.ConfigInstance
+	switch cfg.OCRMethod {
+	case "tesseract":
+		return ocrTesseract(ctx, data, cfg.OCRLanguage)
+	case "api":
+		return ocrAPI(ctx, data, cfg.OCRAPIURL, cfg.OCRAPIToken)
+	default:
+		return "", fmt.Errorf("extract: unsupported OCR method %q", cfg.OCRMethod)
+	}
+}
+
+// ocrTesseract pipes the image through the tesseract binary.
+func ocrTesseract(ctx context.Context, data []byte, language string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "tesseract", "stdin", "stdout", "-l", language)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("extract: tesseract failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// ocrAPI posts the raw image to an external OCR service. The service may
+// answer with plain text or with a JSON object carrying a "text" field.
+func ocrAPI(ctx context.Context, data []byte, url, token string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", http.DetectContentType(data))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := utils.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("extract: OCR API returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var result struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return "", fmt.Errorf("extract: invalid OCR API response: %w", err)
+		}
+		return strings.TrimSpace(result.Text), nil
+	}
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// APIKeyPayload represents the expected payload for issuing a scoped API key.
+type APIKeyPayload struct {
+	Name       string   `json:"name"`        // e.g., "hr-team"
+	MappingIDs []uint   `json:"mapping_ids"` // mappings the key may sync, e.g., [1, 2]; empty for all
+	Scopes     []string `json:"scopes"`      // read, sync or admin, e.g., ["sync"]; default sync
+}
+
+// APIKeyCreatedResponse is returned once when a key is issued.
+type APIKeyCreatedResponse struct {
+	models.APIKey
+	// Key is the plaintext key; it cannot be retrieved again.
+	Key string `json:"key" example:"ors_0123456789abcdef"`
+}
+
+// CreateAPIKeyHandler issues a scoped API key.
+// @Summary Issue a scoped API key
+// @Description Issues an API key with the given scopes: read allows reporting GET requests, sync also exports, uploads and syncs, admin also manages mappings. A key listing mappings may only trigger syncs for them. Scopes are enforced on every endpoint with REQUIRE_API_KEY=true. The plaintext key is returned once. Requires ADMIN_API_KEY.
+// @Tags apikeys
+// @Accept json
+// @Produce json
+// @Param key body APIKeyPayload true "API key payload"
+// @Success 201 {object} APIKeyCreatedResponse
+// @Failure 400 {object} map[string]string "Invalid payload"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Failed to create API key"
+// @Router /apikeys [post]
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var payload APIKeyPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Name == "" {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+	if len(payload.Scopes) == 0 {
+		payload.Scopes = []string{models.ScopeSync}
+	}
+	for _, scope := range payload.Scopes {
+		if !models.ValidScope(scope) {
+			http.Error(w, "Invalid scope "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+	key, err := generateAPIKey()
+	if err != nil {
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	ids := make([]string, len(payload.MappingIDs))
+	for i, id := range payload.MappingIDs {
+		ids[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	record := models.APIKey{
+		Name:       payload.Name,
+		Prefix:     key[:len(apiKeyPrefix)+4],
+		KeyHash:    utils.Checksum([]byte(key)),
+		MappingIDs: strings.Join(ids, ","),
+		Scopes:     strings.Join(payload.Scopes, ","),
+	}
+	if err := utils.DB.Create(&record).Error; err != nil {
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	setAuditTarget(r, strconv.FormatUint(uint64(record.ID), 10))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(APIKeyCreatedResponse{APIKey: record, Key: key})
+}
+
+// GetAPIKeysHandler lists the issued API keys.
+// @Summary Get API keys
+// @Description Lists issued API keys and their scopes (without the keys themselves). Requires ADMIN_API_KEY.
+// @Tags apikeys
+// @Produce json
+// @Success 200 {array} models.APIKey
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Failed to retrieve API keys"
+// @Router /apikeys [get]
+func GetAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	var keys []models.APIKey
+	if err := utils.DB.Order("id").Find(&keys).Error; err != nil {
+		http.Error(w, "Failed to retrieve API keys", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// DeleteAPIKeyHandler revokes an API key.
+// @Summary Revoke an API key
+// @Description Deletes an API key so it can no longer be used. Requires ADMIN_API_KEY.
+// @Tags apikeys
+// @Param id path int true "API key ID"
+// @Success 204 "Revoked"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "API key not found"
+// @Failure 500 {object} map[string]string "Failed to revoke API key"
+// @Router /apikeys/{id} [delete]
+func DeleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	result := utils.DB.Delete(&models.APIKey{}, id)
+	if result.Error != nil {
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/extract"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sources"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// maxAttachmentSize caps attachment downloads so a huge upload in Outline
+// cannot exhaust memory.
+const maxAttachmentSize = 50 << 20
+
+// attachmentLink matches Markdown links to Outline attachments, capturing the
+// link text (the file name) and the attachment ID.
+var attachmentLink = regexp.MustCompile(`\[([^\]]+)\]\([^)\s]*attachments\.redirect\?id=([0-9a-fA-F-]+)[^)]*\)`)
+
+// attachment is a file attached to an Outline document.
+type attachment struct {
+	ID   string
+	Name string
+}
+
+// findAttachments returns the attachments linked from a document whose text
+// can be extracted, without duplicates.
+func findAttachments(markdown string) []attachment {
+	seen := make(map[string]bool)
+	var attachments []attachment
+	for _, m := range attachmentLink.FindAllStringSubmatch(markdown, -1) {
+		name, id := m[1], m[2]
+		if seen[id] || !extract.Supported(name) {
+			continue
+		}
+		seen[id] = true
+		attachments = append(attachments, attachment{ID: id, Name: name})
+	}
+	return attachments
+}
+
+// downloadAttachment fetches an attachment's content. Outline answers with a
+// redirect to the storage backend, which the client follows.
+func downloadAttachment(ctx context.Context, ws config.Workspace, id string) ([]byte, error) {
+	url := fmt.Sprintf("%s/attachments.redirect?id=%s", ws.APIBaseURL, id)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+ws.APIToken)
+	resp, err := sources.DoWithRateLimit(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloadAttachment: unexpected status: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAttachmentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxAttachmentSize {
+		return nil, fmt.Errorf("downloadAttachment: attachment %s exceeds %d bytes", id, maxAttachmentSize)
+	}
+	return data, nil
+}
+
+// exportAttachments extracts the text of the PDF, docx and pptx attachments of
+// an exported document and saves each as a companion Markdown file next to
+// it. Their text goes through redact before it is written. Companions link
+// back to their parent document and inherit its classification. Attachments already extracted are skipped, since Outline
+// gives a replaced file a new attachment ID.
+func exportAttachments(ctx context.Context, ws config.Workspace, parent *models.ExportedDocument, markdown string, redact func(string) (string, error)) {
+	base := strings.TrimSuffix(parent.FilePath, filepath.Ext(parent.FilePath))
+	for _, a := range findAttachments(markdown) {
+		if previous, err := models.GetExportedDocument(utils.DB, a.ID); err == nil {
+			if _, err := os.Stat(previous.FilePath); err == nil {
+				continue
+			}
+		}
+		data, err := downloadAttachment(ctx, ws, a.ID)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error downloading attachment", "attachment", a.Name, "document_id", parent.DocumentID, "error", err)
+			continue
+		}
+		text, err := extract.Text(a.Name, data)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error extracting attachment", "attachment", a.Name, "document_id", parent.DocumentID, "error", err)
+			continue
+		}
+		if text, err = redact(text); err != nil {
+			logging.FromContext(ctx).Error("Error transforming attachment", "attachment", a.Name, "document_id", parent.DocumentID, "error", err)
+			continue
+		}
+
+		var header utils.FrontMatter
+		header.Set("title", a.Name)
+		header.Set("attachment", a.Name)
+		header.Set("parent_document", parent.Title)
+		header.Set("outline_id", parent.DocumentID)
+		header.Set("collection", parent.CollectionName)
+		header.Set("url", parent.URL)
+		header.Set("workspace", ws.Name)
+		header.Set("classification", parent.Classification)
+		content := fmt.Sprintf("%s\n%s\n", header.String(), text)
+		filePath := base + "__" + utils.SanitizeFilename(a.Name) + ".md"
+		if err = utils.WriteFileAtomic(filePath, []byte(content), 0644); err != nil {
+			logging.FromContext(ctx).Error("Error writing attachment", "attachment", a.Name, "document_id", parent.DocumentID, "error", err)
+			continue
+		}
+		record := *parent
+		record.ID = 0
+		record.CreatedAt, record.UpdatedAt = time.Time{}, time.Time{}
+		record.SyncCount = 0
+		record.DocumentID = a.ID
+		record.ParentDocumentID = parent.DocumentID
+		record.FilePath = filePath
+		record.Checksum = utils.Checksum([]byte(content))
+		record.Title = fmt.Sprintf("%s: %s", parent.Title, a.Name)
+		if err = models.SaveExportedDocument(utils.DB, &record); err != nil {
+			logging.FromContext(ctx).Error("Error recording attachment", "attachment", a.Name, "document_id", parent.DocumentID, "error", err)
+			continue
+		}
+		if err = models.RecordDocumentChange(utils.DB, models.ChangeAdded, &record); err != nil {
+			logging.FromContext(ctx).Error("Error recording change for attachment", "attachment_id", a.ID, "error", err)
+		}
+		logging.FromContext(ctx).Info("Extracted attachment", "file", filePath)
+	}
+}
+
+// attachmentReference matches Markdown links and images pointing at Outline
+// attachments, capturing the image marker, the text, the attachment ID and
+// an optional link title.
+var attachmentReference = regexp.MustCompile(`(!?)\[([^\]]*)\]\([^)\s]*attachments\.redirect\?id=([0-9a-fA-F-]+)[^)\s]*(\s+"[^"]*")?\)`)
+
+// attachmentDir returns the directory holding the downloaded attachments of
+// an exported document.
+func attachmentDir(filePath string) string {
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".files"
+}
+
+// localizeAttachments downloads the attachments referenced by a document
+// into attachmentDir(filePath) and rewrites the links to point at the local
+// copies; with ATTACHMENT_LINKS=inline small images become data URIs. Files
+// no longer referenced are removed. A failed download keeps its original link.
+func localizeAttachments(ctx context.Context, ws config.Workspace, filePath, markdown string) string {
+	dir := attachmentDir(filePath)
+	keep := make(map[string]bool)
+	localized := attachmentReference.ReplaceAllStringFunc(markdown, func(link string) string {
+		m := attachmentReference.FindStringSubmatch(link)
+		image, text, id, title := m[1] == "!", m[2], m[3], m[4]
+		name, data, err := localAttachment(ctx, ws, dir, id, text)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error downloading attachment", "attachment_id", id, "file", filePath, "error", err)
+			return link
+		}
+		keep[name] = true
+		target := url.PathEscape(filepath.Base(dir)) + "/" + url.PathEscape(name)
+		if image && config.ConfigInstance.AttachmentLinks == "inline" && len(data) <= config.ConfigInstance.InlineImageMaxSize {
+			target = "data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data)
+		}
+		return fmt.Sprintf("%s[%s](%s%s)", m[1], text, target, title)
+	})
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return localized
+	}
+	for _, entry := range entries {
+		if !keep[entry.Name()] {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(keep) == 0 {
+		os.Remove(dir)
+	}
+	return localized
+}
+
+// localAttachment returns the local file name and content of an attachment,
+// downloading it into dir unless an earlier export already did. Outline gives
+// a replaced file a new attachment ID, so a stored copy never goes stale.
+func localAttachment(ctx context.Context, ws config.Workspace, dir, id, text string) (string, []byte, error) {
+	prefix := id + "-"
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), prefix) {
+				data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+				return entry.Name(), data, err
+			}
+		}
+	}
+	data, err := downloadAttachment(ctx, ws, id)
+	if err != nil {
+		return "", nil, err
+	}
+	name := utils.SanitizeFilename(text)
+	if filepath.Ext(name) == "" {
+		if extensions, _ := mime.ExtensionsByType(http.DetectContentType(data)); len(extensions) > 0 {
+			name += extensions[0]
+		}
+	}
+	name = prefix + name
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", nil, err
+	}
+	if err := utils.WriteFileAtomic(filepath.Join(dir, name), data, 0644); err != nil {
+		return "", nil, err
+	}
+	return name, data, nil
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+type auditContextKey struct{}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// principalFor names the caller of a request based on its API key or OIDC
+// session.
+func principalFor(r *http.Request) string {
+	key := apiKeyFromRequest(r)
+	if key == "" {
+		if session, ok := oidcSessionFor(r); ok {
+			return session.principal()
+		}
+		return "anonymous"
+	}
+	if isAdminKey(key) {
+		return "admin"
+	}
+	if record, ok := lookupAPIKey(key); ok {
+		return "apikey:" + record.Name
+	}
+	return "unauthenticated"
+}
+
+// sourceIP returns the client address, honouring X-Forwarded-For only when
+// the service runs behind a trusted proxy.
+func sourceIP(r *http.Request) string {
+	if config.ConfigInstance.TrustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// setAuditTarget lets a handler name the object it affected, e.g. a newly
+// created mapping whose ID is not part of the URL.
+func setAuditTarget(r *http.Request, target string) {
+	if event, ok := r.Context().Value(auditContextKey{}).(*models.AuditEvent); ok {
+		event.Target = target
+	}
+}
+
+// setAuditTrigger overrides the trigger type of the request's audit event,
+// e.g. for requests sent by a webhook instead of a person.
+func setAuditTrigger(r *http.Request, trigger string) {
+	if event, ok := r.Context().Value(auditContextKey{}).(*models.AuditEvent); ok {
+		event.Trigger = trigger
+	}
+}
+
+// audited records an audit event for every request to next, including the
+// principal, source IP and resulting status.
+func audited(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		event := &models.AuditEvent{
+			Principal: principalFor(r),
+			SourceIP:  sourceIP(r),
+			Trigger:   models.TriggerManual,
+			Action:    action,
+			Target:    mux.Vars(r)["id"],
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r.WithContext(context.WithValue(r.Context(), auditContextKey{}, event)))
+		event.Status = rec.status
+		if event.Status == 0 {
+			event.Status = http.StatusOK
+		}
+		if err := models.RecordAuditEvent(utils.DB, event); err != nil {
+			logging.FromContext(r.Context()).Error("Error recording audit event", "action", action, "error", err)
+		}
+	}
+}
+
+// GetAuditHandler returns the audit trail.
+// @Summary Get audit trail
+// @Description Lists who triggered which job or configuration change, from which address and with which trigger type, newest first. Requires ADMIN_API_KEY.
+// @Tags audit
+// @Produce json
+// @Param principal query string false "Filter by principal, e.g. admin or apikey:hr-team"
+// @Param action query string false "Filter by action, e.g. export or mapping.create"
+// @Param trigger query string false "Filter by trigger: manual, schedule or webhook"
+// @Param since query string false "Only events at or after this RFC 3339 timestamp"
+// @Param limit query int false "Maximum number of events (default 100)"
+// @Success 200 {array} models.AuditEvent
+// @Failure 400 {object} map[string]string "Invalid filter"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Failed to retrieve audit trail"
+// @Router /audit [get]
+func GetAuditHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		Principal: query.Get("principal"),
+		Action:    query.Get("action"),
+		Trigger:   query.Get("trigger"),
+		Limit:     100,
+	}
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			http.Error(w, "Invalid since timestamp", http.StatusBadRequest)
+			return
+		}
+		filter.Since = t
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+	events, err := models.ListAuditEvents(utils.DB, filter)
+	if err != nil {
+		http.Error(w, "Failed to retrieve audit trail", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// apiKeyPrefix marks keys issued by this service.
+const apiKeyPrefix = "ors_"
+
+// apiKeyFromRequest extracts a key from the Authorization bearer header or the
+// X-API-Key header.
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// isAdminKey reports whether key matches the configured ADMIN_API_KEY.
+func isAdminKey(key string) bool {
+	admin := config.ConfigInstance.AdminAPIKey
+	return admin != "" && subtle.ConstantTimeCompare([]byte(key), []byte(admin)) == 1
+}
+
+// lookupAPIKey resolves a scoped key and records its use.
+func lookupAPIKey(key string) (*models.APIKey, bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, false
+	}
+	record, err := models.FindAPIKeyByHash(utils.DB, utils.Checksum([]byte(key)))
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	utils.DB.Model(record).Update("last_used_at", now)
+	return record, true
+}
+
+// generateAPIKey returns a new random key.
+func generateAPIKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// requireAdmin rejects requests that do not carry ADMIN_API_KEY or come from
+// a user signed in through OIDC with the admin role. Key management is
+// disabled entirely while no admin key is configured.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.ConfigInstance.AdminAPIKey == "" {
+			http.Error(w, "ADMIN_API_KEY is not configured", http.StatusForbidden)
+			return
+		}
+		key := apiKeyFromRequest(r)
+		if isAdminKey(key) {
+			next(w, r)
+			return
+		}
+		session, signedIn := oidcSessionFor(r)
+		if key != "" || !signedIn {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !session.hasScope(models.ScopeAdmin) {
+			http.Error(w, "Your role lacks the admin scope", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// selfAuthenticatedPaths are left to their own checks by requireAPIKey:
+// signed webhooks, the browser OAuth and OIDC flows, the corpus with its own
+// credentials, the static site behind requireReader and the collection status
+// with STATUS_PUBLIC.
+var selfAuthenticatedPaths = []string{"/webhooks/outline", "/oauth/outline/", "/oauth/oidc/", "/corpus/", "/site/", "/status/collections/"}
+
+// adminScopeRoutes are the routes, by method and path template, that need the
+// admin scope: mapping management.
+var adminScopeRoutes = map[string]bool{
+	"POST /mappings":          true,
+	"POST /mappings/discover": true,
+	"PUT /mappings/{id}":      true,
+	"DELETE /mappings/{id}":   true,
+}
+
+// syncScopeRoutes are GET routes that start work and need the sync scope.
+var syncScopeRoutes = map[string]bool{
+	"GET /export": true,
+	"GET /upload": true,
+}
+
+// mappingSyncRoute is the only route keys limited to mappings may trigger
+// syncs through; the handler checks the mapping.
+const mappingSyncRoute = "POST /mappings/{id}/sync"
+
+// matchPath reports whether path matches one of paths; entries ending with
+// a slash match every path below them.
+func matchPath(path string, paths []string) bool {
+	for _, public := range paths {
+		if path == public || strings.HasSuffix(public, "/") && strings.HasPrefix(path, public) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeScope returns the scope a request needs: admin for mapping
+// management, read for GET and HEAD requests that only report, and sync
+// otherwise.
+func routeScope(r *http.Request) (scope, route string) {
+	template := r.URL.Path
+	if current := mux.CurrentRoute(r); current != nil {
+		if t, err := current.GetPathTemplate(); err == nil {
+			template = t
+		}
+	}
+	route = r.Method + " " + template
+	switch {
+	case adminScopeRoutes[route]:
+		return models.ScopeAdmin, route
+	case syncScopeRoutes[route]:
+		return models.ScopeSync, route
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return models.ScopeRead, route
+	}
+	return models.ScopeSync, route
+}
+
+// requireAPIKey rejects requests without ADMIN_API_KEY or an issued key
+// holding the route's scope when REQUIRE_API_KEY is set; users signed in
+// through OIDC hold their role's scope. Keys limited to mappings may only trigger
+// syncs of those mappings. Routes that need ADMIN_API_KEY still check it
+// themselves.
+func requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.ConfigInstance
+		if !cfg.RequireAPIKey || matchPath(r.URL.Path, cfg.PublicPaths) || matchPath(r.URL.Path, selfAuthenticatedPaths) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := apiKeyFromRequest(r)
+		if isAdminKey(key) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if session, signedIn := oidcSessionFor(r); key == "" && signedIn {
+			if scope, _ := routeScope(r); !session.hasScope(scope) {
+				http.Error(w, "Your role lacks the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if status, message := checkAPIKey(r, key); status != 0 {
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			http.Error(w, message, status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireReader guards content served to browsers, whatever REQUIRE_API_KEY
+// says: requests need ADMIN_API_KEY, an issued key or OIDC session holding the
+// read scope, or the corpus credentials, unless the path is in PUBLIC_PATHS.
+func requireReader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if matchPath(r.URL.Path, config.ConfigInstance.PublicPaths) || corpusAuthorized(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := apiKeyFromRequest(r)
+		if session, signedIn := oidcSessionFor(r); key == "" && signedIn {
+			if !session.hasScope(models.ScopeRead) {
+				http.Error(w, "Your role lacks the "+models.ScopeRead+" scope", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		status, message := http.StatusUnauthorized, "Unauthorized"
+		if key != "" {
+			status, message = checkAPIKey(r, key)
+		}
+		switch status {
+		case 0:
+			next.ServeHTTP(w, r)
+		case http.StatusUnauthorized:
+			w.Header().Set("WWW-Authenticate", `Basic realm="site"`)
+			fallthrough
+		default:
+			http.Error(w, message, status)
+		}
+	})
+}
+
+// checkAPIKey validates a key sent with a request against the route's scope.
+// It returns 0 if the key may be used, otherwise the status and message to
+// reject the request with.
+func checkAPIKey(r *http.Request, key string) (int, string) {
+	if isAdminKey(key) {
+		return 0, ""
+	}
+	record, ok := lookupAPIKey(key)
+	if !ok {
+		return http.StatusUnauthorized, "Unauthorized"
+	}
+	scope, route := routeScope(r)
+	if !record.HasScope(scope) {
+		return http.StatusForbidden, "Key lacks the " + scope + " scope"
+	}
+	if scope == models.ScopeSync && record.MappingIDs != "" && route != mappingSyncRoute {
+		return http.StatusForbidden, "Key is limited to syncing its mappings"
+	}
+	return 0, ""
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// knowledgeExists reports whether OpenWebUI has a knowledge collection.
+// Depending on the release, a missing collection is answered with 404 or
+// with 401/400 and a "not found" detail.
+func knowledgeExists(ctx context.Context, knowledgeID string) (bool, error) {
+	url := fmt.Sprintf("%s/knowledge/%s", config.ConfigInstance.OpenWebUIAPIURL, knowledgeID)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
+	req.Header.Set("Accept", "application/json")
+	resp, err := utils.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	case http.StatusUnauthorized, http.StatusBadRequest:
+		body, _ := ioutil.ReadAll(resp.Body)
+		if strings.Contains(strings.ToLower(string(body)), "not found") {
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("knowledgeExists: unexpected status: %s", resp.Status)
+}
+
+// createKnowledgeCollection creates an OpenWebUI knowledge collection and
+// returns its ID. A nil accessControl leaves the collection public.
+func createKnowledgeCollection(ctx context.Context, name, description string, accessControl interface{}) (string, error) {
+	url := fmt.Sprintf("%s/knowledge/create", config.ConfigInstance.OpenWebUIAPIURL)
+	payload := map[string]interface{}{
+		"name":        name,
+		"description": description,
+	}
+	if accessControl != nil {
+		payload["access_control"] = accessControl
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := utils.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("createKnowledgeCollection: unexpected status: %s, body: %s", resp.Status, string(respBody))
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", err
+	}
+	if created.ID == "" {
+		return "", fmt.Errorf("createKnowledgeCollection: knowledge ID not found in response")
+	}
+	return created.ID, nil
+}
+
+// ensureKnowledgeCollections creates the missing knowledge collections of
+// mappings with auto-create enabled (per mapping, or AUTO_CREATE_KNOWLEDGE by
+// default) and stores the new IDs in place of the missing ones, both in the
+// database and in mappings. Vector store sinks create their collections
+// themselves.
+func ensureKnowledgeCollections(ctx context.Context, mappings map[string]models.CollectionMapping) error {
+	if !config.ConfigInstance.HasSink("openwebui") {
+		return nil
+	}
+	for key, mapping := range mappings {
+		if !mapping.AutoCreates(config.ConfigInstance.AutoCreateKnowledge) {
+			continue
+		}
+		ids := mapping.KnowledgeIDs()
+		replaced := false
+		for i, knowledgeID := range ids {
+			exists, err := knowledgeExists(ctx, knowledgeID)
+			if err != nil {
+				return fmt.Errorf("knowledge collection %s: %w", knowledgeID, err)
+			}
+			if exists {
+				continue
+			}
+			created, err := createKnowledgeCollection(ctx, mapping.OutlineCollection,
+				fmt.Sprintf("Documents of the Outline collection %s", mapping.OutlineCollection), nil)
+			if err != nil {
+				return fmt.Errorf("error creating knowledge collection for %s: %w", mapping.OutlineCollection, err)
+			}
+			logging.FromContext(ctx).Info("Created knowledge collection for mapping", "knowledge_id", created, "collection", mapping.OutlineCollection, "replaced", knowledgeID)
+			ids[i], replaced = created, true
+		}
+		if !replaced {
+			continue
+		}
+		mapping.OpenWebUICollections = strings.Join(ids, ",")
+		if err := utils.DB.Model(&mapping).Update("OpenWebUICollections", mapping.OpenWebUICollections).Error; err != nil {
+			return err
+		}
+		mappings[key] = mapping
+	}
+	return nil
+}
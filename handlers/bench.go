@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/chunk"
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sinks"
+	"github.com/mikeshootzz/outline-rag-scraper/sources"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// benchKnowledgeID is the knowledge ID sinks other than OpenWebUI are
+// benchmarked against; its documents are removed afterwards.
+const benchKnowledgeID = "outline-rag-scraper-bench"
+
+// benchDocument is a document the pipeline and uploads are measured with.
+type benchDocument struct {
+	Title   string
+	Content string
+}
+
+// benchResult summarizes the operations of one benchmark run.
+type benchResult struct {
+	Concurrency int
+	Elapsed     time.Duration
+	Latencies   []time.Duration
+	Bytes       int
+	Errors      int
+}
+
+// percentile returns the p-th percentile of the (sorted) latencies.
+func (r benchResult) percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	return r.Latencies[int(float64(len(r.Latencies)-1)*p)]
+}
+
+// perSecond returns how many operations and megabytes were done per second.
+func (r benchResult) perSecond() (float64, float64) {
+	seconds := r.Elapsed.Seconds()
+	if seconds == 0 {
+		return 0, 0
+	}
+	return float64(len(r.Latencies)) / seconds, float64(r.Bytes) / 1e6 / seconds
+}
+
+// runConcurrently calls op for n items with the given concurrency and records
+// the latency of every successful call.
+func runConcurrently(n, concurrency int, op func(i int) (int, error)) benchResult {
+	result := benchResult{Concurrency: concurrency}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	next := make(chan int)
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				began := time.Now()
+				size, err := op(i)
+				latency := time.Since(began)
+				mu.Lock()
+				if err != nil {
+					slog.Error("Benchmark operation failed", "error", err)
+					result.Errors++
+				} else {
+					result.Latencies = append(result.Latencies, latency)
+					result.Bytes += size
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	result.Elapsed = time.Since(start)
+	sort.Slice(result.Latencies, func(i, j int) bool { return result.Latencies[i] < result.Latencies[j] })
+	return result
+}
+
+// syntheticDocument generates a Markdown document of about size bytes with
+// headings, paragraphs, a table and a code block, like a typical wiki page.
+func syntheticDocument(rng *rand.Rand, index, size int) benchDocument {
+	words := strings.Fields("deploy service cluster database backup restore runbook incident alert " +
+		"latency token config release rollout migration schema queue worker cache index")
+	sentence := func() string {
+		n := 8 + rng.Intn(12)
+		parts := make([]string, n)
+		for i := range parts {
+			parts[i] = words[rng.Intn(len(words))]
+		}
+		return strings.ToUpper(parts[0][:1]) + strings.Join(parts, " ")[1:] + "."
+	}
+	var b strings.Builder
+	for section := 1; b.Len() < size; section++ {
+		fmt.Fprintf(&b, "## Section %d\n\n", section)
+		for p := 0; p < 3; p++ {
+			for s := 0; s < 4; s++ {
+				b.WriteString(sentence() + " ")
+			}
+			b.WriteString("\n\n")
+		}
+		switch section % 3 {
+		case 1:
+			b.WriteString("| Setting | Value |\n| --- | --- |\n")
+			for r := 0; r < 4; r++ {
+				fmt.Fprintf(&b, "| %s | %d |\n", words[rng.Intn(len(words))], rng.Intn(1000))
+			}
+			b.WriteString("\n")
+		case 2:
+			b.WriteString("```bash\nkubectl rollout restart deployment/" + words[rng.Intn(len(words))] + "\n```\n\n")
+		}
+	}
+	return benchDocument{Title: fmt.Sprintf("Benchmark document %d", index+1), Content: b.String()}
+}
+
+// sampleDocuments lists up to n documents of a workspace to export.
+func sampleDocuments(ctx context.Context, ws config.Workspace, n int) ([]models.Document, error) {
+	var docs []models.Document
+	for offset := 0; len(docs) < n; {
+		page, err := sources.For(ws).ListDocuments(ctx, offset, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range page {
+			if len(docs) == n {
+				break
+			}
+			docs = append(docs, doc)
+		}
+		if len(page) < config.ConfigInstance.Limit || len(page) == 0 {
+			break
+		}
+		offset += len(page)
+	}
+	return docs, nil
+}
+
+// benchStages times the local pipeline stages for every document.
+func benchStages(ctx context.Context, docs []benchDocument) (map[string]benchResult, []string) {
+	format := resolveExportFormat("")
+	size := config.ConfigInstance.ChunkSize
+	if size <= 0 {
+		size = sinks.VectorChunkSize
+	}
+	stages := []string{"render", "strip_sections", "glossary", "chunk", "convert"}
+	results := make(map[string]benchResult, len(stages))
+	for _, doc := range docs {
+		var header utils.FrontMatter
+		header.Set("title", doc.Title)
+		header.Set("updated_at", time.Now())
+		content := fmt.Sprintf("%s\n%s", header.String(), doc.Content)
+		plainText := uploadOptionsFor("bench"+exportExtensions[format], nil).PlainText
+		steps := map[string]func(){
+			"render": func() { content, _ = renderExport(format, header, content) },
+			"strip_sections": func() {
+				content = utils.StripSections(content, config.ConfigInstance.StripSections)
+			},
+			"glossary": func() { content = string(expandGlossary(ctx, []byte(content))) },
+			"chunk": func() {
+				chunk.SplitWith(content, chunk.Options{
+					Strategy:     config.ConfigInstance.ChunkStrategy,
+					Size:         size,
+					Overlap:      config.ConfigInstance.ChunkOverlap,
+					HeadingLevel: config.ConfigInstance.ChunkHeadingLevel,
+				})
+			},
+			"convert": func() {
+				if plainText {
+					utils.MarkdownToPlainText(content)
+				}
+			},
+		}
+		for _, stage := range stages {
+			began := time.Now()
+			steps[stage]()
+			result := results[stage]
+			result.Latencies = append(result.Latencies, time.Since(began))
+			result.Elapsed += time.Since(began)
+			result.Bytes += len(content)
+			results[stage] = result
+		}
+	}
+	for _, stage := range stages {
+		result := results[stage]
+		sort.Slice(result.Latencies, func(i, j int) bool { return result.Latencies[i] < result.Latencies[j] })
+		results[stage] = result
+	}
+	return results, stages
+}
+
+// deleteOpenWebUIFile deletes an uploaded file from OpenWebUI.
+func deleteOpenWebUIFile(ctx context.Context, fileID string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("%s/files/%s", config.ConfigInstance.OpenWebUIAPIURL, fileID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
+	resp, err := utils.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("deleteOpenWebUIFile: unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// benchUpload uploads every document to a sink and removes the uploads
+// again. OpenWebUI is measured by file uploads outside any knowledge
+// collection, other sinks including embedding.
+func benchUpload(ctx context.Context, name string, docs []benchDocument, concurrency int) benchResult {
+	var mu sync.Mutex
+	var fileIDs, filePaths []string
+	sink := sinks.Get(name)
+	result := runConcurrently(len(docs), concurrency, func(i int) (int, error) {
+		filePath := fmt.Sprintf("%s-%d-%d.md", benchKnowledgeID, concurrency, i+1)
+		// Like an export, the header is separated from the body by a blank line.
+		content := []byte("# " + docs[i].Title + "\n\n" + docs[i].Content)
+		if name != "openwebui" {
+			doc := sinks.Document{
+				Path:        filePath,
+				Checksum:    utils.Checksum(content),
+				Content:     content,
+				Metadata:    map[string]interface{}{"collection": benchKnowledgeID, "title": docs[i].Title},
+				Name:        filePath,
+				ContentType: "text/markdown",
+			}
+			mu.Lock()
+			filePaths = append(filePaths, filePath)
+			mu.Unlock()
+			_, err := sink.Upload(ctx, benchKnowledgeID, []sinks.Document{doc})
+			return len(content), err
+		}
+		fileID, err := sinks.PostOpenWebUIFile(ctx, filePath, content, "text/markdown")
+		if err != nil {
+			return 0, err
+		}
+		mu.Lock()
+		fileIDs = append(fileIDs, fileID)
+		mu.Unlock()
+		return len(content), nil
+	})
+	if len(filePaths) > 0 {
+		if err := sink.Remove(ctx, benchKnowledgeID, filePaths); err != nil {
+			logging.FromContext(ctx).Error("Error removing benchmark documents", "error", err)
+		}
+	}
+	for _, fileID := range fileIDs {
+		if err := deleteOpenWebUIFile(ctx, fileID); err != nil {
+			logging.FromContext(ctx).Error("Error removing benchmark file", "file_id", fileID, "error", err)
+		}
+	}
+	return result
+}
+
+// writeBenchResults prints one table row per concurrency level and names the
+// level with the highest error-free throughput.
+func writeBenchResults(w io.Writer, title, unit string, results []benchResult) {
+	fmt.Fprintf(w, "\n%s\n", title)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "concurrency\t%s/s\tMB/s\tp50\tp95\tmax\terrors\t\n", unit)
+	best, bestRate := 0, 0.0
+	for _, r := range results {
+		rate, mb := r.perSecond()
+		fmt.Fprintf(tw, "%d\t%.1f\t%.2f\t%s\t%s\t%s\t%d\t\n", r.Concurrency, rate, mb,
+			r.percentile(0.5).Round(time.Millisecond), r.percentile(0.95).Round(time.Millisecond),
+			r.percentile(1).Round(time.Millisecond), r.Errors)
+		if r.Errors == 0 && rate > bestRate {
+			best, bestRate = r.Concurrency, rate
+		}
+	}
+	tw.Flush()
+	if best > 0 {
+		fmt.Fprintf(w, "Highest error-free throughput at concurrency %d (%.1f %s/s)\n", best, bestRate, unit)
+	}
+}
+
+// RunBenchmark implements "outline-rag-scraper bench": it measures export
+// throughput, pipeline stage latency and upload throughput against the
+// configured endpoints at several concurrency levels and writes a report to w.
+// Nothing is written to the documents directory, the knowledge collections or
+// the export records; uploaded benchmark files and targets are deleted again.
+func RunBenchmark(ctx context.Context, args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.SetOutput(w)
+	workspace := flags.String("workspace", "", "workspace to sample documents from (default workspace if empty)")
+	count := flags.Int("documents", 20, "number of documents per run")
+	levels := flags.String("concurrency", "1,2,4,8", "comma-separated concurrency levels to measure")
+	synthetic := flags.Bool("synthetic", false, "use generated documents instead of sampling Outline (skips the export benchmark)")
+	size := flags.Int("size", 8000, "approximate size in bytes of synthetic documents")
+	upload := flags.Bool("upload", true, "measure upload throughput (benchmark uploads are removed afterwards)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *count <= 0 {
+		return fmt.Errorf("RunBenchmark: -documents must be positive")
+	}
+	var concurrency []int
+	for _, level := range strings.Split(*levels, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(level))
+		if err != nil || n <= 0 {
+			return fmt.Errorf("RunBenchmark: invalid concurrency %q", level)
+		}
+		concurrency = append(concurrency, n)
+	}
+
+	var docs []benchDocument
+	if *synthetic {
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < *count; i++ {
+			docs = append(docs, syntheticDocument(rng, i, *size))
+		}
+		fmt.Fprintf(w, "Using %d synthetic documents of about %d bytes\n", len(docs), *size)
+	} else {
+		ws, ok := findWorkspace(*workspace)
+		if !ok {
+			return fmt.Errorf("RunBenchmark: unknown workspace %q", *workspace)
+		}
+		listed, err := sampleDocuments(ctx, ws, *count)
+		if err != nil {
+			return fmt.Errorf("RunBenchmark: sampling documents: %w", err)
+		}
+		if len(listed) == 0 {
+			return fmt.Errorf("RunBenchmark: workspace %q has no documents", ws.Name)
+		}
+		// Every worker writes only the entries of its own documents.
+		exported := make([]benchDocument, len(listed))
+		var results []benchResult
+		for _, n := range concurrency {
+			results = append(results, runConcurrently(len(listed), n, func(i int) (int, error) {
+				markdown, err := sources.For(ws).ExportDocument(ctx, listed[i].ID)
+				if err != nil {
+					return 0, err
+				}
+				exported[i] = benchDocument{Title: listed[i].Title, Content: markdown}
+				return len(markdown), nil
+			}))
+		}
+		for _, doc := range exported {
+			if doc.Title != "" {
+				docs = append(docs, doc)
+			}
+		}
+		fmt.Fprintf(w, "Sampled %d documents from workspace %q\n", len(listed), ws.Name)
+		writeBenchResults(w, "Export (documents.export)", "docs", results)
+	}
+
+	if len(docs) == 0 {
+		return fmt.Errorf("RunBenchmark: no document could be exported")
+	}
+	stages, order := benchStages(ctx, docs)
+	fmt.Fprintf(w, "\nPipeline stages (per document)\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "stage\tp50\tp95\tmax\ttotal\t\n")
+	for _, stage := range order {
+		r := stages[stage]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", stage, r.percentile(0.5), r.percentile(0.95), r.percentile(1), r.Elapsed)
+	}
+	tw.Flush()
+
+	if *upload {
+		for _, name := range config.ConfigInstance.Sinks {
+			writeBenchResults(w, fmt.Sprintf("Upload (%s)", name), "docs", benchSink(ctx, name, docs, concurrency))
+		}
+	}
+	return nil
+}
+
+// benchSink measures uploads to a sink at every concurrency level. Uploads
+// are not counted as syncs, and a target the sink created for the benchmark,
+// such as a Chroma collection, is deleted afterwards.
+func benchSink(ctx context.Context, name string, docs []benchDocument, concurrency []int) []benchResult {
+	ctx = sinks.WithoutSyncCounts(ctx)
+	if dropper, ok := sinks.Get(name).(sinks.Dropper); ok {
+		defer func() {
+			if err := dropper.Drop(ctx, benchKnowledgeID); err != nil {
+				logging.FromContext(ctx).Error("Error removing benchmark target", "knowledge_id", benchKnowledgeID, "error", err)
+			}
+		}()
+	}
+	var results []benchResult
+	for _, n := range concurrency {
+		results = append(results, benchUpload(ctx, name, docs, n))
+	}
+	return results
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// internalLink matches Markdown links to Outline documents ("/doc/<slug>-<urlId>"),
+// capturing the link text, the target and the urlId.
+var internalLink = regexp.MustCompile(`\[([^\]]*)\]\(((?:[^)\s]*/)?doc/[^)\s]*?-?([A-Za-z0-9]{10}))(?:[#?][^)\s]*)?\)`)
+
+// findBrokenLinks checks the internal links of every exported document of a
+// workspace against the urlIds documents.list returned, and records the links
+// to documents that were deleted or archived.
+func findBrokenLinks(ws config.Workspace, listedURLIDs map[string]bool) error {
+	records, err := models.ListWorkspaceDocuments(utils.DB, ws.Name)
+	if err != nil {
+		return err
+	}
+	links := []models.BrokenLink{}
+	for _, record := range records {
+		if record.ParentDocumentID != "" || record.IsGenerated() {
+			continue
+		}
+		body, err := documentBody(record.FilePath)
+		if err != nil {
+			continue
+		}
+		for _, m := range internalLink.FindAllStringSubmatch(body, -1) {
+			if listedURLIDs[m[3]] {
+				continue
+			}
+			links = append(links, models.BrokenLink{
+				Workspace:      ws.Name,
+				DocumentID:     record.DocumentID,
+				Title:          record.Title,
+				URL:            record.URL,
+				CollectionName: record.CollectionName,
+				LinkText:       m[1],
+				Target:         m[2],
+			})
+		}
+	}
+	return models.ReplaceBrokenLinks(utils.DB, ws.Name, links)
+}
+
+// BrokenLinksCollection groups the broken links of one collection.
+type BrokenLinksCollection struct {
+	Collection string              `json:"collection"`
+	Links      []models.BrokenLink `json:"links"`
+}
+
+// GetBrokenLinksHandler reports broken internal links per collection.
+// @Summary Report broken internal links
+// @Description Lists links pointing at deleted or archived Outline documents, grouped by collection, as detected during the last complete export.
+// @Tags reports
+// @Produce json
+// @Success 200 {array} BrokenLinksCollection
+// @Failure 500 {object} map[string]string "Failed to retrieve broken links"
+// @Router /reports/broken-links [get]
+func GetBrokenLinksHandler(w http.ResponseWriter, r *http.Request) {
+	links, err := models.ListBrokenLinks(utils.DB)
+	if err != nil {
+		http.Error(w, "Failed to retrieve broken links", http.StatusInternalServerError)
+		return
+	}
+	report := []BrokenLinksCollection{}
+	for _, link := range links {
+		if n := len(report); n == 0 || report[n-1].Collection != link.CollectionName {
+			report = append(report, BrokenLinksCollection{Collection: link.CollectionName})
+		}
+		report[len(report)-1].Links = append(report[len(report)-1].Links, link)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
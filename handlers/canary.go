@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+)
+
+// canarySample picks up to n Markdown files from every collection directory
+// (and from the top level), in a stable order.
+func canarySample(n int) ([]string, error) {
+	byDir := make(map[string][]string)
+	err := filepath.WalkDir(config.ConfigInstance.DocumentsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && isExportedFile(d.Name()) {
+			dir := filepath.Dir(path)
+			byDir[dir] = append(byDir[dir], path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var sample []string
+	for _, files := range byDir {
+		sort.Strings(files)
+		if len(files) > n {
+			files = files[:n]
+		}
+		sample = append(sample, files...)
+	}
+	sort.Strings(sample)
+	return sample, nil
+}
+
+// runCanary syncs a small sample into the canary knowledge collection and
+// checks that OpenWebUI accepted and indexed every file. Any failure means the
+// full run should not proceed.
+func runCanary(ctx context.Context, mappings map[string]models.CollectionMapping) error {
+	canaryID := config.ConfigInstance.CanaryKnowledgeCollectionID
+	sample, err := canarySample(config.ConfigInstance.CanarySampleSize)
+	if err != nil {
+		return fmt.Errorf("error selecting canary sample: %w", err)
+	}
+	sample = filterByClassification(ctx, canaryID, sample, mappings)
+	if len(sample) == 0 {
+		return nil
+	}
+	if err := clearKnowledgeCollection(ctx, canaryID); err != nil {
+		return fmt.Errorf("error clearing canary collection: %w", err)
+	}
+	for _, filePath := range sample {
+		if err := uploadToOpenWebUI(ctx, filePath, canaryID, uploadOptionsFor(filePath, mappings)); err != nil {
+			return fmt.Errorf("error uploading %s: %w", filePath, err)
+		}
+	}
+	// A file only stays attached to the knowledge collection once OpenWebUI
+	// processed and embedded it, so the listing doubles as an indexing check.
+	knowResp, err := fetchKnowledgeFiles(ctx, canaryID)
+	if err != nil {
+		return fmt.Errorf("error listing canary collection: %w", err)
+	}
+	if len(knowResp.Files) < len(sample) {
+		return fmt.Errorf("only %d of %d canary files were indexed", len(knowResp.Files), len(sample))
+	}
+	logging.FromContext(ctx).Info("Canary sync succeeded", "files", len(sample))
+	return nil
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// ChangesResponse is a page of the document change feed.
+type ChangesResponse struct {
+	Changes []models.DocumentChange `json:"changes"`
+	// NextCursor is passed as `since` to fetch the following page.
+	NextCursor string `json:"next_cursor" example:"42"`
+	// HasMore reports whether further changes are available right away.
+	HasMore bool `json:"has_more"`
+}
+
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+)
+
+// GetChangesHandler returns the document change feed.
+// @Summary Get document change feed
+// @Description Returns documents added, updated or removed since the given cursor, with content hashes and URLs, so external indexers can consume exports incrementally.
+// @Tags changes
+// @Produce json
+// @Param since query string false "Cursor returned as next_cursor by the previous call; omit to start from the beginning"
+// @Param limit query int false "Maximum number of changes to return (default 100, max 1000)"
+// @Success 200 {object} ChangesResponse
+// @Failure 400 {object} map[string]string "Invalid cursor or limit"
+// @Failure 500 {object} map[string]string "Failed to retrieve changes"
+// @Router /changes [get]
+func GetChangesHandler(w http.ResponseWriter, r *http.Request) {
+	var since uint64
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		if since, err = strconv.ParseUint(s, 10, 64); err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := defaultChangesLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		if n < maxChangesLimit {
+			limit = n
+		} else {
+			limit = maxChangesLimit
+		}
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	changes, err := models.ListDocumentChanges(utils.DB, uint(since), limit+1)
+	if err != nil {
+		http.Error(w, "Failed to retrieve changes", http.StatusInternalServerError)
+		return
+	}
+	resp := ChangesResponse{Changes: changes, NextCursor: strconv.FormatUint(since, 10)}
+	if len(changes) > limit {
+		resp.Changes = changes[:limit]
+		resp.HasMore = true
+	}
+	if len(resp.Changes) > 0 {
+		resp.NextCursor = strconv.FormatUint(uint64(resp.Changes[len(resp.Changes)-1].ID), 10)
+	}
+	if resp.Changes == nil {
+		resp.Changes = []models.DocumentChange{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// targetClassification returns the most sensitive classification a knowledge
+// collection may receive. A collection only accepts more than the configured
+// default if a mapping routing to it explicitly allows it.
+func targetClassification(knowledgeID string, mappings map[string]models.CollectionMapping) string {
+	limit := ""
+	for _, mapping := range mappings {
+		if mapping.MaxClassification == "" {
+			continue
+		}
+		for _, id := range mapping.KnowledgeIDs() {
+			if id == knowledgeID {
+				limit = models.MaxClassification(limit, mapping.MaxClassification)
+			}
+		}
+	}
+	if limit == "" {
+		return config.ConfigInstance.KnowledgeMaxClassification
+	}
+	return limit
+}
+
+// fileClassification returns the classification recorded when the file was
+// exported, falling back to the configured default.
+func fileClassification(filePath string) string {
+	record, err := models.GetExportedDocumentByPath(utils.DB, filePath)
+	if err != nil || !models.ValidClassification(record.Classification) {
+		return config.ConfigInstance.DefaultClassification
+	}
+	return record.Classification
+}
+
+// filterByClassification drops the files the knowledge collection is not
+// allowed to receive.
+func filterByClassification(ctx context.Context, knowledgeID string, filePaths []string, mappings map[string]models.CollectionMapping) []string {
+	limit := targetClassification(knowledgeID, mappings)
+	var allowed []string
+	for _, filePath := range filePaths {
+		if level := fileClassification(filePath); !models.ClassificationAllows(limit, level) {
+			logging.FromContext(ctx).Info("Skipping file classified above the knowledge collection's limit", "file", filePath, "classification", level, "knowledge_id", knowledgeID, "limit", limit)
+			continue
+		}
+		allowed = append(allowed, filePath)
+	}
+	return allowed
+}
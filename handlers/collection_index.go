@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// indexFileName is the per-collection table of contents written with
+// COLLECTION_INDEX.
+const indexFileName = "_index.md"
+
+// indexSummaryLength bounds the one-line summary of a document in an index.
+const indexSummaryLength = 160
+
+// writeCollectionIndexes writes a table of contents into every collection
+// directory, listing each document's title, link and a one-line summary taken
+// from its first paragraph, so the assistant can answer where something is
+// documented. Nested pages are indented under their parent. Indexes of
+// directories without documents are removed.
+func writeCollectionIndexes(ctx context.Context) error {
+	records, err := models.ListExportedDocuments(utils.DB)
+	if err != nil {
+		return err
+	}
+	byDir := make(map[string][]models.ExportedDocument)
+	previous := make(map[string]models.ExportedDocument)
+	for _, record := range records {
+		switch {
+		case strings.HasPrefix(record.DocumentID, "index:"):
+			previous[record.DocumentID] = record
+		// Text extracted from attachments is not a page of its own.
+		case record.ParentDocumentID == "" && !record.IsGenerated():
+			dir := filepath.Dir(record.FilePath)
+			// Top-level files belong to no collection.
+			if dir != filepath.Clean(config.ConfigInstance.DocumentsDir) {
+				byDir[dir] = append(byDir[dir], record)
+			}
+		}
+	}
+
+	written := make(map[string]bool)
+	for dir, docs := range byDir {
+		documentID := "index:" + filepath.Base(dir)
+		written[documentID] = true
+		collection := docs[0].CollectionName
+		if collection == "" {
+			collection = filepath.Base(dir)
+		}
+
+		classification := ""
+		var list strings.Builder
+		for _, entry := range indexTree(docs) {
+			doc := entry.doc
+			classification = models.MaxClassification(classification, doc.Classification)
+			line := doc.Title
+			if doc.URL != "" {
+				line = fmt.Sprintf("[%s](%s)", doc.Title, doc.URL)
+			}
+			if filepath.Ext(doc.FilePath) == ".md" || filepath.Ext(doc.FilePath) == ".txt" {
+				if body, err := documentBody(doc.FilePath); err == nil {
+					if summary := utils.Summary(body, indexSummaryLength); summary != "" {
+						line += ": " + summary
+					}
+				}
+			}
+			fmt.Fprintf(&list, "%s- %s\n", strings.Repeat("  ", entry.depth), line)
+		}
+		if classification == "" {
+			classification = config.ConfigInstance.DefaultClassification
+		}
+		title := collection + " table of contents"
+		var header utils.FrontMatter
+		header.Set("title", title)
+		header.Set("collection", collection)
+		header.Set("classification", classification)
+		content := fmt.Sprintf("%s\n# Documents in %s\n\n%s", header.String(), collection, list.String())
+		data := []byte(content)
+
+		filePath := filepath.Join(dir, indexFileName)
+		old, existed := previous[documentID]
+		if existed && old.Checksum == utils.Checksum(data) {
+			continue
+		}
+		if err := utils.WriteFileAtomic(filePath, data, 0644); err != nil {
+			return err
+		}
+		record := models.ExportedDocument{
+			DocumentID:     documentID,
+			Workspace:      docs[0].Workspace,
+			FilePath:       filePath,
+			Checksum:       utils.Checksum(data),
+			ExportedAt:     time.Now(),
+			Title:          title,
+			CollectionID:   docs[0].CollectionID,
+			CollectionName: collection,
+			Classification: classification,
+		}
+		if err := models.SaveExportedDocument(utils.DB, &record); err != nil {
+			return err
+		}
+		changeType := models.ChangeAdded
+		if existed {
+			changeType = models.ChangeUpdated
+		}
+		if err := models.RecordDocumentChange(utils.DB, changeType, &record); err != nil {
+			logging.FromContext(ctx).Error("Error recording change", "file", filePath, "error", err)
+		}
+	}
+
+	for documentID, record := range previous {
+		if written[documentID] {
+			continue
+		}
+		os.Remove(record.FilePath)
+		if err := models.RecordDocumentChange(utils.DB, models.ChangeRemoved, &record); err != nil {
+			logging.FromContext(ctx).Error("Error recording removal", "file", record.FilePath, "error", err)
+		}
+		if err := models.DeleteExportedDocument(utils.DB, documentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexEntry is a document in a table of contents with its nesting depth.
+type indexEntry struct {
+	doc   models.ExportedDocument
+	depth int
+}
+
+// indexTree orders docs by title with nested pages following their parent.
+// Pages whose parent is not among docs are listed at the top level.
+func indexTree(docs []models.ExportedDocument) []indexEntry {
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Title < docs[j].Title })
+	present := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		present[doc.DocumentID] = true
+	}
+	children := make(map[string][]models.ExportedDocument)
+	var roots []models.ExportedDocument
+	for _, doc := range docs {
+		if doc.ParentPageID != "" && present[doc.ParentPageID] {
+			children[doc.ParentPageID] = append(children[doc.ParentPageID], doc)
+		} else {
+			roots = append(roots, doc)
+		}
+	}
+	entries := make([]indexEntry, 0, len(docs))
+	visited := make(map[string]bool, len(docs))
+	var walk func(docs []models.ExportedDocument, depth int)
+	walk = func(docs []models.ExportedDocument, depth int) {
+		for _, doc := range docs {
+			if visited[doc.DocumentID] {
+				continue
+			}
+			visited[doc.DocumentID] = true
+			entries = append(entries, indexEntry{doc: doc, depth: depth})
+			walk(children[doc.DocumentID], depth+1)
+		}
+	}
+	walk(roots, 0)
+	// Pages in a parent cycle have no root; list them at the top level.
+	walk(docs, 0)
+	return entries
+}
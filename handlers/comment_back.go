@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/i18n"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sources"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// postOutlineComment adds a comment with a single paragraph of text to a
+// document.
+func postOutlineComment(ctx context.Context, ws config.Workspace, documentID, text string) error {
+	url := fmt.Sprintf("%s/comments.create", ws.APIBaseURL)
+	payloadBytes, err := json.Marshal(map[string]interface{}{
+		"documentId": documentID,
+		"data": map[string]interface{}{
+			"type": "doc",
+			"content": []interface{}{map[string]interface{}{
+				"type":    "paragraph",
+				"content": []interface{}{map[string]interface{}{"type": "text", "text": text}},
+			}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+ws.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := sources.DoWithRateLimit(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("postOutlineComment: unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// commentOnFailure tells the authors of a document in Outline once its
+// export failed COMMENT_BACK_FAILURES times in a row. Every reader sees the
+// comment, so it names the run instead of the error, which upstream responses
+// may fill with internal hostnames or tokens; the error goes to the log.
+func commentOnFailure(ctx context.Context, ws config.Workspace, documentID string, streak *models.FailureStreak) {
+	if !config.ConfigInstance.CommentBack || !ws.IsOutline() || streak.Failures < config.ConfigInstance.CommentBackFailures {
+		return
+	}
+	if feedback, err := models.GetDocumentFeedback(utils.DB, documentID); err == nil && feedback.CommentedReason == models.FeedbackFailing {
+		return
+	}
+	logging.FromContext(ctx).Warn("Export keeps failing, commenting in Outline", "document_id", documentID, "failures", streak.Failures, "error", streak.LastError)
+	lang := config.ConfigInstance.Language
+	text := i18n.Sprintf(lang,
+		"This document could not be synced to the knowledge base %d times in a row. The knowledge base keeps its previous version until a sync succeeds.",
+		streak.Failures)
+	if runID := logging.RunID(ctx); runID != "" {
+		text += " " + i18n.Sprintf(lang, "Administrators find the error in the logs of run %s.", runID)
+	}
+	commentOn(ctx, ws, documentID, models.FeedbackFailing, text)
+}
+
+// clearFailureComment forgets the failure comment on a document once it
+// exports again, so a later streak is commented on again.
+func clearFailureComment(ctx context.Context, ws config.Workspace, documentID string) {
+	if !config.ConfigInstance.CommentBack || !ws.IsOutline() {
+		return
+	}
+	if err := models.ClearCommentedReason(utils.DB, documentID, models.FeedbackFailing); err != nil {
+		logging.FromContext(ctx).Error("Error clearing feedback", "document_id", documentID, "error", err)
+	}
+}
+
+// commentOnExclusions tells the authors of documents newly excluded for one of
+// COMMENT_BACK_EXCLUSIONS why their document is not in the knowledge base.
+// Documents no longer excluded are forgotten, so a later exclusion is
+// commented on again.
+func commentOnExclusions(ctx context.Context, ws config.Workspace, excluded []models.ExcludedDocument) {
+	reasons := config.ConfigInstance.CommentBackExclusions
+	if !config.ConfigInstance.CommentBack || !ws.IsOutline() || len(reasons) == 0 {
+		return
+	}
+	current := make(map[string]string)
+	for _, doc := range excluded {
+		if slices.Contains(reasons, doc.Reason) {
+			current[doc.DocumentID] = doc.Reason
+		}
+	}
+	commented, err := models.ListCommentedFeedback(utils.DB, ws.Name, reasons)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error loading document feedback", "error", err)
+		return
+	}
+	for _, feedback := range commented {
+		if current[feedback.DocumentID] == feedback.CommentedReason {
+			delete(current, feedback.DocumentID)
+			continue
+		}
+		if _, still := current[feedback.DocumentID]; !still {
+			if err := models.SetCommentedReason(utils.DB, ws.Name, feedback.DocumentID, ""); err != nil {
+				logging.FromContext(ctx).Error("Error clearing feedback", "document_id", feedback.DocumentID, "error", err)
+			}
+		}
+	}
+	lang := config.ConfigInstance.Language
+	for documentID, reason := range current {
+		text := i18n.Sprintf(lang, "This document is not in the knowledge base. %s", i18n.Sprintf(lang, exclusionDetails[reason]))
+		commentOn(ctx, ws, documentID, reason, text)
+	}
+}
+
+// commentOn posts a comment about reason and records it.
+func commentOn(ctx context.Context, ws config.Workspace, documentID, reason, text string) {
+	if err := postOutlineComment(ctx, ws, documentID, text); err != nil {
+		logging.FromContext(ctx).Error("Error commenting on document", "document_id", documentID, "error", err)
+		return
+	}
+	if err := models.SetCommentedReason(utils.DB, ws.Name, documentID, reason); err != nil {
+		logging.FromContext(ctx).Error("Error recording comment on document", "document_id", documentID, "error", err)
+	}
+}
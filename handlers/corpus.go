@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+)
+
+// readOnlyFS exposes a directory through WebDAV without allowing any writes.
+// Hidden files (temp files, sync manifests) are not served or listed.
+type readOnlyFS struct {
+	dir webdav.Dir
+}
+
+func (fs readOnlyFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (fs readOnlyFS) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+
+func (fs readOnlyFS) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+func (fs readOnlyFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	if isHiddenPath(name) {
+		return nil, os.ErrNotExist
+	}
+	return fs.dir.Stat(ctx, name)
+}
+
+func (fs readOnlyFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+	if isHiddenPath(name) {
+		return nil, os.ErrNotExist
+	}
+	f, err := fs.dir.OpenFile(ctx, name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	return hiddenFilterFile{f}, nil
+}
+
+// Open implements http.FileSystem so the same view backs plain HTTP GETs.
+func (fs readOnlyFS) Open(name string) (http.File, error) {
+	return fs.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+}
+
+// hiddenFilterFile omits hidden entries from directory listings and rejects writes.
+type hiddenFilterFile struct {
+	webdav.File
+}
+
+func (f hiddenFilterFile) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(count)
+	visible := infos[:0]
+	for _, info := range infos {
+		if !strings.HasPrefix(info.Name(), ".") {
+			visible = append(visible, info)
+		}
+	}
+	return visible, err
+}
+
+func (f hiddenFilterFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+// isHiddenPath reports whether any segment of name starts with a dot.
+func isHiddenPath(name string) bool {
+	for _, segment := range strings.Split(path.Clean("/"+name), "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// corpusAuthorized checks the request against the configured corpus credentials.
+func corpusAuthorized(r *http.Request) bool {
+	cfg := config.ConfigInstance
+	if cfg.CorpusToken != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.CorpusToken)) == 1 {
+			return true
+		}
+	}
+	if cfg.CorpusUser != "" {
+		user, password, ok := r.BasicAuth()
+		if ok && subtle.ConstantTimeCompare([]byte(user), []byte(cfg.CorpusUser)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(cfg.CorpusPassword)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// NewCorpusHandler serves the published corpus read-only below prefix. GET and HEAD
+// are answered by a file server (with directory listings for browsers), while
+// OPTIONS and PROPFIND are handled by WebDAV so tools like Obsidian or rclone
+// can mount the corpus. Every request must authenticate with the corpus token
+// or basic auth credentials.
+func NewCorpusHandler(prefix string) http.Handler {
+	fs := readOnlyFS{dir: webdav.Dir(config.ConfigInstance.PublishedDir())}
+	dav := &webdav.Handler{
+		Prefix:     prefix,
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	}
+	files := http.StripPrefix(prefix, http.FileServer(fs))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !corpusAuthorized(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="corpus"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			files.ServeHTTP(w, r)
+		case http.MethodOptions, "PROPFIND":
+			dav.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+			http.Error(w, "Corpus is read-only", http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// captureBodyLimit bounds the part of a request or response body kept in a
+// debug bundle.
+const captureBodyLimit = 256 << 10
+
+// redacted replaces secrets in captured exchanges.
+const redacted = "[REDACTED]"
+
+// sensitiveHeaders are removed from captured requests and responses.
+var sensitiveHeaders = []string{"Authorization", "X-Api-Key", "Api-Key", "X-Chroma-Token", "Cookie", "Set-Cookie"}
+
+// sensitiveFields are redacted wherever they appear in JSON bodies, form
+// bodies and query strings.
+var sensitiveFields = map[string]bool{
+	"token": true, "access_token": true, "refresh_token": true, "client_secret": true,
+	"password": true, "api_key": true, "apikey": true, "secret": true, "code": true,
+}
+
+// capturedMessage is a sanitized request or response.
+type capturedMessage struct {
+	Method    string              `json:"method,omitempty"`
+	URL       string              `json:"url,omitempty"`
+	Status    string              `json:"status,omitempty"`
+	Headers   map[string][]string `json:"headers"`
+	Body      string              `json:"body,omitempty"`
+	Truncated bool                `json:"truncated,omitempty"`
+}
+
+// capturedExchange is one upstream call made during a debug capture.
+type capturedExchange struct {
+	StartedAt  time.Time        `json:"started_at"`
+	DurationMS int64            `json:"duration_ms"`
+	Request    capturedMessage  `json:"request"`
+	Response   *capturedMessage `json:"response,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// debugCapture records the upstream calls of one debug sync.
+type debugCapture struct {
+	mu        sync.Mutex
+	exchanges []capturedExchange
+	secrets   []string
+}
+
+// captureTransport records every exchange passing through it.
+type captureTransport struct {
+	next    http.RoundTripper
+	capture *debugCapture
+}
+
+func (t captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	exchange := capturedExchange{StartedAt: time.Now()}
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	exchange.Request = t.capture.sanitize(req.Header, req.Header.Get("Content-Type"), body)
+	exchange.Request.Method = req.Method
+	exchange.Request.URL = t.capture.sanitizeURL(req.URL)
+
+	resp, err := t.next.RoundTrip(req)
+	exchange.DurationMS = time.Since(exchange.StartedAt).Milliseconds()
+	if err != nil {
+		exchange.Error = t.capture.redactSecrets(err.Error())
+		t.capture.add(exchange)
+		return nil, err
+	}
+	respBody, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	message := t.capture.sanitize(resp.Header, resp.Header.Get("Content-Type"), respBody)
+	message.Status = resp.Status
+	exchange.Response = &message
+	if readErr != nil {
+		exchange.Error = readErr.Error()
+	}
+	t.capture.add(exchange)
+	return resp, readErr
+}
+
+func (c *debugCapture) add(exchange capturedExchange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.exchanges = append(c.exchanges, exchange)
+}
+
+// redactSecrets replaces every configured secret in text.
+func (c *debugCapture) redactSecrets(text string) string {
+	for _, secret := range c.secrets {
+		text = strings.ReplaceAll(text, secret, redacted)
+	}
+	return text
+}
+
+// sanitizeURL redacts sensitive query parameters and secrets in a URL.
+func (c *debugCapture) sanitizeURL(u *url.URL) string {
+	copied := *u
+	query := copied.Query()
+	for key := range query {
+		if sensitiveFields[strings.ToLower(key)] {
+			query.Set(key, redacted)
+		}
+	}
+	copied.RawQuery = query.Encode()
+	copied.User = nil
+	return c.redactSecrets(copied.String())
+}
+
+// sanitize copies headers and body without credentials. Bodies other than
+// text, JSON and form data are summarized by size.
+func (c *debugCapture) sanitize(header http.Header, contentType string, body []byte) capturedMessage {
+	message := capturedMessage{Headers: make(map[string][]string, len(header))}
+	for key, values := range header {
+		message.Headers[key] = values
+	}
+	for _, key := range sensitiveHeaders {
+		if _, ok := message.Headers[http.CanonicalHeaderKey(key)]; ok {
+			message.Headers[http.CanonicalHeaderKey(key)] = []string{redacted}
+		}
+	}
+	switch {
+	case len(body) == 0:
+	case strings.Contains(contentType, "json"):
+		var value interface{}
+		if json.Unmarshal(body, &value) == nil {
+			if data, err := json.Marshal(redactFields(value)); err == nil {
+				body = data
+			}
+		}
+		message.Body = string(body)
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for key := range form {
+				if sensitiveFields[strings.ToLower(key)] {
+					form.Set(key, redacted)
+				}
+			}
+			body = []byte(form.Encode())
+		}
+		message.Body = string(body)
+	case strings.HasPrefix(contentType, "text/"), strings.HasPrefix(contentType, "multipart/"):
+		message.Body = string(body)
+	default:
+		message.Body = fmt.Sprintf("[%d bytes of %s]", len(body), contentType)
+	}
+	if len(message.Body) > captureBodyLimit {
+		message.Body, message.Truncated = message.Body[:captureBodyLimit], true
+	}
+	message.Body = c.redactSecrets(message.Body)
+	return message
+}
+
+// redactFields replaces the values of sensitive fields in decoded JSON.
+func redactFields(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if sensitiveFields[strings.ToLower(key)] {
+				v[key] = redacted
+			} else {
+				v[key] = redactFields(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactFields(item)
+		}
+	}
+	return value
+}
+
+// configuredSecrets lists the credentials that must never appear in a bundle.
+func configuredSecrets() []string {
+	cfg := config.ConfigInstance
+	secrets := []string{
+		cfg.OpenWebUIAPIToken, cfg.AdminAPIKey, cfg.CorpusToken, cfg.CorpusPassword,
+		cfg.RemoteSyncPassword, cfg.OCRAPIToken, cfg.OutlineWebhookSecret, cfg.TokenEncryptionKey,
+		cfg.IntegritySigningKey, cfg.OutlineOAuthClientSecret, cfg.QdrantAPIKey, cfg.ChromaToken,
+		cfg.EmbeddingAPIKey, cfg.ElasticsearchAPIKey, cfg.ElasticsearchPassword, cfg.OIDCClientSecret, cfg.TicketToken,
+	}
+	for _, ws := range cfg.Workspaces {
+		secrets = append(secrets, ws.APIToken)
+	}
+	secrets = append(secrets, cfg.TokenEncryptionOldKeys...)
+	var nonEmpty []string
+	for _, secret := range secrets {
+		if secret != "" {
+			nonEmpty = append(nonEmpty, secret)
+		}
+	}
+	return nonEmpty
+}
+
+// captureDocumentSync runs a single-document sync while recording every
+// upstream call and log line, and returns the bundle as a zip archive. The
+// sync gets its own HTTP client and logger, so work running alongside it is
+// neither slowed down nor recorded.
+func captureDocumentSync(ctx context.Context, params documentSyncParams) ([]byte, error) {
+	capture := &debugCapture{secrets: configuredSecrets()}
+	next := utils.HTTPClient(ctx).Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client := &http.Client{Transport: captureTransport{next: next, capture: capture}}
+	var logs bytes.Buffer
+	ctx = logging.WithLogger(utils.WithHTTPClient(ctx, client), logging.Tee(&logs))
+
+	started := time.Now()
+	syncErr := runDocumentSync(ctx, params)
+	finished := time.Now()
+
+	ws, _ := findWorkspace(params.Workspace)
+	manifest := map[string]interface{}{
+		"document_id":       params.DocumentID,
+		"workspace":         params.Workspace,
+		"started_at":        started,
+		"finished_at":       finished,
+		"outline_version":   outlineCapabilitiesFor(ws).Version,
+		"openwebui_version": openWebUI.Version,
+		"sinks":             config.ConfigInstance.Sinks,
+		"export_format":     config.ConfigInstance.ExportFormat,
+		"chunk_strategy":    config.ConfigInstance.ChunkStrategy,
+		"exchanges":         len(capture.exchanges),
+	}
+	if syncErr != nil {
+		manifest["error"] = capture.redactSecrets(syncErr.Error())
+	}
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	write := func(name string, data []byte) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := write("manifest.json", data); err != nil {
+		return nil, err
+	}
+	if err := write("log.txt", []byte(capture.redactSecrets(logs.String()))); err != nil {
+		return nil, err
+	}
+	for i, exchange := range capture.exchanges {
+		data, err := json.MarshalIndent(exchange, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := write(fmt.Sprintf("exchanges/%03d-%s.json", i+1, strings.ToLower(exchange.Request.Method)), data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return archive.Bytes(), nil
+}
+
+// DebugDocumentSyncHandler syncs one document and returns a debug bundle.
+// @Summary Sync a document in debug mode
+// @Description Runs a single-document sync while capturing every upstream request and response (Outline, OpenWebUI, vector stores, embedding providers) and the log output, and returns them as a zip bundle to attach to bug reports. Credentials are removed from headers, bodies and URLs; binary bodies are replaced by their size and text bodies are cut at 256 KiB. Only one capture runs at a time. Requires ADMIN_API_KEY.
+// @Tags sync
+// @Produce application/zip
+// @Param id path string true "Outline document ID"
+// @Param workspace query string false "Name of the workspace the document belongs to (default workspace if omitted)"
+// @Success 200 {file} file "Debug bundle"
+// @Failure 400 {object} map[string]string "Unknown workspace"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Failed to build the bundle"
+// @Router /documents/{id}/debug-sync [post]
+func DebugDocumentSyncHandler(w http.ResponseWriter, r *http.Request) {
+	params := documentSyncParams{
+		Workspace:  r.URL.Query().Get("workspace"),
+		DocumentID: mux.Vars(r)["id"],
+	}
+	if _, ok := findWorkspace(params.Workspace); !ok {
+		http.Error(w, "Unknown workspace", http.StatusBadRequest)
+		return
+	}
+	setAuditTarget(r, "document:"+params.DocumentID)
+	bundle, err := captureDocumentSync(context.WithoutCancel(r.Context()), params)
+	if err != nil {
+		http.Error(w, "Failed to build the bundle", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="debug-%s-%s.zip"`,
+		strings.Map(func(r rune) rune {
+			if r == '"' || r == '/' || r == '\\' {
+				return '_'
+			}
+			return r
+		}, params.DocumentID), time.Now().UTC().Format("20060102T150405Z")))
+	w.Write(bundle)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// diagramBlock matches fenced Mermaid and PlantUML code blocks, capturing the
+// language and the diagram source.
+var diagramBlock = regexp.MustCompile("(?ms)^```[ \\t]*(mermaid|plantuml|puml)[ \\t]*\\n(.*?)^```[ \\t]*$")
+
+// diagramPrompt instructs the LLM how to describe a diagram.
+const diagramPrompt = "Describe the following %s diagram in plain English for a knowledge base. " +
+	"Name every component and explain how they are connected, in the order a reader would follow them. " +
+	"Answer with the description only.\n\n%s"
+
+// describeDiagrams replaces Mermaid and PlantUML blocks with a description
+// generated by the configured LLM, or adds the description below the block
+// when DIAGRAM_DESCRIPTIONS is "append". The source is passed through redact
+// before it is sent. Blocks that cannot be described are left untouched.
+func describeDiagrams(ctx context.Context, documentID, markdown string, redact func(string) (string, error)) string {
+	mode := config.ConfigInstance.DiagramDescriptions
+	return diagramBlock.ReplaceAllStringFunc(markdown, func(block string) string {
+		m := diagramBlock.FindStringSubmatch(block)
+		language := m[1]
+		source, err := redact(m[2])
+		if err != nil {
+			logging.FromContext(ctx).Error("Error transforming diagram", "language", language, "document_id", documentID, "error", err)
+			return block
+		}
+		if strings.TrimSpace(source) == "" {
+			return block
+		}
+		description, err := diagramDescription(ctx, language, source)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error describing diagram", "language", language, "document_id", documentID, "error", err)
+			return block
+		}
+		text := fmt.Sprintf("Diagram description: %s", description)
+		if mode == "append" {
+			return block + "\n\n" + text
+		}
+		return text
+	})
+}
+
+// diagramDescription returns the description of a diagram, asking the LLM only
+// if no cached description exists for the same source.
+func diagramDescription(ctx context.Context, language, source string) (string, error) {
+	checksum := utils.Checksum([]byte(language + "\n" + source))
+	if cached, err := models.GetDiagramDescription(utils.DB, checksum); err == nil {
+		return cached.Description, nil
+	}
+	description, err := completeChat(ctx, config.ConfigInstance.DiagramModel, fmt.Sprintf(diagramPrompt, language, source))
+	if err != nil {
+		return "", err
+	}
+	if err := models.SaveDiagramDescription(utils.DB, checksum, description); err != nil {
+		logging.FromContext(ctx).Error("Error caching diagram description", "error", err)
+	}
+	return description, nil
+}
+
+// completeChat sends a single-turn prompt to a model through OpenWebUI's
+// OpenAI-compatible chat completions endpoint and returns the answer.
+func completeChat(ctx context.Context, model, prompt string) (string, error) {
+	payload := map[string]interface{}{
+		"model": model,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+		"stream": false,
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", openWebUIBaseURL()+"/api/chat/completions", bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := utils.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("completeChat: unexpected status: %s, body: %s", resp.Status, string(respBody))
+	}
+	var chatResp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return "", err
+	}
+	if len(chatResp.Choices) == 0 {
+		return "", fmt.Errorf("completeChat: no choices in response")
+	}
+	return strings.TrimSpace(chatResp.Choices[0].Message.Content), nil
+}
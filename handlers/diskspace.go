@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// mebibytes formats a byte count for error messages.
+func mebibytes(n int64) string {
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+}
+
+// checkDiskSpace estimates the space a full export needs and fails when the
+// documents volume cannot hold it, so the export stops before writing anything
+// instead of running out of space halfway. The estimate is the size of the
+// files on disk plus, for every listed document that was never exported, their
+// average size, with DISK_HEADROOM_PERCENT on top. Files the export overwrites
+// count as available unless corpus snapshots (CORPUS_DIR) keep hard links to
+// them. Without previous runs there is nothing to estimate from and the check
+// passes.
+func checkDiskSpace(ctx context.Context) error {
+	records, err := models.ListExportedDocuments(utils.DB)
+	if err != nil {
+		return fmt.Errorf("error loading export records: %w", err)
+	}
+	var existing int64
+	sized := 0
+	known := make(map[string]bool, len(records))
+	for _, record := range records {
+		known[record.DocumentID] = true
+		if info, err := os.Stat(record.FilePath); err == nil {
+			existing += info.Size()
+			sized++
+		}
+	}
+	if sized == 0 {
+		return nil
+	}
+	added := 0
+	for _, ws := range config.ConfigInstance.Workspaces {
+		err := listDocumentsPass(ctx, ws, func(doc models.Document) {
+			if !known[doc.ID] {
+				known[doc.ID] = true
+				added++
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("error listing documents: %w", err)
+		}
+	}
+	average := existing / int64(sized)
+	needed := (existing + average*int64(added)) * int64(100+config.ConfigInstance.DiskHeadroomPercent) / 100
+	// Snapshots keep the previous version of every overwritten file.
+	if config.ConfigInstance.CorpusDir == "" {
+		needed -= existing
+	}
+	dir := config.ConfigInstance.DocumentsDir
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	free, err := utils.FreeSpace(dir)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Error checking free space, skipping the disk space check", "dir", dir, "error", err)
+		return nil
+	}
+	if free < needed {
+		return fmt.Errorf("not enough disk space for a full export: %s free on %s, about %s needed for %d files and %d new documents of %s on average",
+			mebibytes(free), dir, mebibytes(needed), sized, added, mebibytes(average))
+	}
+	return nil
+}
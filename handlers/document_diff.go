@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/textdiff"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// diffContextLines is how many unchanged lines surround every change.
+const diffContextLines = 3
+
+// recordSourceDiff stores the source Markdown of an export and, when it
+// differs from the previous export, the diff between them.
+func recordSourceDiff(ctx context.Context, documentID, markdown string) {
+	previous, err := models.GetDocumentDiff(utils.DB, documentID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logging.FromContext(ctx).Error("Error loading previous content", "document_id", documentID, "error", err)
+		return
+	}
+	if previous != nil && previous.Content == markdown {
+		return
+	}
+	entry := models.DocumentDiff{DocumentID: documentID, Content: markdown, ChangedAt: time.Now()}
+	if previous != nil {
+		entry.Diff = textdiff.Unified("a/"+documentID, "b/"+documentID, previous.Content, markdown, diffContextLines)
+		entry.PreviousChangedAt = &previous.ChangedAt
+	}
+	if err := models.SaveDocumentDiff(utils.DB, &entry); err != nil {
+		logging.FromContext(ctx).Error("Error storing diff", "document_id", documentID, "error", err)
+	}
+}
+
+// GetDocumentDiffHandler returns how a document last changed.
+// @Summary Get the diff of a document
+// @Description Returns the unified diff between the source content of the document's previous export and its latest one, taken before the export pipeline (headers, link rewriting, transforms) runs. The diff is empty until the document changes after its first export. With format=text the diff is returned as text/x-diff.
+// @Tags documents
+// @Produce json
+// @Produce text/x-diff
+// @Param id path string true "Outline document ID"
+// @Param format query string false "json (default) or text"
+// @Success 200 {object} models.DocumentDiff
+// @Failure 404 {object} map[string]string "Document not exported"
+// @Failure 500 {object} map[string]string "Failed to retrieve diff"
+// @Router /documents/{id}/diff [get]
+func GetDocumentDiffHandler(w http.ResponseWriter, r *http.Request) {
+	diff, err := models.GetDocumentDiff(utils.DB, mux.Vars(r)["id"])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Document not exported", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve diff", http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+		w.Write([]byte(diff.Diff))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// GetDocumentsHandler lists the exported documents and their metadata.
+// @Summary Get exported documents
+// @Description Lists every exported document with its file path, checksum, and Outline metadata such as icon and collection color.
+// @Tags documents
+// @Produce json
+// @Success 200 {array} models.ExportedDocument
+// @Failure 500 {object} map[string]string "Failed to retrieve documents"
+// @Router /documents [get]
+func GetDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	records, err := models.ListExportedDocuments(utils.DB)
+	if err != nil {
+		http.Error(w, "Failed to retrieve documents", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
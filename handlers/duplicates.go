@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// DuplicateDocument identifies one side of a near-duplicate pair.
+type DuplicateDocument struct {
+	DocumentID string `json:"document_id"`
+	Title      string `json:"title"`
+	URL        string `json:"url"`
+	Collection string `json:"collection"`
+}
+
+// DuplicatePair is two documents with largely the same content.
+type DuplicatePair struct {
+	A DuplicateDocument `json:"a"`
+	B DuplicateDocument `json:"b"`
+	// Similarity is the estimated Jaccard similarity of their word shingles (0-1).
+	Similarity float64 `json:"similarity"`
+}
+
+// DuplicatesReport lists near-duplicate documents, most similar first.
+type DuplicatesReport struct {
+	Threshold float64         `json:"threshold"`
+	Documents int             `json:"documents"`
+	Pairs     []DuplicatePair `json:"pairs"`
+}
+
+// documentBody returns the exported content of a file without its header.
+func documentBody(filePath string) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	if _, body, found := strings.Cut(string(data), "\n\n"); found {
+		return body, nil
+	}
+	return string(data), nil
+}
+
+// GetDuplicatesHandler reports near-duplicate documents.
+// @Summary Report near-duplicate documents
+// @Description Compares the exported documents using MinHash over word shingles and lists pairs whose estimated similarity reaches the threshold. Duplicated but slightly divergent documents make the assistant give contradictory answers.
+// @Tags reports
+// @Produce json
+// @Param threshold query number false "Minimum similarity between 0 and 1 (default 0.8)"
+// @Success 200 {object} DuplicatesReport
+// @Failure 400 {object} map[string]string "Invalid threshold"
+// @Failure 500 {object} map[string]string "Failed to compute report"
+// @Router /reports/duplicates [get]
+func GetDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	threshold := 0.8
+	if t := r.URL.Query().Get("threshold"); t != "" {
+		v, err := strconv.ParseFloat(t, 64)
+		if err != nil || v <= 0 || v > 1 {
+			http.Error(w, "Invalid threshold", http.StatusBadRequest)
+			return
+		}
+		threshold = v
+	}
+
+	records, err := models.ListExportedDocuments(utils.DB)
+	if err != nil {
+		http.Error(w, "Failed to compute report", http.StatusInternalServerError)
+		return
+	}
+	var docs []DuplicateDocument
+	var signatures [][]uint64
+	for _, record := range records {
+		// Attachment companions, glossaries and overviews naturally overlap their sources.
+		if record.ParentDocumentID != "" || record.IsGenerated() {
+			continue
+		}
+		body, err := documentBody(record.FilePath)
+		if err != nil || strings.TrimSpace(body) == "" {
+			continue
+		}
+		docs = append(docs, DuplicateDocument{
+			DocumentID: record.DocumentID,
+			Title:      record.Title,
+			URL:        record.URL,
+			Collection: record.CollectionName,
+		})
+		signatures = append(signatures, utils.MinHash(body))
+	}
+
+	report := DuplicatesReport{Threshold: threshold, Documents: len(docs), Pairs: []DuplicatePair{}}
+	for _, pair := range utils.MinHashCandidates(signatures) {
+		similarity := utils.MinHashSimilarity(signatures[pair[0]], signatures[pair[1]])
+		if similarity < threshold {
+			continue
+		}
+		report.Pairs = append(report.Pairs, DuplicatePair{
+			A:          docs[pair[0]],
+			B:          docs[pair[1]],
+			Similarity: math.Round(similarity*100) / 100,
+		})
+	}
+	sort.Slice(report.Pairs, func(i, j int) bool {
+		if report.Pairs[i].Similarity != report.Pairs[j].Similarity {
+			return report.Pairs[i].Similarity > report.Pairs[j].Similarity
+		}
+		return report.Pairs[i].A.Title+report.Pairs[i].B.Title < report.Pairs[j].A.Title+report.Pairs[j].B.Title
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
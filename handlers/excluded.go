@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sources"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// exclusionDetails tell document owners how to get an excluded document into
+// the knowledge base.
+var exclusionDetails = map[string]string{
+	"archived": "The document is archived in Outline. Restore it to include it.",
+	"draft":    "The document is an unpublished draft. Publish it in Outline to include it.",
+	"template": "The document is a template. Templates are not included.",
+	"filtered": "The document does not match the export filter. Ask an administrator which collections and tags are included.",
+}
+
+// excludedDocument describes a listed document that exportExclusion keeps out
+// of the knowledge base.
+func excludedDocument(ctx context.Context, ws config.Workspace, doc models.Document, reason string) models.ExcludedDocument {
+	excluded := models.ExcludedDocument{
+		Workspace:  ws.Name,
+		DocumentID: doc.ID,
+		Title:      doc.Title,
+		URL:        sources.For(ws).DocumentURL(doc),
+		Author:     doc.CreatedBy.Name,
+		Reason:     reason,
+		Detail:     exclusionDetails[reason],
+	}
+	if doc.CollectionId != "" {
+		if collection, err := sources.Collection(ctx, sources.For(ws), doc.CollectionId); err == nil {
+			excluded.CollectionName = collection.Name
+		}
+	}
+	return excluded
+}
+
+// GetExcludedDocumentsHandler lists the documents kept out of the knowledge base.
+// @Summary Report excluded documents
+// @Description Lists Outline documents that are not in the knowledge base because they are archived, drafts or templates or do not match EXPORT_FILTER, with the reason and how to fix it, as detected during the last complete export.
+// @Tags reports
+// @Produce json
+// @Param collection query string false "Only documents of this Outline collection"
+// @Param reason query string false "Only documents excluded for this reason (archived, draft, template or filtered)"
+// @Success 200 {array} models.ExcludedDocument
+// @Failure 500 {object} map[string]string "Failed to retrieve excluded documents"
+// @Router /reports/excluded [get]
+func GetExcludedDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	docs, err := models.ListExcludedDocuments(utils.DB, r.URL.Query().Get("collection"), r.URL.Query().Get("reason"))
+	if err != nil {
+		http.Error(w, "Failed to retrieve excluded documents", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(docs)
+}
@@ -1,248 +1,817 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/mikeshootzz/outline-rag-scraper/adaptive"
 	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/expr"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
 	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/remotesync"
+	"github.com/mikeshootzz/outline-rag-scraper/site"
+	"github.com/mikeshootzz/outline-rag-scraper/snapshot"
+	"github.com/mikeshootzz/outline-rag-scraper/sources"
+	"github.com/mikeshootzz/outline-rag-scraper/timings"
+	"github.com/mikeshootzz/outline-rag-scraper/transform"
 	"github.com/mikeshootzz/outline-rag-scraper/utils"
 )
 
-// Global cache for collection names (to avoid repeated API calls)
-var (
-	collectionCache   = make(map[string]string)
-	collectionCacheMu sync.Mutex
-)
+// exportAndSaveDocument exports a single document and saves it in format
+// (empty for EXPORT_FORMAT), grouping it into a subdirectory based on its
+// collection. Pinned documents keep their current export.
+func exportAndSaveDocument(ctx context.Context, ws config.Workspace, doc models.Document, format string) error {
+	format = resolveExportFormat(format)
+	if reason := exportExclusion(ctx, ws, doc); reason != "" {
+		logging.FromContext(ctx).Info("Skipping document", "reason", reason, "document_id", doc.ID)
+		return nil
+	}
+	pinned, err := models.IsDocumentPinned(utils.DB, doc.ID)
+	if err != nil {
+		return err
+	}
+	if pinned {
+		logging.FromContext(ctx).Info("Document is pinned, keeping its current export", "document_id", doc.ID)
+		return nil
+	}
+	src := sources.For(ws)
+	docURL := src.DocumentURL(doc)
+	// Create a file-safe title for the document.
+	safeTitle := utils.SanitizeFilename(doc.Title)
+	if ws.Name != "" {
+		// Prefix files with the workspace so documents from several wikis can
+		// share a collection directory without colliding.
+		safeTitle = utils.SanitizeFilename(ws.Name) + "__" + safeTitle
+	}
 
-// doRequestWithRateLimit sends an HTTP request and respects rate limiting.
-// If a 429 status code is returned, it reads the "Retry-After" header (which
-// specifies the number of milliseconds to wait) before retrying.
-func doRequestWithRateLimit(req *http.Request) (*http.Response, error) {
-	for {
-		resp, err := http.DefaultClient.Do(req)
+	// Export the document from its source.
+	markdown, err := src.ExportDocument(ctx, doc.ID)
+	if err != nil {
+		return err
+	}
+	defer timings.Since(ctx, timings.Pipeline, time.Now())
+
+	// Determine the directory path based on the document's collection.
+	var dirPath string
+	var collection models.Collection
+	if doc.CollectionId != "" {
+		collection, err = sources.Collection(ctx, src, doc.CollectionId)
 		if err != nil {
-			return nil, err
+			logging.FromContext(ctx).Error("Error fetching collection name", "document_id", doc.ID, "error", err)
+			// If the collection lookup fails, use the base documents directory.
+			dirPath = config.ConfigInstance.DocumentsDir
+		} else {
+			// Sanitize the collection name to be safe for a directory name.
+			safeCollectionName := utils.SanitizeFilename(collection.Name)
+			dirPath = filepath.Join(config.ConfigInstance.DocumentsDir, safeCollectionName)
+		}
+	} else {
+		// If no collection ID is provided, fall back to the base directory.
+		dirPath = config.ConfigInstance.DocumentsDir
+	}
+
+	// Structured metadata lets embedders filter and cite; the visual cues
+	// from Outline let citations show them.
+	var header utils.FrontMatter
+	header.Set("title", doc.Title)
+	header.Set("outline_id", doc.ID)
+	header.Set("collection", collection.Name)
+	header.Set("author", doc.CreatedBy.Name)
+	header.Set("created_at", doc.CreatedAt)
+	header.Set("updated_at", doc.UpdatedAt)
+	tags := utils.Hashtags(markdown)
+	header.Set("tags", tags)
+	header.Set("url", docURL)
+	header.Set("workspace", ws.Name)
+	header.Set("icon", doc.DisplayIcon())
+	// A #confidential tag on the document or in the collection description
+	// raises the label; routing rules enforce it on upload.
+	classification := models.MaxClassification(
+		models.ClassificationFromText(markdown),
+		models.ClassificationFromText(collection.Description),
+	)
+	if classification == "" {
+		classification = config.ConfigInstance.DefaultClassification
+	}
+	header.Set("classification", classification)
+	filePath := filepath.Join(dirPath, safeTitle+exportExtensions[format])
+	// A large change waits for a reviewer; the previous export and its
+	// attachments stay in place.
+	if holdForReview(ctx, doc.ID, doc.Title, collection.Name, filePath, markdown) {
+		return nil
+	}
+	// Text sent to the LLM or OCR and written as attachments goes through
+	// the collection's transforms first, so their redactions apply to it as
+	// they do to the written file.
+	redact := func(text string) (string, error) {
+		if len(config.ConfigInstance.TransformCommands)+len(config.ConfigInstance.TransformModules) == 0 {
+			return text, nil
 		}
-		// If we are not rate-limited, return the response.
-		if resp.StatusCode != http.StatusTooManyRequests {
-			return resp, nil
+		return applyTransforms(ws, doc, collection, dirPath, text)
+	}
+	redacted, err := redact(markdown)
+	if err != nil {
+		return err
+	}
+	// Questions the document answers help retrieval match terse reference text.
+	var questions []string
+	if config.ConfigInstance.QuestionGeneration != "" {
+		if models.ClassificationAllows(config.ConfigInstance.KnowledgeMaxClassification, classification) {
+			questions = generateQuestions(ctx, doc.ID, doc.Title, redacted)
+			header.Set("questions", questions)
+		} else {
+			logging.FromContext(ctx).Info("Skipping question generation", "document_id", doc.ID, "classification", classification)
 		}
+	}
+	body := markdown
+	// Make architecture knowledge encoded in diagrams retrievable as text.
+	if config.ConfigInstance.DiagramDescriptions != "" {
+		body = describeDiagrams(ctx, doc.ID, body, redact)
+	}
+	// Replace attachment links OpenWebUI cannot resolve with local copies.
+	if config.ConfigInstance.AttachmentLinks != "" {
+		body = localizeAttachments(ctx, ws, filePath, body)
+	}
+	// Make links to other documents resolvable from citations.
+	if config.ConfigInstance.InternalLinks != "" {
+		body = rewriteInternalLinks(ws, filePath, body, func(urlID string) string {
+			if target, err := models.FindExportedDocumentByURLID(utils.DB, ws.Name, urlID); err == nil {
+				return target.FilePath
+			}
+			return ""
+		})
+	}
+	if config.ConfigInstance.QuestionGeneration == "append" && len(questions) > 0 {
+		body = strings.TrimRight(body, "\n") + questionsSection(questions)
+	}
+	content := fmt.Sprintf("%s\n%s", header.String(), body)
+	// Screenshots often hold runbook knowledge; append their text as metadata.
+	if config.ConfigInstance.OCRMethod != "" {
+		content += recognizeImages(ctx, ws, doc.ID, redacted)
+	}
+	if len(config.ConfigInstance.TransformCommands)+len(config.ConfigInstance.TransformModules) > 0 {
+		if content, err = applyTransforms(ws, doc, collection, dirPath, content); err != nil {
+			return err
+		}
+	}
+	if content, err = renderExport(format, header, content); err != nil {
+		return err
+	}
 
-		// Otherwise, read the Retry-After header.
-		retryAfterStr := resp.Header.Get("Retry-After")
-		var waitDuration time.Duration
-		if retryAfterStr != "" {
-			ms, err := strconv.Atoi(retryAfterStr)
-			if err != nil {
-				waitDuration = 1 * time.Second
-			} else {
-				waitDuration = time.Duration(ms) * time.Millisecond
+	// Ensure the directory exists.
+	if err = os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return err
+	}
+	// Write the file atomically so a crash mid-export never leaves a
+	// truncated file behind for the uploader.
+	if err = utils.WriteFileAtomic(filePath, []byte(content), 0644); err != nil {
+		return err
+	}
+	// Record the checksum so the uploader can detect corruption before upload.
+	record := models.ExportedDocument{
+		DocumentID:        doc.ID,
+		Workspace:         ws.Name,
+		FilePath:          filePath,
+		Checksum:          utils.Checksum([]byte(content)),
+		DocumentUpdatedAt: doc.UpdatedAt,
+		Revision:          doc.Revision,
+		ExportedAt:        time.Now(),
+		Title:             doc.Title,
+		URL:               docURL,
+		URLID:             doc.URLId,
+		Icon:              doc.DisplayIcon(),
+		Color:             doc.Color,
+		CollectionID:      doc.CollectionId,
+		ParentPageID:      doc.ParentDocumentId,
+		CollectionName:    collection.Name,
+		CollectionIcon:    collection.Icon,
+		CollectionColor:   collection.Color,
+		Classification:    classification,
+		Tags:              strings.Join(tags, ","),
+		Questions:         strings.Join(questions, "\n"),
+	}
+	changeType := models.ChangeAdded
+	if previous, err := models.GetExportedDocument(utils.DB, doc.ID); err == nil {
+		changeType = models.ChangeUpdated
+		if previous.Checksum == record.Checksum && previous.FilePath == filePath {
+			changeType = ""
+		}
+		// A new title or format moves the file; drop the old one.
+		if previous.FilePath != filePath {
+			if err := os.Remove(previous.FilePath); err != nil && !os.IsNotExist(err) {
+				logging.FromContext(ctx).Error("Error removing previous export", "file", previous.FilePath, "error", err)
 			}
-		} else {
-			waitDuration = 1 * time.Second
+			if err := models.RecordDocumentChange(utils.DB, models.ChangeRemoved, previous); err != nil {
+				logging.FromContext(ctx).Error("Error recording removal", "file", previous.FilePath, "error", err)
+			}
+			changeType = models.ChangeAdded
 		}
-		log.Printf("Rate limited: waiting for %v before retrying...", waitDuration)
-		resp.Body.Close() // Make sure to close the response body before sleeping.
-		time.Sleep(waitDuration)
 	}
+	if err = models.SaveExportedDocument(utils.DB, &record); err != nil {
+		return fmt.Errorf("exportAndSaveDocument: failed to record checksum: %w", err)
+	}
+	// Keep what changed at the source for GET /documents/{id}/diff.
+	recordSourceDiff(ctx, doc.ID, markdown)
+	// Feed the change log consumed via GET /changes.
+	if changeType != "" {
+		if err = models.RecordDocumentChange(utils.DB, changeType, &record); err != nil {
+			logging.FromContext(ctx).Error("Error recording change", "document_id", doc.ID, "error", err)
+		}
+	}
+	if config.ConfigInstance.ExtractAttachments {
+		exportAttachments(ctx, ws, &record, redacted, redact)
+	}
+	logging.FromContext(ctx).Info("Downloaded and saved", "document_id", doc.ID, "workspace", ws.Name, "file", filePath, "change", changeType)
+	return nil
 }
 
-// fetchDocuments retrieves a page of documents from the docs API.
-func fetchDocuments(offset int) (*models.DocumentsResponse, error) {
-	url := fmt.Sprintf("%s/documents.list", config.ConfigInstance.APIBaseURL)
-	payload := map[string]interface{}{
-		"offset":    offset,
-		"limit":     config.ConfigInstance.Limit,
-		"sort":      "updatedAt",
-		"direction": "DESC",
+// exportExclusion returns why a document is kept out of the knowledge base
+// ("archived", "draft", "template" or "filtered"), or "" if it is exported.
+// Which kinds are skipped is set by EXPORT_SKIP_ARCHIVED, EXPORT_SKIP_DRAFTS,
+// EXPORT_SKIP_TEMPLATES and EXPORT_FILTER.
+func exportExclusion(ctx context.Context, ws config.Workspace, doc models.Document) string {
+	switch {
+	case doc.ArchivedAt != nil && config.ConfigInstance.ExportSkipArchived:
+		return "archived"
+	case doc.PublishedAt == nil && config.ConfigInstance.ExportSkipDrafts:
+		return "draft"
+	case doc.Template && config.ConfigInstance.ExportSkipTemplates:
+		return "template"
 	}
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return nil, err
+	if filter := config.ConfigInstance.ExportFilter; filter != nil {
+		keep, err := filter.Eval(documentVars(ctx, ws, doc))
+		if err != nil {
+			// A broken rule must not silently empty the knowledge base.
+			logging.FromContext(ctx).Error("Error evaluating EXPORT_FILTER", "document_id", doc.ID, "error", err)
+			return ""
+		}
+		if !keep {
+			return "filtered"
+		}
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		return nil, err
+	return ""
+}
+
+// documentVars exposes a listed document to EXPORT_FILTER as doc.id,
+// doc.title, doc.collection, doc.workspace, doc.author, doc.tags,
+// doc.archived, doc.draft and doc.template.
+func documentVars(ctx context.Context, ws config.Workspace, doc models.Document) expr.Vars {
+	collection := ""
+	if doc.CollectionId != "" {
+		if c, err := sources.Collection(ctx, sources.For(ws), doc.CollectionId); err == nil {
+			collection = c.Name
+		}
 	}
-	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.APIToken)
-	req.Header.Set("Content-Type", "application/json")
+	return expr.Vars{"doc": map[string]interface{}{
+		"id":         doc.ID,
+		"title":      doc.Title,
+		"collection": collection,
+		"workspace":  ws.Name,
+		"author":     doc.CreatedBy.Name,
+		"tags":       utils.Hashtags(doc.Text),
+		"archived":   doc.ArchivedAt != nil,
+		"draft":      doc.PublishedAt == nil,
+		"template":   doc.Template,
+	}}
+}
 
-	resp, err := doRequestWithRateLimit(req)
+// applyTransforms pipes an exported document through the transforms of its
+// collection's mapping. A failing transform fails the export, so a document
+// is never written without, e.g., its redaction.
+func applyTransforms(ws config.Workspace, doc models.Document, collection models.Collection, dirPath, content string) (string, error) {
+	// Only documents in a collection directory have a mapping.
+	if dirPath == config.ConfigInstance.DocumentsDir {
+		return content, nil
+	}
+	mapping, err := models.FindCollectionMapping(utils.DB, ws.Name, filepath.Base(dirPath))
+	if err != nil || mapping == nil {
+		return content, err
+	}
+	names := mapping.TransformNames()
+	if len(names) == 0 {
+		return content, nil
+	}
+	transformed, err := transform.Apply(names, []byte(content), map[string]string{
+		"ORS_DOCUMENT_ID":     doc.ID,
+		"ORS_DOCUMENT_TITLE":  doc.Title,
+		"ORS_COLLECTION":      mapping.OutlineCollection,
+		"ORS_COLLECTION_NAME": collection.Name,
+		"ORS_WORKSPACE":       ws.Name,
+	})
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("exportAndSaveDocument: %w", err)
+	}
+	return string(transformed), nil
+}
+
+// exceedsFailureThreshold reports whether failed out of total operations is
+// more than MAX_FAILURE_PERCENT allows, in which case a run must be aborted
+// before its destructive phase.
+func exceedsFailureThreshold(failed, total int) bool {
+	return total > 0 && failed*100 > total*config.ConfigInstance.MaxFailurePercent
+}
+
+// runExport exports the documents of every configured workspace in format
+// (empty for EXPORT_FORMAT), resuming an unfinished run from its persisted
+// checkpoint unless restart is set. Unless full is set, documents whose
+// updatedAt and revision match the last export in the same format are skipped;
+// a full export first checks that the documents volume has room for it.
+func runExport(ctx context.Context, restart, full bool, format string) error {
+	if restart {
+		if err := models.AbandonCheckpoints(utils.DB); err != nil {
+			return fmt.Errorf("error resetting checkpoint: %w", err)
+		}
 	}
-	defer resp.Body.Close()
+	if full {
+		if err := checkDiskSpace(ctx); err != nil {
+			return err
+		}
+	}
+	for _, ws := range config.ConfigInstance.Workspaces {
+		if err := exportWorkspace(ctx, ws, full, format); err != nil {
+			if ws.Name != "" {
+				return fmt.Errorf("workspace %s: %w", ws.Name, err)
+			}
+			return err
+		}
+	}
+	// Give every collection the definitions of the acronyms it uses.
+	if config.ConfigInstance.GlossaryMode == "chunk" {
+		if err := writeGlossaryChunks(ctx); err != nil {
+			return fmt.Errorf("error writing glossaries: %w", err)
+		}
+	}
+	// Give every collection a table of contents of its documents.
+	if config.ConfigInstance.CollectionIndex {
+		if err := writeCollectionIndexes(ctx); err != nil {
+			return fmt.Errorf("error writing collection indexes: %w", err)
+		}
+	}
+	return nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("fetchDocuments: unexpected status: %s", resp.Status)
+// exportAndPublish runs an export outside of a sync. Without a validation gate
+// (SYNC_GATE) nothing would ever approve its result, so the corpus is
+// published right away; with a gate, it is published by the next sync run
+// that passes it.
+func exportAndPublish(ctx context.Context, params exportParams) error {
+	if err := runExport(ctx, params.Restart, params.Full, params.Format); err != nil {
+		return err
 	}
-	var docsResp models.DocumentsResponse
-	if err = json.NewDecoder(resp.Body).Decode(&docsResp); err != nil {
-		return nil, err
+	if config.ConfigInstance.SyncGate != "" {
+		return nil
 	}
-	return &docsResp, nil
+	return publishCorpus(ctx, nil)
 }
 
-// fetchCollectionName retrieves the collection name for a given collectionID.
-// It uses caching to avoid duplicate API calls.
-func fetchCollectionName(collectionID string) (string, error) {
-	// Check if the collection name is already in the cache.
-	collectionCacheMu.Lock()
-	if name, exists := collectionCache[collectionID]; exists {
-		collectionCacheMu.Unlock()
-		return name, nil
+// publishCorpus publishes the documents directory to consumers outside the
+// knowledge collections: the corpus snapshot, the static site and the remote
+// mirror. Unless run is nil, the snapshot must hold exactly the files the run
+// staged, with the checksums they were validated with, or nothing is
+// published.
+func publishCorpus(ctx context.Context, run *models.SyncRun) error {
+	cfg := config.ConfigInstance
+	if cfg.CorpusDir != "" {
+		var verify func(string) error
+		if run != nil {
+			verify = func(dir string) error { return verifySnapshot(run, dir) }
+		}
+		published, err := snapshot.Publish(cfg.DocumentsDir, cfg.CorpusDir, cfg.CorpusRunsDir, cfg.CorpusRetention, verify)
+		if err != nil {
+			return fmt.Errorf("error publishing corpus: %w", err)
+		}
+		logging.FromContext(ctx).Info("Published corpus run", "run", published)
+	}
+	// Refresh the static HTML mirror of the corpus.
+	if cfg.StaticSite {
+		if err := site.Generate(cfg.PublishedDir(), cfg.SiteDir); err != nil {
+			return fmt.Errorf("error generating static site: %w", err)
+		}
+	}
+	// Mirror the corpus to a remote host when configured.
+	if err := remotesync.Push(ctx, cfg.PublishedDir()); err != nil {
+		return fmt.Errorf("error pushing documents to remote: %w", err)
+	}
+	return nil
+}
+
+// verifySnapshot checks that the snapshot in dir matches the staged files of
+// run: changed files with their staged checksums, removed files absent.
+func verifySnapshot(run *models.SyncRun, dir string) error {
+	var modified []string
+	for _, file := range run.Files {
+		rel, err := filepath.Rel(config.ConfigInstance.DocumentsDir, file.Path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, rel))
+		if file.Removed {
+			if err == nil {
+				modified = append(modified, file.Path)
+			}
+			continue
+		}
+		if err != nil || utils.Checksum(content) != file.Checksum {
+			modified = append(modified, file.Path)
+		}
+	}
+	if len(modified) > 0 {
+		return fmt.Errorf("files changed since staging: %s", strings.Join(modified, ", "))
 	}
-	collectionCacheMu.Unlock()
+	return nil
+}
 
-	// Make API call to fetch the collection info.
-	url := fmt.Sprintf("%s/collections.info", config.ConfigInstance.APIBaseURL)
-	payload := map[string]interface{}{
-		"id": collectionID,
+// exportWorkspace exports the documents of a single workspace. In
+// incremental mode (full unset) only documents changed since their last
+// export are downloaded.
+func exportWorkspace(ctx context.Context, ws config.Workspace, full bool, format string) error {
+	extension := exportExtensions[resolveExportFormat(format)]
+	if err := sources.Refresh(ctx, sources.For(ws)); err != nil {
+		return fmt.Errorf("error refreshing source: %w", err)
 	}
-	payloadBytes, err := json.Marshal(payload)
+	checkpoint, resumed, err := models.ResumeOrStartCheckpoint(utils.DB, ws.Name)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("error loading checkpoint: %w", err)
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	// Documents already exported during this run are skipped when resuming;
+	// incremental runs also skip everything unchanged since earlier runs.
+	since := checkpoint.StartedAt
+	if !full {
+		since = time.Time{}
+	}
+	done, err := models.ExportedSince(utils.DB, ws.Name, since)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("error loading export state: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.APIToken)
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := doRequestWithRateLimit(req)
-	if err != nil {
-		return "", err
+	skipped, attempted, failed := 0, 0, 0
+	excluded := []models.ExcludedDocument{}
+	listed := make(map[string]bool)
+	listedURLIDs := make(map[string]bool)
+	// mu guards the state above once exports run concurrently.
+	var mu sync.Mutex
+	// pending records a listed document and reports whether it needs to be
+	// exported.
+	pending := func(doc models.Document) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		listedURLIDs[doc.URLId] = true
+		// Unlisted documents are removed, so an earlier export of a
+		// document that became a draft or template goes away too.
+		if reason := exportExclusion(ctx, ws, doc); reason != "" {
+			excluded = append(excluded, excludedDocument(ctx, ws, doc, reason))
+			return false
+		}
+		listed[doc.ID] = true
+		if version, ok := done[doc.ID]; ok && version.Matches(doc) {
+			// Export again if the file went missing locally or has
+			// another format; an empty path means it was exported
+			// earlier in this run.
+			if version.FilePath == "" {
+				skipped++
+				return false
+			}
+			if _, err := os.Stat(version.FilePath); err == nil && filepath.Ext(version.FilePath) == extension {
+				skipped++
+				return false
+			}
+		}
+		attempted++
+		return true
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("fetchCollectionName: unexpected status: %s", resp.Status)
+	// exportPage exports the documents of a page concurrently, as many at
+	// once as the adaptive limit of the workspace's upstream allows, and
+	// returns once all are done so the checkpoint never runs ahead of them.
+	limiter := adaptive.Source(ws.APIBaseURL)
+	exportPage := func(docs []models.Document) {
+		var wg sync.WaitGroup
+		for _, doc := range docs {
+			if !pending(doc) {
+				continue
+			}
+			limiter.Acquire()
+			wg.Add(1)
+			go func(doc models.Document) {
+				defer wg.Done()
+				defer limiter.Release()
+				err := exportAndSaveDocument(ctx, ws, doc, format)
+				if err != nil {
+					noteExportFailure(ctx, ws, doc.ID, err)
+				} else {
+					noteExportSuccess(ctx, ws, doc.ID)
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					logging.FromContext(ctx).Error("Error exporting document", "document_id", doc.ID, "workspace", ws.Name, "error", err)
+					failed++
+					return
+				}
+				done[doc.ID] = models.ExportedVersion{UpdatedAt: doc.UpdatedAt, Revision: doc.Revision}
+			}(doc)
+		}
+		wg.Wait()
 	}
 
-	// Define a temporary struct to parse the response.
-	var collResp struct {
-		Data struct {
-			ID   string `json:"id"`
-			Name string `json:"name"`
-		} `json:"data"`
+	if resumed {
+		logging.FromContext(ctx).Info("Resuming export", "started_at", checkpoint.StartedAt, "offset", checkpoint.Offset)
 	}
-	if err = json.NewDecoder(resp.Body).Decode(&collResp); err != nil {
-		return "", err
+	// Documents edited since the run started have moved to the front of an
+	// updatedAt-DESC list; pick them up before jumping ahead.
+	if resumed && checkpoint.Offset > 0 && config.ConfigInstance.ExportTraversal == "paged" &&
+		config.ConfigInstance.ExportSort == "updatedAt" && config.ConfigInstance.ExportDirection == "DESC" {
+		for offset := 0; offset < checkpoint.Offset; offset += config.ConfigInstance.Limit {
+			page, err := sources.For(ws).ListDocuments(ctx, offset, "")
+			if err != nil {
+				return fmt.Errorf("error fetching documents: %w", err)
+			}
+			var edited []models.Document
+			for _, doc := range page {
+				if doc.UpdatedAt.After(checkpoint.StartedAt) {
+					edited = append(edited, doc)
+				}
+			}
+			exportPage(edited)
+			if len(edited) < len(page) || len(page) == 0 {
+				break
+			}
+		}
 	}
 
-	// Cache the collection name for future lookups.
-	collectionCacheMu.Lock()
-	collectionCache[collectionID] = collResp.Data.Name
-	collectionCacheMu.Unlock()
+	if config.ConfigInstance.ExportDriftProtection {
+		// Listing everything first means edits made while exporting cannot
+		// shift unexported documents out of view.
+		docs, err := collectDocuments(ctx, ws)
+		if err != nil {
+			return err
+		}
+		exportPage(docs)
+	} else if config.ConfigInstance.ExportTraversal == "collection" {
+		collections, err := sources.For(ws).ListCollections(ctx)
+		if err != nil {
+			return fmt.Errorf("error fetching collections: %w", err)
+		}
+		// When resuming, skip collections that were completed before the crash.
+		start := 0
+		for i, collection := range collections {
+			if collection.ID == checkpoint.CollectionID {
+				start = i
+				break
+			}
+		}
+		for i := start; i < len(collections); i++ {
+			offset := 0
+			if collections[i].ID == checkpoint.CollectionID {
+				offset = checkpoint.Offset
+			}
+			if err := exportPages(ctx, ws, checkpoint, collections[i].ID, offset, exportPage); err != nil {
+				return err
+			}
+		}
+	} else if err := exportPages(ctx, ws, checkpoint, "", checkpoint.Offset, exportPage); err != nil {
+		return err
+	}
 
-	return collResp.Data.Name, nil
+	if skipped > 0 {
+		logging.FromContext(ctx).Info("Skipped unchanged documents", "count", skipped)
+	}
+	if len(excluded) > 0 {
+		logging.FromContext(ctx).Info("Skipped archived, draft, template or filtered documents", "count", len(excluded))
+	}
+	// An outage makes most exports fail; removing documents or uploading on
+	// that basis would leave the knowledge collections half empty. The next
+	// run starts over so the failed documents are retried.
+	if exceedsFailureThreshold(failed, attempted) {
+		now := time.Now()
+		checkpoint.CompletedAt = &now
+		if err := utils.DB.Save(checkpoint).Error; err != nil {
+			logging.FromContext(ctx).Error("Error closing aborted checkpoint", "error", err)
+		}
+		return fmt.Errorf("export aborted: %d of %d documents failed to export", failed, attempted)
+	}
+	// A resumed run only listed the documents after its checkpoint, so it
+	// cannot tell which documents are gone.
+	if !resumed || config.ConfigInstance.ExportDriftProtection {
+		if err := removeDeletedDocuments(ctx, ws, listed); err != nil {
+			return fmt.Errorf("error removing deleted documents: %w", err)
+		}
+		if config.ConfigInstance.InternalLinks == "file" {
+			if err := resolveInternalLinks(ctx, ws); err != nil {
+				logging.FromContext(ctx).Error("Error resolving internal links", "error", err)
+			}
+		}
+		if err := findBrokenLinks(ws, listedURLIDs); err != nil {
+			logging.FromContext(ctx).Error("Error checking for broken links", "error", err)
+		}
+		if config.ConfigInstance.CollectionOverviews {
+			if err := writeCollectionOverviews(ctx, ws); err != nil {
+				logging.FromContext(ctx).Error("Error writing collection overviews", "error", err)
+			}
+		}
+		if err := models.ReplaceExcludedDocuments(utils.DB, ws.Name, excluded); err != nil {
+			logging.FromContext(ctx).Error("Error recording excluded documents", "error", err)
+		}
+		commentOnExclusions(ctx, ws, excluded)
+	} else {
+		logging.FromContext(ctx).Info("Skipping deleted document cleanup and link check for resumed export")
+	}
+	now := time.Now()
+	checkpoint.CompletedAt = &now
+	if err := utils.DB.Save(checkpoint).Error; err != nil {
+		return fmt.Errorf("error completing checkpoint: %w", err)
+	}
+	return nil
 }
 
-// exportAndSaveDocument exports a single document and saves it as a Markdown file,
-// grouping it into a subdirectory based on its collection.
-func exportAndSaveDocument(doc models.Document) error {
-	// Create a URL-safe and file-safe title for the document.
-	safeURLTitle := utils.SanitizeURLTitle(doc.Title)
-	docURL := fmt.Sprintf("%s/%s-%s", config.ConfigInstance.DocsBaseURL, safeURLTitle, doc.URLId)
-	safeTitle := utils.SanitizeFilename(doc.Title)
-
-	// Export the document using the API.
-	url := fmt.Sprintf("%s/documents.export", config.ConfigInstance.APIBaseURL)
-	payload := map[string]interface{}{
-		"id": doc.ID,
-	}
-	payloadBytes, err := json.Marshal(payload)
+// removeDeletedDocuments deletes the exported files of documents that
+// documents.list no longer returns because they were deleted or archived in
+// Outline, along with their attachment companions, and records the removals
+// in the change feed. The uploader then drops them from OpenWebUI.
+func removeDeletedDocuments(ctx context.Context, ws config.Workspace, listed map[string]bool) error {
+	records, err := models.ListWorkspaceDocuments(utils.DB, ws.Name)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		return err
+	for _, record := range records {
+		id := record.DocumentID
+		if record.ParentDocumentID != "" {
+			id = record.ParentDocumentID
+		}
+		// Glossaries and overviews are generated locally, not listed by Outline.
+		if listed[id] || record.IsGenerated() {
+			continue
+		}
+		if err := removeExportedDocument(ctx, record); err != nil {
+			return err
+		}
 	}
-	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.APIToken)
-	req.Header.Set("Content-Type", "application/json")
+	return nil
+}
 
-	resp, err := doRequestWithRateLimit(req)
-	if err != nil {
+// removeExportedDocument deletes an exported file and its export record and
+// records the removal in the change feed.
+func removeExportedDocument(ctx context.Context, record models.ExportedDocument) error {
+	if err := os.Remove(record.FilePath); err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("exportAndSaveDocument: unexpected status: %s", resp.Status)
+	if err := os.RemoveAll(attachmentDir(record.FilePath)); err != nil {
+		logging.FromContext(ctx).Error("Error removing attachments", "file", record.FilePath, "error", err)
+	}
+	if err := models.RecordDocumentChange(utils.DB, models.ChangeRemoved, &record); err != nil {
+		logging.FromContext(ctx).Error("Error recording removal", "document_id", record.DocumentID, "error", err)
 	}
-	var expResp models.ExportResponse
-	if err = json.NewDecoder(resp.Body).Decode(&expResp); err != nil {
+	if err := models.DeleteExportedDocument(utils.DB, record.DocumentID); err != nil {
 		return err
 	}
-	content := fmt.Sprintf("Document URL: %s\n\n%s", docURL, expResp.Data)
+	logging.FromContext(ctx).Info("Removed deleted or archived document", "document_id", record.DocumentID, "file", record.FilePath)
+	return nil
+}
 
-	// Determine the directory path based on the document's collection.
-	var dirPath string
-	if doc.CollectionId != "" {
-		collectionName, err := fetchCollectionName(doc.CollectionId)
+// exportPages pages through documents.list starting at offset, passing each
+// page to exportPage and persisting the checkpoint after every page.
+func exportPages(ctx context.Context, ws config.Workspace, checkpoint *models.ExportCheckpoint, collectionID string, offset int, exportPage func([]models.Document)) error {
+	for {
+		page, err := sources.For(ws).ListDocuments(ctx, offset, collectionID)
 		if err != nil {
-			log.Printf("Error fetching collection name for document %s: %v", doc.ID, err)
-			// If the collection lookup fails, use the base documents directory.
-			dirPath = config.ConfigInstance.DocumentsDir
-		} else {
-			// Sanitize the collection name to be safe for a directory name.
-			safeCollectionName := utils.SanitizeFilename(collectionName)
-			dirPath = filepath.Join(config.ConfigInstance.DocumentsDir, safeCollectionName)
+			return fmt.Errorf("error fetching documents: %w", err)
+		}
+		if len(page) == 0 {
+			return nil
+		}
+		exportPage(page)
+		offset += config.ConfigInstance.Limit
+
+		checkpoint.CollectionID = collectionID
+		checkpoint.Offset = offset
+		checkpoint.Watermark = page[len(page)-1].UpdatedAt
+		if err := utils.DB.Save(checkpoint).Error; err != nil {
+			logging.FromContext(ctx).Error("Error saving export checkpoint", "error", err)
 		}
-	} else {
-		// If no collection ID is provided, fall back to the base directory.
-		dirPath = config.ConfigInstance.DocumentsDir
 	}
+}
 
-	// Ensure the directory exists.
-	if err = os.MkdirAll(dirPath, os.ModePerm); err != nil {
-		return err
+// maxListingPasses bounds how often collectDocuments re-lists while documents keep shifting.
+const maxListingPasses = 3
+
+// listDocumentsPass pages through every document once using the configured
+// traversal and calls fn for each document returned.
+func listDocumentsPass(ctx context.Context, ws config.Workspace, fn func(models.Document)) error {
+	collectionIDs := []string{""}
+	if config.ConfigInstance.ExportTraversal == "collection" {
+		collections, err := sources.For(ws).ListCollections(ctx)
+		if err != nil {
+			return fmt.Errorf("error fetching collections: %w", err)
+		}
+		collectionIDs = collectionIDs[:0]
+		for _, collection := range collections {
+			collectionIDs = append(collectionIDs, collection.ID)
+		}
 	}
-	// Create the file path within the subdirectory.
-	filePath := filepath.Join(dirPath, safeTitle+".md")
-	if err = ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
-		return err
+	for _, collectionID := range collectionIDs {
+		for offset := 0; ; offset += config.ConfigInstance.Limit {
+			page, err := sources.For(ws).ListDocuments(ctx, offset, collectionID)
+			if err != nil {
+				return fmt.Errorf("error fetching documents: %w", err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			for _, doc := range page {
+				fn(doc)
+			}
+		}
 	}
-	log.Printf("Downloaded and saved: %s", filePath)
 	return nil
 }
 
+// collectDocuments lists all documents before anything is exported. Paging
+// while documents are edited shifts them between pages, which shows up as
+// duplicates or misses; the listing is therefore repeated until a pass finds
+// no previously unseen document, so nothing is silently skipped.
+func collectDocuments(ctx context.Context, ws config.Workspace) ([]models.Document, error) {
+	seen := make(map[string]int)
+	var docs []models.Document
+	for pass := 1; pass <= maxListingPasses; pass++ {
+		added, duplicates := 0, 0
+		inPass := make(map[string]bool)
+		err := listDocumentsPass(ctx, ws, func(doc models.Document) {
+			if inPass[doc.ID] {
+				duplicates++
+				return
+			}
+			inPass[doc.ID] = true
+			if i, ok := seen[doc.ID]; ok {
+				// Keep the freshest metadata for documents seen before.
+				docs[i] = doc
+				return
+			}
+			seen[doc.ID] = len(docs)
+			docs = append(docs, doc)
+			added++
+		})
+		if err != nil {
+			return nil, err
+		}
+		if duplicates > 0 {
+			logging.FromContext(ctx).Info("Pagination drift: listing pass returned duplicate documents", "pass", pass, "duplicates", duplicates)
+		}
+		if pass > 1 {
+			if added == 0 {
+				break
+			}
+			logging.FromContext(ctx).Info("Pagination drift: listing pass found documents missed by earlier passes", "pass", pass, "added", added)
+		}
+	}
+	logging.FromContext(ctx).Info("Collected documents for export", "count", len(docs))
+	return docs, nil
+}
+
+// exportParams are the parameters of an export job.
+type exportParams struct {
+	Restart bool   `json:"restart"`
+	Full    bool   `json:"full"`
+	Format  string `json:"format,omitempty"`
+}
+
 // ExportDocumentsHandler handles the export process.
+// An interrupted export is resumed from its checkpoint; pass restart=true to start over.
+// Only changed documents are exported unless full=true is given.
 // @Summary Export documents
-// @Description Fetches documents from the source API, exports their content, and saves them as Markdown files grouped by collection.
+// @Description Fetches documents from the source API, exports their content, and saves them as Markdown files grouped by collection. Documents whose updatedAt and revision are unchanged since their last export are skipped unless full=true is given. Files of documents deleted or archived in Outline are removed. An interrupted export resumes from its last checkpoint unless restart=true is given. With async=true, or when the process runs in API-only mode, the export is queued as a background job.
 // @Tags export
 // @Produce plain
+// @Param restart query bool false "Discard any unfinished checkpoint and start from the beginning"
+// @Param full query bool false "Export every document, even unchanged ones"
+// @Param format query string false "Export format for this run: markdown, html, text or json (default EXPORT_FORMAT)"
+// @Param async query bool false "Queue the export as a background job"
 // @Success 200 {string} string "Export completed."
+// @Success 202 {object} models.Job
 // @Failure 500 {object} map[string]interface{}
 // @Router /export [get]
 func ExportDocumentsHandler(w http.ResponseWriter, r *http.Request) {
-	offset := 0
-	for {
-		docsResp, err := fetchDocuments(offset)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Error fetching documents: %v", err), http.StatusInternalServerError)
-			return
-		}
-		if len(docsResp.Data) == 0 {
-			break
-		}
-		for _, doc := range docsResp.Data {
-			if err := exportAndSaveDocument(doc); err != nil {
-				log.Printf("Error exporting document %s: %v", doc.ID, err)
-			}
-		}
-		offset += config.ConfigInstance.Limit
+	params := exportParams{
+		Restart: r.URL.Query().Get("restart") == "true",
+		Full:    r.URL.Query().Get("full") == "true",
+		Format:  r.URL.Query().Get("format"),
+	}
+	if _, ok := exportExtensions[params.Format]; params.Format != "" && !ok {
+		http.Error(w, "format must be markdown, html, text or json", http.StatusBadRequest)
+		return
+	}
+	if runInBackground(r) {
+		enqueueJob(w, r, "export", params)
+		return
+	}
+	if err := exportAndPublish(context.WithoutCancel(r.Context()), params); err != nil {
+		http.Error(w, localize(r, "Error exporting documents: %v", err), http.StatusInternalServerError)
+		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Export completed."))
+	writeMessage(w, r, "Export completed.")
 }
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/site"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// exportExtensions are the file extensions of the export formats.
+var exportExtensions = map[string]string{
+	"markdown": ".md",
+	"html":     ".html",
+	"text":     ".txt",
+	"json":     ".json",
+}
+
+// exportContentTypes are the MIME types exported files are uploaded with by default.
+var exportContentTypes = map[string]string{
+	".md":   "text/markdown",
+	".html": "text/html",
+	".txt":  "text/plain",
+	".json": "application/json",
+}
+
+// resolveExportFormat returns format, or EXPORT_FORMAT if it is empty.
+func resolveExportFormat(format string) string {
+	if format == "" {
+		return config.ConfigInstance.ExportFormat
+	}
+	return format
+}
+
+// isExportedFile reports whether a file name has the extension of an export format.
+func isExportedFile(name string) bool {
+	ext := filepath.Ext(name)
+	for _, e := range exportExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// renderExport converts an exported document (front matter, a blank line
+// and the Markdown body) into format. Plain text keeps the front matter, so
+// the upload pipeline still finds the header; HTML carries the metadata as
+// meta tags and JSON as an envelope next to the Markdown content.
+func renderExport(format string, header utils.FrontMatter, content string) (string, error) {
+	if format == "markdown" {
+		return content, nil
+	}
+	frontMatter, body, found := strings.Cut(content, "\n\n")
+	if !found {
+		frontMatter, body = "", frontMatter
+	}
+	switch format {
+	case "text":
+		return frontMatter + "\n\n" + utils.MarkdownToPlainText(body), nil
+	case "html":
+		fields := header.Fields()
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var b strings.Builder
+		b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+		var title string
+		json.Unmarshal(fields["title"], &title)
+		fmt.Fprintf(&b, "<title>%s</title>\n", html.EscapeString(title))
+		for _, key := range keys {
+			value := string(fields[key])
+			var s string
+			if json.Unmarshal(fields[key], &s) == nil {
+				value = s
+			}
+			fmt.Fprintf(&b, "<meta name=\"%s\" content=\"%s\">\n", html.EscapeString(key), html.EscapeString(value))
+		}
+		b.WriteString("</head>\n<body>\n")
+		b.Write(site.RenderHTML([]byte(body)))
+		b.WriteString("</body>\n</html>\n")
+		return b.String(), nil
+	case "json":
+		data, err := json.MarshalIndent(struct {
+			Metadata map[string]json.RawMessage `json:"metadata"`
+			Content  string                     `json:"content"`
+		}{header.Fields(), body}, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	}
+	return "", fmt.Errorf("renderExport: unknown format %q", format)
+}
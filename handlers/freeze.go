@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/jobs"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// freezeFlushInterval is how often workers check whether a freeze ended.
+const freezeFlushInterval = time.Minute
+
+// checkNotFrozen fails while a freeze window is active. It guards operations
+// that replace whole knowledge collections and cannot be queued file by file.
+// Jobs failing with it are deferred until the window ends.
+func checkNotFrozen() error {
+	if until, frozen := config.FrozenUntil(time.Now()); frozen {
+		return jobs.Defer(until, fmt.Errorf("knowledge collections are frozen until %s", until.In(config.ConfigInstance.FreezeLocation).Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// deferIfFrozen queues changed and removed files while a freeze window is
+// active and reports whether it did; they are pushed once the freeze ends.
+func deferIfFrozen(ctx context.Context, changed, removed map[string]bool) (bool, error) {
+	until, frozen := config.FrozenUntil(time.Now())
+	if !frozen {
+		return false, nil
+	}
+	if err := models.QueuePendingChanges(utils.DB, changed, removed); err != nil {
+		return true, fmt.Errorf("error queuing changes during freeze: %w", err)
+	}
+	logging.FromContext(ctx).Info("Freeze active: queued changes", "until", until.Format(time.RFC3339), "changed", len(changed), "removed", len(removed))
+	return true, nil
+}
+
+// flushPendingChanges pushes the changes queued during a freeze window.
+// Changes that fail to apply are queued again for the next attempt.
+func flushPendingChanges(ctx context.Context) error {
+	if _, frozen := config.FrozenUntil(time.Now()); frozen {
+		return nil
+	}
+	ctx, unlock, err := lockSync(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	pending, err := models.TakePendingChanges(utils.DB)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		publishDeferredRuns(ctx)
+		return nil
+	}
+	changed := make(map[string]bool)
+	removed := make(map[string]bool)
+	for _, change := range pending {
+		if change.Removed {
+			removed[change.FilePath] = true
+		} else {
+			changed[change.FilePath] = true
+		}
+	}
+	requeue := func(err error) error {
+		if qerr := models.QueuePendingChanges(utils.DB, changed, removed); qerr != nil {
+			logging.FromContext(ctx).Error("Error re-queuing pending changes", "error", qerr)
+		}
+		return err
+	}
+	mappings, err := models.GetCollectionMappingRecords(utils.DB)
+	if err != nil {
+		return requeue(fmt.Errorf("error loading mappings: %w", err))
+	}
+	if config.ConfigInstance.CanaryKnowledgeCollectionID != "" && len(changed) > 0 {
+		if err := runCanary(ctx, mappings); err != nil {
+			return requeue(fmt.Errorf("canary sync failed, flush aborted: %w", err))
+		}
+	}
+	if err := uploadChanges(ctx, changed, removed, mappings); err != nil {
+		return requeue(err)
+	}
+	logging.FromContext(ctx).Info("Freeze ended: flushed pending changes", "changed", len(changed), "removed", len(removed))
+	publishDeferredRuns(ctx)
+	return nil
+}
+
+// publishDeferredRuns marks the sync runs deferred by a freeze window as
+// published once their changes were flushed. The integrity report is written
+// for the newest run only, since it checks the current state of the targets.
+func publishDeferredRuns(ctx context.Context) {
+	runs, err := models.ListSyncRuns(utils.DB, models.SyncRunDeferred, -1)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error loading deferred sync runs", "error", err)
+		return
+	}
+	now := time.Now()
+	for i := range runs {
+		run := &runs[i]
+		run.Status, run.PublishedAt = models.SyncRunPublished, &now
+		if err := utils.DB.Save(run).Error; err != nil {
+			logging.FromContext(ctx).Error("Error saving sync run", "sync_run", run.ID, "error", err)
+		}
+	}
+	if len(runs) > 0 {
+		if err := writeIntegrityReport(ctx, &runs[0]); err != nil {
+			logging.FromContext(ctx).Error("Error writing integrity report", "sync_run", runs[0].ID, "error", err)
+		}
+	}
+}
+
+// StartFreezeFlusher periodically flushes the changes queued during freeze
+// windows until ctx is done. It does nothing if no windows are configured.
+func StartFreezeFlusher(ctx context.Context) {
+	if len(config.ConfigInstance.FreezeWindows) == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(freezeFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := flushPendingChanges(ctx); err != nil {
+					logging.FromContext(ctx).Error("Error flushing pending changes", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// FreezeStatus describes the current freeze state.
+type FreezeStatus struct {
+	Frozen bool       `json:"frozen"`
+	Until  *time.Time `json:"until,omitempty"`
+	// Pending is the number of files waiting to be pushed after the freeze.
+	Pending int64 `json:"pending"`
+}
+
+// GetFreezeHandler reports whether a freeze window is active.
+// @Summary Get freeze status
+// @Description Reports whether a freeze window (FREEZE_WINDOWS) is active, when it ends and how many changed files are queued until then.
+// @Tags sync
+// @Produce json
+// @Success 200 {object} FreezeStatus
+// @Failure 500 {object} map[string]string "Failed to retrieve freeze status"
+// @Router /freeze [get]
+func GetFreezeHandler(w http.ResponseWriter, r *http.Request) {
+	pending, err := models.CountPendingChanges(utils.DB)
+	if err != nil {
+		http.Error(w, "Failed to retrieve freeze status", http.StatusInternalServerError)
+		return
+	}
+	status := FreezeStatus{Pending: pending}
+	if until, frozen := config.FrozenUntil(time.Now()); frozen {
+		status.Frozen, status.Until = true, &until
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// glossaryFileName is the per-collection glossary written in "chunk" mode.
+const glossaryFileName = "Glossary.md"
+
+// glossaryCache holds the last glossary read, so it is parsed once rather
+// than for every document.
+var glossaryCache struct {
+	sync.Mutex
+	path     string
+	modTime  time.Time
+	size     int64
+	glossary *utils.Glossary
+}
+
+// loadGlossary reads the glossary from GLOSSARY_FILE or from the exported
+// copy of the Outline document GLOSSARY_DOCUMENT_ID. It returns nil when no
+// glossary is configured. The file is parsed again only when it changed.
+func loadGlossary() (*utils.Glossary, error) {
+	cfg := config.ConfigInstance
+	var path string
+	switch {
+	case cfg.GlossaryFile != "":
+		path = cfg.GlossaryFile
+	case cfg.GlossaryDocumentID != "":
+		record, err := models.GetExportedDocument(utils.DB, cfg.GlossaryDocumentID)
+		if err != nil {
+			return nil, fmt.Errorf("loadGlossary: glossary document %s has not been exported: %w", cfg.GlossaryDocumentID, err)
+		}
+		path = record.FilePath
+	default:
+		return nil, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	glossaryCache.Lock()
+	defer glossaryCache.Unlock()
+	if glossaryCache.glossary != nil && glossaryCache.path == path &&
+		glossaryCache.modTime.Equal(info.ModTime()) && glossaryCache.size == info.Size() {
+		return glossaryCache.glossary, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	glossaryCache.path, glossaryCache.modTime, glossaryCache.size = path, info.ModTime(), info.Size()
+	glossaryCache.glossary = utils.ParseGlossary(string(data))
+	return glossaryCache.glossary, nil
+}
+
+// expandGlossary expands acronyms in the document body when GLOSSARY_MODE is "inline".
+func expandGlossary(ctx context.Context, content []byte) []byte {
+	if config.ConfigInstance.GlossaryMode != "inline" {
+		return content
+	}
+	glossary, err := loadGlossary()
+	if err != nil {
+		logging.FromContext(ctx).Error("Error loading glossary", "error", err)
+		return content
+	}
+	if glossary == nil {
+		return content
+	}
+	// Leave the document header (URL, workspace, ...) untouched.
+	header, body, found := strings.Cut(string(content), "\n\n")
+	if !found {
+		return []byte(glossary.ExpandAcronyms(header))
+	}
+	return []byte(header + "\n\n" + glossary.ExpandAcronyms(body))
+}
+
+// documentGlossaryTerms returns the glossary terms the exported document
+// uses. They are kept in its record and only searched for again when the
+// file or the glossary changed since.
+func documentGlossaryTerms(ctx context.Context, record models.ExportedDocument, glossary *utils.Glossary) ([]string, error) {
+	key := record.Checksum + ":" + glossary.Checksum
+	if record.GlossaryKey == key {
+		if record.GlossaryTerms == "" {
+			return nil, nil
+		}
+		return strings.Split(record.GlossaryTerms, "\n"), nil
+	}
+	data, err := os.ReadFile(record.FilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	terms := glossary.Terms(string(data))
+	if err := models.SetGlossaryTerms(utils.DB, record.DocumentID, strings.Join(terms, "\n"), key); err != nil {
+		logging.FromContext(ctx).Error("Error recording glossary terms", "document_id", record.DocumentID, "error", err)
+	}
+	return terms, nil
+}
+
+// writeGlossaryChunks writes a glossary document into every collection
+// directory, holding the definitions of the terms used in that collection, so
+// each knowledge collection gets the context its documents rely on.
+func writeGlossaryChunks(ctx context.Context) error {
+	glossary, err := loadGlossary()
+	if err != nil || glossary == nil {
+		return err
+	}
+	records, err := models.ListExportedDocuments(utils.DB)
+	if err != nil {
+		return err
+	}
+	byDir := make(map[string]map[string]bool)
+	for _, record := range records {
+		dir := filepath.Dir(record.FilePath)
+		if strings.HasPrefix(record.DocumentID, "glossary:") {
+			// Visit directories with a glossary left, so it is removed
+			// once no document there uses a term.
+			if byDir[dir] == nil {
+				byDir[dir] = make(map[string]bool)
+			}
+			continue
+		}
+		if record.IsGenerated() || !strings.HasSuffix(record.FilePath, ".md") {
+			continue
+		}
+		terms, err := documentGlossaryTerms(ctx, record, glossary)
+		if err != nil {
+			return err
+		}
+		if byDir[dir] == nil {
+			byDir[dir] = make(map[string]bool)
+		}
+		for _, term := range terms {
+			byDir[dir][term] = true
+		}
+	}
+
+	for dir, used := range byDir {
+		filePath := filepath.Join(dir, glossaryFileName)
+		documentID := "glossary:" + filepath.Base(dir)
+		previous, _ := models.GetExportedDocument(utils.DB, documentID)
+		if len(used) == 0 {
+			if previous != nil {
+				os.Remove(filePath)
+				if err := models.RecordDocumentChange(utils.DB, models.ChangeRemoved, previous); err != nil {
+					logging.FromContext(ctx).Error("Error recording removal", "file", filePath, "error", err)
+				}
+				if err := models.DeleteExportedDocument(utils.DB, documentID); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		terms := make([]string, 0, len(used))
+		for term := range used {
+			terms = append(terms, term)
+		}
+		sort.Strings(terms)
+
+		collection := filepath.Base(dir)
+		var content strings.Builder
+		var header utils.FrontMatter
+		header.Set("title", "Glossary")
+		header.Set("collection", collection)
+		fmt.Fprintf(&content, "%s\n# Glossary\n\n", header.String())
+		for _, term := range terms {
+			fmt.Fprintf(&content, "- **%s**: %s\n", term, glossary.Definitions[term])
+		}
+		data := []byte(content.String())
+		if previous != nil && previous.Checksum == utils.Checksum(data) {
+			continue
+		}
+		if err := utils.WriteFileAtomic(filePath, data, 0644); err != nil {
+			return err
+		}
+		record := models.ExportedDocument{
+			DocumentID:     documentID,
+			FilePath:       filePath,
+			Checksum:       utils.Checksum(data),
+			ExportedAt:     time.Now(),
+			Title:          "Glossary",
+			CollectionName: collection,
+			Classification: models.ClassificationPublic,
+		}
+		if err := models.SaveExportedDocument(utils.DB, &record); err != nil {
+			return err
+		}
+		changeType := models.ChangeAdded
+		if previous != nil {
+			changeType = models.ChangeUpdated
+		}
+		if err := models.RecordDocumentChange(utils.DB, changeType, &record); err != nil {
+			logging.FromContext(ctx).Error("Error recording change", "file", filePath, "error", err)
+		}
+	}
+	return nil
+}
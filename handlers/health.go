@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HealthzHandler reports that the service is up.
+// @Summary Liveness probe
+// @Description Returns 200 while the HTTP server is running. With details=true, also returns the availability of Outline and OpenWebUI from the last upstream probes (UPSTREAM_PROBE_INTERVAL); the status stays 200 while they are down, so outages upstream do not restart the service. Public even with REQUIRE_API_KEY=true unless PUBLIC_PATHS leaves it out.
+// @Tags status
+// @Produce plain
+// @Produce json
+// @Param details query bool false "Include the upstream availability"
+// @Success 200 {string} string "ok"
+// @Router /healthz [get]
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("details") == "true" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":    "ok",
+			"upstreams": currentUpstreamStatuses(),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok"))
+}
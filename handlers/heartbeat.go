@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/jobs"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// heartbeatTimeout bounds a heartbeat ping, so a slow monitor never delays
+// a sync.
+const heartbeatTimeout = 10 * time.Second
+
+// pingHeartbeat posts body to a heartbeat URL; monitors such as
+// Healthchecks.io show it with the ping.
+func pingHeartbeat(ctx context.Context, url, body string) {
+	if url == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, heartbeatTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(body))
+	if err != nil {
+		logging.FromContext(ctx).Warn("Error pinging heartbeat", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp, err := utils.Do(req)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Error pinging heartbeat", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logging.FromContext(ctx).Warn("Error pinging heartbeat", "status", resp.Status)
+	}
+}
+
+// withHeartbeat runs a scheduled sync between a start ping and a success or
+// failure ping. A sync deferred to the end of a freeze window is not a
+// failure; its success ping says so.
+func withHeartbeat(ctx context.Context, run func() error) error {
+	cfg := config.ConfigInstance
+	pingHeartbeat(ctx, cfg.HeartbeatStartURL, "")
+	err := run()
+	var deferred *jobs.DeferredError
+	if errors.As(err, &deferred) {
+		pingHeartbeat(ctx, cfg.HeartbeatURL, "deferred: "+err.Error())
+		return err
+	}
+	if err != nil {
+		pingHeartbeat(ctx, cfg.HeartbeatFailURL, err.Error())
+		return err
+	}
+	pingHeartbeat(ctx, cfg.HeartbeatURL, "")
+	return nil
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mikeshootzz/outline-rag-scraper/cache"
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sinks"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// TargetIntegrity compares one knowledge collection with the local state.
+type TargetIntegrity struct {
+	KnowledgeID string `json:"knowledge_id"`
+	// LocalFiles is the number of local files routed to the collection,
+	// TrackedFiles the number of files recorded as uploaded there and
+	// RemoteFiles the number of files OpenWebUI lists.
+	LocalFiles   int `json:"local_files"`
+	TrackedFiles int `json:"tracked_files"`
+	RemoteFiles  int `json:"remote_files"`
+	// NotUploaded lists local files routed to the collection but never uploaded.
+	NotUploaded []string `json:"not_uploaded"`
+	// MissingRemote lists tracked file IDs OpenWebUI no longer has.
+	MissingRemote []string `json:"missing_remote"`
+	// Sampled files were downloaded and hashed; Mismatched differ from what was uploaded.
+	Sampled    int      `json:"sampled"`
+	Mismatched []string `json:"mismatched"`
+	Passed     bool     `json:"passed"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// IntegrityReport is the integrity check of a published sync run.
+type IntegrityReport struct {
+	SyncRunID   uint              `json:"sync_run_id"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	Targets     []TargetIntegrity `json:"targets"`
+	Passed      bool              `json:"passed"`
+}
+
+// SignedIntegrityReport is an integrity report with its ed25519 signature
+// over the exact report bytes.
+type SignedIntegrityReport struct {
+	Report    json.RawMessage `json:"report" swaggertype:"object"`
+	Signature string          `json:"signature,omitempty"`
+	PublicKey string          `json:"public_key,omitempty"`
+	Algorithm string          `json:"algorithm,omitempty" example:"ed25519"`
+}
+
+// integritySigningKey derives the ed25519 key reports are signed with from
+// INTEGRITY_SIGNING_KEY; nil if none is configured.
+func integritySigningKey() ed25519.PrivateKey {
+	if config.ConfigInstance.IntegritySigningKey == "" {
+		return nil
+	}
+	seed := sha256.Sum256([]byte(config.ConfigInstance.IntegritySigningKey))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+// downloadFileContent fetches the stored content of an OpenWebUI file.
+func downloadFileContent(ctx context.Context, fileID string) ([]byte, error) {
+	url := fmt.Sprintf("%s/files/%s/content", config.ConfigInstance.OpenWebUIAPIURL, fileID)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
+	resp, err := utils.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloadFileContent: unexpected status: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// checkTargetIntegrity verifies the counts of a knowledge collection and
+// spot-checks the hashes of sampleSize of its files. local lists the local
+// files routed to it, or is nil if the collection is not routed to.
+func checkTargetIntegrity(ctx context.Context, knowledgeID string, local []string, sampleSize int) TargetIntegrity {
+	target := TargetIntegrity{KnowledgeID: knowledgeID, LocalFiles: len(local), NotUploaded: []string{}, MissingRemote: []string{}, Mismatched: []string{}}
+	tracked, err := models.ListUploadedFiles(utils.DB, knowledgeID)
+	if err != nil {
+		target.Error = err.Error()
+		return target
+	}
+	cache.Delete(sinks.OpenWebUIKnowledgeCacheKey(knowledgeID))
+	knowResp, err := fetchKnowledgeFiles(ctx, knowledgeID)
+	if err != nil {
+		target.Error = err.Error()
+		return target
+	}
+	target.TrackedFiles, target.RemoteFiles = len(tracked), len(knowResp.Files)
+
+	remote := make(map[string]bool, len(knowResp.Files))
+	for _, file := range knowResp.Files {
+		remote[file.ID] = true
+	}
+	uploaded := make(map[string]bool)
+	var managed []models.UploadedFile
+	for _, file := range tracked {
+		if !remote[file.FileID] {
+			target.MissingRemote = append(target.MissingRemote, file.FileID)
+		}
+		if file.Managed && file.Checksum != "" {
+			uploaded[file.FilePath] = true
+			managed = append(managed, file)
+		}
+	}
+	for _, filePath := range local {
+		if !uploaded[filePath] {
+			target.NotUploaded = append(target.NotUploaded, filePath)
+		}
+	}
+
+	rand.Shuffle(len(managed), func(i, j int) { managed[i], managed[j] = managed[j], managed[i] })
+	if len(managed) > sampleSize {
+		managed = managed[:sampleSize]
+	}
+	for _, file := range managed {
+		target.Sampled++
+		content, err := downloadFileContent(ctx, file.FileID)
+		if err != nil || utils.Checksum(content) != file.Checksum {
+			target.Mismatched = append(target.Mismatched, file.FileID)
+		}
+	}
+	target.Passed = target.Error == "" && len(target.NotUploaded) == 0 && len(target.MissingRemote) == 0 && len(target.Mismatched) == 0
+	return target
+}
+
+// writeIntegrityReport checks every knowledge collection against the local
+// state after a run was published and stores the signed report.
+func writeIntegrityReport(ctx context.Context, run *models.SyncRun) error {
+	mappings, err := models.GetCollectionMappingRecords(utils.DB)
+	if err != nil {
+		return err
+	}
+	filePaths, err := listMarkdownFiles(config.ConfigInstance.DocumentsDir)
+	if err != nil {
+		return err
+	}
+	routed := make(map[string][]string)
+	for _, filePath := range filePaths {
+		for _, knowledgeID := range knowledgeTargets(ctx, filePath, mappings) {
+			routed[knowledgeID] = append(routed[knowledgeID], filePath)
+		}
+	}
+	for knowledgeID, files := range routed {
+		routed[knowledgeID] = filterByClassification(ctx, knowledgeID, files, mappings)
+	}
+	knowledgeIDs, err := models.ListTrackedKnowledgeIDs(utils.DB)
+	if err != nil {
+		return err
+	}
+	for knowledgeID := range routed {
+		knowledgeIDs = append(knowledgeIDs, knowledgeID)
+	}
+	sort.Strings(knowledgeIDs)
+
+	report := IntegrityReport{SyncRunID: run.ID, GeneratedAt: time.Now().UTC(), Targets: []TargetIntegrity{}, Passed: true}
+	seen := make(map[string]bool)
+	for _, knowledgeID := range knowledgeIDs {
+		// The canary collection holds samples only.
+		if seen[knowledgeID] || knowledgeID == config.ConfigInstance.CanaryKnowledgeCollectionID {
+			continue
+		}
+		seen[knowledgeID] = true
+		target := checkTargetIntegrity(ctx, knowledgeID, routed[knowledgeID], config.ConfigInstance.IntegritySampleSize)
+		report.Passed = report.Passed && target.Passed
+		report.Targets = append(report.Targets, target)
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	record := models.IntegrityReport{SyncRunID: run.ID, Passed: report.Passed, Report: string(data)}
+	if key := integritySigningKey(); key != nil {
+		record.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+	}
+	if err := utils.DB.Create(&record).Error; err != nil {
+		return err
+	}
+	if !report.Passed {
+		logging.FromContext(ctx).Warn("Integrity check failed, see GET /sync/runs/{id}/integrity", "sync_run", run.ID)
+	}
+	return nil
+}
+
+// GetIntegrityReportHandler returns the signed integrity report of a sync run.
+// @Summary Get the integrity report of a sync run
+// @Description Returns the integrity report written after a sync run was published: file counts of the local corpus, the tracked uploads and every knowledge collection, plus a hash spot-check of uploaded files. With INTEGRITY_SIGNING_KEY set, the report is signed with ed25519 over the exact bytes of the report field.
+// @Tags sync
+// @Produce json
+// @Param id path int true "Sync run ID"
+// @Success 200 {object} SignedIntegrityReport
+// @Failure 404 {object} map[string]string "No integrity report for this run"
+// @Failure 500 {object} map[string]string "Failed to retrieve integrity report"
+// @Router /sync/runs/{id}/integrity [get]
+func GetIntegrityReportHandler(w http.ResponseWriter, r *http.Request) {
+	run, ok := loadSyncRun(w, r)
+	if !ok {
+		return
+	}
+	record, err := models.GetIntegrityReport(utils.DB, run.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "No integrity report for this run", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve integrity report", http.StatusInternalServerError)
+		return
+	}
+	signed := SignedIntegrityReport{Report: json.RawMessage(record.Report), Signature: record.Signature}
+	if key := integritySigningKey(); key != nil && record.Signature != "" {
+		signed.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+		signed.Algorithm = "ed25519"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(signed)
+}
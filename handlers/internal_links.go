@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// rewriteInternalLinks rewrites the links of a document exported to filePath
+// that point at other documents of its workspace. With INTERNAL_LINKS=file,
+// exportedPath resolves a urlId to the exported file, or "" to fall back to
+// the DocsBaseURL form. Links to other sites are left alone.
+func rewriteInternalLinks(ws config.Workspace, filePath, markdown string, exportedPath func(urlID string) string) string {
+	docsBase := strings.TrimSuffix(ws.DocsBaseURL, "/")
+	return internalLink.ReplaceAllStringFunc(markdown, func(link string) string {
+		m := internalLink.FindStringSubmatch(link)
+		text, target, urlID := m[1], m[2], m[3]
+		if !strings.HasPrefix(target, "/") && (docsBase == "" || !strings.HasPrefix(target, docsBase+"/")) {
+			return link
+		}
+		// The query and fragment follow the target inside the parentheses.
+		suffix := strings.TrimSuffix(link[len("["+text+"]("+target):], ")")
+		slug := target[strings.LastIndex(target, "doc/")+len("doc/"):]
+		resolved := docsBase + "/" + slug + suffix
+		if config.ConfigInstance.InternalLinks == "file" {
+			if path := exportedPath(urlID); path != "" && path != filePath {
+				if rel, err := filepath.Rel(filepath.Dir(filePath), path); err == nil {
+					segments := strings.Split(filepath.ToSlash(rel), "/")
+					for i, segment := range segments {
+						segments[i] = url.PathEscape(segment)
+					}
+					resolved = strings.Join(segments, "/")
+					if _, fragment, found := strings.Cut(suffix, "#"); found {
+						resolved += "#" + fragment
+					}
+				}
+			}
+		}
+		return "[" + text + "](" + resolved + ")"
+	})
+}
+
+// resolveInternalLinks runs after a complete export with INTERNAL_LINKS=file
+// and points links at documents exported after the linking one (which fell
+// back to the URL form) at their files. Rewritten files are recorded in the
+// change feed so they are uploaded again.
+func resolveInternalLinks(ctx context.Context, ws config.Workspace) error {
+	records, err := models.ListWorkspaceDocuments(utils.DB, ws.Name)
+	if err != nil {
+		return err
+	}
+	paths := make(map[string]string, len(records))
+	for _, record := range records {
+		if record.ParentDocumentID != "" || record.IsGenerated() {
+			continue
+		}
+		urlID := record.URLID
+		if urlID == "" {
+			// Records exported before urlIds were stored end their URL with it.
+			urlID = record.URL[strings.LastIndex(record.URL, "-")+1:]
+		}
+		paths[urlID] = record.FilePath
+	}
+	for _, record := range records {
+		if record.ParentDocumentID != "" || record.IsGenerated() {
+			continue
+		}
+		data, err := os.ReadFile(record.FilePath)
+		if err != nil {
+			continue
+		}
+		header, body, found := strings.Cut(string(data), "\n\n")
+		if !found {
+			continue
+		}
+		rewritten := rewriteInternalLinks(ws, record.FilePath, body, func(urlID string) string { return paths[urlID] })
+		if rewritten == body {
+			continue
+		}
+		content := header + "\n\n" + rewritten
+		if err := utils.WriteFileAtomic(record.FilePath, []byte(content), 0644); err != nil {
+			return err
+		}
+		record.Checksum = utils.Checksum([]byte(content))
+		if err := models.UpdateExportedContent(utils.DB, record.DocumentID, record.Checksum); err != nil {
+			return err
+		}
+		if err := models.RecordDocumentChange(utils.DB, models.ChangeUpdated, &record); err != nil {
+			logging.FromContext(ctx).Error("Error recording change", "document_id", record.DocumentID, "error", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/jobs"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// RegisterJobRunners makes the export, upload and sync jobs available to workers.
+func RegisterJobRunners() {
+	jobs.Register("export", func(ctx context.Context, job *models.Job, progress func(string)) error {
+		var params exportParams
+		if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+			return err
+		}
+		return exportAndPublish(ctx, params)
+	})
+	jobs.Register("upload", func(ctx context.Context, job *models.Job, progress func(string)) error {
+		var params uploadParams
+		if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+			return err
+		}
+		return runUpload(ctx, params.SkipCanary)
+	})
+	jobs.Register("sync", func(ctx context.Context, job *models.Job, progress func(string)) error {
+		var params syncParams
+		if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+			return err
+		}
+		run := func() error {
+			_, err := runSync(ctx, params)
+			return err
+		}
+		// Only scheduled syncs feed the dead man's switch.
+		if job.Principal == schedulerPrincipal {
+			return withHeartbeat(ctx, run)
+		}
+		return run()
+	})
+	jobs.Register("user.sync", func(ctx context.Context, job *models.Job, progress func(string)) error {
+		var params userTokenParams
+		if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+			return err
+		}
+		return runUserSync(ctx, params.ID)
+	})
+	jobs.Register("sync.publish", func(ctx context.Context, job *models.Job, progress func(string)) error {
+		var params publishParams
+		if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+			return err
+		}
+		return runPublish(ctx, params.ID, job.Principal)
+	})
+	jobs.Register("permissions.sync", func(ctx context.Context, job *models.Job, progress func(string)) error {
+		return runPermissionSync(ctx)
+	})
+	jobs.Register("document.sync", func(ctx context.Context, job *models.Job, progress func(string)) error {
+		var params documentSyncParams
+		if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+			return err
+		}
+		return runDocumentSync(ctx, params)
+	})
+}
+
+// runInBackground reports whether a request's work should be queued: when the
+// caller asked for it with async=true, or always in API-only mode where no
+// worker runs in this process.
+func runInBackground(r *http.Request) bool {
+	return r.URL.Query().Get("async") == "true" || config.ConfigInstance.Mode == "api"
+}
+
+// enqueueJob queues a background job and answers 202 with the job record.
+func enqueueJob(w http.ResponseWriter, r *http.Request, jobType string, params interface{}) {
+	enqueueJobWithPriority(w, r, jobType, params, models.PriorityNormal)
+}
+
+// enqueueJobWithPriority is enqueueJob with an explicit job priority.
+func enqueueJobWithPriority(w http.ResponseWriter, r *http.Request, jobType string, params interface{}, priority int) {
+	job, err := jobs.Enqueue(jobType, params, principalFor(r), priority)
+	if err != nil {
+		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
+		return
+	}
+	setAuditTarget(r, "job:"+strconv.FormatUint(uint64(job.ID), 10))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+strconv.FormatUint(uint64(job.ID), 10))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetJobsHandler lists background jobs.
+// @Summary List jobs
+// @Description Lists background jobs, newest first.
+// @Tags jobs
+// @Produce json
+// @Param status query string false "Filter by status (queued, running, succeeded, failed)"
+// @Param limit query int false "Maximum number of jobs (default 50)"
+// @Success 200 {array} models.Job
+// @Failure 400 {object} map[string]string "Invalid limit"
+// @Failure 500 {object} map[string]string "Failed to retrieve jobs"
+// @Router /jobs [get]
+func GetJobsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	list, err := models.ListJobs(utils.DB, r.URL.Query().Get("status"), limit)
+	if err != nil {
+		http.Error(w, "Failed to retrieve jobs", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetJobHandler returns a single job including its live progress.
+// @Summary Get a job
+// @Description Returns the status and progress of a background job.
+// @Tags jobs
+// @Produce json
+// @Param id path int true "Job ID"
+// @Success 200 {object} models.Job
+// @Failure 400 {object} map[string]string "Invalid job ID"
+// @Failure 404 {object} map[string]string "Job not found"
+// @Router /jobs/{id} [get]
+func GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+	job, err := jobs.Get(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve job", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/cache"
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sinks"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// knowledgeMeta is the data KNOWLEDGE_NAME_TEMPLATE and
+// KNOWLEDGE_DESCRIPTION_TEMPLATE are rendered with, e.g.
+// "{{.Collections}} – {{.Documents}} docs, synced {{.LastSync.Format \"2006-01-02 15:04\"}}".
+type knowledgeMeta struct {
+	KnowledgeID string
+	// Name and Description are the current values in OpenWebUI.
+	Name        string
+	Description string
+	// Collections lists the source collections, comma-separated; CollectionNames holds them individually.
+	Collections     string
+	CollectionNames []string
+	// Documents is the number of documents uploaded to the collection.
+	Documents int
+	LastSync  time.Time
+}
+
+// renderKnowledgeTemplate renders a template from the config; an empty
+// template yields fallback.
+func renderKnowledgeTemplate(name, text, fallback string, meta knowledgeMeta) (string, error) {
+	if text == "" {
+		return fallback, nil
+	}
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, meta); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// describeKnowledgeCollection updates the name and description of a
+// knowledge collection from the configured templates, so WebUI users see the
+// source collections, the document count and when it was last synced.
+func describeKnowledgeCollection(ctx context.Context, knowledgeID string) error {
+	nameTemplate := config.ConfigInstance.KnowledgeNameTemplate
+	descriptionTemplate := config.ConfigInstance.KnowledgeDescriptionTemplate
+	if nameTemplate == "" && descriptionTemplate == "" {
+		return nil
+	}
+	knowResp, err := fetchKnowledgeFiles(ctx, knowledgeID)
+	if err != nil {
+		return err
+	}
+	tracked, err := models.ListUploadedFiles(utils.DB, knowledgeID)
+	if err != nil {
+		return err
+	}
+	meta := knowledgeMeta{
+		KnowledgeID: knowledgeID,
+		Name:        knowResp.Name,
+		Description: knowResp.Description,
+		LastSync:    time.Now(),
+	}
+	documents := make(map[string]bool)
+	collections := make(map[string]bool)
+	for _, file := range tracked {
+		if !file.Managed || documents[file.FilePath] {
+			continue
+		}
+		documents[file.FilePath] = true
+		if collection := collectionOf(file.FilePath); collection != "" && collection != "." {
+			collections[collection] = true
+		}
+	}
+	meta.Documents = len(documents)
+	for collection := range collections {
+		meta.CollectionNames = append(meta.CollectionNames, collection)
+	}
+	sort.Strings(meta.CollectionNames)
+	meta.Collections = strings.Join(meta.CollectionNames, ", ")
+
+	name, err := renderKnowledgeTemplate("KNOWLEDGE_NAME_TEMPLATE", nameTemplate, knowResp.Name, meta)
+	if err != nil {
+		return err
+	}
+	description, err := renderKnowledgeTemplate("KNOWLEDGE_DESCRIPTION_TEMPLATE", descriptionTemplate, knowResp.Description, meta)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = knowResp.Name
+	}
+	return updateKnowledgeCollection(ctx, knowledgeID, name, description, knowResp.AccessControl)
+}
+
+// updateKnowledgeCollection sets the name and description of a knowledge
+// collection. OpenWebUI replaces the access control on update, so the
+// current value is sent back unchanged.
+func updateKnowledgeCollection(ctx context.Context, knowledgeID, name, description string, accessControl json.RawMessage) error {
+	url := fmt.Sprintf("%s/knowledge/%s/update", config.ConfigInstance.OpenWebUIAPIURL, knowledgeID)
+	payload := map[string]interface{}{
+		"name":        name,
+		"description": description,
+	}
+	if len(accessControl) > 0 {
+		payload["access_control"] = accessControl
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := utils.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("updateKnowledgeCollection: unexpected status: %s, body: %s", resp.Status, string(respBody))
+	}
+	cache.Delete(sinks.OpenWebUIKnowledgeCacheKey(knowledgeID))
+	logging.FromContext(ctx).Info("Updated name and description of knowledge collection", "knowledge_id", knowledgeID)
+	return nil
+}
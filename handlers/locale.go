@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/i18n"
+)
+
+// localize formats a response message in the language the request prefers
+// (Accept-Language), falling back to LANGUAGE.
+func localize(r *http.Request, format string, args ...interface{}) string {
+	return i18n.Sprintf(i18n.Match(r.Header.Get("Accept-Language"), config.ConfigInstance.Language), format, args...)
+}
+
+// writeMessage answers with a localized plain-text message.
+func writeMessage(w http.ResponseWriter, r *http.Request, format string, args ...interface{}) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(localize(r, format, args...)))
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/mikeshootzz/outline-rag-scraper/cache"
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sinks"
+	"github.com/mikeshootzz/outline-rag-scraper/snapshot"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// KnowledgeDrift describes the differences between the tracked state and the
+// actual contents of one knowledge collection.
+type KnowledgeDrift struct {
+	KnowledgeID string `json:"knowledge_id"`
+	// Tracked and Actual are the number of files in the database and in OpenWebUI.
+	Tracked int `json:"tracked"`
+	Actual  int `json:"actual"`
+	// Missing lists tracked files that no longer exist in the collection.
+	Missing []models.UploadedFile `json:"missing"`
+	// Unknown lists file IDs present in the collection but not tracked.
+	Unknown []string `json:"unknown"`
+	// Repaired lists the actions taken when repair was requested.
+	Repaired []string `json:"repaired,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// VerifyReport is the result of a drift check across knowledge collections.
+type VerifyReport struct {
+	Collections []KnowledgeDrift `json:"collections"`
+	InSync      bool             `json:"in_sync"`
+}
+
+// verifyKnowledgeCollection compares one knowledge collection with its tracked
+// files and optionally repairs the drift. Missing managed files are uploaded
+// again, missing unmanaged ones are forgotten. Unknown files are recorded as
+// unmanaged, or removed when removeUnknown is set. A document uploaded in
+// several parts is re-uploaded as a whole once, replacing its remaining parts.
+func verifyKnowledgeCollection(ctx context.Context, knowledgeID string, repair, removeUnknown bool, mappings map[string]models.CollectionMapping) KnowledgeDrift {
+	drift := KnowledgeDrift{KnowledgeID: knowledgeID, Missing: []models.UploadedFile{}, Unknown: []string{}}
+	tracked, err := models.ListUploadedFiles(utils.DB, knowledgeID)
+	if err != nil {
+		drift.Error = err.Error()
+		return drift
+	}
+	// Drift is about changes made outside the scraper, so never trust a cached listing.
+	cache.Delete(sinks.OpenWebUIKnowledgeCacheKey(knowledgeID))
+	knowResp, err := fetchKnowledgeFiles(ctx, knowledgeID)
+	if err != nil {
+		drift.Error = err.Error()
+		return drift
+	}
+	drift.Tracked, drift.Actual = len(tracked), len(knowResp.Files)
+
+	actual := make(map[string]bool, len(knowResp.Files))
+	for _, file := range knowResp.Files {
+		actual[file.ID] = true
+	}
+	known := make(map[string]bool, len(tracked))
+	for _, file := range tracked {
+		known[file.FileID] = true
+		if !actual[file.FileID] {
+			drift.Missing = append(drift.Missing, file)
+		}
+	}
+	for _, file := range knowResp.Files {
+		if !known[file.ID] {
+			drift.Unknown = append(drift.Unknown, file.ID)
+		}
+	}
+	if !repair {
+		return drift
+	}
+
+	reuploaded := make(map[string]bool)
+	for _, file := range drift.Missing {
+		if err := models.DeleteUploadedFile(utils.DB, knowledgeID, file.FileID); err != nil {
+			drift.Error = err.Error()
+			return drift
+		}
+		if file.Managed && reuploaded[file.FilePath] {
+			continue
+		}
+		if !file.Managed || file.FilePath == "" {
+			drift.Repaired = append(drift.Repaired, "forgot unmanaged file "+file.FileID)
+			continue
+		}
+		if _, err := os.Stat(file.FilePath); err != nil {
+			drift.Repaired = append(drift.Repaired, "forgot file "+file.FileID+" whose source no longer exists")
+			continue
+		}
+		reuploaded[file.FilePath] = true
+		for _, other := range tracked {
+			if other.FilePath != file.FilePath || !actual[other.FileID] {
+				continue
+			}
+			if err := sinks.RemoveOpenWebUIFile(ctx, knowledgeID, other.FileID); err != nil {
+				logging.FromContext(ctx).Error("Error removing file", "file_id", other.FileID, "error", err)
+				continue
+			}
+			if err := models.DeleteUploadedFile(utils.DB, knowledgeID, other.FileID); err != nil {
+				drift.Error = err.Error()
+				return drift
+			}
+		}
+		if err := uploadToOpenWebUI(ctx, file.FilePath, knowledgeID, uploadOptionsFor(file.FilePath, mappings)); err != nil {
+			logging.FromContext(ctx).Error("Error re-uploading", "file", file.FilePath, "error", err)
+			drift.Repaired = append(drift.Repaired, "failed to re-upload "+file.FilePath+": "+err.Error())
+			continue
+		}
+		drift.Repaired = append(drift.Repaired, "re-uploaded "+file.FilePath)
+	}
+	for _, fileID := range drift.Unknown {
+		if removeUnknown {
+			if err := sinks.RemoveOpenWebUIFile(ctx, knowledgeID, fileID); err != nil {
+				drift.Repaired = append(drift.Repaired, "failed to remove unknown file "+fileID+": "+err.Error())
+				continue
+			}
+			drift.Repaired = append(drift.Repaired, "removed unknown file "+fileID)
+			continue
+		}
+		record := models.UploadedFile{KnowledgeID: knowledgeID, FileID: fileID}
+		if err := utils.DB.Create(&record).Error; err != nil {
+			drift.Error = err.Error()
+			return drift
+		}
+		drift.Repaired = append(drift.Repaired, "tracked unknown file "+fileID+" as unmanaged")
+	}
+	return drift
+}
+
+// VerifyKnowledgeHandler detects drift between the database and OpenWebUI.
+// @Summary Verify knowledge collections
+// @Description Compares the tracked file IDs with what each knowledge collection actually contains and reports missing files and unknown extras. With repair=true, missing files are re-uploaded and unknown files are tracked as unmanaged (or removed with remove_unknown=true).
+// @Tags maintenance
+// @Produce json
+// @Param repair query bool false "Repair the detected drift"
+// @Param remove_unknown query bool false "When repairing, remove unknown files instead of tracking them as unmanaged"
+// @Success 200 {object} VerifyReport
+// @Failure 503 {object} map[string]string "Repair refused during a freeze window"
+// @Failure 500 {object} map[string]string "Failed to verify knowledge collections"
+// @Router /maintenance/verify [post]
+func VerifyKnowledgeHandler(w http.ResponseWriter, r *http.Request) {
+	repair := r.URL.Query().Get("repair") == "true"
+	removeUnknown := r.URL.Query().Get("remove_unknown") == "true"
+	if repair {
+		if err := checkNotFrozen(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	knowledgeIDs, err := models.ListTrackedKnowledgeIDs(utils.DB)
+	if err != nil {
+		http.Error(w, "Failed to verify knowledge collections", http.StatusInternalServerError)
+		return
+	}
+	mappings, err := models.GetCollectionMappingRecords(utils.DB)
+	if err != nil {
+		http.Error(w, "Failed to verify knowledge collections", http.StatusInternalServerError)
+		return
+	}
+	if id := config.ConfigInstance.KnowledgeCollectionID; id != "" {
+		found := false
+		for _, knowledgeID := range knowledgeIDs {
+			found = found || knowledgeID == id
+		}
+		if !found {
+			knowledgeIDs = append(knowledgeIDs, id)
+		}
+	}
+
+	report := VerifyReport{Collections: []KnowledgeDrift{}, InSync: true}
+	for _, knowledgeID := range knowledgeIDs {
+		drift := verifyKnowledgeCollection(r.Context(), knowledgeID, repair, removeUnknown, mappings)
+		if len(drift.Missing) > 0 || len(drift.Unknown) > 0 || drift.Error != "" {
+			report.InSync = false
+		}
+		report.Collections = append(report.Collections, drift)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// RollbackCorpusHandler points the published corpus back at an earlier run.
+// @Summary Roll back the published corpus
+// @Description Swaps CORPUS_DIR back to the corpus published by the export before the current one, or to a run kept in CORPUS_RUNS_DIR by name, for when the latest export turned out broken. The "latest" symlink keeps pointing at the newest run, and the next successful export publishes a new one. Requires ADMIN_API_KEY.
+// @Tags maintenance
+// @Produce json
+// @Param run query string false "Name of the run directory to publish, e.g. 20260101T120000Z"
+// @Success 200 {object} map[string]string "Run directory now published"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "CORPUS_DIR is not set or the run does not exist"
+// @Failure 409 {object} map[string]string "No previous run to roll back to"
+// @Failure 500 {object} map[string]string "Failed to roll back"
+// @Router /maintenance/corpus/rollback [post]
+func RollbackCorpusHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := config.ConfigInstance
+	if cfg.CorpusDir == "" {
+		http.Error(w, "CORPUS_DIR is not set", http.StatusNotFound)
+		return
+	}
+	run, err := snapshot.Rollback(cfg.CorpusDir, cfg.CorpusRunsDir, r.URL.Query().Get("run"))
+	if errors.Is(err, snapshot.ErrUnknownRun) {
+		http.Error(w, "Unknown run", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, snapshot.ErrNoPreviousRun) {
+		http.Error(w, "No previous run to roll back to", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error rolling back corpus", "error", err)
+		http.Error(w, "Failed to roll back", http.StatusInternalServerError)
+		return
+	}
+	setAuditTarget(r, "corpus:"+filepath.Base(run))
+	logging.FromContext(r.Context()).Info("Rolled back corpus", "run", run)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"run": run})
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sources"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// outlineCollectionRef identifies a collection within a workspace.
+type outlineCollectionRef struct {
+	Workspace  config.Workspace
+	Collection models.Collection
+}
+
+// findOutlineCollections returns every Outline collection whose sanitized name
+// matches name, across all workspaces or in the workspace named source.
+func findOutlineCollections(ctx context.Context, source, name string) ([]outlineCollectionRef, error) {
+	var refs []outlineCollectionRef
+	for _, ws := range config.ConfigInstance.Workspaces {
+		if source != "" && ws.Name != source {
+			continue
+		}
+		collections, err := sources.For(ws).ListCollections(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, collection := range collections {
+			if utils.SanitizeFilename(collection.Name) == name {
+				refs = append(refs, outlineCollectionRef{Workspace: ws, Collection: collection})
+			}
+		}
+	}
+	return refs, nil
+}
+
+// listMarkdownFiles returns the exported files (Markdown or another export
+// format) in dir and all its subdirectories.
+func listMarkdownFiles(dir string) ([]string, error) {
+	var filePaths []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && isExportedFile(entry.Name()) {
+			filePaths = append(filePaths, path)
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return filePaths, err
+}
+
+// collectionOf returns the collection directory a local file belongs to: the
+// first path segment below the documents directory, or "" for top-level
+// files. Files elsewhere (e.g. per-user copies) belong to their parent directory.
+func collectionOf(filePath string) string {
+	rel, err := filepath.Rel(config.ConfigInstance.DocumentsDir, filePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Base(filepath.Dir(filePath))
+	}
+	collection, _, nested := strings.Cut(rel, string(filepath.Separator))
+	if !nested {
+		return ""
+	}
+	return collection
+}
+
+// sourceOf returns the name of the workspace a local file was exported from,
+// as recorded at export, or "" for the default workspace and files without a
+// record.
+func sourceOf(filePath string) string {
+	record, err := models.GetExportedDocumentByPath(utils.DB, filePath)
+	if err != nil {
+		return ""
+	}
+	return record.Workspace
+}
+
+// syncMapping exports the Outline collection of a mapping and uploads its files
+// to every knowledge collection the mapping targets (or the default one).
+func syncMapping(ctx context.Context, mapping models.CollectionMapping) error {
+	if err := checkNotFrozen(); err != nil {
+		return err
+	}
+	refs, err := findOutlineCollections(ctx, mapping.Source, mapping.OutlineCollection)
+	if err != nil {
+		return fmt.Errorf("error fetching collections: %w", err)
+	}
+	if len(refs) == 0 {
+		return fmt.Errorf("no Outline collection named %s", mapping.OutlineCollection)
+	}
+	attempted, failed := 0, 0
+	for _, ref := range refs {
+		if err := sources.Refresh(ctx, sources.For(ref.Workspace)); err != nil {
+			return fmt.Errorf("error refreshing source: %w", err)
+		}
+		for offset := 0; ; offset += config.ConfigInstance.Limit {
+			page, err := sources.For(ref.Workspace).ListDocuments(ctx, offset, ref.Collection.ID)
+			if err != nil {
+				return fmt.Errorf("error fetching documents: %w", err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			for _, doc := range page {
+				attempted++
+				if err := exportAndSaveDocument(ctx, ref.Workspace, doc, ""); err != nil {
+					logging.FromContext(ctx).Error("Error exporting document", "document_id", doc.ID, "error", err)
+					failed++
+				}
+			}
+		}
+	}
+
+	if exceedsFailureThreshold(failed, attempted) {
+		return fmt.Errorf("sync aborted: %d of %d documents failed to export", failed, attempted)
+	}
+
+	mappings, err := models.GetCollectionMappingRecords(utils.DB)
+	if err != nil {
+		return fmt.Errorf("error loading mappings: %w", err)
+	}
+	if err := ensureKnowledgeCollections(ctx, mappings); err != nil {
+		return err
+	}
+	if current, ok := mappings[mapping.Key()]; ok {
+		mapping = current
+	}
+	dir := filepath.Join(config.ConfigInstance.DocumentsDir, mapping.OutlineCollection)
+	files, err := listMarkdownFiles(dir)
+	if err != nil {
+		return fmt.Errorf("error reading directory: %w", err)
+	}
+	// Workspaces sharing the directory may have mappings of their own.
+	var filePaths []string
+	for _, filePath := range files {
+		if applied, ok := models.LookupMapping(mappings, sourceOf(filePath), mapping.OutlineCollection); ok && applied.ID == mapping.ID {
+			filePaths = append(filePaths, filePath)
+		}
+	}
+	knowledgeIDs := mapping.KnowledgeIDs()
+	if len(knowledgeIDs) == 0 && config.ConfigInstance.KnowledgeCollectionID != "" {
+		knowledgeIDs = []string{config.ConfigInstance.KnowledgeCollectionID}
+	}
+	for _, knowledgeID := range knowledgeIDs {
+		if err := uploadFilesToKnowledge(ctx, knowledgeID, filePaths, dir, mappings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncMappingHandler syncs a single mapping.
+// @Summary Sync a single mapping
+// @Description Exports the Outline collection of a mapping and uploads it to the mapped OpenWebUI knowledge collections. Requires ADMIN_API_KEY or an API key with the sync scope issued for this mapping or for all mappings.
+// @Tags mappings
+// @Produce plain
+// @Param id path int true "Mapping ID"
+// @Success 200 {string} string "Sync completed."
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Key not scoped to this mapping"
+// @Failure 404 {object} map[string]string "Mapping not found"
+// @Failure 500 {object} map[string]string "Sync failed"
+// @Router /mappings/{id}/sync [post]
+func SyncMappingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Mapping not found", http.StatusNotFound)
+		return
+	}
+
+	key := apiKeyFromRequest(r)
+	if !isAdminKey(key) {
+		record, ok := lookupAPIKey(key)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !record.HasScope(models.ScopeSync) || !record.AllowsMapping(uint(id)) {
+			http.Error(w, "Key not scoped to this mapping", http.StatusForbidden)
+			return
+		}
+	}
+
+	var mapping models.CollectionMapping
+	if err := utils.DB.First(&mapping, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Mapping not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to load mapping", http.StatusInternalServerError)
+		return
+	}
+	if err := syncMapping(context.WithoutCancel(r.Context()), mapping); err != nil {
+		http.Error(w, localize(r, "Sync failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeMessage(w, r, "Sync completed.")
+}
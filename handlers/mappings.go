@@ -2,46 +2,123 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
 	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sources"
+	"github.com/mikeshootzz/outline-rag-scraper/transform"
 	"github.com/mikeshootzz/outline-rag-scraper/utils"
 )
 
 // MappingPayload represents the expected payload for creating a collection mapping.
 type MappingPayload struct {
+	Source               string   `json:"source"`                // workspace name, e.g. "sales"; empty maps the collection of every workspace
 	OutlineCollection    string   `json:"outline_collection"`    // e.g., "Human_Resources"
 	OpenWebUICollections []string `json:"openwebui_collections"` // e.g., ["collectionID1", "collectionID2"]
+	UploadExtension      string   `json:"upload_extension"`      // e.g., ".txt"; empty keeps the default
+	UploadContentType    string   `json:"upload_content_type"`   // e.g., "text/plain"; empty keeps the default
+	ConvertToPlainText   bool     `json:"convert_to_plain_text"` // strip Markdown syntax before upload
+	MaxClassification    string   `json:"max_classification"`    // public, internal or confidential; empty keeps the default
+	AutoCreate           *bool    `json:"auto_create,omitempty"` // create missing knowledge collections; omitted keeps AUTO_CREATE_KNOWLEDGE
+	Transforms           []string `json:"transforms"`            // e.g., ["redact"]; names from TRANSFORM_COMMANDS or TRANSFORM_WASM_MODULES
+	Models               []string `json:"models"`                // e.g., ["support-bot"]; OpenWebUI models the knowledge collections are attached to
+}
+
+// decodeMappingPayload reads and validates a mapping payload, answering 400 if it is invalid.
+func decodeMappingPayload(w http.ResponseWriter, r *http.Request) (*MappingPayload, bool) {
+	var payload MappingPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.OutlineCollection == "" {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return nil, false
+	}
+	if _, ok := findWorkspace(payload.Source); payload.Source != "" && !ok {
+		http.Error(w, fmt.Sprintf("Unknown source %q, see OUTLINE_WORKSPACES", payload.Source), http.StatusBadRequest)
+		return nil, false
+	}
+	if payload.MaxClassification != "" && !models.ValidClassification(payload.MaxClassification) {
+		http.Error(w, "max_classification must be public, internal or confidential", http.StatusBadRequest)
+		return nil, false
+	}
+	for _, name := range payload.Transforms {
+		if !transform.Known(name) {
+			http.Error(w, fmt.Sprintf("Unknown transform %q, see TRANSFORM_COMMANDS and TRANSFORM_WASM_MODULES", name), http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	return &payload, true
+}
+
+// apply copies the payload onto a mapping.
+func (payload MappingPayload) apply(mapping *models.CollectionMapping) {
+	mapping.Source = payload.Source
+	mapping.OutlineCollection = payload.OutlineCollection
+	mapping.OpenWebUICollections = strings.Join(payload.OpenWebUICollections, ",")
+	mapping.UploadExtension = utils.NormalizeExtension(payload.UploadExtension)
+	mapping.UploadContentType = payload.UploadContentType
+	mapping.ConvertToPlainText = payload.ConvertToPlainText
+	mapping.MaxClassification = payload.MaxClassification
+	mapping.AutoCreate = payload.AutoCreate
+	mapping.Transforms = strings.Join(payload.Transforms, ",")
+	mapping.Models = strings.Join(payload.Models, ",")
+}
+
+// loadMapping loads the mapping named in the request path, answering 404 if it does not exist.
+func loadMapping(w http.ResponseWriter, r *http.Request) (*models.CollectionMapping, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Mapping not found", http.StatusNotFound)
+		return nil, false
+	}
+	var mapping models.CollectionMapping
+	if err := utils.DB.First(&mapping, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Mapping not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Failed to load mapping", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &mapping, true
 }
 
 // CreateMappingHandler creates a new collection mapping.
 // @Summary Create a new collection mapping
-// @Description Creates a mapping between an Outline collection (subdirectory) and one or more OpenWebUI knowledge collections.
+// @Description Creates a mapping between an Outline collection (subdirectory) and one or more OpenWebUI knowledge collections. Set source to the name of a workspace to map only that workspace's collection, e.g. to route equally named collections of two Outline instances to different knowledge collections; a mapping without source applies to every workspace without a mapping of its own. Set max_classification to "confidential" to allow the mapped knowledge collections to receive documents tagged #confidential.
 // @Tags mappings
 // @Accept json
 // @Produce json
 // @Param mapping body MappingPayload true "Mapping Payload"
 // @Success 201 {object} models.CollectionMapping
 // @Failure 400 {object} map[string]string "Invalid payload"
+// @Failure 409 {object} map[string]string "A mapping for this collection already exists"
 // @Failure 500 {object} map[string]string "Failed to create mapping"
 // @Router /mappings [post]
 func CreateMappingHandler(w http.ResponseWriter, r *http.Request) {
-	var payload MappingPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid payload", http.StatusBadRequest)
+	payload, ok := decodeMappingPayload(w, r)
+	if !ok {
 		return
 	}
-
-	mapping := models.CollectionMapping{
-		OutlineCollection:    payload.OutlineCollection,
-		OpenWebUICollections: strings.Join(payload.OpenWebUICollections, ","),
-	}
+	var mapping models.CollectionMapping
+	payload.apply(&mapping)
 
 	if err := utils.DB.Create(&mapping).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			http.Error(w, "A mapping for this collection already exists", http.StatusConflict)
+			return
+		}
 		http.Error(w, "Failed to create mapping", http.StatusInternalServerError)
 		return
 	}
+	setAuditTarget(r, strconv.FormatUint(uint64(mapping.ID), 10))
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(mapping)
@@ -64,3 +141,149 @@ func GetMappingsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(mappings)
 }
+
+// GetMappingHandler retrieves a single collection mapping.
+// @Summary Get a collection mapping
+// @Description Retrieves one mapping between an Outline collection and OpenWebUI knowledge collections.
+// @Tags mappings
+// @Produce json
+// @Param id path int true "Mapping ID"
+// @Success 200 {object} models.CollectionMapping
+// @Failure 404 {object} map[string]string "Mapping not found"
+// @Failure 500 {object} map[string]string "Failed to load mapping"
+// @Router /mappings/{id} [get]
+func GetMappingHandler(w http.ResponseWriter, r *http.Request) {
+	mapping, ok := loadMapping(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mapping)
+}
+
+// UpdateMappingHandler replaces a collection mapping.
+// @Summary Update a collection mapping
+// @Description Replaces every field of a mapping. Files already uploaded keep their knowledge collections until the next upload or sync.
+// @Tags mappings
+// @Accept json
+// @Produce json
+// @Param id path int true "Mapping ID"
+// @Param mapping body MappingPayload true "Mapping Payload"
+// @Success 200 {object} models.CollectionMapping
+// @Failure 400 {object} map[string]string "Invalid payload"
+// @Failure 404 {object} map[string]string "Mapping not found"
+// @Failure 409 {object} map[string]string "A mapping for this collection already exists"
+// @Failure 500 {object} map[string]string "Failed to update mapping"
+// @Router /mappings/{id} [put]
+func UpdateMappingHandler(w http.ResponseWriter, r *http.Request) {
+	mapping, ok := loadMapping(w, r)
+	if !ok {
+		return
+	}
+	payload, ok := decodeMappingPayload(w, r)
+	if !ok {
+		return
+	}
+	payload.apply(mapping)
+	if err := utils.DB.Save(mapping).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			http.Error(w, "A mapping for this collection already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to update mapping", http.StatusInternalServerError)
+		return
+	}
+	setAuditTarget(r, strconv.FormatUint(uint64(mapping.ID), 10))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mapping)
+}
+
+// DeleteMappingHandler removes a collection mapping.
+// @Summary Delete a collection mapping
+// @Description Removes a mapping; its collection is routed to the default knowledge collection from the next upload or sync on. Files already uploaded are left in place until then.
+// @Tags mappings
+// @Param id path int true "Mapping ID"
+// @Success 204 "Deleted"
+// @Failure 404 {object} map[string]string "Mapping not found"
+// @Failure 500 {object} map[string]string "Failed to delete mapping"
+// @Router /mappings/{id} [delete]
+func DeleteMappingHandler(w http.ResponseWriter, r *http.Request) {
+	mapping, ok := loadMapping(w, r)
+	if !ok {
+		return
+	}
+	// Deleted for good, so the collection can be mapped again.
+	if err := utils.DB.Unscoped().Delete(mapping).Error; err != nil {
+		http.Error(w, "Failed to delete mapping", http.StatusInternalServerError)
+		return
+	}
+	setAuditTarget(r, strconv.FormatUint(uint64(mapping.ID), 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MappingDiscovery is the result of discovering Outline collections.
+type MappingDiscovery struct {
+	// Created are the placeholder mappings added for unmapped collections.
+	Created []models.CollectionMapping `json:"created"`
+	// Existing are the collections that already had a mapping.
+	Existing []string `json:"existing"`
+	// Orphaned are mappings whose collection no longer exists in Outline.
+	Orphaned []string `json:"orphaned"`
+}
+
+// DiscoverMappingsHandler creates placeholder mappings for unmapped collections.
+// @Summary Discover Outline collections
+// @Description Lists the collections of every workspace and creates a mapping without knowledge collections for each one that is not mapped yet, so only the targets have to be filled in. Until then its documents go to the default knowledge collection. Returns the created mappings, the collections already mapped and mappings whose collection no longer exists.
+// @Tags mappings
+// @Produce json
+// @Success 200 {object} MappingDiscovery
+// @Failure 500 {object} map[string]string "Failed to discover collections"
+// @Router /mappings/discover [post]
+func DiscoverMappingsHandler(w http.ResponseWriter, r *http.Request) {
+	// Soft-deleted mappings still hold their unique collection name.
+	var mappings []models.CollectionMapping
+	if err := utils.DB.Unscoped().Find(&mappings).Error; err != nil {
+		http.Error(w, "Failed to discover collections", http.StatusInternalServerError)
+		return
+	}
+	mapped := make(map[string]bool, len(mappings))
+	for _, mapping := range mappings {
+		mapped[mapping.OutlineCollection] = true
+	}
+
+	result := MappingDiscovery{Created: []models.CollectionMapping{}, Existing: []string{}, Orphaned: []string{}}
+	seen := make(map[string]bool)
+	for _, ws := range config.ConfigInstance.Workspaces {
+		collections, err := sources.For(ws).ListCollections(r.Context())
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error fetching collections", "workspace", ws.Name, "error", err)
+			http.Error(w, "Failed to discover collections", http.StatusInternalServerError)
+			return
+		}
+		for _, collection := range collections {
+			name := utils.SanitizeFilename(collection.Name)
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if mapped[name] {
+				result.Existing = append(result.Existing, name)
+				continue
+			}
+			mapping := models.CollectionMapping{OutlineCollection: name}
+			if err := utils.DB.Create(&mapping).Error; err != nil {
+				http.Error(w, "Failed to discover collections", http.StatusInternalServerError)
+				return
+			}
+			result.Created = append(result.Created, mapping)
+		}
+	}
+	for _, mapping := range mappings {
+		if !seen[mapping.OutlineCollection] && !mapping.DeletedAt.Valid {
+			result.Orphaned = append(result.Orphaned, mapping.OutlineCollection)
+		}
+	}
+	logging.FromContext(r.Context()).Info("Discovered unmapped collections", "collections", len(result.Created))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/adaptive"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/timings"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// metricsPrefix namespaces every exported metric.
+const metricsPrefix = "outline_rag_scraper_"
+
+// metricLabels renders Prometheus labels from name/value pairs.
+func metricLabels(pairs ...string) string {
+	var labels []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1])
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, pairs[i], value))
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// writeMetricHeader writes the HELP and TYPE lines of a metric.
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s %s\n", metricsPrefix, name, help, metricsPrefix, name, kind)
+}
+
+// writeCredentialMetrics exports the last credential health checks.
+func writeCredentialMetrics(w io.Writer) error {
+	statuses, err := models.ListCredentialStatuses(utils.DB)
+	if err != nil {
+		return err
+	}
+	writeMetricHeader(w, "credential_up", "gauge", "Whether a credential was accepted at its last check (1) or not (0).")
+	for _, s := range statuses {
+		up := 0
+		if s.Status == models.CredentialOK || s.Status == models.CredentialExpiring {
+			up = 1
+		}
+		fmt.Fprintf(w, "%scredential_up%s %d\n", metricsPrefix, metricLabels("credential", s.Credential, "kind", s.Kind, "status", s.Status), up)
+	}
+	writeMetricHeader(w, "credential_expiry_timestamp_seconds", "gauge", "When a credential expires, for credentials reporting an expiry.")
+	for _, s := range statuses {
+		if s.ExpiresAt != nil {
+			fmt.Fprintf(w, "%scredential_expiry_timestamp_seconds%s %d\n", metricsPrefix, metricLabels("credential", s.Credential, "kind", s.Kind), s.ExpiresAt.Unix())
+		}
+	}
+	writeMetricHeader(w, "credential_checked_timestamp_seconds", "gauge", "When a credential was last checked.")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%scredential_checked_timestamp_seconds%s %d\n", metricsPrefix, metricLabels("credential", s.Credential, "kind", s.Kind), s.UpdatedAt.Unix())
+	}
+	return nil
+}
+
+// writeStageMetrics exports the time spent per sync stage since start, and
+// per stage of the newest sync run.
+func writeStageMetrics(w io.Writer) error {
+	histograms := timings.Histograms()
+	stages := make([]string, 0, len(histograms))
+	for stage := range histograms {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	writeMetricHeader(w, "sync_stage_duration_seconds", "histogram", "Duration of the operations of a sync stage (list, export, pipeline, upload, knowledge).")
+	for _, stage := range stages {
+		h := histograms[stage]
+		var cumulative uint64
+		for i, bound := range timings.Buckets {
+			cumulative += h.Counts[i]
+			fmt.Fprintf(w, "%ssync_stage_duration_seconds_bucket%s %d\n", metricsPrefix, metricLabels("stage", stage, "le", strconv.FormatFloat(bound, 'g', -1, 64)), cumulative)
+		}
+		fmt.Fprintf(w, "%ssync_stage_duration_seconds_bucket%s %d\n", metricsPrefix, metricLabels("stage", stage, "le", "+Inf"), h.Count)
+		fmt.Fprintf(w, "%ssync_stage_duration_seconds_sum%s %g\n", metricsPrefix, metricLabels("stage", stage), h.Sum.Seconds())
+		fmt.Fprintf(w, "%ssync_stage_duration_seconds_count%s %d\n", metricsPrefix, metricLabels("stage", stage), h.Count)
+	}
+
+	runs, err := models.ListSyncRuns(utils.DB, "", 1)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		return nil
+	}
+	writeMetricHeader(w, "last_run_stage_seconds", "gauge", "Total time spent per stage by the newest sync run.")
+	for _, t := range runs[0].Timings {
+		fmt.Fprintf(w, "%slast_run_stage_seconds%s %g\n", metricsPrefix, metricLabels("stage", t.Stage), float64(t.TotalMS)/1000)
+	}
+	writeMetricHeader(w, "last_run_stage_p95_seconds", "gauge", "95th percentile duration of a stage's operations in the newest sync run.")
+	for _, t := range runs[0].Timings {
+		fmt.Fprintf(w, "%slast_run_stage_p95_seconds%s %g\n", metricsPrefix, metricLabels("stage", t.Stage), float64(t.P95MS)/1000)
+	}
+	return nil
+}
+
+// writeConcurrencyMetrics exports the adaptive concurrency per upstream.
+func writeConcurrencyMetrics(w io.Writer) {
+	limiters := adaptive.Limiters()
+	writeMetricHeader(w, "concurrency_limit", "gauge", "Requests currently allowed in flight against an upstream.")
+	for _, l := range limiters {
+		fmt.Fprintf(w, "%sconcurrency_limit%s %d\n", metricsPrefix, metricLabels("upstream", l.Name), l.Stats().Limit)
+	}
+	writeMetricHeader(w, "concurrency_max", "gauge", "Configured concurrency cap of an upstream.")
+	for _, l := range limiters {
+		fmt.Fprintf(w, "%sconcurrency_max%s %d\n", metricsPrefix, metricLabels("upstream", l.Name), l.Stats().Max)
+	}
+	writeMetricHeader(w, "concurrency_in_flight", "gauge", "Requests in flight against an upstream.")
+	for _, l := range limiters {
+		fmt.Fprintf(w, "%sconcurrency_in_flight%s %d\n", metricsPrefix, metricLabels("upstream", l.Name), l.Stats().InFlight)
+	}
+	writeMetricHeader(w, "upstream_latency_seconds", "gauge", "Moving average of an upstream's request latency.")
+	for _, l := range limiters {
+		fmt.Fprintf(w, "%supstream_latency_seconds%s %g\n", metricsPrefix, metricLabels("upstream", l.Name), l.Stats().Latency.Seconds())
+	}
+}
+
+// writeUpstreamMetrics exports the results of the upstream availability probes.
+func writeUpstreamMetrics(w io.Writer) {
+	statuses := currentUpstreamStatuses()
+	writeMetricHeader(w, "upstream_up", "gauge", "Whether an upstream answered its last availability probe (1) or not (0).")
+	for _, s := range statuses {
+		up := 0
+		if s.Up {
+			up = 1
+		}
+		fmt.Fprintf(w, "%supstream_up%s %d\n", metricsPrefix, metricLabels("upstream", s.Upstream, "target", s.Target), up)
+	}
+	writeMetricHeader(w, "upstream_probe_duration_seconds", "gauge", "Duration of an upstream's last availability probe.")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%supstream_probe_duration_seconds%s %g\n", metricsPrefix, metricLabels("upstream", s.Upstream, "target", s.Target), float64(s.LatencyMS)/1000)
+	}
+	writeMetricHeader(w, "upstream_status_change_timestamp_seconds", "gauge", "When an upstream last went up or down.")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%supstream_status_change_timestamp_seconds%s %d\n", metricsPrefix, metricLabels("upstream", s.Upstream, "target", s.Target), s.Since.Unix())
+	}
+	writeMetricHeader(w, "upstream_probes_total", "counter", "Availability probes of an upstream since start.")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%supstream_probes_total%s %d\n", metricsPrefix, metricLabels("upstream", s.Upstream, "target", s.Target), s.Checks)
+	}
+	writeMetricHeader(w, "upstream_probe_failures_total", "counter", "Failed availability probes of an upstream since start.")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%supstream_probe_failures_total%s %d\n", metricsPrefix, metricLabels("upstream", s.Upstream, "target", s.Target), s.Failures)
+	}
+}
+
+// MetricsHandler exposes metrics in the Prometheus text format.
+// @Summary Get metrics
+// @Description Exposes the scraper's metrics, such as credential health, the time spent per sync stage and the availability of Outline and OpenWebUI, in the Prometheus text format.
+// @Tags metrics
+// @Produce plain
+// @Success 200 {string} string "Metrics"
+// @Failure 500 {object} map[string]string "Failed to collect metrics"
+// @Router /metrics [get]
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	if err := writeCredentialMetrics(&b); err != nil {
+		http.Error(w, "Failed to collect metrics", http.StatusInternalServerError)
+		return
+	}
+	if err := writeStageMetrics(&b); err != nil {
+		http.Error(w, "Failed to collect metrics", http.StatusInternalServerError)
+		return
+	}
+	writeConcurrencyMetrics(&b)
+	writeUpstreamMetrics(&b)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	io.WriteString(w, b.String())
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// boundModels returns the OpenWebUI models a knowledge collection is attached
+// to: those of every mapping targeting it, plus KNOWLEDGE_MODELS for the
+// default collection.
+func boundModels(knowledgeID string, mappings map[string]models.CollectionMapping) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	add := func(modelIDs []string) {
+		for _, id := range modelIDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if knowledgeID == config.ConfigInstance.KnowledgeCollectionID {
+		add(config.ConfigInstance.KnowledgeModels)
+	}
+	for _, mapping := range mappings {
+		for _, id := range mapping.KnowledgeIDs() {
+			if id == knowledgeID {
+				add(mapping.ModelIDs())
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// bindKnowledgeModels attaches a knowledge collection to the OpenWebUI models
+// configured for it, so a newly created collection is usable in chats right away.
+func bindKnowledgeModels(ctx context.Context, knowledgeID string, mappings map[string]models.CollectionMapping) {
+	modelIDs := boundModels(knowledgeID, mappings)
+	if len(modelIDs) == 0 {
+		return
+	}
+	knowledge, err := fetchKnowledgeFiles(ctx, knowledgeID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error loading knowledge collection for model binding", "knowledge_id", knowledgeID, "error", err)
+		return
+	}
+	for _, modelID := range modelIDs {
+		if err := attachKnowledgeToModel(ctx, modelID, knowledgeID, knowledge); err != nil {
+			logging.FromContext(ctx).Error("Error attaching knowledge collection to model", "knowledge_id", knowledgeID, "model", modelID, "error", err)
+		}
+	}
+}
+
+// attachKnowledgeToModel adds a knowledge collection to the knowledge of an
+// OpenWebUI model unless it is already there. The model is decoded loosely
+// and sent back whole, so fields this service does not know survive.
+func attachKnowledgeToModel(ctx context.Context, modelID, knowledgeID string, knowledge *models.KnowledgeResponse) error {
+	base := config.ConfigInstance.OpenWebUIAPIURL
+	query := "?id=" + url.QueryEscape(modelID)
+	req, err := http.NewRequestWithContext(ctx, "GET", base+"/models/model"+query, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
+	req.Header.Set("Accept", "application/json")
+	resp, err := utils.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("attachKnowledgeToModel: unexpected status: %s", resp.Status)
+	}
+	var model map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&model); err != nil {
+		return err
+	}
+	if model == nil {
+		return fmt.Errorf("attachKnowledgeToModel: model %s not found", modelID)
+	}
+
+	meta, _ := model["meta"].(map[string]interface{})
+	if meta == nil {
+		meta = make(map[string]interface{})
+		model["meta"] = meta
+	}
+	items, _ := meta["knowledge"].([]interface{})
+	for _, item := range items {
+		if entry, ok := item.(map[string]interface{}); ok && entry["id"] == knowledgeID {
+			return nil
+		}
+	}
+	meta["knowledge"] = append(items, map[string]interface{}{
+		"id":          knowledgeID,
+		"name":        knowledge.Name,
+		"description": knowledge.Description,
+		"type":        "collection",
+	})
+
+	payloadBytes, err := json.Marshal(model)
+	if err != nil {
+		return err
+	}
+	req, err = http.NewRequestWithContext(ctx, "POST", base+"/models/model/update"+query, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
+	req.Header.Set("Content-Type", "application/json")
+	updateResp, err := utils.Do(req)
+	if err != nil {
+		return err
+	}
+	defer updateResp.Body.Close()
+	if updateResp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(updateResp.Body)
+		return fmt.Errorf("attachKnowledgeToModel: unexpected status: %s, body: %s", updateResp.Status, string(respBody))
+	}
+	logging.FromContext(ctx).Info("Attached knowledge collection to model", "knowledge_id", knowledgeID, "model", modelID)
+	return nil
+}
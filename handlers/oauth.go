@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/jobs"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sources"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// oauthStateTTL is how long a user has to complete the consent screen.
+const oauthStateTTL = 10 * time.Minute
+
+// oauthNonceCookie binds the OAuth state to the browser that started the flow.
+const oauthNonceCookie = "outline_oauth_nonce"
+
+// oauthRefreshMargin refreshes tokens this long before they expire.
+const oauthRefreshMargin = 5 * time.Minute
+
+// oauthState is carried, encrypted, through the consent screen.
+type oauthState struct {
+	Workspace       string `json:"workspace,omitempty"`
+	OpenWebUIUserID string `json:"openwebui_user_id,omitempty"`
+	Schedule        string `json:"schedule,omitempty"`
+	Nonce           string `json:"nonce"`
+	Expires         int64  `json:"expires"`
+}
+
+// oauthTokenResponse is the answer of Outline's token endpoint.
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// outlineBaseURL returns the Outline server of a workspace, without /api.
+func outlineBaseURL(ws config.Workspace) string {
+	return strings.TrimSuffix(strings.TrimSuffix(ws.APIBaseURL, "/"), "/api")
+}
+
+// requestOutlineToken calls Outline's OAuth token endpoint with a grant. A
+// grant Outline refuses as invalid, e.g. a revoked refresh token, returns
+// errTokenRejected; other failures may be temporary.
+func requestOutlineToken(ctx context.Context, ws config.Workspace, grant url.Values) (*oauthTokenResponse, error) {
+	grant.Set("client_id", config.ConfigInstance.OutlineOAuthClientID)
+	grant.Set("client_secret", config.ConfigInstance.OutlineOAuthClientSecret)
+	req, err := http.NewRequestWithContext(ctx, "POST", outlineBaseURL(ws)+"/oauth/token", strings.NewReader(grant.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := utils.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		var refusal struct {
+			Error string `json:"error"`
+		}
+		if (resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized) &&
+			json.Unmarshal(body, &refusal) == nil && refusal.Error == "invalid_grant" {
+			return nil, fmt.Errorf("requestOutlineToken: %w: %s", errTokenRejected, string(body))
+		}
+		return nil, fmt.Errorf("requestOutlineToken: unexpected status: %s, body: %s", resp.Status, string(body))
+	}
+	var token oauthTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("requestOutlineToken: access token not found in response")
+	}
+	return &token, nil
+}
+
+// fetchOutlineUser returns the ID and name of the user a token belongs to.
+func fetchOutlineUser(ctx context.Context, ws config.Workspace, token string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", ws.APIBaseURL+"/auth.info", bytes.NewBufferString("{}"))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := sources.DoWithRateLimit(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("fetchOutlineUser: unexpected status: %s", resp.Status)
+	}
+	var info struct {
+		Data struct {
+			User struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", "", err
+	}
+	if info.Data.User.ID == "" {
+		return "", "", fmt.Errorf("fetchOutlineUser: user not found in response")
+	}
+	return info.Data.User.ID, info.Data.User.Name, nil
+}
+
+// storeOAuthToken encrypts the tokens of a token response into record.
+func storeOAuthToken(record *models.UserToken, token *oauthTokenResponse) error {
+	encrypted, err := encryptSecret(token.AccessToken)
+	if err != nil {
+		return err
+	}
+	record.EncryptedToken = encrypted
+	// Outline only rotates the refresh token on some releases; keep the old one otherwise.
+	if token.RefreshToken != "" {
+		if record.EncryptedRefreshToken, err = encryptSecret(token.RefreshToken); err != nil {
+			return err
+		}
+	}
+	record.TokenExpiresAt = nil
+	if token.ExpiresIn > 0 {
+		expires := time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+		record.TokenExpiresAt = &expires
+	}
+	return nil
+}
+
+// userOutlineToken returns the decrypted Outline token of a user token,
+// refreshing OAuth tokens that are about to expire.
+func userOutlineToken(ctx context.Context, record *models.UserToken) (string, error) {
+	if !record.OAuth || record.TokenExpiresAt == nil || time.Until(*record.TokenExpiresAt) > oauthRefreshMargin {
+		return decryptSecret(record.EncryptedToken)
+	}
+	// Refreshes of a token are serialized across processes, since Outline
+	// rotates the refresh token and a second refresh with the old one fails.
+	ctx, unlock, err := jobs.Lock(ctx, fmt.Sprintf("oauth-refresh:%d", record.ID))
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	// Another sync may have refreshed the token while we waited.
+	if err := utils.DB.First(record, record.ID).Error; err != nil {
+		return "", err
+	}
+	if record.TokenExpiresAt == nil || time.Until(*record.TokenExpiresAt) > oauthRefreshMargin {
+		return decryptSecret(record.EncryptedToken)
+	}
+	if record.EncryptedRefreshToken == "" {
+		return "", errors.New("token expired and no refresh token is stored, the user must reconnect")
+	}
+	refreshToken, err := decryptSecret(record.EncryptedRefreshToken)
+	if err != nil {
+		return "", err
+	}
+	ws, ok := findWorkspace(record.Workspace)
+	if !ok {
+		return "", fmt.Errorf("unknown workspace %q", record.Workspace)
+	}
+	token, err := requestOutlineToken(ctx, ws, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error refreshing token, the user may need to reconnect: %w", err)
+	}
+	if err := storeOAuthToken(record, token); err != nil {
+		return "", err
+	}
+	if err := utils.DB.Model(record).Select("encrypted_token", "encrypted_refresh_token", "token_expires_at").Updates(record).Error; err != nil {
+		return "", err
+	}
+	logging.FromContext(ctx).Info("Refreshed Outline OAuth token", "user", record.Name)
+	return token.AccessToken, nil
+}
+
+// oauthUserTokenName returns the name of a new user token for an Outline
+// user: their sanitized name, suffixed with their ID if it is taken.
+func oauthUserTokenName(userID, userName string) (string, error) {
+	name := utils.SanitizeFilename(userName)
+	if name == "" {
+		return "outline-" + userID, nil
+	}
+	var count int64
+	if err := utils.DB.Model(&models.UserToken{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count > 0 {
+		name += "-" + userID
+	}
+	return name, nil
+}
+
+// oauthConfigured rejects requests while Outline OAuth is not configured.
+func oauthConfigured(w http.ResponseWriter) bool {
+	if config.ConfigInstance.OutlineOAuthClientID == "" {
+		http.Error(w, "Outline OAuth is not configured", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// ConnectOutlineHandler starts the Outline OAuth flow.
+// @Summary Connect an Outline account
+// @Description Redirects to Outline's consent screen. Once the user approves, their OAuth token is stored encrypted as a user token, so exports with it only see the documents they may read, and a first sync is queued. Without a knowledge collection, a private one shared with openwebui_user_id is provisioned. Requires OUTLINE_OAUTH_CLIENT_ID.
+// @Tags usertokens
+// @Param workspace query string false "Configured workspace name, empty for the default one"
+// @Param openwebui_user_id query string false "OpenWebUI user the provisioned knowledge collection is shared with"
+// @Param schedule query string false "Sync schedule in the SYNC_SCHEDULE format"
+// @Success 302 "Redirect to the Outline consent screen"
+// @Failure 400 {object} map[string]string "Invalid parameters"
+// @Failure 403 {object} map[string]string "Outline OAuth is not configured"
+// @Router /oauth/outline/connect [get]
+func ConnectOutlineHandler(w http.ResponseWriter, r *http.Request) {
+	if !oauthConfigured(w) {
+		return
+	}
+	query := r.URL.Query()
+	ws, ok := findWorkspace(query.Get("workspace"))
+	if !ok {
+		http.Error(w, "Unknown workspace", http.StatusBadRequest)
+		return
+	}
+	if _, err := nextUserSync(query.Get("schedule"), time.Now()); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid schedule: %v", err), http.StatusBadRequest)
+		return
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		http.Error(w, "Failed to start authorization", http.StatusInternalServerError)
+		return
+	}
+	nonce := hex.EncodeToString(buf)
+	data, err := json.Marshal(oauthState{
+		Workspace:       ws.Name,
+		OpenWebUIUserID: query.Get("openwebui_user_id"),
+		Schedule:        query.Get("schedule"),
+		Nonce:           nonce,
+		Expires:         time.Now().Add(oauthStateTTL).Unix(),
+	})
+	if err != nil {
+		http.Error(w, "Failed to start authorization", http.StatusInternalServerError)
+		return
+	}
+	state, err := encryptSecret(string(data))
+	if err != nil {
+		http.Error(w, "Failed to start authorization", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthNonceCookie,
+		Value:    nonce,
+		Path:     "/oauth/outline",
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(config.ConfigInstance.OutlineOAuthRedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	params := url.Values{
+		"client_id":     {config.ConfigInstance.OutlineOAuthClientID},
+		"redirect_uri":  {config.ConfigInstance.OutlineOAuthRedirectURL},
+		"response_type": {"code"},
+		"scope":         {config.ConfigInstance.OutlineOAuthScope},
+		"state":         {state},
+	}
+	http.Redirect(w, r, outlineBaseURL(ws)+"/oauth/authorize?"+params.Encode(), http.StatusFound)
+}
+
+// OutlineOAuthCallbackHandler completes the Outline OAuth flow.
+// @Summary Outline OAuth callback
+// @Description Exchanges the authorization code for tokens, identifies the Outline user and stores their tokens encrypted in a user token, creating it on first connect. Tokens are refreshed automatically before they expire.
+// @Tags usertokens
+// @Produce plain
+// @Param code query string true "Authorization code"
+// @Param state query string true "State issued by /oauth/outline/connect"
+// @Success 200 {string} string "Outline account connected."
+// @Failure 400 {object} map[string]string "Authorization failed"
+// @Failure 403 {object} map[string]string "Outline OAuth is not configured"
+// @Failure 500 {object} map[string]string "Failed to store the token"
+// @Router /oauth/outline/callback [get]
+func OutlineOAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !oauthConfigured(w) {
+		return
+	}
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		http.Error(w, "Authorization failed: "+reason, http.StatusBadRequest)
+		return
+	}
+	var state oauthState
+	decrypted, err := decryptSecret(query.Get("state"))
+	if err == nil {
+		err = json.Unmarshal([]byte(decrypted), &state)
+	}
+	cookie, cookieErr := r.Cookie(oauthNonceCookie)
+	if err != nil || cookieErr != nil || time.Now().Unix() > state.Expires ||
+		subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state.Nonce)) != 1 {
+		http.Error(w, "Authorization failed: invalid or expired state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oauthNonceCookie, Path: "/oauth/outline", MaxAge: -1})
+	ws, ok := findWorkspace(state.Workspace)
+	if !ok {
+		http.Error(w, "Unknown workspace", http.StatusBadRequest)
+		return
+	}
+	token, err := requestOutlineToken(r.Context(), ws, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {query.Get("code")},
+		"redirect_uri": {config.ConfigInstance.OutlineOAuthRedirectURL},
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error exchanging Outline authorization code", "error", err)
+		http.Error(w, "Authorization failed: code exchange rejected", http.StatusBadRequest)
+		return
+	}
+	userID, userName, err := fetchOutlineUser(r.Context(), ws, token.AccessToken)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error identifying Outline user", "error", err)
+		http.Error(w, "Authorization failed: unknown user", http.StatusBadRequest)
+		return
+	}
+
+	var record models.UserToken
+	err = utils.DB.Where("outline_user_id = ? AND workspace = ?", userID, ws.Name).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Failed to store the token", http.StatusInternalServerError)
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		name, err := oauthUserTokenName(userID, userName)
+		if err != nil {
+			http.Error(w, "Failed to store the token", http.StatusInternalServerError)
+			return
+		}
+		record = models.UserToken{Name: name, Workspace: ws.Name, OutlineUserID: userID}
+	}
+	record.OAuth = true
+	if state.OpenWebUIUserID != "" {
+		record.OpenWebUIUserID = state.OpenWebUIUserID
+	}
+	if state.Schedule != "" {
+		record.Schedule = state.Schedule
+		if record.NextSyncAt, err = nextUserSync(state.Schedule, time.Now()); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid schedule: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := storeOAuthToken(&record, token); err != nil {
+		http.Error(w, "Failed to store the token", http.StatusInternalServerError)
+		return
+	}
+	if err := utils.DB.Save(&record).Error; err != nil {
+		http.Error(w, "Failed to store the token", http.StatusInternalServerError)
+		return
+	}
+	setAuditTarget(r, strconv.FormatUint(uint64(record.ID), 10))
+	logging.FromContext(r.Context()).Info("Connected Outline account", "user", record.Name, "outline_user", userID)
+	if _, err := jobs.Enqueue("user.sync", userTokenParams{ID: record.ID}, "oauth:"+record.Name, models.PriorityNormal); err != nil {
+		logging.FromContext(r.Context()).Error("Error queuing first sync of user token", "user", record.Name, "error", err)
+	}
+	writeMessage(w, r, "Outline account %s connected.", userName)
+}
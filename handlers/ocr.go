@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/extract"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// imageLink matches Markdown images stored as Outline attachments, capturing
+// the alt text and the attachment ID.
+var imageLink = regexp.MustCompile(`!\[([^\]]*)\]\([^)\s]*attachments\.redirect\?id=([0-9a-fA-F-]+)[^)]*\)`)
+
+// recognizeImages runs OCR on the images embedded in a document and returns a
+// section listing the recognized text per image, or "" if no image holds any
+// text. Results are cached per attachment.
+func recognizeImages(ctx context.Context, ws config.Workspace, documentID, markdown string) string {
+	seen := make(map[string]bool)
+	var section strings.Builder
+	for _, m := range imageLink.FindAllStringSubmatch(markdown, -1) {
+		alt, id := m[1], m[2]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		text, err := imageText(ctx, ws, id)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error recognizing image", "attachment_id", id, "document_id", documentID, "error", err)
+			continue
+		}
+		if text == "" {
+			continue
+		}
+		name := alt
+		if extract.IsImage(name) {
+			name = strings.TrimSuffix(name, path.Ext(name))
+		}
+		if name == "" {
+			name = id
+		}
+		fmt.Fprintf(&section, "\nImage Text (%s):\n%s\n", name, text)
+	}
+	if section.Len() == 0 {
+		return ""
+	}
+	return "\n---\n" + section.String()
+}
+
+// imageText returns the recognized text of an image attachment, running OCR
+// only if no cached result exists.
+func imageText(ctx context.Context, ws config.Workspace, attachmentID string) (string, error) {
+	if cached, err := models.GetImageText(utils.DB, attachmentID); err == nil {
+		return cached.Text, nil
+	}
+	data, err := downloadAttachment(ctx, ws, attachmentID)
+	if err != nil {
+		return "", err
+	}
+	text, err := extract.OCR(ctx, data)
+	if err != nil {
+		return "", err
+	}
+	if err := models.SaveImageText(utils.DB, attachmentID, text); err != nil {
+		logging.FromContext(ctx).Error("Error caching OCR result", "attachment_id", attachmentID, "error", err)
+	}
+	return text, nil
+}
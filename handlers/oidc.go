@@ -0,0 +1,600 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// oidcSessionCookie carries the encrypted session of a signed-in user.
+const oidcSessionCookie = "oidc_session"
+
+// oidcNonceCookie binds the OIDC state to the browser that started the flow.
+const oidcNonceCookie = "oidc_nonce"
+
+// oidcKeysRefreshInterval limits how often the provider's keys are fetched
+// again for an unknown key ID.
+const oidcKeysRefreshInterval = time.Minute
+
+// oidcProvider is the part of the provider's discovery document this tool uses.
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcState is carried, encrypted, through the provider's login screen.
+type oidcState struct {
+	Redirect string `json:"redirect"`
+	Nonce    string `json:"nonce"`
+	Expires  int64  `json:"expires"`
+}
+
+// oidcSession is the content of the session cookie.
+type oidcSession struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"` // Only set once verified by the provider.
+	Name    string `json:"name,omitempty"`
+	Expires int64  `json:"expires"`
+	// AdminGroup is set when the user belonged to OIDC_ADMIN_GROUP at sign-in.
+	AdminGroup bool `json:"admin_group,omitempty"`
+}
+
+// Discovered provider metadata and signing keys.
+var (
+	oidcMu          sync.Mutex
+	oidcMeta        *oidcProvider
+	oidcKeys        map[string]crypto.PublicKey
+	oidcKeysFetched time.Time
+)
+
+// oidcConfigured reports whether single sign-on is enabled.
+func oidcConfigured() bool {
+	return config.ConfigInstance.OIDCIssuerURL != ""
+}
+
+// fetchJSON decodes the JSON document at u.
+func fetchJSON(u string, v interface{}) error {
+	resp, err := http.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetchJSON: unexpected status: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// discoverOIDC returns the provider metadata, fetching it on first use.
+func discoverOIDC() (*oidcProvider, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	if oidcMeta != nil {
+		return oidcMeta, nil
+	}
+	var meta oidcProvider
+	if err := fetchJSON(config.ConfigInstance.OIDCIssuerURL+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("discoverOIDC: %w", err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != config.ConfigInstance.OIDCIssuerURL {
+		return nil, fmt.Errorf("discoverOIDC: provider reports issuer %q", meta.Issuer)
+	}
+	oidcMeta = &meta
+	return oidcMeta, nil
+}
+
+// parseJWK decodes an RSA or EC public key.
+func parseJWK(key map[string]string) (crypto.PublicKey, error) {
+	decode := func(name string) (*big.Int, error) {
+		data, err := base64.RawURLEncoding.DecodeString(key[name])
+		if err != nil || len(data) == 0 {
+			return nil, fmt.Errorf("invalid %s", name)
+		}
+		return new(big.Int).SetBytes(data), nil
+	}
+	switch key["kty"] {
+	case "RSA":
+		n, err := decode("n")
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode("e")
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[key["crv"]]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", key["crv"])
+		}
+		x, err := decode("x")
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode("y")
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", key["kty"])
+}
+
+// oidcKey returns the provider's signing key with the given ID, fetching the
+// key set again when the ID is unknown, e.g. after a key rotation.
+func oidcKey(meta *oidcProvider, kid string) (crypto.PublicKey, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	if key, ok := oidcKeys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(oidcKeysFetched) < oidcKeysRefreshInterval {
+		return nil, fmt.Errorf("oidcKey: unknown key %q", kid)
+	}
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := fetchJSON(meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidcKey: %w", err)
+	}
+	oidcKeysFetched = time.Now()
+	oidcKeys = make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if use := jwk["use"]; use != "" && use != "sig" {
+			continue
+		}
+		key, err := parseJWK(jwk)
+		if err != nil {
+			slog.Warn("Skipping OIDC key", "kid", jwk["kid"], "error", err)
+			continue
+		}
+		oidcKeys[jwk["kid"]] = key
+	}
+	if key, ok := oidcKeys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("oidcKey: unknown key %q", kid)
+}
+
+// verifySignature checks a JWS signature made with one of the RS and ES
+// algorithms.
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	hashes := map[string]crypto.Hash{
+		"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+		"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+	}
+	hash, ok := hashes[alg]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			break
+		}
+		return rsa.VerifyPKCS1v15(k, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			break
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("key does not match algorithm %q", alg)
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token and returns its claims.
+func verifyIDToken(meta *oidcProvider, token, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("verifyIDToken: malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(headerJSON, &header) != nil {
+		return nil, errors.New("verifyIDToken: malformed header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("verifyIDToken: malformed signature")
+	}
+	key, err := oidcKey(meta, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, fmt.Errorf("verifyIDToken: %w", err)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("verifyIDToken: malformed payload")
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("verifyIDToken: malformed payload")
+	}
+	if claims["iss"] != meta.Issuer {
+		return nil, fmt.Errorf("verifyIDToken: unexpected issuer %v", claims["iss"])
+	}
+	if !claimContains(claims["aud"], config.ConfigInstance.OIDCClientID) {
+		return nil, errors.New("verifyIDToken: token not issued for this client")
+	}
+	if exp, _ := claims["exp"].(float64); time.Now().Unix() > int64(exp) {
+		return nil, errors.New("verifyIDToken: token expired")
+	}
+	if n, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(n), []byte(nonce)) != 1 {
+		return nil, errors.New("verifyIDToken: nonce mismatch")
+	}
+	return claims, nil
+}
+
+// claimContains reports whether a string or string list claim holds value.
+func claimContains(claim interface{}, value string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == value
+	case []interface{}:
+		return slices.Contains(v, interface{}(value))
+	}
+	return false
+}
+
+// lookupClaim returns a claim by its dot-separated path, such as
+// "realm_access.roles".
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	var value interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// oidcSessionFor returns the signed-in user of a request, if any.
+func oidcSessionFor(r *http.Request) (*oidcSession, bool) {
+	if !oidcConfigured() {
+		return nil, false
+	}
+	cookie, err := r.Cookie(oidcSessionCookie)
+	if err != nil {
+		return nil, false
+	}
+	decrypted, err := decryptSecret(cookie.Value)
+	if err != nil {
+		return nil, false
+	}
+	var session oidcSession
+	if json.Unmarshal([]byte(decrypted), &session) != nil || time.Now().Unix() > session.Expires {
+		return nil, false
+	}
+	return &session, true
+}
+
+// secureCookies reports whether cookies must only be sent over HTTPS.
+func secureCookies() bool {
+	return strings.HasPrefix(config.ConfigInstance.OIDCRedirectURL, "https://")
+}
+
+// requireOIDC sends requests to OIDC_PROTECTED_PATHS without a session or a
+// valid API key to the identity provider: browsers are redirected to the
+// login, other clients get a 401. Signed-in users need their role's scope,
+// keys the route's scope, whether or not REQUIRE_API_KEY is set.
+func requireOIDC(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !oidcConfigured() || !matchPath(r.URL.Path, config.ConfigInstance.OIDCProtectedPaths) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if key := apiKeyFromRequest(r); key != "" {
+			if status, message := checkAPIKey(r, key); status != 0 {
+				if status == http.StatusUnauthorized {
+					w.Header().Set("WWW-Authenticate", "Bearer")
+				}
+				http.Error(w, message, status)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if session, ok := oidcSessionFor(r); ok {
+			if scope, _ := routeScope(r); !session.hasScope(scope) {
+				http.Error(w, "Your role lacks the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, "/oauth/oidc/login?"+url.Values{"redirect": {r.URL.RequestURI()}}.Encode(), http.StatusFound)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// OIDCLoginHandler starts single sign-on.
+// @Summary Sign in with the identity provider
+// @Description Redirects to the OIDC provider's login. Once signed in as a member of OIDC_ADMIN_GROUP or a user registered under /users, the browser returns to redirect with a session for the Swagger UI and the admin endpoints. Requires OIDC_ISSUER_URL.
+// @Tags auth
+// @Param redirect query string false "Path to return to after signing in (default /docs/index.html)"
+// @Success 302 "Redirect to the identity provider"
+// @Failure 403 {object} map[string]string "OIDC is not configured"
+// @Failure 502 {object} map[string]string "Identity provider unavailable"
+// @Router /oauth/oidc/login [get]
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if !oidcConfigured() {
+		http.Error(w, "OIDC is not configured", http.StatusForbidden)
+		return
+	}
+	meta, err := discoverOIDC()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error discovering OIDC provider", "error", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	redirect := r.URL.Query().Get("redirect")
+	// Only local paths, so the login cannot be abused as an open redirect.
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		redirect = "/docs/index.html"
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		http.Error(w, "Failed to start sign-in", http.StatusInternalServerError)
+		return
+	}
+	nonce := hex.EncodeToString(buf)
+	data, err := json.Marshal(oidcState{Redirect: redirect, Nonce: nonce, Expires: time.Now().Add(oauthStateTTL).Unix()})
+	if err != nil {
+		http.Error(w, "Failed to start sign-in", http.StatusInternalServerError)
+		return
+	}
+	state, err := encryptSecret(string(data))
+	if err != nil {
+		http.Error(w, "Failed to start sign-in", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcNonceCookie,
+		Value:    nonce,
+		Path:     "/oauth/oidc",
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	params := url.Values{
+		"client_id":     {config.ConfigInstance.OIDCClientID},
+		"redirect_uri":  {config.ConfigInstance.OIDCRedirectURL},
+		"response_type": {"code"},
+		"scope":         {config.ConfigInstance.OIDCScopes},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	http.Redirect(w, r, meta.AuthorizationEndpoint+"?"+params.Encode(), http.StatusFound)
+}
+
+// OIDCCallbackHandler completes single sign-on.
+// @Summary OIDC callback
+// @Description Exchanges the authorization code for an ID token, verifies it and checks that the user belongs to OIDC_ADMIN_GROUP or is registered under /users, then sets a session cookie valid for OIDC_SESSION_TTL.
+// @Tags auth
+// @Param code query string true "Authorization code"
+// @Param state query string true "State issued by /oauth/oidc/login"
+// @Success 302 "Redirect to the page that required signing in"
+// @Failure 400 {object} map[string]string "Sign-in failed"
+// @Failure 403 {object} map[string]string "Not a member of the admin group or a registered user"
+// @Router /oauth/oidc/callback [get]
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !oidcConfigured() {
+		http.Error(w, "OIDC is not configured", http.StatusForbidden)
+		return
+	}
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		http.Error(w, "Sign-in failed: "+reason, http.StatusBadRequest)
+		return
+	}
+	var state oidcState
+	decrypted, err := decryptSecret(query.Get("state"))
+	if err == nil {
+		err = json.Unmarshal([]byte(decrypted), &state)
+	}
+	cookie, cookieErr := r.Cookie(oidcNonceCookie)
+	if err != nil || cookieErr != nil || time.Now().Unix() > state.Expires ||
+		subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state.Nonce)) != 1 {
+		http.Error(w, "Sign-in failed: invalid or expired state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcNonceCookie, Path: "/oauth/oidc", MaxAge: -1})
+	meta, err := discoverOIDC()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error discovering OIDC provider", "error", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	idToken, err := requestIDToken(meta, query.Get("code"))
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error exchanging OIDC authorization code", "error", err)
+		http.Error(w, "Sign-in failed: code exchange rejected", http.StatusBadRequest)
+		return
+	}
+	claims, err := verifyIDToken(meta, idToken, state.Nonce)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error verifying OIDC ID token", "error", err)
+		http.Error(w, "Sign-in failed: invalid ID token", http.StatusBadRequest)
+		return
+	}
+	session := oidcSession{Expires: time.Now().Add(config.ConfigInstance.OIDCSessionTTL).Unix()}
+	session.Subject, _ = claims["sub"].(string)
+	// Users are matched by email, so an address the provider has not
+	// verified could claim another user's role.
+	if verified, _ := claims["email_verified"].(bool); verified || claims["email_verified"] == "true" {
+		session.Email, _ = claims["email"].(string)
+	}
+	session.Name, _ = claims["name"].(string)
+	group := config.ConfigInstance.OIDCAdminGroup
+	session.AdminGroup = group != "" && claimContains(lookupClaim(claims, config.ConfigInstance.OIDCGroupsClaim), group)
+	user := session.user()
+	if !session.AdminGroup && user == nil {
+		logging.FromContext(r.Context()).Warn("OIDC sign-in refused: not a member of the group or a registered user", "principal", session.principal(), "group", group)
+		http.Error(w, "Not a member of the admin group or a registered user", http.StatusForbidden)
+		return
+	}
+	if user != nil {
+		now := time.Now()
+		updates := map[string]interface{}{"last_login_at": now}
+		if user.Name == "" && session.Name != "" {
+			updates["name"] = session.Name
+		}
+		if err := utils.DB.Model(user).Updates(updates).Error; err != nil {
+			logging.FromContext(r.Context()).Error("Error recording sign-in", "principal", session.principal(), "error", err)
+		}
+	}
+	data, err := json.Marshal(session)
+	if err == nil {
+		var sealed string
+		if sealed, err = encryptSecret(string(data)); err == nil {
+			http.SetCookie(w, &http.Cookie{
+				Name:     oidcSessionCookie,
+				Value:    sealed,
+				Path:     "/",
+				MaxAge:   int(config.ConfigInstance.OIDCSessionTTL.Seconds()),
+				HttpOnly: true,
+				Secure:   secureCookies(),
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+	}
+	if err != nil {
+		http.Error(w, "Failed to start the session", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, state.Redirect, http.StatusFound)
+}
+
+// OIDCLogoutHandler ends the session.
+// @Summary Sign out
+// @Description Removes the session cookie set by the OIDC sign-in.
+// @Tags auth
+// @Success 204 "Signed out"
+// @Router /oauth/oidc/logout [post]
+func OIDCLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: oidcSessionCookie, Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestIDToken exchanges an authorization code at the token endpoint.
+func requestIDToken(meta *oidcProvider, code string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {config.ConfigInstance.OIDCRedirectURL},
+		"client_id":     {config.ConfigInstance.OIDCClientID},
+		"client_secret": {config.ConfigInstance.OIDCClientSecret},
+	}
+	req, err := http.NewRequest("POST", meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("requestIDToken: unexpected status: %s, body: %s", resp.Status, string(body))
+	}
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.IDToken == "" {
+		return "", fmt.Errorf("requestIDToken: ID token not found in response")
+	}
+	return token.IDToken, nil
+}
+
+// principal names the signed-in user in audit events.
+func (s oidcSession) principal() string {
+	if s.Email != "" {
+		return "oidc:" + s.Email
+	}
+	return "oidc:" + s.Subject
+}
+
+// user returns the registered user the session belongs to, if any. Only
+// sessions with an email the provider verified are matched.
+func (s oidcSession) user() *models.User {
+	if s.Email == "" {
+		return nil
+	}
+	user, err := models.FindUserByEmail(utils.DB, s.Email)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+// scope returns the scope the signed-in user holds: their role's, or admin
+// for unregistered members of OIDC_ADMIN_GROUP. The role is looked up on
+// every request, so changes apply to running sessions.
+func (s oidcSession) scope() string {
+	if user := s.user(); user != nil {
+		return user.Role.Scope
+	}
+	if s.AdminGroup {
+		return models.ScopeAdmin
+	}
+	return ""
+}
+
+// hasScope reports whether the signed-in user's role includes scope.
+func (s oidcSession) hasScope(scope string) bool {
+	return models.ScopeIncludes(s.scope(), scope)
+}
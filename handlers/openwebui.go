@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// minOpenWebUIVersion is the oldest OpenWebUI release whose knowledge API
+// (knowledge/{id}/file/add and file/remove) this tool can drive.
+const minOpenWebUIVersion = "0.3.35"
+
+// openWebUICapabilities describes the API differences between OpenWebUI releases.
+type openWebUICapabilities struct {
+	// Version is the detected OpenWebUI version, empty if detection failed.
+	Version string
+	// KnowledgeListPath lists all knowledge collections ("/knowledge/list" since 0.6).
+	KnowledgeListPath string
+	// LegacyKnowledgeFiles is set for releases before 0.4 that return the file
+	// IDs of a knowledge collection in data.file_ids instead of a files array.
+	LegacyKnowledgeFiles bool
+}
+
+// openWebUI holds the capabilities detected at startup. The defaults match the
+// most recent API so a failed probe degrades gracefully.
+var openWebUI = openWebUICapabilities{KnowledgeListPath: "/knowledge/list"}
+
+// parseVersion turns "v0.5.20" or "0.5.20-dev" into comparable integers.
+func parseVersion(version string) [3]int {
+	var parts [3]int
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+ "); i >= 0 {
+		version = version[:i]
+	}
+	for i, field := range strings.SplitN(version, ".", 3) {
+		parts[i], _ = strconv.Atoi(field)
+	}
+	return parts
+}
+
+// versionLess reports whether version a is older than b.
+func versionLess(a, b string) bool {
+	pa, pb := parseVersion(a), parseVersion(b)
+	for i := range pa {
+		if pa[i] != pb[i] {
+			return pa[i] < pb[i]
+		}
+	}
+	return false
+}
+
+// openWebUIBaseURL strips the /api/v1 suffix from the configured API URL.
+func openWebUIBaseURL() string {
+	base := strings.TrimSuffix(config.ConfigInstance.OpenWebUIAPIURL, "/")
+	return strings.TrimSuffix(base, "/api/v1")
+}
+
+// DetectOpenWebUIVersion probes the OpenWebUI version and adapts endpoint
+// paths and payloads to it. Unsupported versions abort startup with a clear
+// message; if the server cannot be reached the latest API is assumed.
+func DetectOpenWebUIVersion(ctx context.Context) {
+	if config.ConfigInstance.OpenWebUIAPIURL == "" {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", openWebUIBaseURL()+"/api/version", nil)
+	if err != nil {
+		logging.FromContext(ctx).Warn("OpenWebUI version detection failed", "error", err)
+		return
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := utils.Do(req)
+	if err != nil {
+		logging.FromContext(ctx).Warn("OpenWebUI version detection failed, assuming latest API", "error", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logging.FromContext(ctx).Warn("OpenWebUI version detection failed, assuming latest API", "status", resp.Status)
+		return
+	}
+	var versionResp struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&versionResp); err != nil || versionResp.Version == "" {
+		logging.FromContext(ctx).Warn("OpenWebUI version detection failed, assuming latest API", "error", "unreadable version response")
+		return
+	}
+
+	caps, err := capabilitiesFor(versionResp.Version)
+	if err != nil {
+		logging.Fatal("Unsupported OpenWebUI version", "error", err)
+	}
+	openWebUI = caps
+	logging.FromContext(ctx).Info("Detected OpenWebUI version", "version", caps.Version)
+}
+
+// capabilitiesFor returns the API layout of the given OpenWebUI version.
+func capabilitiesFor(version string) (openWebUICapabilities, error) {
+	if versionLess(version, minOpenWebUIVersion) {
+		return openWebUICapabilities{}, fmt.Errorf("unsupported OpenWebUI version %s: at least %s is required for the knowledge API", version, minOpenWebUIVersion)
+	}
+	caps := openWebUICapabilities{Version: version, KnowledgeListPath: "/knowledge/list"}
+	if versionLess(version, "0.6.0") {
+		caps.KnowledgeListPath = "/knowledge/"
+	}
+	if versionLess(version, "0.4.0") {
+		caps.LegacyKnowledgeFiles = true
+	}
+	return caps, nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/sources"
+)
+
+// minOutlineVersion is the oldest self-hosted Outline release supported.
+const minOutlineVersion = "0.67.0"
+
+// outlineCapabilities describes the API differences between Outline releases.
+type outlineCapabilities struct {
+	// Version is the detected or configured Outline version, empty if unknown.
+	Version string
+	// StatusFilter is set when documents.list accepts statusFilter (0.72+);
+	// older servers need drafts and archived documents filtered client-side.
+	StatusFilter bool
+}
+
+// Detected Outline capabilities per workspace name.
+var (
+	outlineCaps   = make(map[string]outlineCapabilities)
+	outlineCapsMu sync.RWMutex
+)
+
+// outlineCapabilitiesFor returns the capabilities of a workspace, assuming the
+// latest API when nothing was detected.
+func outlineCapabilitiesFor(ws config.Workspace) outlineCapabilities {
+	outlineCapsMu.RLock()
+	defer outlineCapsMu.RUnlock()
+	if caps, ok := outlineCaps[ws.Name]; ok {
+		return caps
+	}
+	return outlineCapabilities{StatusFilter: true}
+}
+
+// fetchOutlineVersion calls auth.info, which both validates the API token and,
+// on servers that report it, returns the Outline version.
+func fetchOutlineVersion(ctx context.Context, ws config.Workspace) (string, error) {
+	url := fmt.Sprintf("%s/auth.info", ws.APIBaseURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBufferString("{}"))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+ws.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := sources.DoWithRateLimit(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetchOutlineVersion: unexpected status: %s", resp.Status)
+	}
+	var infoResp struct {
+		Version string `json:"version"`
+		Data    struct {
+			Version string `json:"version"`
+		} `json:"data"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&infoResp); err != nil {
+		return "", err
+	}
+	if infoResp.Data.Version != "" {
+		return infoResp.Data.Version, nil
+	}
+	return infoResp.Version, nil
+}
+
+// DetectOutlineVersions checks every workspace via auth.info at startup and
+// records its capabilities. A version configured through OUTLINE_VERSION (or
+// OUTLINE_<NAME>_VERSION) is used when the server does not report one.
+// Versions older than minOutlineVersion abort startup.
+func DetectOutlineVersions(ctx context.Context) {
+	for _, ws := range config.ConfigInstance.Workspaces {
+		if !ws.IsOutline() {
+			continue
+		}
+		logger := logging.FromContext(ctx).With("workspace", ws.Name)
+		version, err := fetchOutlineVersion(ctx, ws)
+		if err != nil {
+			logger.Warn("Outline version detection failed, assuming latest API", "error", err)
+			continue
+		}
+		if version == "" {
+			version = ws.Version
+		}
+		if version == "" {
+			logger.Warn("Outline does not report its version, assuming latest API")
+			continue
+		}
+		if versionLess(version, minOutlineVersion) {
+			logging.Fatal("Unsupported Outline version", "workspace", ws.Name, "version", version, "minimum", minOutlineVersion)
+		}
+		caps := outlineCapabilities{
+			Version:      version,
+			StatusFilter: !versionLess(version, "0.72.0"),
+		}
+		outlineCapsMu.Lock()
+		outlineCaps[ws.Name] = caps
+		outlineCapsMu.Unlock()
+		logger.Info("Detected Outline version", "version", version)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sources"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// overviewFileName is the per-collection overview written with
+// COLLECTION_OVERVIEWS.
+const overviewFileName = "_overview.md"
+
+// writeCollectionOverviews writes the description of every collection of a
+// workspace, with the titles of its documents, to an overview document in the
+// collection directory, which the uploader sends along with the documents.
+// Overviews of collections that are gone or lost their description are
+// removed.
+func writeCollectionOverviews(ctx context.Context, ws config.Workspace) error {
+	collections, err := sources.For(ws).ListCollections(ctx)
+	if err != nil {
+		return err
+	}
+	records, err := models.ListWorkspaceDocuments(utils.DB, ws.Name)
+	if err != nil {
+		return err
+	}
+	titles := make(map[string][]string)
+	previous := make(map[string]models.ExportedDocument)
+	for _, record := range records {
+		switch {
+		case strings.HasPrefix(record.DocumentID, "overview:"):
+			previous[record.DocumentID] = record
+		case record.ParentDocumentID == "" && !record.IsGenerated() && record.CollectionID != "":
+			titles[record.CollectionID] = append(titles[record.CollectionID], record.Title)
+		}
+	}
+
+	written := make(map[string]bool)
+	for _, collection := range collections {
+		description := strings.TrimSpace(collection.Description)
+		if description == "" {
+			continue
+		}
+		documentID := "overview:" + collection.ID
+		if ws.Name != "" {
+			documentID = "overview:" + ws.Name + ":" + collection.ID
+		}
+		written[documentID] = true
+		fileName := overviewFileName
+		if ws.Name != "" {
+			// Workspaces sharing a collection directory each get their own overview.
+			fileName = utils.SanitizeFilename(ws.Name) + "__" + overviewFileName
+		}
+		dirPath := filepath.Join(config.ConfigInstance.DocumentsDir, utils.SanitizeFilename(collection.Name))
+		filePath := filepath.Join(dirPath, fileName)
+
+		classification := models.ClassificationFromText(description)
+		if classification == "" {
+			classification = config.ConfigInstance.DefaultClassification
+		}
+		title := collection.Name + " overview"
+		var header utils.FrontMatter
+		header.Set("title", title)
+		header.Set("collection", collection.Name)
+		header.Set("workspace", ws.Name)
+		header.Set("icon", collection.Icon)
+		header.Set("classification", classification)
+		var content strings.Builder
+		fmt.Fprintf(&content, "%s\n# %s\n\n%s\n", header.String(), collection.Name, description)
+		if docs := titles[collection.ID]; len(docs) > 0 {
+			sort.Strings(docs)
+			fmt.Fprintf(&content, "\n## Documents\n\nThis collection holds %d documents:\n\n", len(docs))
+			for _, doc := range docs {
+				fmt.Fprintf(&content, "- %s\n", doc)
+			}
+		}
+		data := []byte(content.String())
+
+		old, existed := previous[documentID]
+		if existed && old.Checksum == utils.Checksum(data) && old.FilePath == filePath {
+			continue
+		}
+		if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+			return err
+		}
+		if err := utils.WriteFileAtomic(filePath, data, 0644); err != nil {
+			return err
+		}
+		// A renamed collection moves its overview; drop the old file.
+		if existed && old.FilePath != filePath {
+			if err := removeExportedDocument(ctx, old); err != nil {
+				return err
+			}
+			existed = false
+		}
+		record := models.ExportedDocument{
+			DocumentID:      documentID,
+			Workspace:       ws.Name,
+			FilePath:        filePath,
+			Checksum:        utils.Checksum(data),
+			ExportedAt:      time.Now(),
+			Title:           title,
+			CollectionID:    collection.ID,
+			CollectionName:  collection.Name,
+			CollectionIcon:  collection.Icon,
+			CollectionColor: collection.Color,
+			Classification:  classification,
+		}
+		if err := models.SaveExportedDocument(utils.DB, &record); err != nil {
+			return err
+		}
+		changeType := models.ChangeAdded
+		if existed {
+			changeType = models.ChangeUpdated
+		}
+		if err := models.RecordDocumentChange(utils.DB, changeType, &record); err != nil {
+			logging.FromContext(ctx).Error("Error recording change", "file", filePath, "error", err)
+		}
+	}
+
+	for documentID, record := range previous {
+		if written[documentID] {
+			continue
+		}
+		if err := removeExportedDocument(ctx, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sources"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// outlineUser is a user as returned in Outline membership listings.
+type outlineUser struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// outlineGroup is a group as returned in Outline membership listings.
+type outlineGroup struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// outlineMembership links a user or group to a collection.
+type outlineMembership struct {
+	UserID     string `json:"userId"`
+	GroupID    string `json:"groupId"`
+	Permission string `json:"permission"`
+}
+
+// postOutlinePage posts a paged request for a collection to the docs API and
+// decodes the response into out.
+func postOutlinePage(ctx context.Context, ws config.Workspace, endpoint, collectionID string, offset int, out interface{}) error {
+	payloadBytes, err := json.Marshal(map[string]interface{}{
+		"id":     collectionID,
+		"offset": offset,
+		"limit":  config.ConfigInstance.Limit,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/%s", ws.APIBaseURL, endpoint), bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+ws.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := sources.DoWithRateLimit(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("postOutlinePage: %s: unexpected status: %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// fetchCollectionPermissions lists who may read a collection: its user and
+// group memberships plus, for non-private collections, the whole workspace.
+func fetchCollectionPermissions(ctx context.Context, ws config.Workspace, collection models.Collection) ([]models.CollectionPermission, error) {
+	base := models.CollectionPermission{
+		Workspace:      ws.Name,
+		CollectionID:   collection.ID,
+		CollectionName: collection.Name,
+	}
+	var permissions []models.CollectionPermission
+	if collection.Permission != "" {
+		permission := base
+		permission.SubjectType = models.SubjectWorkspace
+		permission.Permission = collection.Permission
+		permissions = append(permissions, permission)
+	}
+
+	for offset := 0; ; offset += config.ConfigInstance.Limit {
+		var resp struct {
+			Data struct {
+				Users       []outlineUser       `json:"users"`
+				Memberships []outlineMembership `json:"memberships"`
+			} `json:"data"`
+		}
+		if err := postOutlinePage(ctx, ws, "collections.memberships", collection.ID, offset, &resp); err != nil {
+			return nil, err
+		}
+		if len(resp.Data.Memberships) == 0 {
+			break
+		}
+		users := make(map[string]outlineUser, len(resp.Data.Users))
+		for _, user := range resp.Data.Users {
+			users[user.ID] = user
+		}
+		for _, membership := range resp.Data.Memberships {
+			permission := base
+			permission.SubjectType = models.SubjectUser
+			permission.SubjectID = membership.UserID
+			permission.SubjectName = users[membership.UserID].Name
+			permission.Email = users[membership.UserID].Email
+			permission.Permission = membership.Permission
+			permissions = append(permissions, permission)
+		}
+	}
+
+	for offset := 0; ; offset += config.ConfigInstance.Limit {
+		var resp struct {
+			Data struct {
+				Groups           []outlineGroup      `json:"groups"`
+				GroupMemberships []outlineMembership `json:"groupMemberships"`
+			} `json:"data"`
+		}
+		if err := postOutlinePage(ctx, ws, "collections.group_memberships", collection.ID, offset, &resp); err != nil {
+			return nil, err
+		}
+		if len(resp.Data.GroupMemberships) == 0 {
+			break
+		}
+		groups := make(map[string]string, len(resp.Data.Groups))
+		for _, group := range resp.Data.Groups {
+			groups[group.ID] = group.Name
+		}
+		for _, membership := range resp.Data.GroupMemberships {
+			permission := base
+			permission.SubjectType = models.SubjectGroup
+			permission.SubjectID = membership.GroupID
+			permission.SubjectName = groups[membership.GroupID]
+			permission.Permission = membership.Permission
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions, nil
+}
+
+// runPermissionSync records the read permissions of every collection in every workspace.
+func runPermissionSync(ctx context.Context) error {
+	for _, ws := range config.ConfigInstance.Workspaces {
+		// Only Outline reports collection memberships.
+		if !ws.IsOutline() {
+			continue
+		}
+		collections, err := sources.For(ws).ListCollections(ctx)
+		if err != nil {
+			return fmt.Errorf("error fetching collections: %w", err)
+		}
+		for _, collection := range collections {
+			permissions, err := fetchCollectionPermissions(ctx, ws, collection)
+			if err != nil {
+				return fmt.Errorf("collection %s: %w", collection.Name, err)
+			}
+			if err := models.ReplaceCollectionPermissions(utils.DB, ws.Name, collection.ID, permissions); err != nil {
+				return err
+			}
+		}
+		logging.FromContext(ctx).Info("Synced permissions", "collections", len(collections))
+	}
+	return nil
+}
+
+// CollectionPermissions describes who may read a collection and which
+// knowledge collections its documents are uploaded to.
+type CollectionPermissions struct {
+	Workspace      string `json:"workspace,omitempty"`
+	CollectionID   string `json:"collection_id"`
+	CollectionName string `json:"collection_name"`
+	// KnowledgeIDs are the OpenWebUI knowledge collections the collection is routed to.
+	KnowledgeIDs []string                      `json:"knowledge_ids"`
+	Permissions  []models.CollectionPermission `json:"permissions"`
+}
+
+// SyncPermissionsHandler records the read permissions of all collections.
+// @Summary Sync collection permissions
+// @Description Reads the user and group memberships of every Outline collection and stores who can read it. With async=true, or when the process runs in API-only mode, the sync is queued as a background job.
+// @Tags permissions
+// @Produce plain
+// @Param async query bool false "Queue the sync as a background job"
+// @Success 200 {string} string "Permissions synced."
+// @Success 202 {object} models.Job
+// @Failure 500 {object} map[string]string "Sync failed"
+// @Router /permissions/sync [post]
+func SyncPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	if runInBackground(r) {
+		enqueueJob(w, r, "permissions.sync", struct{}{})
+		return
+	}
+	if err := runPermissionSync(context.WithoutCancel(r.Context())); err != nil {
+		http.Error(w, localize(r, "Sync failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeMessage(w, r, "Permissions synced.")
+}
+
+// GetCollectionPermissionsHandler returns who may read a collection.
+// @Summary Get collection permissions
+// @Description Returns the users, groups and workspace-wide access recorded for an Outline collection by the last permission sync, with the knowledge collections it is routed to, so OpenWebUI knowledge access can be configured accordingly.
+// @Tags permissions
+// @Produce json
+// @Param collection path string true "Outline collection ID or name"
+// @Success 200 {array} CollectionPermissions
+// @Failure 404 {object} map[string]string "No permissions recorded for this collection"
+// @Failure 500 {object} map[string]string "Failed to retrieve permissions"
+// @Router /permissions/{collection} [get]
+func GetCollectionPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	collection := mux.Vars(r)["collection"]
+	permissions, err := models.ListCollectionPermissions(utils.DB, collection)
+	if err != nil {
+		http.Error(w, "Failed to retrieve permissions", http.StatusInternalServerError)
+		return
+	}
+	if len(permissions) == 0 {
+		http.Error(w, "No permissions recorded for this collection", http.StatusNotFound)
+		return
+	}
+	mappings, err := models.GetCollectionMappingRecords(utils.DB)
+	if err != nil {
+		http.Error(w, "Failed to retrieve permissions", http.StatusInternalServerError)
+		return
+	}
+
+	// One entry per collection; a name can match collections in several workspaces.
+	var result []*CollectionPermissions
+	byCollection := make(map[string]*CollectionPermissions)
+	for _, permission := range permissions {
+		key := permission.Workspace + "/" + permission.CollectionID
+		entry, ok := byCollection[key]
+		if !ok {
+			entry = &CollectionPermissions{
+				Workspace:      permission.Workspace,
+				CollectionID:   permission.CollectionID,
+				CollectionName: permission.CollectionName,
+				KnowledgeIDs:   []string{},
+			}
+			if mapping, ok := models.LookupMapping(mappings, permission.Workspace, utils.SanitizeFilename(permission.CollectionName)); ok {
+				entry.KnowledgeIDs = append(entry.KnowledgeIDs, mapping.KnowledgeIDs()...)
+			}
+			byCollection[key] = entry
+			result = append(result, entry)
+		}
+		entry.Permissions = append(entry.Permissions, permission)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
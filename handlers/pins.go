@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/mikeshootzz/outline-rag-scraper/jobs"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// PinPayload represents the optional payload for pinning a document.
+type PinPayload struct {
+	Reason string `json:"reason"` // e.g., "restructuring in progress"
+}
+
+// PinDocumentHandler pins a document.
+// @Summary Pin a document
+// @Description Freezes the exported and uploaded version of a document: exports and webhook syncs leave it untouched regardless of upstream edits until it is unpinned. Deleting the document in Outline still removes it.
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param id path string true "Outline document ID"
+// @Param pin body PinPayload false "Pin payload"
+// @Success 200 {object} models.PinnedDocument
+// @Failure 400 {object} map[string]string "Invalid payload"
+// @Failure 500 {object} map[string]string "Failed to pin document"
+// @Router /documents/{id}/pin [post]
+func PinDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload PinPayload
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid payload", http.StatusBadRequest)
+			return
+		}
+	}
+	pin := models.PinnedDocument{
+		DocumentID: mux.Vars(r)["id"],
+		Reason:     payload.Reason,
+		PinnedBy:   principalFor(r),
+	}
+	err := utils.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "document_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reason", "pinned_by"}),
+	}).Create(&pin).Error
+	if err != nil {
+		http.Error(w, "Failed to pin document", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pin)
+}
+
+// UnpinDocumentHandler removes the pin of a document and queues a sync so
+// the document catches up with the edits made while it was pinned.
+// @Summary Unpin a document
+// @Description Removes the pin of a document and queues a sync of it to pick up the edits made in the meantime.
+// @Tags documents
+// @Param id path string true "Outline document ID"
+// @Success 204 "Unpinned"
+// @Failure 404 {object} map[string]string "Document not pinned"
+// @Failure 500 {object} map[string]string "Failed to unpin document"
+// @Router /documents/{id}/pin [delete]
+func UnpinDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	documentID := mux.Vars(r)["id"]
+	result := utils.DB.Where("document_id = ?", documentID).Delete(&models.PinnedDocument{})
+	if result.Error != nil {
+		http.Error(w, "Failed to unpin document", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Document not pinned", http.StatusNotFound)
+		return
+	}
+	record, err := models.GetExportedDocument(utils.DB, documentID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logging.FromContext(r.Context()).Error("Error loading document", "document_id", documentID, "error", err)
+	}
+	if err == nil {
+		params := documentSyncParams{Workspace: record.Workspace, DocumentID: documentID}
+		if _, err := jobs.Enqueue("document.sync", params, principalFor(r), models.PriorityNormal); err != nil {
+			logging.FromContext(r.Context()).Error("Error queuing sync of unpinned document", "document_id", documentID, "error", err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPinnedDocumentsHandler lists pinned documents.
+// @Summary Get pinned documents
+// @Description Lists the documents whose exported version is currently frozen.
+// @Tags documents
+// @Produce json
+// @Success 200 {array} models.PinnedDocument
+// @Failure 500 {object} map[string]string "Failed to retrieve pinned documents"
+// @Router /documents/pinned [get]
+func GetPinnedDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	pins, err := models.ListPinnedDocuments(utils.DB)
+	if err != nil {
+		http.Error(w, "Failed to retrieve pinned documents", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pins)
+}
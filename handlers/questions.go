@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// questionPrompt instructs the LLM how to write the questions of a document.
+const questionPrompt = "Write %d questions a colleague could ask that the following document answers. " +
+	"Use the terms of the document and make every question understandable on its own. " +
+	"Answer with one question per line, without numbering.\n\nTitle: %s\n\n%s"
+
+// questionInputLimit bounds the part of a document sent to the LLM.
+const questionInputLimit = 12000
+
+// generateQuestions returns the questions a document answers, asking the LLM
+// only if none are cached for the same content. Failures are logged and
+// leave the document without questions.
+func generateQuestions(ctx context.Context, documentID, title, markdown string) []string {
+	cfg := config.ConfigInstance
+	checksum := utils.Checksum([]byte(fmt.Sprintf("%s\n%d\n%s\n%s", cfg.QuestionModel, cfg.QuestionCount, title, markdown)))
+	if cached, err := models.GetDocumentQuestions(utils.DB, checksum); err == nil {
+		return cached
+	}
+	input := markdown
+	if runes := []rune(input); len(runes) > questionInputLimit {
+		input = string(runes[:questionInputLimit])
+	}
+	answer, err := completeChat(ctx, cfg.QuestionModel, fmt.Sprintf(questionPrompt, cfg.QuestionCount, title, input))
+	if err != nil {
+		logging.FromContext(ctx).Error("Error generating questions", "document_id", documentID, "error", err)
+		return nil
+	}
+	questions := parseQuestions(answer, cfg.QuestionCount)
+	if len(questions) == 0 {
+		logging.FromContext(ctx).Error("Error generating questions: no questions in the answer", "document_id", documentID)
+		return nil
+	}
+	if err := models.SaveDocumentQuestions(utils.DB, checksum, questions); err != nil {
+		logging.FromContext(ctx).Error("Error caching questions", "document_id", documentID, "error", err)
+	}
+	return questions
+}
+
+// parseQuestions takes up to limit questions from an LLM answer, dropping
+// list markers and numbering models add despite the prompt.
+func parseQuestions(answer string, limit int) []string {
+	var questions []string
+	for _, line := range strings.Split(answer, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimLeft(line, "-*•0123456789.) ")
+		if !strings.HasSuffix(line, "?") {
+			continue
+		}
+		questions = append(questions, line)
+		if len(questions) == limit {
+			break
+		}
+	}
+	return questions
+}
+
+// questionsSection renders the questions as a section appended to a document.
+func questionsSection(questions []string) string {
+	var section strings.Builder
+	section.WriteString("\n\n## Questions this document answers\n\n")
+	for _, question := range questions {
+		fmt.Fprintf(&section, "- %s\n", question)
+	}
+	return section.String()
+}
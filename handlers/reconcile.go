@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// adoptExistingKnowledge imports the current state of a knowledge collection
+// the first time the scraper syncs into it. Existing files are matched to the
+// local exported files by upload name or content hash; matches are adopted as
+// managed files, everything else is recorded as unmanaged so later syncs never
+// remove manually curated knowledge. Collections with tracked state are left alone.
+func adoptExistingKnowledge(ctx context.Context, knowledgeID string, filePaths []string, mappings map[string]models.CollectionMapping) error {
+	count, err := models.CountUploadedFiles(utils.DB, knowledgeID)
+	if err != nil || count > 0 {
+		return err
+	}
+	knowResp, err := fetchKnowledgeFiles(ctx, knowledgeID)
+	if err != nil {
+		return err
+	}
+	if len(knowResp.Files) == 0 {
+		return nil
+	}
+
+	byName := make(map[string]string)
+	byHash := make(map[string]string)
+	for _, filePath := range filePaths {
+		parts, err := prepareUploadParts(ctx, filePath, uploadOptionsFor(filePath, mappings))
+		if err != nil {
+			continue
+		}
+		for _, part := range parts {
+			byName[part.Name] = filePath
+			byHash[utils.Checksum(part.Content)] = filePath
+		}
+	}
+
+	adopted := 0
+	for _, file := range knowResp.Files {
+		record := models.UploadedFile{KnowledgeID: knowledgeID, FileID: file.ID, Name: file.Name()}
+		if filePath, ok := byName[file.Name()]; ok {
+			record.FilePath = filePath
+		} else if filePath, ok := byHash[file.Hash]; ok && file.Hash != "" {
+			record.FilePath = filePath
+		}
+		record.Managed = record.FilePath != ""
+		record.Adopted = record.Managed
+		record.Checksum = file.Hash
+		if record.Managed {
+			adopted++
+		}
+		if err := utils.DB.Create(&record).Error; err != nil {
+			return err
+		}
+	}
+	logging.FromContext(ctx).Info("Imported knowledge collection, unmanaged files left untouched",
+		"knowledge_id", knowledgeID, "adopted", adopted, "unmanaged", len(knowResp.Files)-adopted)
+	return nil
+}
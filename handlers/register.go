@@ -1,15 +1,116 @@
 // handlers/register.go
 package handlers
 
-import "github.com/gorilla/mux"
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+)
 
 // RegisterRoutes registers the API endpoints with the router.
 func RegisterRoutes(router *mux.Router) {
+	// Request IDs, single sign-on for OIDC_PROTECTED_PATHS, then API keys
+	// and their scopes with REQUIRE_API_KEY
+	router.Use(withRequestID, requireOIDC, requireAPIKey)
+	// Liveness probe, public by default
+	router.HandleFunc("/healthz", HealthzHandler).Methods("GET")
 	// Export endpoint
-	router.HandleFunc("/export", ExportDocumentsHandler).Methods("GET")
+	router.HandleFunc("/export", audited("export", ExportDocumentsHandler)).Methods("GET")
 	// Upload endpoint
-	router.HandleFunc("/upload", UploadDocumentsHandler).Methods("GET")
+	router.HandleFunc("/upload", audited("upload", UploadDocumentsHandler)).Methods("GET")
+	// Background jobs
+	router.HandleFunc("/jobs", GetJobsHandler).Methods("GET")
+	router.HandleFunc("/jobs/{id}", GetJobHandler).Methods("GET")
+	// Export and upload in one pipeline
+	router.HandleFunc("/sync", audited("sync", SyncHandler)).Methods("POST")
+	// Staged sync runs and the validation gate
+	router.HandleFunc("/sync/runs", GetSyncRunsHandler).Methods("GET")
+	router.HandleFunc("/sync/runs/{id}", GetSyncRunHandler).Methods("GET")
+	router.HandleFunc("/sync/runs/{id}/integrity", GetIntegrityReportHandler).Methods("GET")
+	router.HandleFunc("/sync/runs/{id}/approve", requireAdmin(audited("sync.approve", ApproveSyncRunHandler))).Methods("POST")
+	router.HandleFunc("/sync/runs/{id}/reject", requireAdmin(audited("sync.reject", RejectSyncRunHandler))).Methods("POST")
+	// Freeze window status
+	router.HandleFunc("/freeze", GetFreezeHandler).Methods("GET")
+	// Outline webhooks trigger priority single-document syncs
+	router.HandleFunc("/webhooks/outline", audited("webhook.outline", OutlineWebhookHandler)).Methods("POST")
+	// Exported document metadata
+	router.HandleFunc("/documents", GetDocumentsHandler).Methods("GET")
+	// Pinned documents keep their exported version until unpinned
+	router.HandleFunc("/documents/pinned", GetPinnedDocumentsHandler).Methods("GET")
+	router.HandleFunc("/documents/{id}/pin", audited("document.pin", PinDocumentHandler)).Methods("POST")
+	router.HandleFunc("/documents/{id}/pin", audited("document.unpin", UnpinDocumentHandler)).Methods("DELETE")
+	// Source diff of a document's latest change
+	router.HandleFunc("/documents/{id}/diff", GetDocumentDiffHandler).Methods("GET")
+	// Single-document sync capturing upstream calls for bug reports (requires ADMIN_API_KEY)
+	router.HandleFunc("/documents/{id}/debug-sync", requireAdmin(audited("document.debug_sync", DebugDocumentSyncHandler))).Methods("POST")
+	// Review queue for large document changes (approval requires ADMIN_API_KEY)
+	router.HandleFunc("/reviews", GetReviewsHandler).Methods("GET")
+	router.HandleFunc("/reviews/{id}/approve", requireAdmin(audited("review.approve", ApproveReviewHandler))).Methods("POST")
+	router.HandleFunc("/reviews/{id}/reject", requireAdmin(audited("review.reject", RejectReviewHandler))).Methods("POST")
+	// Change feed for external indexers
+	router.HandleFunc("/changes", GetChangesHandler).Methods("GET")
+	// Activity statistics for knowledge owners
+	router.HandleFunc("/stats", GetStatsHandler).Methods("GET")
+	// Corpus quality reports for knowledge owners
+	router.HandleFunc("/reports/duplicates", GetDuplicatesHandler).Methods("GET")
+	router.HandleFunc("/reports/broken-links", GetBrokenLinksHandler).Methods("GET")
+	router.HandleFunc("/reports/excluded", GetExcludedDocumentsHandler).Methods("GET")
+	// Per-collection sync status, linkable from Outline
+	router.HandleFunc("/status/collections/{name}", GetCollectionStatusHandler).Methods("GET")
+	// Outline collection permissions
+	router.HandleFunc("/permissions/sync", audited("permissions.sync", SyncPermissionsHandler)).Methods("POST")
+	router.HandleFunc("/permissions/{collection}", GetCollectionPermissionsHandler).Methods("GET")
 	// Mapping endpoints
-	router.HandleFunc("/mappings", CreateMappingHandler).Methods("POST")
+	router.HandleFunc("/mappings", audited("mapping.create", CreateMappingHandler)).Methods("POST")
 	router.HandleFunc("/mappings", GetMappingsHandler).Methods("GET")
+	router.HandleFunc("/mappings/discover", audited("mapping.discover", DiscoverMappingsHandler)).Methods("POST")
+	router.HandleFunc("/mappings/{id}", GetMappingHandler).Methods("GET")
+	router.HandleFunc("/mappings/{id}", audited("mapping.update", UpdateMappingHandler)).Methods("PUT")
+	router.HandleFunc("/mappings/{id}", audited("mapping.delete", DeleteMappingHandler)).Methods("DELETE")
+	router.HandleFunc("/mappings/{id}/sync", audited("mapping.sync", SyncMappingHandler)).Methods("POST")
+	// Scoped API key management (requires ADMIN_API_KEY)
+	router.HandleFunc("/apikeys", requireAdmin(audited("apikey.create", CreateAPIKeyHandler))).Methods("POST")
+	router.HandleFunc("/apikeys", requireAdmin(GetAPIKeysHandler)).Methods("GET")
+	router.HandleFunc("/apikeys/{id}", requireAdmin(audited("apikey.delete", DeleteAPIKeyHandler))).Methods("DELETE")
+	router.HandleFunc("/users", requireAdmin(audited("user.create", CreateUserHandler))).Methods("POST")
+	router.HandleFunc("/users", requireAdmin(GetUsersHandler)).Methods("GET")
+	router.HandleFunc("/users/{id}", requireAdmin(audited("user.update", UpdateUserHandler))).Methods("PUT")
+	router.HandleFunc("/users/{id}", requireAdmin(audited("user.delete", DeleteUserHandler))).Methods("DELETE")
+	router.HandleFunc("/roles", requireAdmin(audited("role.create", CreateRoleHandler))).Methods("POST")
+	router.HandleFunc("/roles", requireAdmin(GetRolesHandler)).Methods("GET")
+	router.HandleFunc("/roles/{id}", requireAdmin(audited("role.delete", DeleteRoleHandler))).Methods("DELETE")
+	// Per-user Outline tokens (requires ADMIN_API_KEY)
+	router.HandleFunc("/usertokens", requireAdmin(audited("usertoken.create", CreateUserTokenHandler))).Methods("POST")
+	router.HandleFunc("/usertokens", requireAdmin(GetUserTokensHandler)).Methods("GET")
+	router.HandleFunc("/usertokens/{id}", requireAdmin(audited("usertoken.delete", DeleteUserTokenHandler))).Methods("DELETE")
+	router.HandleFunc("/usertokens/{id}/sync", requireAdmin(audited("usertoken.sync", SyncUserTokenHandler))).Methods("POST")
+	// Users connect their own Outline account through OAuth
+	router.HandleFunc("/oauth/outline/connect", ConnectOutlineHandler).Methods("GET")
+	router.HandleFunc("/oauth/outline/callback", audited("usertoken.connect", OutlineOAuthCallbackHandler)).Methods("GET")
+	// Single sign-on through an OIDC provider
+	router.HandleFunc("/oauth/oidc/login", OIDCLoginHandler).Methods("GET")
+	router.HandleFunc("/oauth/oidc/callback", audited("oidc.login", OIDCCallbackHandler)).Methods("GET")
+	router.HandleFunc("/oauth/oidc/logout", OIDCLogoutHandler).Methods("POST")
+	// Master key rotation for stored tokens (requires ADMIN_API_KEY)
+	router.HandleFunc("/secrets/rotate", requireAdmin(audited("secrets.rotate", RotateSecretsHandler))).Methods("POST")
+	// Token health checks and metrics
+	router.HandleFunc("/tokens/health", requireAdmin(GetTokenHealthHandler)).Methods("GET")
+	// Report of upstream calls answered from recorded fixtures (requires ADMIN_API_KEY)
+	router.HandleFunc("/simulation", requireAdmin(GetSimulationHandler)).Methods("GET")
+	router.HandleFunc("/metrics", MetricsHandler).Methods("GET")
+	// Audit trail (requires ADMIN_API_KEY)
+	router.HandleFunc("/audit", requireAdmin(GetAuditHandler)).Methods("GET")
+	// Maintenance endpoints
+	router.HandleFunc("/maintenance/verify", audited("maintenance.verify", VerifyKnowledgeHandler)).Methods("POST")
+	router.HandleFunc("/maintenance/corpus/rollback", requireAdmin(audited("corpus.rollback", RollbackCorpusHandler))).Methods("POST")
+	// Read-only HTTP/WebDAV access to the exported corpus
+	if config.ConfigInstance.ServeCorpus {
+		router.PathPrefix("/corpus/").Handler(NewCorpusHandler("/corpus"))
+	}
+	// Static HTML mirror of the corpus, always behind authentication
+	if config.ConfigInstance.StaticSite {
+		router.PathPrefix("/site/").Handler(requireReader(http.StripPrefix("/site/", http.FileServer(http.Dir(config.ConfigInstance.SiteDir)))))
+	}
 }
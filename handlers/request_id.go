@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+)
+
+// requestIDHeader carries the ID of a request, set by a proxy or generated.
+const requestIDHeader = "X-Request-ID"
+
+// withRequestID returns every request's ID in the X-Request-ID response
+// header, reusing the one a proxy sent, and logs the request at debug level
+// under it.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = logging.NewID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		started := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		slog.Debug("HTTP request", "request_id", id, "method", r.Method, "path", r.URL.Path,
+			"status", rec.status, "duration_ms", time.Since(started).Milliseconds())
+	})
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/textdiff"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// diffChangedLines counts the added and removed lines of a unified diff.
+func diffChangedLines(diff string) int {
+	changed := 0
+	inHunk := false
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+		case inHunk && (strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-")):
+			changed++
+		}
+	}
+	return changed
+}
+
+// reviewApprovalKey is the context key of the review an export is approved by.
+type reviewApprovalKey struct{}
+
+// withReviewApproval returns a copy of ctx whose export of the change under
+// review in item is written rather than held.
+func withReviewApproval(ctx context.Context, item *models.ReviewItem) context.Context {
+	return context.WithValue(ctx, reviewApprovalKey{}, item)
+}
+
+// approvedBy reports whether ctx carries the approval of item's change.
+func approvedBy(ctx context.Context, item *models.ReviewItem) bool {
+	approval, ok := ctx.Value(reviewApprovalKey{}).(*models.ReviewItem)
+	return ok && approval.DocumentID == item.DocumentID && approval.ChangedAt.Equal(item.ChangedAt)
+}
+
+// holdForReview reports whether the export of a document must wait for a
+// reviewer instead of being written. A change of at least REVIEW_DIFF_LINES
+// source lines is queued for review and held until approved. While a change
+// is pending or after it was rejected, later changes are held too, since
+// their content still carries it. A held export leaves the local file at its
+// previous version, and with it the corpus, the site, the remote mirror and
+// the knowledge collections. First exports are never held.
+func holdForReview(ctx context.Context, documentID, title, collection, filePath, markdown string) bool {
+	cfg := config.ConfigInstance
+	if cfg.ReviewDiffLines <= 0 {
+		return false
+	}
+	if len(cfg.ReviewCollections) > 0 && !slices.Contains(cfg.ReviewCollections, collectionOf(filePath)) {
+		return false
+	}
+	previous, err := models.GetDocumentDiff(utils.DB, documentID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logging.FromContext(ctx).Error("Error loading diff", "document_id", documentID, "error", err)
+		}
+		return false
+	}
+	item, err := models.GetReviewItem(utils.DB, documentID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logging.FromContext(ctx).Error("Error loading review", "document_id", documentID, "error", err)
+		return true
+	}
+	unreviewed := item != nil && item.Status != models.ReviewApproved
+	if previous.Content == markdown {
+		// The source is unchanged, so the review of its last change decides.
+		if item == nil || !item.ChangedAt.Equal(previous.ChangedAt) {
+			return false
+		}
+		return unreviewed && !approvedBy(ctx, item)
+	}
+	changed := diffChangedLines(textdiff.Unified("a/"+documentID, "b/"+documentID, previous.Content, markdown, diffContextLines))
+	if unreviewed {
+		changed += item.ChangedLines
+	} else if changed < cfg.ReviewDiffLines {
+		return false
+	}
+	recordSourceDiff(ctx, documentID, markdown)
+	diff, err := models.GetDocumentDiff(utils.DB, documentID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error loading diff", "document_id", documentID, "error", err)
+		return true
+	}
+	queued := &models.ReviewItem{
+		DocumentID:   documentID,
+		FilePath:     filePath,
+		Title:        title,
+		Collection:   collection,
+		ChangedLines: changed,
+		ChangedAt:    diff.ChangedAt,
+	}
+	if err := models.QueueReviewItem(utils.DB, queued); err != nil {
+		logging.FromContext(ctx).Error("Error queuing review", "document_id", documentID, "error", err)
+	} else {
+		logging.FromContext(ctx).Info("Holding document for review", "document_id", documentID, "file", filePath, "changed_lines", changed)
+	}
+	return true
+}
+
+// loadReviewItem returns the review named by the request's id.
+func loadReviewItem(w http.ResponseWriter, r *http.Request) (*models.ReviewItem, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return nil, false
+	}
+	var item models.ReviewItem
+	if err := utils.DB.First(&item, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Review not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Failed to retrieve review", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &item, true
+}
+
+// GetReviewsHandler lists document changes held for review.
+// @Summary List reviews
+// @Description Lists document changes whose diff reached REVIEW_DIFF_LINES changed lines, oldest first. Their exports are held, so the local files, the corpus, the site, the remote mirror and the knowledge collections keep the previous version, until a reviewer approves them.
+// @Tags reviews
+// @Produce json
+// @Param status query string false "pending, approved or rejected (all if omitted)"
+// @Success 200 {array} models.ReviewItem
+// @Failure 500 {object} map[string]string "Failed to retrieve reviews"
+// @Router /reviews [get]
+func GetReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	items, err := models.ListReviewItems(utils.DB, r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, "Failed to retrieve reviews", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// setReviewStatus records the decision on a pending review. The update only
+// applies while the review is still pending on the same change, so a change
+// queued meanwhile is not decided unseen.
+func setReviewStatus(w http.ResponseWriter, r *http.Request, item *models.ReviewItem, status string) bool {
+	now := time.Now()
+	result := utils.DB.Model(&models.ReviewItem{}).
+		Where("id = ? AND status = ? AND changed_at = ?", item.ID, models.ReviewPending, item.ChangedAt).
+		Updates(map[string]interface{}{"status": status, "reviewed_by": principalFor(r), "reviewed_at": now})
+	if result.Error != nil {
+		http.Error(w, "Failed to update review", http.StatusInternalServerError)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Review is not pending", http.StatusConflict)
+		return false
+	}
+	item.Status, item.ReviewedBy, item.ReviewedAt = status, principalFor(r), &now
+	setAuditTarget(r, "document:"+item.DocumentID)
+	return true
+}
+
+// ApproveReviewHandler approves a held document change and publishes it.
+// @Summary Approve a review
+// @Description Approves a held document change. Documents from Outline are exported again right away and published like a document sync: written locally, staged, and after the sync gate copied to the corpus, the site, the remote mirror and the knowledge collections; during a freeze window the upload is queued until the freeze ends. The review is only marked approved once that succeeded. Documents from other sources are exported by the next sync. If the document changed again since the review was queued, nothing is published and the new change is up for review instead. Requires ADMIN_API_KEY.
+// @Tags reviews
+// @Produce json
+// @Param id path int true "Review ID"
+// @Success 200 {object} models.ReviewItem
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Review not found"
+// @Failure 409 {object} map[string]string "Review is not pending, or the document changed again"
+// @Failure 500 {object} map[string]string "Upload failed"
+// @Router /reviews/{id}/approve [post]
+func ApproveReviewHandler(w http.ResponseWriter, r *http.Request) {
+	item, ok := loadReviewItem(w, r)
+	if !ok {
+		return
+	}
+	if item.Status != models.ReviewPending {
+		http.Error(w, "Review is not pending", http.StatusConflict)
+		return
+	}
+	record, err := models.GetExportedDocument(utils.DB, item.DocumentID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve document", http.StatusInternalServerError)
+		return
+	}
+	if ws, ok := findWorkspace(record.Workspace); ok && ws.IsOutline() {
+		ctx := withReviewApproval(context.WithoutCancel(r.Context()), item)
+		if err := runDocumentSync(ctx, documentSyncParams{Workspace: ws.Name, DocumentID: item.DocumentID}); err != nil {
+			logging.FromContext(ctx).Error("Error publishing approved document", "document_id", item.DocumentID, "error", err)
+			http.Error(w, "Upload failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if current, err := models.GetReviewItem(utils.DB, item.DocumentID); err == nil && !current.ChangedAt.Equal(item.ChangedAt) {
+			http.Error(w, "Document changed again since the review was queued; review the new change", http.StatusConflict)
+			return
+		}
+	}
+	if !setReviewStatus(w, r, item, models.ReviewApproved) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+// RejectReviewHandler rejects a held document change.
+// @Summary Reject a review
+// @Description Rejects a held document change. The knowledge collections keep the previous version; later changes of the document are held for review again, since they still contain the rejected one. Requires ADMIN_API_KEY.
+// @Tags reviews
+// @Produce json
+// @Param id path int true "Review ID"
+// @Success 200 {object} models.ReviewItem
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Review not found"
+// @Failure 409 {object} map[string]string "Review is not pending"
+// @Failure 500 {object} map[string]string "Failed to update review"
+// @Router /reviews/{id}/reject [post]
+func RejectReviewHandler(w http.ResponseWriter, r *http.Request) {
+	item, ok := loadReviewItem(w, r)
+	if !ok || !setReviewStatus(w, r, item, models.ReviewRejected) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/jobs"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// schedulerPrincipal is recorded as the principal of scheduled syncs.
+const schedulerPrincipal = "scheduler"
+
+// enqueueScheduledSync queues the sync job of a schedule's slot unless one is
+// still waiting, and records it in the audit trail.
+func enqueueScheduledSync(schedule config.Schedule, slot time.Time) error {
+	return enqueueScheduled("sync", "sync", syncParams{}, "sync:"+schedule.String(), slot)
+}
+
+// enqueueScheduled queues a job of jobType for the run of schedule due at
+// slot unless another scheduler already claimed that slot or an identical job
+// is still waiting, and records it in the audit trail as action.
+func enqueueScheduled(jobType, action string, params interface{}, schedule string, slot time.Time) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	// Several processes may run the scheduler; the first to claim the slot queues it.
+	claimed, err := models.ClaimScheduleSlot(utils.DB, schedule, slot)
+	if err != nil || !claimed {
+		return err
+	}
+	event := &models.AuditEvent{
+		Principal: schedulerPrincipal,
+		Trigger:   models.TriggerSchedule,
+		Action:    action,
+		Status:    http.StatusAccepted,
+	}
+	// A run still waiting from an earlier slot covers this one.
+	queued, err := models.FindQueuedJob(utils.DB, jobType, string(data))
+	if err != nil {
+		return err
+	}
+	if queued != nil {
+		event.Target = "job:" + strconv.FormatUint(uint64(queued.ID), 10)
+	} else {
+		job, err := jobs.Enqueue(jobType, params, schedulerPrincipal, models.PriorityNormal)
+		if err != nil {
+			event.Status = http.StatusInternalServerError
+			if recErr := models.RecordAuditEvent(utils.DB, event); recErr != nil {
+				slog.Error("Error recording audit event", "action", action, "error", recErr)
+			}
+			return err
+		}
+		event.Target = "job:" + strconv.FormatUint(uint64(job.ID), 10)
+	}
+	return models.RecordAuditEvent(utils.DB, event)
+}
+
+// scheduleJitter returns the random delay added to a scheduled sync.
+func scheduleJitter() time.Duration {
+	if config.ConfigInstance.SyncJitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(config.ConfigInstance.SyncJitter)))
+}
+
+// nextRun returns the earliest time one of schedules is due after now, or nil.
+func nextRun(schedules []config.Schedule, now time.Time) *time.Time {
+	var next *time.Time
+	for _, schedule := range schedules {
+		if t := schedule.Next(now); next == nil || t.Before(*next) {
+			next = &t
+		}
+	}
+	return next
+}
+
+// userSchedulePollInterval is how often user token schedules are checked.
+const userSchedulePollInterval = time.Minute
+
+// enqueueDueUserSyncs queues a sync for every user token whose schedule is
+// due and advances its next sync time. The conditional update claims the
+// slot, so only one of several schedulers queues it.
+func enqueueDueUserSyncs(now time.Time) error {
+	var due []models.UserToken
+	if err := utils.DB.Where("next_sync_at <= ?", now).Find(&due).Error; err != nil {
+		return err
+	}
+	for _, record := range due {
+		next, err := nextUserSync(record.Schedule, now)
+		if err != nil {
+			slog.Error("Error parsing schedule of user token", "user", record.Name, "error", err)
+		}
+		claim := utils.DB.Model(&models.UserToken{}).
+			Where("id = ? AND next_sync_at = ?", record.ID, record.NextSyncAt).
+			Update("next_sync_at", next)
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+		schedule := "usertoken:" + strconv.FormatUint(uint64(record.ID), 10)
+		if err := enqueueScheduled("user.sync", "usertoken.sync", userTokenParams{ID: record.ID}, schedule, *record.NextSyncAt); err != nil {
+			slog.Error("Error queuing scheduled sync of user token", "user", record.Name, "error", err)
+		}
+	}
+	return nil
+}
+
+// StartScheduler queues a sync whenever one of the SYNC_SCHEDULE entries is
+// due, in the schedule's time zone and delayed by up to SYNC_JITTER, and
+// syncs user tokens on their own schedules, until ctx is done.
+func StartScheduler(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(userSchedulePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := enqueueDueUserSyncs(now); err != nil {
+					logging.FromContext(ctx).Error("Error checking user token schedules", "error", err)
+				}
+			}
+		}
+	}()
+	for _, schedule := range config.ConfigInstance.SyncSchedules {
+		go func(schedule config.Schedule) {
+			for {
+				// The next slot is computed from after the jittered run, so no slot runs twice.
+				slot := schedule.Next(time.Now())
+				next := slot.Add(scheduleJitter())
+				logging.FromContext(ctx).Info("Next scheduled sync", "schedule", schedule.String(), "at", next.Format(time.RFC3339))
+				timer := time.NewTimer(time.Until(next))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+					if err := enqueueScheduledSync(schedule, slot); err != nil {
+						logging.FromContext(ctx).Error("Error queuing scheduled sync", "schedule", schedule.String(), "error", err)
+					}
+				}
+			}
+		}(schedule)
+	}
+}
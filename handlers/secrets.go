@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// encryptSecret seals a token with the current master key.
+func encryptSecret(plaintext string) (string, error) {
+	return utils.EncryptString(config.ConfigInstance.TokenEncryptionKey, plaintext)
+}
+
+// secretKeys returns the current master key followed by the old ones.
+func secretKeys() []string {
+	if config.ConfigInstance.TokenEncryptionKey == "" {
+		return nil
+	}
+	return append([]string{config.ConfigInstance.TokenEncryptionKey}, config.ConfigInstance.TokenEncryptionOldKeys...)
+}
+
+// decryptSecret opens a token sealed with the current or an old master key.
+func decryptSecret(encoded string) (string, error) {
+	plaintext, _, err := utils.DecryptWithKeys(secretKeys(), encoded)
+	return plaintext, err
+}
+
+// rotateSecret re-encrypts a sealed token with the current master key. It
+// reports whether the value changed.
+func rotateSecret(encoded *string) (bool, error) {
+	if *encoded == "" {
+		return false, nil
+	}
+	plaintext, current, err := utils.DecryptWithKeys(secretKeys(), *encoded)
+	if err != nil || current {
+		return false, err
+	}
+	if *encoded, err = encryptSecret(plaintext); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// rotateSecrets re-encrypts every stored token not yet sealed with the current
+// master key and returns how many records changed. Tokens that cannot be
+// decrypted with any configured key are logged and left alone.
+func rotateSecrets() (int, error) {
+	var records []models.UserToken
+	if err := utils.DB.Find(&records).Error; err != nil {
+		return 0, err
+	}
+	rotated := 0
+	for _, record := range records {
+		changed := false
+		for _, field := range []*string{&record.EncryptedToken, &record.EncryptedRefreshToken} {
+			ok, err := rotateSecret(field)
+			if err != nil {
+				slog.Error("Error rotating token of user token", "user", record.Name, "error", err)
+			}
+			changed = changed || ok
+		}
+		if !changed {
+			continue
+		}
+		if err := utils.DB.Model(&record).Select("encrypted_token", "encrypted_refresh_token").Updates(&record).Error; err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
+
+// RotateStoredSecrets re-encrypts stored tokens sealed with an old master key
+// at startup, so old keys can be dropped after one restart.
+func RotateStoredSecrets() {
+	if len(config.ConfigInstance.TokenEncryptionOldKeys) == 0 {
+		return
+	}
+	rotated, err := rotateSecrets()
+	if err != nil {
+		slog.Error("Error rotating stored tokens", "error", err)
+		return
+	}
+	slog.Info("Re-encrypted user tokens with the current master key", "tokens", rotated)
+}
+
+// RotateSecretsHandler re-encrypts stored tokens with the current master key.
+// @Summary Rotate the token encryption key
+// @Description Re-encrypts every stored token sealed with one of TOKEN_ENCRYPTION_OLD_KEYS (or written before key IDs were recorded) with the current TOKEN_ENCRYPTION_KEY. Once it reports no failures in the log, the old keys can be removed. Requires ADMIN_API_KEY.
+// @Tags usertokens
+// @Produce json
+// @Success 200 {object} map[string]int "Number of re-encrypted records"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "TOKEN_ENCRYPTION_KEY is not configured"
+// @Failure 500 {object} map[string]string "Rotation failed"
+// @Router /secrets/rotate [post]
+func RotateSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	if config.ConfigInstance.TokenEncryptionKey == "" {
+		http.Error(w, "TOKEN_ENCRYPTION_KEY is not configured", http.StatusForbidden)
+		return
+	}
+	rotated, err := rotateSecrets()
+	if err != nil {
+		http.Error(w, "Rotation failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"rotated": rotated})
+}
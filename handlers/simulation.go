@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// simulationUnmatchedLimit bounds the unmatched requests kept for the report.
+const simulationUnmatchedLimit = 100
+
+// simulatedCommand is the recorded outcome of an external command, such as
+// a git fetch or an rsync push.
+type simulatedCommand struct {
+	Command  string   `json:"command"`
+	Args     []string `json:"args,omitempty"`
+	Stdout   string   `json:"stdout,omitempty"`
+	Stderr   string   `json:"stderr,omitempty"`
+	ExitCode int      `json:"exit_code,omitempty"`
+}
+
+// simulator answers upstream calls and commands from recorded fixtures.
+type simulator struct {
+	mu sync.Mutex
+	// fixtures holds the exchanges by method and URL path, in recording order.
+	fixtures map[string][]capturedExchange
+	// commands holds the command fixtures by commandKey, in recording order.
+	commands map[string][]simulatedCommand
+	// cursors counts how often a fixture list was served, by list key.
+	cursors   map[string]int
+	total     int
+	served    int
+	unmatched []string
+	// normalize sanitizes live requests like recorded ones, so redacted
+	// bodies still match.
+	normalize *debugCapture
+}
+
+// activeSimulator is set at startup when SIMULATION_FIXTURES is configured.
+var activeSimulator *simulator
+
+// simulationKey identifies the fixtures a request can be answered from. Hosts
+// are ignored, so fixtures recorded against production also answer a
+// configuration pointing elsewhere.
+func simulationKey(method, path string) string {
+	return method + " " + path
+}
+
+// commandKey identifies the fixtures a command can be answered from: the
+// program, and for git the subcommand, since paths and URLs differ between
+// setups.
+func commandKey(name string, args []string) string {
+	name = filepath.Base(name)
+	if name != "git" {
+		return name
+	}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-C" || args[i] == "-c":
+			i++
+		case !strings.HasPrefix(args[i], "-"):
+			return name + " " + args[i]
+		}
+	}
+	return name
+}
+
+// loadFixtures reads every exchange and command below dir, such as the
+// exchanges/ of an unpacked debug bundle. Files are read in lexical order,
+// which keeps the order of a recording.
+func loadFixtures(dir string) (*simulator, error) {
+	s := &simulator{
+		fixtures:  make(map[string][]capturedExchange),
+		commands:  make(map[string][]simulatedCommand),
+		cursors:   make(map[string]int),
+		normalize: &debugCapture{secrets: configuredSecrets()},
+	}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(path) != ".json" || entry.Name() == "manifest.json" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var command simulatedCommand
+		if err := json.Unmarshal(data, &command); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if command.Command != "" {
+			key := commandKey(command.Command, command.Args)
+			s.commands[key] = append(s.commands[key], command)
+			s.total++
+			return nil
+		}
+		var exchange capturedExchange
+		if err := json.Unmarshal(data, &exchange); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if exchange.Request.Method == "" || exchange.Response == nil {
+			slog.Warn("Skipping fixture: no request or response recorded", "file", path)
+			return nil
+		}
+		u, err := url.Parse(exchange.Request.URL)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		key := simulationKey(exchange.Request.Method, u.Path)
+		s.fixtures[key] = append(s.fixtures[key], exchange)
+		s.total++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// pick returns the fixture for a request: recordings with the same body are
+// preferred, then any recording of the method and path. Recordings are served
+// in order and the last one is repeated.
+func (s *simulator) pick(req *http.Request, body []byte) (capturedExchange, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := simulationKey(req.Method, req.URL.Path)
+	candidates := s.fixtures[key]
+	if len(candidates) == 0 {
+		if len(s.unmatched) < simulationUnmatchedLimit {
+			s.unmatched = append(s.unmatched, key)
+		}
+		return capturedExchange{}, false
+	}
+	live := s.normalize.sanitize(req.Header, req.Header.Get("Content-Type"), body).Body
+	var sameBody []capturedExchange
+	for _, exchange := range candidates {
+		if exchange.Request.Body == live {
+			sameBody = append(sameBody, exchange)
+		}
+	}
+	if len(sameBody) > 0 {
+		candidates, key = sameBody, key+"\x00"+live
+	}
+	i := s.cursors[key]
+	if i >= len(candidates) {
+		i = len(candidates) - 1
+	}
+	s.cursors[key]++
+	s.served++
+	return candidates[i], true
+}
+
+// RoundTrip answers a request from the fixtures; requests without one get a
+// 501, so they fail like an unsupported upstream call.
+func (s *simulator) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    req,
+	}
+	exchange, ok := s.pick(req, body)
+	if !ok {
+		logging.FromContext(req.Context()).Warn("Simulation: no fixture for request", "method", req.Method, "path", req.URL.Path)
+		resp.StatusCode, resp.Status = http.StatusNotImplemented, "501 Not Implemented"
+		resp.Header.Set("Content-Type", "application/json")
+		payload, _ := json.Marshal(map[string]string{"error": "no fixture for " + simulationKey(req.Method, req.URL.Path)})
+		resp.Body = io.NopCloser(strings.NewReader(string(payload)))
+		resp.ContentLength = int64(len(payload))
+		return resp, nil
+	}
+	recorded := exchange.Response
+	resp.Status = recorded.Status
+	resp.StatusCode, _ = strconv.Atoi(strings.Fields(recorded.Status + " 200")[0])
+	for key, values := range recorded.Headers {
+		if key == "Content-Length" || key == "Content-Encoding" || key == "Transfer-Encoding" {
+			continue
+		}
+		resp.Header[key] = values
+	}
+	resp.Body = io.NopCloser(strings.NewReader(recorded.Body))
+	resp.ContentLength = int64(len(recorded.Body))
+	return resp, nil
+}
+
+// Run answers a command from the fixtures, writing the recorded output to
+// the command's stdout and stderr. Commands without a fixture fail.
+func (s *simulator) Run(cmd *exec.Cmd) error {
+	key := commandKey(cmd.Path, cmd.Args[1:])
+	s.mu.Lock()
+	candidates := s.commands[key]
+	if len(candidates) == 0 {
+		if len(s.unmatched) < simulationUnmatchedLimit {
+			s.unmatched = append(s.unmatched, key)
+		}
+		s.mu.Unlock()
+		slog.Warn("Simulation: no fixture for command", "command", key)
+		return fmt.Errorf("simulation: no fixture for command %s", key)
+	}
+	i := s.cursors[key]
+	if i >= len(candidates) {
+		i = len(candidates) - 1
+	}
+	s.cursors[key]++
+	s.served++
+	s.mu.Unlock()
+
+	command := candidates[i]
+	if cmd.Stdout != nil {
+		io.WriteString(cmd.Stdout, command.Stdout)
+	}
+	if cmd.Stderr != nil {
+		io.WriteString(cmd.Stderr, command.Stderr)
+	}
+	if command.ExitCode != 0 {
+		return fmt.Errorf("exit status %d", command.ExitCode)
+	}
+	return nil
+}
+
+// StartSimulation returns ctx set up to answer every upstream call and
+// command from the recorded fixtures of SIMULATION_FIXTURES, or ctx itself
+// when simulation is off. Everything that may contact an upstream must run
+// with the returned context.
+func StartSimulation(ctx context.Context) context.Context {
+	dir := config.ConfigInstance.SimulationFixtures
+	if dir == "" {
+		return ctx
+	}
+	s, err := loadFixtures(dir)
+	if err != nil {
+		logging.Fatal("Error loading simulation fixtures", "error", err)
+	}
+	if s.total == 0 {
+		logging.Fatal("SIMULATION_FIXTURES contains no recorded exchanges", "dir", dir)
+	}
+	activeSimulator = s
+	logging.FromContext(ctx).Info("Simulation mode: answering upstream calls from recorded exchanges", "exchanges", s.total, "dir", dir)
+	ctx = utils.WithHTTPClient(ctx, &http.Client{Transport: s})
+	return utils.WithCommandRunner(ctx, s)
+}
+
+// GetSimulationHandler reports how upstream calls were answered.
+// @Summary Get simulation report
+// @Description In simulation mode (SIMULATION_FIXTURES), reports how many recorded exchanges were loaded and served, and which upstream calls had no fixture and failed. Requires ADMIN_API_KEY.
+// @Tags status
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Simulation mode is off"
+// @Router /simulation [get]
+func GetSimulationHandler(w http.ResponseWriter, r *http.Request) {
+	s := activeSimulator
+	if s == nil {
+		http.Error(w, "Simulation mode is off", http.StatusNotFound)
+		return
+	}
+	s.mu.Lock()
+	report := map[string]interface{}{
+		"fixtures_dir": config.ConfigInstance.SimulationFixtures,
+		"fixtures":     s.total,
+		"served":       s.served,
+		"unmatched":    append([]string{}, s.unmatched...),
+	}
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// DocumentActivity summarizes how often a document changed and was synced.
+type DocumentActivity struct {
+	DocumentID string `json:"document_id"`
+	Title      string `json:"title"`
+	Collection string `json:"collection"`
+	// Updates is the number of content changes within the window.
+	Updates int `json:"updates"`
+	// Syncs is the total number of uploads to OpenWebUI.
+	Syncs int `json:"syncs"`
+}
+
+// CollectionActivity aggregates document activity per collection.
+type CollectionActivity struct {
+	Collection string `json:"collection"`
+	Documents  int    `json:"documents"`
+	// Updates is the number of content changes within the window.
+	Updates int `json:"updates"`
+	// UpdatedDocuments is how many distinct documents changed within the window.
+	UpdatedDocuments int `json:"updated_documents"`
+	// Syncs is the total number of uploads to OpenWebUI.
+	Syncs int `json:"syncs"`
+	// LastChange is the most recent content change, if any.
+	LastChange *time.Time `json:"last_change,omitempty"`
+}
+
+// StatsResponse is the activity report for knowledge owners.
+type StatsResponse struct {
+	WindowDays  int                  `json:"window_days"`
+	Collections []CollectionActivity `json:"collections"`
+	// MostUpdated lists the documents with the most changes in the window.
+	MostUpdated []DocumentActivity `json:"most_updated"`
+}
+
+// GetStatsHandler reports document and collection activity.
+// @Summary Get activity statistics
+// @Description Reports per-collection activity and the most frequently updated documents, helping knowledge owners decide which collections deserve tighter sync schedules. Only document-level counts are reported; no user data is collected.
+// @Tags stats
+// @Produce json
+// @Param days query int false "Window for update counts in days (default 30)"
+// @Param limit query int false "Number of most updated documents to list (default 10)"
+// @Success 200 {object} StatsResponse
+// @Failure 400 {object} map[string]string "Invalid parameter"
+// @Failure 500 {object} map[string]string "Failed to compute statistics"
+// @Router /stats [get]
+func GetStatsHandler(w http.ResponseWriter, r *http.Request) {
+	days, limit := 30, 10
+	if d := r.URL.Query().Get("days"); d != "" {
+		n, err := strconv.Atoi(d)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	records, err := models.ListExportedDocuments(utils.DB)
+	if err != nil {
+		http.Error(w, "Failed to compute statistics", http.StatusInternalServerError)
+		return
+	}
+	var changes []models.DocumentChange
+	since := time.Now().AddDate(0, 0, -days)
+	if err := utils.DB.Where("created_at >= ? AND type = ?", since, models.ChangeUpdated).Find(&changes).Error; err != nil {
+		http.Error(w, "Failed to compute statistics", http.StatusInternalServerError)
+		return
+	}
+
+	docs := make(map[string]*DocumentActivity, len(records))
+	collections := make(map[string]*CollectionActivity)
+	for _, record := range records {
+		name := record.CollectionName
+		docs[record.DocumentID] = &DocumentActivity{
+			DocumentID: record.DocumentID,
+			Title:      record.Title,
+			Collection: name,
+			Syncs:      record.SyncCount,
+		}
+		c, ok := collections[name]
+		if !ok {
+			c = &CollectionActivity{Collection: name}
+			collections[name] = c
+		}
+		c.Documents++
+		c.Syncs += record.SyncCount
+	}
+	updated := make(map[string]bool)
+	for _, change := range changes {
+		doc, ok := docs[change.DocumentID]
+		if !ok {
+			continue
+		}
+		doc.Updates++
+		c := collections[doc.Collection]
+		c.Updates++
+		if !updated[change.DocumentID] {
+			updated[change.DocumentID] = true
+			c.UpdatedDocuments++
+		}
+		if c.LastChange == nil || change.CreatedAt.After(*c.LastChange) {
+			t := change.CreatedAt
+			c.LastChange = &t
+		}
+	}
+
+	resp := StatsResponse{WindowDays: days, Collections: []CollectionActivity{}, MostUpdated: []DocumentActivity{}}
+	for _, c := range collections {
+		resp.Collections = append(resp.Collections, *c)
+	}
+	sort.Slice(resp.Collections, func(i, j int) bool {
+		if resp.Collections[i].Updates != resp.Collections[j].Updates {
+			return resp.Collections[i].Updates > resp.Collections[j].Updates
+		}
+		return resp.Collections[i].Collection < resp.Collections[j].Collection
+	})
+	for _, doc := range docs {
+		if doc.Updates > 0 {
+			resp.MostUpdated = append(resp.MostUpdated, *doc)
+		}
+	}
+	sort.Slice(resp.MostUpdated, func(i, j int) bool {
+		if resp.MostUpdated[i].Updates != resp.MostUpdated[j].Updates {
+			return resp.MostUpdated[i].Updates > resp.MostUpdated[j].Updates
+		}
+		return resp.MostUpdated[i].Title < resp.MostUpdated[j].Title
+	})
+	if len(resp.MostUpdated) > limit {
+		resp.MostUpdated = resp.MostUpdated[:limit]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
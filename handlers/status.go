@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// LastSync describes the most recent sync run. Runs cover every collection.
+type LastSync struct {
+	ID          uint       `json:"id"`
+	Status      string     `json:"status"`
+	StartedAt   time.Time  `json:"started_at"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// CollectionStatus summarizes the sync state of one collection.
+type CollectionStatus struct {
+	Collection string `json:"collection"`
+	// Documents is the number of exported documents, Synced how many of
+	// them were uploaded at least once and NotSynced how many never were.
+	Documents int `json:"documents"`
+	Synced    int `json:"synced"`
+	NotSynced int `json:"not_synced"`
+	// LastExport is when a document of the collection was last written.
+	LastExport *time.Time `json:"last_export,omitempty"`
+	LastSync   *LastSync  `json:"last_sync,omitempty"`
+	// Excluded counts the documents kept out of the knowledge base by reason.
+	Excluded    map[string]int `json:"excluded"`
+	BrokenLinks int            `json:"broken_links"`
+	// NextRun is the next scheduled sync, if SYNC_SCHEDULE is set.
+	NextRun *time.Time `json:"next_run,omitempty"`
+}
+
+// collectionMatches reports whether an Outline collection name is the one
+// requested, by its name or its sanitized directory name.
+func collectionMatches(collection, name string) bool {
+	return collection != "" && (collection == name || utils.SanitizeFilename(collection) == name)
+}
+
+// authorizeStatus admits everyone with STATUS_PUBLIC set and otherwise
+// requires ADMIN_API_KEY or a key scoped to the collection's mapping.
+func authorizeStatus(w http.ResponseWriter, r *http.Request, name string) bool {
+	if config.ConfigInstance.StatusPublic {
+		return true
+	}
+	key := apiKeyFromRequest(r)
+	if isAdminKey(key) {
+		return true
+	}
+	record, ok := lookupAPIKey(key)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	mapping, err := models.FindCollectionMapping(utils.DB, "", name)
+	if err != nil || mapping == nil || !record.AllowsMapping(mapping.ID) {
+		http.Error(w, "Key not scoped to this collection", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// GetCollectionStatusHandler reports the sync status of a collection.
+// @Summary Get the sync status of a collection
+// @Description Summarizes the last sync, document counts, documents kept out of the knowledge base and the next scheduled run for an Outline collection, e.g. to link from the collection description. Public with STATUS_PUBLIC=true; otherwise requires ADMIN_API_KEY or a scoped API key issued for the collection's mapping.
+// @Tags status
+// @Produce json
+// @Param name path string true "Outline collection name or mapping name"
+// @Success 200 {object} CollectionStatus
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Key not scoped to this collection"
+// @Failure 404 {object} map[string]string "Collection not found"
+// @Failure 500 {object} map[string]string "Failed to compute status"
+// @Router /status/collections/{name} [get]
+func GetCollectionStatusHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if !authorizeStatus(w, r, utils.SanitizeFilename(name)) {
+		return
+	}
+
+	records, err := models.ListExportedDocuments(utils.DB)
+	if err != nil {
+		http.Error(w, "Failed to compute status", http.StatusInternalServerError)
+		return
+	}
+	status := CollectionStatus{Collection: name, Excluded: map[string]int{}}
+	for _, record := range records {
+		if record.ParentDocumentID != "" || !collectionMatches(record.CollectionName, name) {
+			continue
+		}
+		status.Collection = record.CollectionName
+		status.Documents++
+		if record.SyncCount > 0 {
+			status.Synced++
+		} else {
+			status.NotSynced++
+		}
+		if status.LastExport == nil || record.ExportedAt.After(*status.LastExport) {
+			t := record.ExportedAt
+			status.LastExport = &t
+		}
+	}
+
+	excluded, err := models.ListExcludedDocuments(utils.DB, "", "")
+	if err != nil {
+		http.Error(w, "Failed to compute status", http.StatusInternalServerError)
+		return
+	}
+	for _, doc := range excluded {
+		if collectionMatches(doc.CollectionName, name) {
+			status.Collection = doc.CollectionName
+			status.Excluded[doc.Reason]++
+		}
+	}
+	links, err := models.ListBrokenLinks(utils.DB)
+	if err != nil {
+		http.Error(w, "Failed to compute status", http.StatusInternalServerError)
+		return
+	}
+	for _, link := range links {
+		if collectionMatches(link.CollectionName, name) {
+			status.BrokenLinks++
+		}
+	}
+	if status.Documents == 0 && len(status.Excluded) == 0 {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+
+	runs, err := models.ListSyncRuns(utils.DB, "", 1)
+	if err != nil {
+		http.Error(w, "Failed to compute status", http.StatusInternalServerError)
+		return
+	}
+	if len(runs) > 0 {
+		status.LastSync = &LastSync{
+			ID:          runs[0].ID,
+			Status:      runs[0].Status,
+			StartedAt:   runs[0].CreatedAt,
+			PublishedAt: runs[0].PublishedAt,
+			Error:       runs[0].Error,
+		}
+	}
+	status.NextRun = nextRun(config.ConfigInstance.SyncSchedules, time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
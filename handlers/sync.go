@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/expr"
+	"github.com/mikeshootzz/outline-rag-scraper/jobs"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/timings"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// syncLockName names the lock that serializes sync runs, across every
+// process sharing the database, so two pipelines never interleave their
+// export and upload phases.
+const syncLockName = "sync"
+
+// lockSync waits for the sync lock and returns a context that is cancelled
+// if the lock is lost, and the function releasing it.
+func lockSync(ctx context.Context) (context.Context, func(), error) {
+	ctx, unlock, err := jobs.Lock(ctx, syncLockName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error acquiring sync lock: %w", err)
+	}
+	return ctx, unlock, nil
+}
+
+// syncParams are the parameters of a sync job.
+type syncParams struct {
+	Full       bool `json:"full"`
+	SkipCanary bool `json:"skip_canary"`
+}
+
+// knowledgeTargets returns the knowledge collections a local file is uploaded
+// to: those of the first matching routing rule, every collection mapped to the
+// collection directory it lives in, or the default collection for top-level
+// files, unmapped collections and mappings that name no knowledge collection.
+func knowledgeTargets(ctx context.Context, filePath string, mappings map[string]models.CollectionMapping) []string {
+	if ids := routedTargets(ctx, filePath); ids != nil {
+		return ids
+	}
+	if mapping, ok := models.LookupMapping(mappings, sourceOf(filePath), collectionOf(filePath)); ok {
+		if ids := mapping.KnowledgeIDs(); len(ids) > 0 {
+			return ids
+		}
+	}
+	if config.ConfigInstance.KnowledgeCollectionID != "" {
+		return []string{config.ConfigInstance.KnowledgeCollectionID}
+	}
+	return nil
+}
+
+// runSync exports from Outline (the build phase) and publishes exactly the
+// files the export added, changed or removed, without rescanning the
+// documents directory. With SYNC_GATE set, publishing waits for the gate.
+func runSync(ctx context.Context, params syncParams) (*models.SyncRun, error) {
+	ctx, unlock, err := lockSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	correlationID := logging.NewID()
+	ctx = logging.WithRunID(ctx, correlationID)
+
+	cursor, err := models.LatestDocumentChangeID(utils.DB)
+	if err != nil {
+		return nil, fmt.Errorf("error reading change feed: %w", err)
+	}
+	buildCtx, recorder := timings.Start(ctx)
+	err = runExport(buildCtx, false, params.Full, "")
+	build := recorder.Stop()
+	if err != nil {
+		return nil, err
+	}
+
+	// The change feed entries written by this export are the changeset.
+	changed, removed, err := changesSince(cursor, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(changed) == 0 && len(removed) == 0 {
+		// Runs whose publishing failed are retried even without new changes.
+		var failed int64
+		if err := utils.DB.Model(&models.SyncRun{}).Where("status = ?", models.SyncRunFailed).Count(&failed).Error; err != nil {
+			return nil, fmt.Errorf("error reading sync runs: %w", err)
+		}
+		if failed == 0 {
+			logging.FromContext(ctx).Info("Sync: no documents changed")
+			return nil, nil
+		}
+	}
+	// Build is done; the validation gate decides when the run is published.
+	return stageChanges(ctx, changed, removed, build, params.SkipCanary, correlationID)
+}
+
+// changesSince collects the local files changed and removed by the change
+// feed entries after cursor. If include is set, other entries are ignored.
+func changesSince(cursor uint, include func(models.DocumentChange) bool) (changed, removed map[string]bool, err error) {
+	changed = make(map[string]bool)
+	removed = make(map[string]bool)
+	for {
+		changes, err := models.ListDocumentChanges(utils.DB, cursor, 500)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading change feed: %w", err)
+		}
+		if len(changes) == 0 {
+			return changed, removed, nil
+		}
+		for _, change := range changes {
+			if include != nil && !include(change) {
+				continue
+			}
+			if change.Type == models.ChangeRemoved {
+				removed[change.FilePath] = true
+				delete(changed, change.FilePath)
+			} else {
+				changed[change.FilePath] = true
+				delete(removed, change.FilePath)
+			}
+		}
+		cursor = changes[len(changes)-1].ID
+	}
+}
+
+// uploadChanges applies changed and removed local files to the knowledge
+// collections they are routed to. Files are removed from the collections
+// they were uploaded to, which routing rules can no longer tell once the
+// export record is gone, and from those a changed file is no longer routed to.
+func uploadChanges(ctx context.Context, changed, removed map[string]bool, mappings map[string]models.CollectionMapping) error {
+	if err := ensureKnowledgeCollections(ctx, mappings); err != nil {
+		return err
+	}
+	type changeSet struct{ changed, removed []string }
+	byTarget := make(map[string]*changeSet)
+	target := func(knowledgeID string) *changeSet {
+		set, ok := byTarget[knowledgeID]
+		if !ok {
+			set = &changeSet{}
+			byTarget[knowledgeID] = set
+		}
+		return set
+	}
+	add := func(filePath string, isRemoved bool) error {
+		tracked, err := models.ListKnowledgeIDsByPath(utils.DB, filePath)
+		if err != nil {
+			return fmt.Errorf("error loading uploaded files: %w", err)
+		}
+		routed := make(map[string]bool)
+		for _, knowledgeID := range knowledgeTargets(ctx, filePath, mappings) {
+			routed[knowledgeID] = true
+			set := target(knowledgeID)
+			if isRemoved {
+				set.removed = append(set.removed, filePath)
+			} else {
+				set.changed = append(set.changed, filePath)
+			}
+		}
+		for _, knowledgeID := range tracked {
+			if !routed[knowledgeID] {
+				set := target(knowledgeID)
+				set.removed = append(set.removed, filePath)
+			}
+		}
+		return nil
+	}
+	for filePath := range changed {
+		if err := add(filePath, false); err != nil {
+			return err
+		}
+	}
+	for filePath := range removed {
+		if err := add(filePath, true); err != nil {
+			return err
+		}
+	}
+	for knowledgeID, set := range byTarget {
+		sort.Strings(set.changed)
+		sort.Strings(set.removed)
+		if err := replaceFilesInKnowledge(ctx, knowledgeID, set.changed, set.removed, mappings); err != nil {
+			return fmt.Errorf("knowledge collection %s: %w", knowledgeID, err)
+		}
+	}
+	return nil
+}
+
+// SyncHandler runs export and upload as one pipeline.
+// @Summary Sync documents
+// @Description Exports changed documents from Outline and uploads exactly the added, updated and removed files to their knowledge collections in one run. Files in mapped collection directories go to the mapped knowledge collections, all others to the default one. The changes are staged as a sync run first; with SYNC_GATE set, publishing waits for approval (manual) or for the automatic checks to pass (rules). With async=true, or when the process runs in API-only mode, the sync is queued as a background job.
+// @Tags sync
+// @Produce plain
+// @Param full query bool false "Export every document, even unchanged ones"
+// @Param skip_canary query bool false "Skip the canary sync"
+// @Param async query bool false "Queue the sync as a background job"
+// @Success 200 {string} string "Sync completed, or the staged run waiting for approval"
+// @Success 202 {object} models.Job
+// @Failure 500 {object} map[string]interface{}
+// @Router /sync [post]
+func SyncHandler(w http.ResponseWriter, r *http.Request) {
+	params := syncParams{
+		Full:       r.URL.Query().Get("full") == "true",
+		SkipCanary: r.URL.Query().Get("skip_canary") == "true",
+	}
+	if runInBackground(r) {
+		enqueueJob(w, r, "sync", params)
+		return
+	}
+	run, err := runSync(context.WithoutCancel(r.Context()), params)
+	if err != nil {
+		http.Error(w, localize(r, "Sync failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if run != nil && (run.Status == models.SyncRunStaged || run.Status == models.SyncRunHeld) {
+		writeMessage(w, r, "Sync run %d staged, waiting for approval.", run.ID)
+		return
+	}
+	writeMessage(w, r, "Sync completed.")
+}
+
+// routedTargets returns the knowledge collections of the first ROUTING_RULES
+// rule matching the exported document at filePath, or nil. Rules see doc.id,
+// doc.title, doc.collection, doc.workspace, doc.classification and doc.tags.
+func routedTargets(ctx context.Context, filePath string) []string {
+	if len(config.ConfigInstance.RoutingRules) == 0 {
+		return nil
+	}
+	record, err := models.GetExportedDocumentByPath(utils.DB, filePath)
+	if err != nil {
+		return nil
+	}
+	var tags []string
+	if record.Tags != "" {
+		tags = strings.Split(record.Tags, ",")
+	}
+	vars := expr.Vars{"doc": map[string]interface{}{
+		"id":             record.DocumentID,
+		"title":          record.Title,
+		"collection":     record.CollectionName,
+		"workspace":      record.Workspace,
+		"classification": record.Classification,
+		"tags":           tags,
+	}}
+	for _, rule := range config.ConfigInstance.RoutingRules {
+		matched, err := rule.Condition.Eval(vars)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error evaluating routing rule", "rule", rule.Condition, "file", filePath, "error", err)
+			continue
+		}
+		if matched {
+			return rule.KnowledgeIDs
+		}
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/timings"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// stageMu serializes staging and publishing so pending runs are folded into
+// exactly one newer run.
+var stageMu sync.Mutex
+
+// publishParams are the parameters of a publish job.
+type publishParams struct {
+	ID uint `json:"id"`
+}
+
+// stageChanges records the build result of a sync as a sync run, folding in
+// runs still waiting for approval or whose publishing failed, and publishes it right away unless the
+// validation gate (SYNC_GATE) holds it back. build holds the stage timings of
+// the build phase, correlationID the run_id its log lines carry.
+func stageChanges(ctx context.Context, changed, removed map[string]bool, build []models.StageTiming, skipCanary bool, correlationID string) (*models.SyncRun, error) {
+	stageMu.Lock()
+	defer stageMu.Unlock()
+
+	// Unpublished runs are superseded; their changes move into this one.
+	pending, err := models.ListPendingSyncRuns(utils.DB)
+	if err != nil {
+		return nil, err
+	}
+	for _, previous := range pending {
+		for _, file := range previous.Files {
+			if changed[file.Path] || removed[file.Path] {
+				continue
+			}
+			if file.Removed {
+				removed[file.Path] = true
+			} else {
+				changed[file.Path] = true
+			}
+		}
+	}
+
+	run := &models.SyncRun{Status: models.SyncRunStaged, CorrelationID: correlationID, Checks: []models.GateCheck{}, Timings: build}
+	for filePath := range changed {
+		file := models.StagedFile{Path: filePath}
+		if content, err := os.ReadFile(filePath); err == nil {
+			file.Checksum = utils.Checksum(content)
+		}
+		run.Files = append(run.Files, file)
+	}
+	for filePath := range removed {
+		run.Files = append(run.Files, models.StagedFile{Path: filePath, Removed: true})
+	}
+	sort.Slice(run.Files, func(i, j int) bool { return run.Files[i].Path < run.Files[j].Path })
+	run.Changed, run.Removed = len(changed), len(removed)
+
+	gate := config.ConfigInstance.SyncGate
+	if gate != "" {
+		run.Checks = runGateChecks(run)
+		for _, check := range run.Checks {
+			if !check.Passed && gate == "rules" {
+				run.Status = models.SyncRunHeld
+			}
+		}
+	}
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		for _, previous := range pending {
+			if err := tx.Model(&previous).Update("status", models.SyncRunSuperseded).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(run).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error staging sync run: %w", err)
+	}
+	if gate == "manual" || run.Status == models.SyncRunHeld {
+		logging.FromContext(ctx).Info("Sync run staged, waiting for approval", "sync_run", run.ID, "changed", run.Changed, "removed", run.Removed)
+		return run, nil
+	}
+	return run, publishRun(ctx, run, skipCanary)
+}
+
+// runGateChecks validates a staged run: every changed file must match its
+// export checksum, Markdown and text files must have a body below their
+// metadata header, and no more than
+// SYNC_GATE_MAX_REMOVED_PERCENT of the corpus may be removed at once.
+func runGateChecks(run *models.SyncRun) []models.GateCheck {
+	var corrupt, empty []string
+	for _, file := range run.Files {
+		if file.Removed {
+			continue
+		}
+		content, err := readVerified(file.Path)
+		if err != nil {
+			corrupt = append(corrupt, file.Path)
+			continue
+		}
+		// Only Markdown and text exports start with a metadata header; HTML
+		// and JSON carry their metadata inline.
+		if ext := filepath.Ext(file.Path); ext != ".md" && ext != ".txt" {
+			continue
+		}
+		_, body, _ := strings.Cut(string(content), "\n\n")
+		if strings.TrimSpace(body) == "" {
+			empty = append(empty, file.Path)
+		}
+	}
+	checks := []models.GateCheck{
+		{Name: "checksums", Passed: len(corrupt) == 0, Detail: strings.Join(corrupt, ", ")},
+		{Name: "empty_documents", Passed: len(empty) == 0, Detail: strings.Join(empty, ", ")},
+	}
+
+	var total int64
+	removals := models.GateCheck{Name: "removals", Passed: true}
+	if err := utils.DB.Model(&models.ExportedDocument{}).Count(&total).Error; err != nil {
+		removals.Passed, removals.Detail = false, err.Error()
+	} else if corpus := int(total) + run.Removed; corpus > 0 && run.Removed*100 > corpus*config.ConfigInstance.SyncGateMaxRemovedPercent {
+		removals.Passed = false
+		removals.Detail = fmt.Sprintf("%d of %d documents removed, at most %d%% allowed", run.Removed, corpus, config.ConfigInstance.SyncGateMaxRemovedPercent)
+	}
+	return append(checks, removals)
+}
+
+// publishRun pushes a staged run to the knowledge collections. Files changed
+// since they were staged were not validated, so the run is refused instead.
+// Once published, the targets are checked against the local state and a
+// signed integrity report is stored for the run. The publish stages are added
+// to the run's timings.
+func publishRun(ctx context.Context, run *models.SyncRun, skipCanary bool) error {
+	publishCtx, recorder := timings.Start(ctx)
+	deferred, err := publishFiles(publishCtx, run, skipCanary)
+	run.Timings = timings.Merge(run.Timings, recorder.Stop())
+	if err != nil {
+		run.Status, run.Error = models.SyncRunFailed, err.Error()
+		if outages := upstreamOutages(); outages != "" {
+			run.Error += " (upstream outage: " + outages + ")"
+		}
+	} else if deferred {
+		// Published by flushPendingChanges once the freeze window ends.
+		run.Status = models.SyncRunDeferred
+	} else {
+		now := time.Now()
+		run.Status, run.PublishedAt = models.SyncRunPublished, &now
+	}
+	if saveErr := utils.DB.Save(run).Error; saveErr != nil {
+		logging.FromContext(ctx).Error("Error saving sync run", "sync_run", run.ID, "error", saveErr)
+	}
+	if err == nil && !deferred {
+		if err := writeIntegrityReport(ctx, run); err != nil {
+			logging.FromContext(ctx).Error("Error writing integrity report", "sync_run", run.ID, "error", err)
+		}
+	}
+	return err
+}
+
+// publishFiles performs the upload of publishRun and reports whether it was
+// deferred to the end of a freeze window.
+func publishFiles(ctx context.Context, run *models.SyncRun, skipCanary bool) (bool, error) {
+	changed := make(map[string]bool)
+	removed := make(map[string]bool)
+	var modified []string
+	for _, file := range run.Files {
+		if file.Removed {
+			removed[file.Path] = true
+			continue
+		}
+		content, err := os.ReadFile(file.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		if err != nil || utils.Checksum(content) != file.Checksum {
+			modified = append(modified, file.Path)
+			continue
+		}
+		changed[file.Path] = true
+	}
+	if len(modified) > 0 {
+		return false, fmt.Errorf("files changed since staging, run a new sync: %s", strings.Join(modified, ", "))
+	}
+	// Consumers of the corpus only ever see runs that passed the gate.
+	if err := publishCorpus(ctx, run); err != nil {
+		return false, err
+	}
+	if deferred, err := deferIfFrozen(ctx, changed, removed); deferred {
+		return true, err
+	}
+
+	mappings, err := models.GetCollectionMappingRecords(utils.DB)
+	if err != nil {
+		return false, fmt.Errorf("error loading mappings: %w", err)
+	}
+	if config.ConfigInstance.CanaryKnowledgeCollectionID != "" && !skipCanary && len(changed) > 0 {
+		if err := runCanary(ctx, mappings); err != nil {
+			return false, fmt.Errorf("canary sync failed, upload aborted: %w", err)
+		}
+	}
+	if err := uploadChanges(ctx, changed, removed, mappings); err != nil {
+		return false, err
+	}
+	logging.FromContext(ctx).Info("Sync run published", "sync_run", run.ID, "changed", len(changed), "removed", len(removed))
+	return false, nil
+}
+
+// runPublish publishes a run that is waiting for approval.
+func runPublish(ctx context.Context, id uint, reviewer string) error {
+	stageMu.Lock()
+	defer stageMu.Unlock()
+	var run models.SyncRun
+	if err := utils.DB.First(&run, id).Error; err != nil {
+		return err
+	}
+	if run.Status != models.SyncRunStaged && run.Status != models.SyncRunHeld {
+		return fmt.Errorf("sync run %d is %s", run.ID, run.Status)
+	}
+	run.ReviewedBy = reviewer
+	// Log the publish under the run's correlation ID, like its export.
+	if run.CorrelationID != "" {
+		ctx = logging.WithRunID(ctx, run.CorrelationID)
+	}
+	return publishRun(ctx, &run, false)
+}
+
+// loadSyncRun loads the run named in the request path, answering 404 if it does not exist.
+func loadSyncRun(w http.ResponseWriter, r *http.Request) (*models.SyncRun, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Sync run not found", http.StatusNotFound)
+		return nil, false
+	}
+	var run models.SyncRun
+	if err := utils.DB.First(&run, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Sync run not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Failed to retrieve sync run", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &run, true
+}
+
+// GetSyncRunsHandler lists sync runs.
+// @Summary List sync runs
+// @Description Lists the staged results of sync build phases, newest first, with their gate checks. Files are only included when fetching a single run.
+// @Tags sync
+// @Produce json
+// @Param status query string false "Filter by status (staged, held, deferred, published, rejected, superseded, failed)"
+// @Param limit query int false "Maximum number of runs (default 50)"
+// @Success 200 {array} models.SyncRun
+// @Failure 400 {object} map[string]string "Invalid limit"
+// @Failure 500 {object} map[string]string "Failed to retrieve sync runs"
+// @Router /sync/runs [get]
+func GetSyncRunsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	runs, err := models.ListSyncRuns(utils.DB, r.URL.Query().Get("status"), limit)
+	if err != nil {
+		http.Error(w, "Failed to retrieve sync runs", http.StatusInternalServerError)
+		return
+	}
+	for i := range runs {
+		runs[i].Files = nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+// GetSyncRunHandler returns a sync run with its staged files.
+// @Summary Get a sync run
+// @Description Returns a sync run with its staged files, gate checks and the time spent per stage (list, export, pipeline, upload, knowledge; count, total and p50/p95/max per operation), so the staged corpus can be reviewed before approval and slow stages spotted.
+// @Tags sync
+// @Produce json
+// @Param id path int true "Sync run ID"
+// @Success 200 {object} models.SyncRun
+// @Failure 404 {object} map[string]string "Sync run not found"
+// @Router /sync/runs/{id} [get]
+func GetSyncRunHandler(w http.ResponseWriter, r *http.Request) {
+	run, ok := loadSyncRun(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// ApproveSyncRunHandler publishes a staged or held sync run.
+// @Summary Approve a sync run
+// @Description Publishes a sync run waiting at the validation gate to its knowledge collections. With async=true, or when the process runs in API-only mode, publishing is queued as a background job. Requires ADMIN_API_KEY.
+// @Tags sync
+// @Produce plain
+// @Param id path int true "Sync run ID"
+// @Param async query bool false "Queue publishing as a background job"
+// @Success 200 {string} string "Sync run published."
+// @Success 202 {object} models.Job
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Sync run not found"
+// @Failure 409 {object} map[string]string "Sync run is not waiting for approval"
+// @Failure 500 {object} map[string]string "Publish failed"
+// @Router /sync/runs/{id}/approve [post]
+func ApproveSyncRunHandler(w http.ResponseWriter, r *http.Request) {
+	run, ok := loadSyncRun(w, r)
+	if !ok {
+		return
+	}
+	if run.Status != models.SyncRunStaged && run.Status != models.SyncRunHeld {
+		http.Error(w, localize(r, "Sync run is not waiting for approval"), http.StatusConflict)
+		return
+	}
+	if runInBackground(r) {
+		enqueueJob(w, r, "sync.publish", publishParams{ID: run.ID})
+		return
+	}
+	if err := runPublish(context.WithoutCancel(r.Context()), run.ID, principalFor(r)); err != nil {
+		http.Error(w, localize(r, "Publish failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeMessage(w, r, "Sync run published.")
+}
+
+// RejectSyncRunHandler discards a staged or held sync run.
+// @Summary Reject a sync run
+// @Description Discards a sync run waiting at the validation gate; its changes are not published. Requires ADMIN_API_KEY.
+// @Tags sync
+// @Param id path int true "Sync run ID"
+// @Success 204 "Rejected"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Sync run not found"
+// @Failure 409 {object} map[string]string "Sync run is not waiting for approval"
+// @Failure 500 {object} map[string]string "Failed to reject sync run"
+// @Router /sync/runs/{id}/reject [post]
+func RejectSyncRunHandler(w http.ResponseWriter, r *http.Request) {
+	stageMu.Lock()
+	defer stageMu.Unlock()
+	run, ok := loadSyncRun(w, r)
+	if !ok {
+		return
+	}
+	if run.Status != models.SyncRunStaged && run.Status != models.SyncRunHeld {
+		http.Error(w, localize(r, "Sync run is not waiting for approval"), http.StatusConflict)
+		return
+	}
+	run.Status, run.ReviewedBy = models.SyncRunRejected, principalFor(r)
+	if err := utils.DB.Save(run).Error; err != nil {
+		http.Error(w, "Failed to reject sync run", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// trackFailures reports whether failure streaks are counted, which comment
+// back and tickets rely on.
+func trackFailures() bool {
+	return config.ConfigInstance.CommentBack || config.ConfigInstance.TicketSystem != ""
+}
+
+// noteExportFailure counts a failed export of a document, telling its
+// authors in Outline and opening a ticket once the failures persist.
+func noteExportFailure(ctx context.Context, ws config.Workspace, documentID string, exportErr error) {
+	if !trackFailures() {
+		return
+	}
+	streak, err := models.RecordFailure(utils.DB, "document:"+documentID, exportErr.Error())
+	if err != nil {
+		logging.FromContext(ctx).Error("Error recording export failure", "document_id", documentID, "error", err)
+		return
+	}
+	commentOnFailure(ctx, ws, documentID, streak)
+	if needsTicket(streak) {
+		summary := fmt.Sprintf("Document %s failed to export %d times in a row", documentID, streak.Failures)
+		details := [][2]string{{"Workspace", ws.Name}, {"Document ID", documentID}}
+		if record, err := models.GetExportedDocument(utils.DB, documentID); err == nil {
+			summary = fmt.Sprintf("Document %q failed to export %d times in a row", record.Title, streak.Failures)
+			details = append(details, [2]string{"Title", record.Title}, [2]string{"URL", record.URL},
+				[2]string{"Collection", record.CollectionName}, [2]string{"File", record.FilePath})
+		}
+		openTicket(ctx, streak, summary, details)
+	}
+}
+
+// noteExportSuccess ends the failure streak of a document.
+func noteExportSuccess(ctx context.Context, ws config.Workspace, documentID string) {
+	if !trackFailures() {
+		return
+	}
+	endFailureStreak(ctx, "document:"+documentID)
+	clearFailureComment(ctx, ws, documentID)
+}
+
+// noteTargetResult counts failed uploads to a knowledge collection, opening a
+// ticket once they persist, and ends the streak on success.
+func noteTargetResult(ctx context.Context, knowledgeID string, uploadErr error) {
+	if config.ConfigInstance.TicketSystem == "" {
+		return
+	}
+	subject := "knowledge:" + knowledgeID
+	if uploadErr == nil {
+		endFailureStreak(ctx, subject)
+		return
+	}
+	streak, err := models.RecordFailure(utils.DB, subject, uploadErr.Error())
+	if err != nil {
+		logging.FromContext(ctx).Error("Error recording upload failure", "knowledge_id", knowledgeID, "error", err)
+		return
+	}
+	if needsTicket(streak) {
+		details := [][2]string{{"Knowledge collection", knowledgeID}}
+		if mappings, err := models.GetCollectionMappingRecords(utils.DB); err == nil {
+			var collections []string
+			for _, mapping := range mappings {
+				for _, id := range mapping.KnowledgeIDs() {
+					if id == knowledgeID {
+						collections = append(collections, mapping.Key())
+					}
+				}
+			}
+			details = append(details, [2]string{"Mapped collections", strings.Join(collections, ", ")})
+		}
+		details = append(details, [2]string{"Sinks", strings.Join(config.ConfigInstance.Sinks, ", ")})
+		openTicket(ctx, streak, fmt.Sprintf("Uploads to knowledge collection %s failed %d times in a row", knowledgeID, streak.Failures), details)
+	}
+}
+
+// endFailureStreak forgets the failures of subject, noting when a ticket
+// opened for them can be closed.
+func endFailureStreak(ctx context.Context, subject string) {
+	streak, err := models.EndFailureStreak(utils.DB, subject)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error ending failure streak", "subject", subject, "error", err)
+		return
+	}
+	if streak != nil && streak.TicketKey != "" {
+		logging.FromContext(ctx).Info("Recovered; the ticket can be closed", "subject", subject, "failures", streak.Failures, "ticket", streak.TicketKey)
+	}
+}
+
+// needsTicket reports whether a streak reached TICKET_FAILURES without a
+// ticket yet.
+func needsTicket(streak *models.FailureStreak) bool {
+	return config.ConfigInstance.TicketSystem != "" && streak.TicketKey == "" &&
+		streak.Failures >= config.ConfigInstance.TicketFailures
+}
+
+// openTicket files a ticket for a failure streak with the run context:
+// details about the subject, the streak and the latest sync run.
+func openTicket(ctx context.Context, streak *models.FailureStreak, summary string, details [][2]string) {
+	details = append(details,
+		[2]string{"Consecutive failures", fmt.Sprint(streak.Failures)},
+		[2]string{"First failure", streak.CreatedAt.Format(time.RFC3339)},
+		[2]string{"Last failure", streak.UpdatedAt.Format(time.RFC3339)},
+		[2]string{"Last error", streak.LastError},
+		[2]string{"Upstream outages", upstreamOutages()},
+	)
+	if runs, err := models.ListSyncRuns(utils.DB, "", 1); err == nil && len(runs) > 0 {
+		details = append(details, [2]string{"Latest sync run", fmt.Sprintf("%d (%s, started %s)",
+			runs[0].ID, runs[0].Status, runs[0].CreatedAt.Format(time.RFC3339))})
+	}
+	var description strings.Builder
+	for _, detail := range details {
+		if detail[1] != "" {
+			fmt.Fprintf(&description, "%s: %s\n", detail[0], detail[1])
+		}
+	}
+	summary = "outline-rag-scraper: " + summary
+
+	var key, link string
+	var err error
+	switch config.ConfigInstance.TicketSystem {
+	case "jira":
+		key, link, err = createJiraIssue(ctx, summary, description.String())
+	case "servicenow":
+		key, link, err = createServiceNowRecord(ctx, summary, description.String())
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("Error opening ticket", "subject", streak.Subject, "error", err)
+		return
+	}
+	logging.FromContext(ctx).Info("Opened ticket", "ticket", key, "subject", streak.Subject)
+	if err := models.SetStreakTicket(utils.DB, streak.Subject, key, link); err != nil {
+		logging.FromContext(ctx).Error("Error recording ticket", "ticket", key, "error", err)
+	}
+}
+
+// postTicket sends a JSON payload to the ticket system and decodes the answer.
+func postTicket(ctx context.Context, path string, payload, result interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", config.ConfigInstance.TicketURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if config.ConfigInstance.TicketUsername != "" {
+		req.SetBasicAuth(config.ConfigInstance.TicketUsername, config.ConfigInstance.TicketToken)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.TicketToken)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := utils.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("postTicket: unexpected status: %s, body: %s", resp.Status, string(data))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// createJiraIssue creates an issue in TICKET_PROJECT and returns its key and URL.
+func createJiraIssue(ctx context.Context, summary, description string) (string, string, error) {
+	payload := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": config.ConfigInstance.TicketProject},
+			"issuetype":   map[string]string{"name": config.ConfigInstance.TicketIssueType},
+			"summary":     summary,
+			"description": description,
+		},
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := postTicket(ctx, "/rest/api/2/issue", payload, &created); err != nil {
+		return "", "", err
+	}
+	if created.Key == "" {
+		return "", "", fmt.Errorf("createJiraIssue: issue key not found in response")
+	}
+	return created.Key, config.ConfigInstance.TicketURL + "/browse/" + created.Key, nil
+}
+
+// createServiceNowRecord creates a record in TICKET_TABLE and returns its
+// number and URL.
+func createServiceNowRecord(ctx context.Context, summary, description string) (string, string, error) {
+	table := config.ConfigInstance.TicketTable
+	payload := map[string]string{
+		"short_description": summary,
+		"description":       description,
+	}
+	if group := config.ConfigInstance.TicketAssignmentGroup; group != "" {
+		payload["assignment_group"] = group
+	}
+	var created struct {
+		Result struct {
+			SysID  string `json:"sys_id"`
+			Number string `json:"number"`
+		} `json:"result"`
+	}
+	if err := postTicket(ctx, "/api/now/table/"+url.PathEscape(table), payload, &created); err != nil {
+		return "", "", err
+	}
+	if created.Result.SysID == "" {
+		return "", "", fmt.Errorf("createServiceNowRecord: sys_id not found in response")
+	}
+	key := created.Result.Number
+	if key == "" {
+		key = created.Result.SysID
+	}
+	link := config.ConfigInstance.TicketURL + "/nav_to.do?uri=" + url.QueryEscape(table+".do?sys_id="+created.Result.SysID)
+	return key, link, nil
+}
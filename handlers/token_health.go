@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sources"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// errTokenRejected is returned by token checks when the server refuses the token.
+var errTokenRejected = errors.New("token rejected")
+
+// checkOutlineToken validates an Outline token with auth.info and looks up
+// its expiry among the user's API keys, matched by their last four
+// characters. OAuth tokens are not API keys and report no expiry.
+func checkOutlineToken(ctx context.Context, ws config.Workspace, token string) (*time.Time, error) {
+	call := func(endpoint string, result interface{}) error {
+		req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/%s", ws.APIBaseURL, endpoint), bytes.NewBufferString("{}"))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := sources.DoWithRateLimit(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return json.NewDecoder(resp.Body).Decode(result)
+		case http.StatusUnauthorized:
+			return errTokenRejected
+		}
+		return fmt.Errorf("checkOutlineToken: %s: unexpected status: %s", endpoint, resp.Status)
+	}
+	var info json.RawMessage
+	if err := call("auth.info", &info); err != nil {
+		return nil, err
+	}
+	var keys struct {
+		Data []struct {
+			Last4     string     `json:"last4"`
+			ExpiresAt *time.Time `json:"expiresAt"`
+		} `json:"data"`
+	}
+	// Older servers and tokens without the apiKeys scope cannot list keys.
+	if err := call("apiKeys.list", &keys); err != nil || len(token) < 4 {
+		return nil, nil
+	}
+	for _, key := range keys.Data {
+		if key.Last4 == token[len(token)-4:] {
+			return key.ExpiresAt, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkOpenWebUIToken validates the OpenWebUI token with the session user
+// endpoint. The expiry comes from the answer or, for JWTs, the exp claim.
+func checkOpenWebUIToken(ctx context.Context) (*time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", config.ConfigInstance.OpenWebUIAPIURL+"/auths/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
+	req.Header.Set("Accept", "application/json")
+	resp, err := utils.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, errTokenRejected
+	default:
+		return nil, fmt.Errorf("checkOpenWebUIToken: unexpected status: %s", resp.Status)
+	}
+	var session struct {
+		ExpiresAt *int64 `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, err
+	}
+	if session.ExpiresAt != nil {
+		expires := time.Unix(*session.ExpiresAt, 0)
+		return &expires, nil
+	}
+	return jwtExpiry(config.ConfigInstance.OpenWebUIAPIToken), nil
+}
+
+// jwtExpiry returns the exp claim of a JWT, or nil for other tokens such as
+// OpenWebUI API keys, which do not expire.
+func jwtExpiry(token string) *time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == 0 {
+		return nil
+	}
+	expires := time.Unix(claims.Exp, 0)
+	return &expires
+}
+
+// credentialHealth turns the outcome of a check into a status.
+func credentialHealth(status *models.CredentialStatus, expires *time.Time, err error, now time.Time) {
+	status.ExpiresAt = expires
+	status.Error = ""
+	switch {
+	case errors.Is(err, errTokenRejected):
+		status.Status = models.CredentialRevoked
+		if expires != nil && expires.Before(now) {
+			status.Status = models.CredentialExpired
+		}
+	case err != nil:
+		status.Status, status.Error = models.CredentialError, err.Error()
+	case expires != nil && !expires.After(now):
+		status.Status = models.CredentialExpired
+	case expires != nil && expires.Sub(now) < config.ConfigInstance.TokenExpiryWarning:
+		status.Status = models.CredentialExpiring
+	default:
+		status.Status = models.CredentialOK
+	}
+}
+
+// checkCredentials validates every configured and stored token, records the
+// results and alerts on every status change.
+func checkCredentials(ctx context.Context) error {
+	now := time.Now()
+	var statuses []models.CredentialStatus
+	for _, ws := range config.ConfigInstance.Workspaces {
+		if !ws.IsOutline() {
+			continue
+		}
+		status := models.CredentialStatus{Credential: "outline:" + ws.Name, Kind: "outline", Name: ws.Name}
+		expires, err := checkOutlineToken(ctx, ws, ws.APIToken)
+		credentialHealth(&status, expires, err, now)
+		statuses = append(statuses, status)
+	}
+	if config.ConfigInstance.OpenWebUIAPIToken != "" {
+		status := models.CredentialStatus{Credential: "openwebui", Kind: "openwebui"}
+		expires, err := checkOpenWebUIToken(ctx)
+		credentialHealth(&status, expires, err, now)
+		statuses = append(statuses, status)
+	}
+	var records []models.UserToken
+	if err := utils.DB.Find(&records).Error; err != nil {
+		return err
+	}
+	for i := range records {
+		record := &records[i]
+		status := models.CredentialStatus{Credential: fmt.Sprintf("usertoken:%d", record.ID), Kind: "usertoken", Name: record.Name}
+		ws, ok := findWorkspace(record.Workspace)
+		var expires *time.Time
+		// Refreshing proves an OAuth grant is still valid; Outline refusing
+		// the refresh token means it was revoked.
+		token, err := userOutlineToken(ctx, record)
+		if err == nil && !ok {
+			err = fmt.Errorf("unknown workspace %q", record.Workspace)
+		}
+		if err == nil {
+			expires, err = checkOutlineToken(ctx, ws, token)
+		}
+		credentialHealth(&status, expires, err, now)
+		statuses = append(statuses, status)
+	}
+
+	credentials := make([]string, 0, len(statuses))
+	for i := range statuses {
+		status := &statuses[i]
+		credentials = append(credentials, status.Credential)
+		// New records start as alerted "ok", so only problems are reported.
+		status.AlertedStatus = models.CredentialOK
+		if err := models.SaveCredentialStatus(utils.DB, status); err != nil {
+			return err
+		}
+		claimed, err := models.ClaimCredentialAlert(utils.DB, status.Credential, status.Status)
+		if err != nil {
+			return err
+		}
+		if claimed {
+			sendCredentialAlert(ctx, *status)
+		}
+	}
+	return models.DeleteCredentialStatusesExcept(utils.DB, credentials)
+}
+
+// sendCredentialAlert logs a credential status change and posts it to
+// TOKEN_ALERT_WEBHOOK_URL. The "text" field makes the payload usable as a
+// Slack or Mattermost incoming webhook.
+func sendCredentialAlert(ctx context.Context, status models.CredentialStatus) {
+	text := fmt.Sprintf("Credential %s is %s", status.Credential, status.Status)
+	if status.Name != "" {
+		text = fmt.Sprintf("Credential %s (%s) is %s", status.Credential, status.Name, status.Status)
+	}
+	if status.ExpiresAt != nil {
+		text += fmt.Sprintf(", expires %s", status.ExpiresAt.Format(time.RFC3339))
+	}
+	if status.Error != "" {
+		text += ": " + status.Error
+	}
+	attrs := []any{"credential", status.Credential, "name", status.Name, "status", status.Status}
+	if status.ExpiresAt != nil {
+		attrs = append(attrs, "expires_at", status.ExpiresAt.Format(time.RFC3339))
+	}
+	if status.Error != "" {
+		attrs = append(attrs, "error", status.Error)
+	}
+	logging.FromContext(ctx).Warn("Credential needs attention", attrs...)
+	if config.ConfigInstance.TokenAlertWebhookURL == "" {
+		return
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"text":       text,
+		"credential": status.Credential,
+		"kind":       status.Kind,
+		"name":       status.Name,
+		"status":     status.Status,
+		"expires_at": status.ExpiresAt,
+		"error":      status.Error,
+	})
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", config.ConfigInstance.TokenAlertWebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		logging.FromContext(ctx).Error("Error sending credential alert", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := utils.Do(req)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error sending credential alert", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logging.FromContext(ctx).Error("Error sending credential alert", "status", resp.Status)
+	}
+}
+
+// StartTokenMonitor checks all credentials every TOKEN_CHECK_INTERVAL until
+// ctx is done.
+func StartTokenMonitor(ctx context.Context) {
+	if config.ConfigInstance.TokenCheckInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(config.ConfigInstance.TokenCheckInterval)
+		defer ticker.Stop()
+		for {
+			if err := checkCredentials(ctx); err != nil {
+				logging.FromContext(ctx).Error("Error checking credentials", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// GetTokenHealthHandler reports the last health check of every credential.
+// @Summary Get token health
+// @Description Lists the result of the last health check of the Outline workspace tokens, the OpenWebUI token and every user token: ok, expiring (within TOKEN_EXPIRY_WARNING), expired, revoked or error. With check=true the tokens are checked first. Requires ADMIN_API_KEY.
+// @Tags usertokens
+// @Produce json
+// @Param check query bool false "Check the tokens before answering"
+// @Success 200 {array} models.CredentialStatus
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Failed to check tokens"
+// @Router /tokens/health [get]
+func GetTokenHealthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("check") == "true" {
+		if err := checkCredentials(r.Context()); err != nil {
+			http.Error(w, "Failed to check tokens", http.StatusInternalServerError)
+			return
+		}
+	}
+	statuses, err := models.ListCredentialStatuses(utils.DB)
+	if err != nil {
+		http.Error(w, "Failed to check tokens", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
@@ -1,182 +1,465 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
-	"mime/multipart"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"gorm.io/gorm"
+
+	"github.com/mikeshootzz/outline-rag-scraper/cache"
 	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
 	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sinks"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
 )
 
-// clearKnowledgeCollection clears the OpenWebUI knowledge collection.
-func clearKnowledgeCollection() error {
-	url := fmt.Sprintf("%s/knowledge/%s", config.ConfigInstance.OpenWebUIAPIURL, config.ConfigInstance.KnowledgeCollectionID)
-	req, err := http.NewRequest("GET", url, nil)
+// fetchKnowledgeFiles lists the files currently attached to a knowledge
+// collection. Listings are cached and invalidated whenever the scraper adds or
+// removes a file.
+func fetchKnowledgeFiles(ctx context.Context, knowledgeID string) (*models.KnowledgeResponse, error) {
+	var cached models.KnowledgeResponse
+	if cache.Get(sinks.OpenWebUIKnowledgeCacheKey(knowledgeID), &cached) {
+		return &cached, nil
+	}
+	url := fmt.Sprintf("%s/knowledge/%s", config.ConfigInstance.OpenWebUIAPIURL, knowledgeID)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
 	req.Header.Set("Accept", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := utils.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("clearKnowledgeCollection: unexpected status: %s", resp.Status)
+		return nil, fmt.Errorf("fetchKnowledgeFiles: unexpected status: %s", resp.Status)
 	}
 	var knowResp models.KnowledgeResponse
 	if err = json.NewDecoder(resp.Body).Decode(&knowResp); err != nil {
+		return nil, err
+	}
+	// Older releases only list file IDs; normalize them into Files.
+	if openWebUI.LegacyKnowledgeFiles && len(knowResp.Files) == 0 {
+		for _, id := range knowResp.Data.FileIDs {
+			knowResp.Files = append(knowResp.Files, models.KnowledgeFile{ID: id})
+		}
+	}
+	cache.Set(sinks.OpenWebUIKnowledgeCacheKey(knowledgeID), knowResp)
+	return &knowResp, nil
+}
+
+// clearKnowledgeCollection removes every file from an OpenWebUI knowledge
+// collection, including files the scraper does not manage. It is only used for
+// collections owned by the scraper, such as the canary.
+func clearKnowledgeCollection(ctx context.Context, knowledgeID string) error {
+	knowResp, err := fetchKnowledgeFiles(ctx, knowledgeID)
+	if err != nil {
 		return err
 	}
 	for _, file := range knowResp.Files {
-		if err := removeFileFromKnowledge(file.ID); err != nil {
-			log.Printf("Error removing file %s: %v", file.ID, err)
+		if err := sinks.RemoveOpenWebUIFile(ctx, knowledgeID, file.ID); err != nil {
+			logging.FromContext(ctx).Error("Error removing file", "file_id", file.ID, "error", err)
 		}
 	}
-	log.Printf("Knowledge collection cleared.")
+	if err := models.DeleteUploadedFiles(utils.DB, knowledgeID); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("Knowledge collection cleared", "knowledge_id", knowledgeID)
 	return nil
 }
 
-// removeFileFromKnowledge removes a file from the OpenWebUI knowledge collection.
-func removeFileFromKnowledge(fileID string) error {
-	url := fmt.Sprintf("%s/knowledge/%s/file/remove", config.ConfigInstance.OpenWebUIAPIURL, config.ConfigInstance.KnowledgeCollectionID)
-	payload := map[string]interface{}{
-		"file_id": fileID,
+// verifyChecksum compares content against the checksum recorded when the file
+// was exported. Files without an export record (e.g. placed manually) are
+// accepted with a warning.
+func verifyChecksum(filePath string, content []byte) error {
+	// Copies in a user's directory are verified against their source export.
+	record, err := models.GetExportedDocumentByPath(utils.DB, exportedSourcePath(filePath))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		slog.Warn("No export checksum recorded, uploading unverified", "file", filePath)
+		return nil
 	}
-	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		return err
+	if actual := utils.Checksum(content); actual != record.Checksum {
+		return fmt.Errorf("verifyChecksum: checksum mismatch for %s: expected %s, got %s", filePath, record.Checksum, actual)
 	}
-	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	return nil
+}
+
+// uploadOptions controls how a file is presented to OpenWebUI.
+type uploadOptions struct {
+	Extension   string
+	ContentType string
+	PlainText   bool
+}
+
+// uploadOptionsFor resolves the upload options for a file from the mapping of
+// the collection subdirectory it lives in, falling back to the configured defaults.
+func uploadOptionsFor(filePath string, mappings map[string]models.CollectionMapping) uploadOptions {
+	opts := uploadOptions{
+		Extension:   config.ConfigInstance.UploadExtension,
+		ContentType: config.ConfigInstance.UploadContentType,
+		PlainText:   config.ConfigInstance.UploadPlainText,
+	}
+	if mapping, ok := models.LookupMapping(mappings, sourceOf(filePath), collectionOf(filePath)); ok {
+		if mapping.UploadExtension != "" {
+			opts.Extension = mapping.UploadExtension
+		}
+		if mapping.UploadContentType != "" {
+			opts.ContentType = mapping.UploadContentType
+		}
+		opts.PlainText = opts.PlainText || mapping.ConvertToPlainText
+	}
+	if opts.Extension == "" {
+		opts.Extension = filepath.Ext(filePath)
+	}
+	if opts.ContentType == "" {
+		opts.ContentType = exportContentTypes[filepath.Ext(filePath)]
+	}
+	return opts
+}
+
+// uploadName returns the file name a local file is uploaded under.
+func uploadName(filePath string, opts uploadOptions) string {
+	return strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)) + opts.Extension
+}
+
+// readVerified reads a file and verifies it against its export checksum.
+func readVerified(filePath string) ([]byte, error) {
+	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("removeFileFromKnowledge: failed with status %s", resp.Status)
+	if err = verifyChecksum(filePath, content); err != nil {
+		return nil, err
 	}
-	log.Printf("Removed file ID %s from knowledge collection.", fileID)
-	return nil
+	return content, nil
 }
 
-// uploadToOpenWebUI uploads a file via multipart form data.
-func uploadToOpenWebUI(filePath string) error {
-	f, err := os.Open(filePath)
+// readDocument reads and verifies a file and prepares it for the sinks.
+func readDocument(ctx context.Context, filePath string, opts uploadOptions) (sinks.Document, error) {
+	content, err := readVerified(filePath)
 	if err != nil {
-		return err
+		return sinks.Document{}, err
+	}
+	metadata, err := documentMetadata(filePath)
+	if err != nil {
+		return sinks.Document{}, err
+	}
+	doc := sinks.Document{
+		Path:        filePath,
+		Checksum:    utils.Checksum(content),
+		Metadata:    metadata,
+		Name:        uploadName(filePath, opts),
+		ContentType: opts.ContentType,
+		PlainText:   opts.PlainText,
 	}
-	defer f.Close()
+	// Drop boilerplate such as revision history tables before it adds noise to retrieval.
+	content = []byte(utils.StripSections(string(content), config.ConfigInstance.StripSections))
+	doc.Content = expandGlossary(ctx, content)
+	return doc, nil
+}
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile("file", filepath.Base(filePath))
+// documentMetadata describes a local file from its export record, for sinks
+// that store metadata next to the content.
+func documentMetadata(filePath string) (map[string]interface{}, error) {
+	metadata := map[string]interface{}{"collection": collectionOf(filePath)}
+	record, err := models.GetExportedDocumentByPath(utils.DB, exportedSourcePath(filePath))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return metadata, nil
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if _, err = io.Copy(part, f); err != nil {
-		return err
+	metadata["document_id"] = record.DocumentID
+	metadata["workspace"] = record.Workspace
+	metadata["title"] = record.Title
+	metadata["url"] = record.URL
+	metadata["collection"] = record.CollectionName
+	metadata["classification"] = record.Classification
+	metadata["updated_at"] = record.DocumentUpdatedAt
+	if record.Tags != "" {
+		metadata["tags"] = strings.Split(record.Tags, ",")
+	}
+	if record.Questions != "" {
+		metadata["questions"] = strings.Split(record.Questions, "\n")
 	}
-	writer.Close()
+	return metadata, nil
+}
 
-	url := fmt.Sprintf("%s/files/", config.ConfigInstance.OpenWebUIAPIURL)
-	req, err := http.NewRequest("POST", url, body)
+// prepareUploadParts reads a file and returns the files it is uploaded as.
+func prepareUploadParts(ctx context.Context, filePath string, opts uploadOptions) ([]sinks.OpenWebUIPart, error) {
+	doc, err := readDocument(ctx, filePath, opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	resp, err := http.DefaultClient.Do(req)
+	return sinks.OpenWebUIParts(doc), nil
+}
+
+// uploadToOpenWebUI uploads a document via multipart form data, adds it to the
+// given knowledge collection and tracks it as managed. The content is verified
+// against its export checksum immediately before upload. A pre-chunked
+// document is uploaded as several files, each tracked under the same path.
+func uploadToOpenWebUI(ctx context.Context, filePath, knowledgeID string, opts uploadOptions) error {
+	parts, err := prepareUploadParts(ctx, filePath, opts)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		respBody, _ := ioutil.ReadAll(resp.Body)
-		return fmt.Errorf("uploadToOpenWebUI: unexpected status: %s, body: %s", resp.Status, string(respBody))
+	return sinks.UploadOpenWebUIParts(ctx, filePath, knowledgeID, parts, opts.ContentType)
+}
+
+// prepareDocuments reads and verifies files for the sinks and returns the
+// files that failed.
+func prepareDocuments(ctx context.Context, filePaths []string, mappings map[string]models.CollectionMapping) ([]sinks.Document, map[string]bool) {
+	docs := make([]sinks.Document, 0, len(filePaths))
+	failed := make(map[string]bool)
+	for _, filePath := range filePaths {
+		doc, err := readDocument(ctx, filePath, uploadOptionsFor(filePath, mappings))
+		if err != nil {
+			logging.FromContext(ctx).Error("Error preparing file", "file", filePath, "error", err)
+			failed[filePath] = true
+			continue
+		}
+		docs = append(docs, doc)
 	}
-	var uploadResp map[string]interface{}
-	if err = json.NewDecoder(resp.Body).Decode(&uploadResp); err != nil {
-		return err
+	return docs, failed
+}
+
+// configuredSink returns a sink listed in SINKS.
+func configuredSink(name string) (sinks.Sink, error) {
+	sink := sinks.Get(name)
+	if sink == nil {
+		return nil, fmt.Errorf("sink %s is not registered", name)
 	}
-	fileID, ok := uploadResp["id"].(string)
-	if !ok || fileID == "" {
-		return fmt.Errorf("uploadToOpenWebUI: file ID not found in response")
+	return sink, nil
+}
+
+// beforeKnowledgeSync adopts the files of a pre-populated OpenWebUI knowledge
+// collection on the first sync, protecting everything it does not match
+// instead of wiping it.
+func beforeKnowledgeSync(ctx context.Context, name, knowledgeID string, filePaths []string, mappings map[string]models.CollectionMapping) error {
+	if name != "openwebui" {
+		return nil
+	}
+	if err := adoptExistingKnowledge(ctx, knowledgeID, filePaths, mappings); err != nil {
+		return fmt.Errorf("error reconciling knowledge collection: %w", err)
+	}
+	return nil
+}
+
+// afterKnowledgeSync refreshes the description and model bindings of an
+// OpenWebUI knowledge collection.
+func afterKnowledgeSync(ctx context.Context, name, knowledgeID string, mappings map[string]models.CollectionMapping) {
+	if name != "openwebui" {
+		return
 	}
-	log.Printf("Uploaded file %s with ID %s", filePath, fileID)
-	return addToKnowledgeCollection(fileID)
+	if err := describeKnowledgeCollection(ctx, knowledgeID); err != nil {
+		logging.FromContext(ctx).Error("Error updating description of knowledge collection", "knowledge_id", knowledgeID, "error", err)
+	}
+	bindKnowledgeModels(ctx, knowledgeID, mappings)
 }
 
-// addToKnowledgeCollection adds an uploaded file to the knowledge collection.
-func addToKnowledgeCollection(fileID string) error {
-	url := fmt.Sprintf("%s/knowledge/%s/file/add", config.ConfigInstance.OpenWebUIAPIURL, config.ConfigInstance.KnowledgeCollectionID)
-	payload := map[string]interface{}{
-		"file_id": fileID,
+// uploadFilesToKnowledge makes what every sink stores for a knowledge
+// collection match filePaths: new and changed files are uploaded, files
+// already stored unchanged are left alone and the files of paths no longer
+// present are removed, so the collection stays usable throughout the sync.
+// Only files the scraper manages are removed, and if scopeDir is set only
+// those exported below it, so manually curated files and other collections
+// sharing the knowledge collection stay intact. Files classified above what
+// the knowledge collection allows are skipped. Every file is read and
+// verified before anything is removed; if more than MAX_FAILURE_PERCENT of
+// them fail, the collection is left untouched, and a file that fails keeps
+// its previous version. A failing sink does not stop the others.
+func uploadFilesToKnowledge(ctx context.Context, knowledgeID string, filePaths []string, scopeDir string, mappings map[string]models.CollectionMapping) (err error) {
+	defer func() { noteTargetResult(ctx, knowledgeID, err) }()
+	// Never send content above the collection's classification limit.
+	filePaths = filterByClassification(ctx, knowledgeID, filePaths, mappings)
+	docs, failed := prepareDocuments(ctx, filePaths, mappings)
+	if exceedsFailureThreshold(len(failed), len(filePaths)) {
+		return fmt.Errorf("upload aborted: %d of %d files could not be read or verified", len(failed), len(filePaths))
+	}
+	keep := make(map[string]bool, len(filePaths))
+	for _, filePath := range filePaths {
+		keep[filePath] = true
+	}
+	var errs []error
+	for _, name := range config.ConfigInstance.Sinks {
+		if err := syncKnowledge(ctx, name, knowledgeID, filePaths, docs, scopeDir, keep, mappings); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", name, err))
+		}
 	}
-	payloadBytes, err := json.Marshal(payload)
+	return errors.Join(errs...)
+}
+
+// syncKnowledge makes what one sink stores for a knowledge collection match
+// docs, removing the stored files not in keep.
+func syncKnowledge(ctx context.Context, name, knowledgeID string, filePaths []string, docs []sinks.Document, scopeDir string, keep map[string]bool, mappings map[string]models.CollectionMapping) error {
+	sink, err := configuredSink(name)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	if err := beforeKnowledgeSync(ctx, name, knowledgeID, filePaths, mappings); err != nil {
+		return err
+	}
+	stored, err := sink.List(ctx, knowledgeID)
+	if err != nil {
+		return fmt.Errorf("error listing stored files: %w", err)
+	}
+	var stale []string
+	for filePath := range stored {
+		if keep[filePath] {
+			continue
+		}
+		if scopeDir != "" && !strings.HasPrefix(filePath, scopeDir+string(filepath.Separator)) {
+			continue
+		}
+		stale = append(stale, filePath)
+	}
+	if err := sink.Remove(ctx, knowledgeID, stale); err != nil {
+		return fmt.Errorf("error removing stale files: %w", err)
+	}
+	uploaded, err := sink.Upload(ctx, knowledgeID, docs)
 	if err != nil {
+		return fmt.Errorf("uploaded %d files, the others failed: %w", uploaded, err)
+	}
+	logging.FromContext(ctx).Info("Knowledge collection synced", "knowledge_id", knowledgeID, "sink", name,
+		"uploaded", uploaded, "removed", len(stale), "unchanged", len(docs)-uploaded)
+	afterKnowledgeSync(ctx, name, knowledgeID, mappings)
+	return nil
+}
+
+// replaceFilesInKnowledge applies a set of local changes to a knowledge
+// collection in every sink: the files of removed paths are removed and
+// changed paths whose content differs from what was stored are replaced.
+// Other files are left untouched. A changed file that cannot be read or
+// verified keeps its previous version.
+// Failed uploads are returned, so the sync run fails and its changes are
+// retried by the next one.
+func replaceFilesInKnowledge(ctx context.Context, knowledgeID string, changed, removed []string, mappings map[string]models.CollectionMapping) (err error) {
+	defer func() { noteTargetResult(ctx, knowledgeID, err) }()
+	allowed := filterByClassification(ctx, knowledgeID, changed, mappings)
+	docs, failed := prepareDocuments(ctx, allowed, mappings)
+	if exceedsFailureThreshold(len(failed), len(allowed)) {
+		return fmt.Errorf("upload aborted: %d of %d files could not be read or verified", len(failed), len(allowed))
+	}
+	prepared := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		prepared[doc.Path] = true
+	}
+	// Files now above the classification limit lose their previous version too.
+	var gone []string
+	for _, filePath := range append(append([]string{}, changed...), removed...) {
+		if !prepared[filePath] && !failed[filePath] {
+			gone = append(gone, filePath)
+		}
+	}
+	var errs []error
+	for _, name := range config.ConfigInstance.Sinks {
+		sink, err := configuredSink(name)
+		if err == nil {
+			err = beforeKnowledgeSync(ctx, name, knowledgeID, changed, mappings)
+		}
+		if err == nil {
+			err = sink.Remove(ctx, knowledgeID, gone)
+		}
+		if err == nil {
+			_, err = sink.Upload(ctx, knowledgeID, docs)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", name, err))
+			continue
+		}
+		afterKnowledgeSync(ctx, name, knowledgeID, mappings)
+	}
+	return errors.Join(errs...)
+}
+
+// uploadParams are the parameters of an upload job.
+type uploadParams struct {
+	SkipCanary bool `json:"skip_canary"`
+}
+
+// runUpload uploads the local Markdown files, top-level ones and those
+// anywhere below a collection directory, to the knowledge collections they are routed to
+// and replaces the managed files of every targeted collection. The canary
+// runs first unless skipCanary is set.
+func runUpload(ctx context.Context, skipCanary bool) error {
+	if err := checkNotFrozen(); err != nil {
 		return err
 	}
-	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	mappings, err := models.GetCollectionMappingRecords(utils.DB)
 	if err != nil {
+		return fmt.Errorf("error loading mappings: %w", err)
+	}
+	if err := ensureKnowledgeCollections(ctx, mappings); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("addToKnowledgeCollection: failed with status %s", resp.Status)
+	// Prove OpenWebUI accepts and indexes a sample before touching the real collection.
+	if config.ConfigInstance.CanaryKnowledgeCollectionID != "" && !skipCanary {
+		if err := runCanary(ctx, mappings); err != nil {
+			return fmt.Errorf("canary sync failed, upload aborted: %w", err)
+		}
+	}
+	filePaths, err := listMarkdownFiles(config.ConfigInstance.DocumentsDir)
+	if err != nil {
+		return fmt.Errorf("error reading directory: %w", err)
+	}
+
+	// Every mapped and the default collection is replaced, so collections
+	// whose files are all gone are emptied too.
+	byTarget := make(map[string][]string)
+	if config.ConfigInstance.KnowledgeCollectionID != "" {
+		byTarget[config.ConfigInstance.KnowledgeCollectionID] = nil
+	}
+	for _, mapping := range mappings {
+		for _, knowledgeID := range mapping.KnowledgeIDs() {
+			byTarget[knowledgeID] = nil
+		}
+	}
+	for _, filePath := range filePaths {
+		for _, knowledgeID := range knowledgeTargets(ctx, filePath, mappings) {
+			byTarget[knowledgeID] = append(byTarget[knowledgeID], filePath)
+		}
+	}
+	for knowledgeID, targetFiles := range byTarget {
+		if err := uploadFilesToKnowledge(ctx, knowledgeID, targetFiles, "", mappings); err != nil {
+			return fmt.Errorf("knowledge collection %s: %w", knowledgeID, err)
+		}
 	}
-	log.Printf("Added file ID %s to knowledge collection %s", fileID, config.ConfigInstance.KnowledgeCollectionID)
 	return nil
 }
 
 // UploadDocumentsHandler handles the upload process.
 // @Summary Upload documents
-// @Description Clears the OpenWebUI knowledge collection and uploads local Markdown files.
+// @Description Brings the files the scraper manages in the OpenWebUI knowledge collections in line with the local Markdown files: new and changed files are uploaded, unchanged ones kept and deleted ones removed, so the collections stay usable during the upload. Files added manually are left in place. Files in a collection subdirectory go to every knowledge collection mapped to that collection, all others to the default knowledge collection. When a canary knowledge collection is configured, a sample is synced there first and the upload is aborted if it fails. With async=true, or when the process runs in API-only mode, the upload is queued as a background job.
 // @Tags upload
 // @Produce plain
+// @Param skip_canary query bool false "Skip the canary sync"
+// @Param async query bool false "Queue the upload as a background job"
 // @Success 200 {string} string "Upload completed."
+// @Success 202 {object} models.Job
 // @Failure 500 {object} map[string]interface{}
 // @Router /upload [get]
 func UploadDocumentsHandler(w http.ResponseWriter, r *http.Request) {
-	if err := clearKnowledgeCollection(); err != nil {
-		http.Error(w, fmt.Sprintf("Error clearing knowledge collection: %v", err), http.StatusInternalServerError)
+	params := uploadParams{SkipCanary: r.URL.Query().Get("skip_canary") == "true"}
+	if runInBackground(r) {
+		enqueueJob(w, r, "upload", params)
 		return
 	}
-	files, err := ioutil.ReadDir(config.ConfigInstance.DocumentsDir)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error reading directory: %v", err), http.StatusInternalServerError)
+	if err := runUpload(context.WithoutCancel(r.Context()), params.SkipCanary); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".md") {
-			filePath := filepath.Join(config.ConfigInstance.DocumentsDir, file.Name())
-			if err := uploadToOpenWebUI(filePath); err != nil {
-				log.Printf("Error uploading file %s: %v", filePath, err)
-			}
-		}
-	}
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Upload completed."))
+	writeMessage(w, r, "Upload completed.")
 }
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+)
+
+// upstreamProbeTimeout bounds a single availability probe.
+const upstreamProbeTimeout = 10 * time.Second
+
+// upstreamProbeClient sends the probes. It is separate from the client of a
+// run, which debug capture and simulation replace, so probes always reach the
+// real upstreams.
+var upstreamProbeClient = &http.Client{Timeout: upstreamProbeTimeout}
+
+// upstreamStatus is the availability of an upstream as seen by the probes.
+type upstreamStatus struct {
+	Upstream string `json:"upstream" example:"outline"`
+	// Target is the workspace name for Outline, empty for the default one.
+	Target    string    `json:"target,omitempty"`
+	URL       string    `json:"url"`
+	Up        bool      `json:"up"`
+	CheckedAt time.Time `json:"checked_at"`
+	// Since is when the upstream last went up or down.
+	Since     time.Time `json:"since"`
+	LatencyMS int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	Checks    int       `json:"checks"`
+	Failures  int       `json:"failures"`
+}
+
+// upstreamProbe is a URL to probe.
+type upstreamProbe struct {
+	upstream, target, url string
+}
+
+var (
+	upstreamMu       sync.Mutex
+	upstreamStatuses = make(map[string]*upstreamStatus)
+)
+
+// upstreamProbes lists the health endpoints of the Outline workspaces and
+// OpenWebUI.
+func upstreamProbes() []upstreamProbe {
+	var probes []upstreamProbe
+	for _, ws := range config.ConfigInstance.Workspaces {
+		if !ws.IsOutline() {
+			continue
+		}
+		u, err := url.Parse(ws.APIBaseURL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		// Outline serves /_health next to /api, also under a base path.
+		u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/api") + "/_health"
+		u.RawPath, u.RawQuery = "", ""
+		probes = append(probes, upstreamProbe{upstream: "outline", target: ws.Name, url: u.String()})
+	}
+	if config.ConfigInstance.OpenWebUIAPIURL != "" {
+		probes = append(probes, upstreamProbe{upstream: "openwebui", url: openWebUIBaseURL() + "/health"})
+	}
+	return probes
+}
+
+// probeUpstream requests a health endpoint. Only connection errors and
+// server errors count as down; the health endpoints need no credentials.
+func probeUpstream(ctx context.Context, probe upstreamProbe) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, upstreamProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", probe.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	started := time.Now()
+	resp, err := upstreamProbeClient.Do(req)
+	latency := time.Since(started)
+	if err != nil {
+		return latency, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return latency, fmt.Errorf("probeUpstream: unexpected status: %s", resp.Status)
+	}
+	return latency, nil
+}
+
+// checkUpstreams probes every upstream once and logs changes of availability.
+func checkUpstreams(ctx context.Context) {
+	for _, probe := range upstreamProbes() {
+		latency, err := probeUpstream(ctx, probe)
+		now := time.Now()
+		upstreamMu.Lock()
+		key := probe.upstream + "\x00" + probe.target
+		status, known := upstreamStatuses[key]
+		if !known {
+			status = &upstreamStatus{Upstream: probe.upstream, Target: probe.target, URL: probe.url, Since: now}
+			upstreamStatuses[key] = status
+		}
+		up := err == nil
+		if known && status.Up != up {
+			status.Since = now
+			if up {
+				logging.FromContext(ctx).Info("Upstream is available again", "upstream", status.name())
+			} else {
+				logging.FromContext(ctx).Warn("Upstream is unavailable", "upstream", status.name(), "error", err)
+			}
+		} else if !known && !up {
+			logging.FromContext(ctx).Warn("Upstream is unavailable", "upstream", status.name(), "error", err)
+		}
+		status.Up, status.CheckedAt, status.LatencyMS, status.Error = up, now, latency.Milliseconds(), ""
+		status.Checks++
+		if !up {
+			status.Error = err.Error()
+			status.Failures++
+		}
+		upstreamMu.Unlock()
+	}
+}
+
+// name identifies an upstream in logs and sync errors.
+func (s upstreamStatus) name() string {
+	if s.Target != "" {
+		return s.Upstream + " (" + s.Target + ")"
+	}
+	return s.Upstream
+}
+
+// currentUpstreamStatuses returns a copy of the last probe results, ordered by
+// upstream and target.
+func currentUpstreamStatuses() []upstreamStatus {
+	upstreamMu.Lock()
+	defer upstreamMu.Unlock()
+	statuses := make([]upstreamStatus, 0, len(upstreamStatuses))
+	for _, status := range upstreamStatuses {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Upstream != statuses[j].Upstream {
+			return statuses[i].Upstream < statuses[j].Upstream
+		}
+		return statuses[i].Target < statuses[j].Target
+	})
+	return statuses
+}
+
+// upstreamOutages describes the upstreams currently down, for attributing a
+// failed sync; empty while all are up.
+func upstreamOutages() string {
+	var down []string
+	for _, status := range currentUpstreamStatuses() {
+		if !status.Up {
+			down = append(down, fmt.Sprintf("%s down since %s", status.name(), status.Since.Format(time.RFC3339)))
+		}
+	}
+	return strings.Join(down, ", ")
+}
+
+// StartUpstreamMonitor probes Outline and OpenWebUI every
+// UPSTREAM_PROBE_INTERVAL until ctx is done. Simulation mode has no
+// upstreams to probe.
+func StartUpstreamMonitor(ctx context.Context) {
+	if config.ConfigInstance.UpstreamProbeInterval <= 0 || activeSimulator != nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(config.ConfigInstance.UpstreamProbeInterval)
+		defer ticker.Stop()
+		for {
+			checkUpstreams(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
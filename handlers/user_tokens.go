@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// UserTokenPayload represents the expected payload for registering a user token.
+type UserTokenPayload struct {
+	Name                  string `json:"name"`                    // e.g., "hr-team"
+	Workspace             string `json:"workspace"`               // configured workspace name, empty for the default one
+	Token                 string `json:"token"`                   // the user's Outline API token
+	KnowledgeCollectionID string `json:"knowledge_collection_id"` // e.g., "kc-hr"; empty provisions a private collection
+	OpenWebUIUserID       string `json:"openwebui_user_id"`       // OpenWebUI user a provisioned collection is shared with
+	Schedule              string `json:"schedule"`                // e.g., "Mon-Fri 06:00"; SYNC_SCHEDULE format
+}
+
+// userTokenParams are the parameters of a user sync job.
+type userTokenParams struct {
+	ID uint `json:"id"`
+}
+
+// userDocumentsDir returns the directory the documents of a user token are written to.
+func userDocumentsDir(record models.UserToken) string {
+	return filepath.Join(config.ConfigInstance.UserDocumentsDir, utils.SanitizeFilename(record.Name))
+}
+
+// exportedSourcePath maps a file in a user's directory back to the exported
+// file it was copied from; other paths are returned unchanged.
+func exportedSourcePath(filePath string) string {
+	rel, err := filepath.Rel(config.ConfigInstance.UserDocumentsDir, filePath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filePath
+	}
+	_, rest, found := strings.Cut(rel, string(filepath.Separator))
+	if !found {
+		return filePath
+	}
+	return filepath.Join(config.ConfigInstance.DocumentsDir, rest)
+}
+
+// runUserSync lists the documents a registered user can read with their own
+// Outline token, copies their exports (and attachment companions) into the
+// user's directory and replaces the managed files of the user's knowledge
+// collection with them. Documents are taken from the regular export, so it
+// must have run with a token that sees everything.
+func runUserSync(ctx context.Context, id uint) error {
+	if err := checkNotFrozen(); err != nil {
+		return err
+	}
+	var record models.UserToken
+	if err := utils.DB.First(&record, id).Error; err != nil {
+		return err
+	}
+	syncErr := syncUserDocuments(ctx, &record)
+	now := time.Now()
+	record.LastSyncedAt = &now
+	record.LastError = ""
+	if syncErr != nil {
+		record.LastError = syncErr.Error()
+	}
+	// Only the sync outcome; the scheduler may have advanced next_sync_at meanwhile.
+	if err := utils.DB.Model(&record).Select("last_synced_at", "last_error", "documents").Updates(&record).Error; err != nil {
+		logging.FromContext(ctx).Error("Error recording sync of user token", "user", record.Name, "error", err)
+	}
+	return syncErr
+}
+
+// syncUserDocuments performs the sync of runUserSync.
+func syncUserDocuments(ctx context.Context, record *models.UserToken) error {
+	ws, ok := findWorkspace(record.Workspace)
+	if !ok {
+		return fmt.Errorf("unknown workspace %q", record.Workspace)
+	}
+	token, err := userOutlineToken(ctx, record)
+	if err != nil {
+		return fmt.Errorf("error loading token: %w", err)
+	}
+	ws.APIToken = token
+	docs, err := collectDocuments(ctx, ws)
+	if err != nil {
+		return err
+	}
+
+	dir := userDocumentsDir(*record)
+	written := make(map[string]bool)
+	var filePaths []string
+	for _, doc := range docs {
+		exports, err := models.ListDocumentRecords(utils.DB, doc.ID)
+		if err != nil {
+			return err
+		}
+		if len(exports) == 0 {
+			logging.FromContext(ctx).Info("Document has not been exported yet, skipping", "user", record.Name, "document_id", doc.ID)
+			continue
+		}
+		for _, export := range exports {
+			rel, err := filepath.Rel(config.ConfigInstance.DocumentsDir, export.FilePath)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				continue
+			}
+			content, err := readVerified(export.FilePath)
+			if err != nil {
+				logging.FromContext(ctx).Error("Error reading export", "user", record.Name, "file", export.FilePath, "error", err)
+				continue
+			}
+			target := filepath.Join(dir, rel)
+			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				return err
+			}
+			if err := utils.WriteFileAtomic(target, content, 0644); err != nil {
+				return err
+			}
+			written[target] = true
+			filePaths = append(filePaths, target)
+		}
+	}
+	// Drop documents the user lost access to.
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || written[path] || !isExportedFile(path) {
+			return err
+		}
+		return os.Remove(path)
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	record.Documents = len(docs)
+
+	if err := provisionUserKnowledge(ctx, record); err != nil {
+		return err
+	}
+	mappings, err := models.GetCollectionMappingRecords(utils.DB)
+	if err != nil {
+		return fmt.Errorf("error loading mappings: %w", err)
+	}
+	if err := uploadFilesToKnowledge(ctx, record.KnowledgeCollectionID, filePaths, "", mappings); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("Synced user documents", "user", record.Name, "files", len(filePaths), "documents", len(docs))
+	return nil
+}
+
+// provisionUserKnowledge creates a private knowledge collection for a user
+// token without one, or whose provisioned collection went missing, shared
+// only with the token's OpenWebUI user.
+func provisionUserKnowledge(ctx context.Context, record *models.UserToken) error {
+	if record.KnowledgeCollectionID != "" {
+		if !record.Provisioned {
+			return nil
+		}
+		exists, err := knowledgeExists(ctx, record.KnowledgeCollectionID)
+		if err != nil || exists {
+			return err
+		}
+	}
+	// An empty access control makes the collection private to its owner.
+	access := map[string]interface{}{}
+	if record.OpenWebUIUserID != "" {
+		grant := map[string][]string{"group_ids": {}, "user_ids": {record.OpenWebUIUserID}}
+		access = map[string]interface{}{"read": grant, "write": grant}
+	}
+	created, err := createKnowledgeCollection(ctx, record.Name,
+		fmt.Sprintf("Outline documents %s can read", record.Name), access)
+	if err != nil {
+		return fmt.Errorf("error creating knowledge collection for %s: %w", record.Name, err)
+	}
+	logging.FromContext(ctx).Info("Created private knowledge collection", "user", record.Name, "knowledge_id", created)
+	record.KnowledgeCollectionID, record.Provisioned = created, true
+	// Store the ID now so a failing upload does not provision another one.
+	return utils.DB.Model(record).Updates(map[string]interface{}{
+		"knowledge_collection_id": created,
+		"provisioned":             true,
+	}).Error
+}
+
+// nextUserSync returns the next time a user token schedule is due, or nil
+// without a schedule.
+func nextUserSync(schedule string, now time.Time) (*time.Time, error) {
+	schedules, err := config.ParseSchedules(schedule, config.ConfigInstance.SyncLocation)
+	if err != nil {
+		return nil, err
+	}
+	return nextRun(schedules, now), nil
+}
+
+// CreateUserTokenHandler registers the Outline API token of a user.
+// @Summary Register a user token
+// @Description Stores a user's (or group service user's) Outline API token encrypted with TOKEN_ENCRYPTION_KEY. Syncing the token exports only the documents that user can read into a separate directory and knowledge collection. Without a knowledge collection ID, a private collection shared with openwebui_user_id is created on the first sync. With a schedule, the token is synced at those times. Requires ADMIN_API_KEY.
+// @Tags usertokens
+// @Accept json
+// @Produce json
+// @Param token body UserTokenPayload true "User token payload"
+// @Success 201 {object} models.UserToken
+// @Failure 400 {object} map[string]string "Invalid payload"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "TOKEN_ENCRYPTION_KEY is not configured"
+// @Failure 500 {object} map[string]string "Failed to register user token"
+// @Router /usertokens [post]
+func CreateUserTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if config.ConfigInstance.TokenEncryptionKey == "" {
+		http.Error(w, "TOKEN_ENCRYPTION_KEY is not configured", http.StatusForbidden)
+		return
+	}
+	var payload UserTokenPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Name == "" || payload.Token == "" {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+	nextSync, err := nextUserSync(payload.Schedule, time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid schedule: %v", err), http.StatusBadRequest)
+		return
+	}
+	if _, ok := findWorkspace(payload.Workspace); !ok {
+		http.Error(w, "Unknown workspace", http.StatusBadRequest)
+		return
+	}
+	encrypted, err := encryptSecret(payload.Token)
+	if err != nil {
+		http.Error(w, "Failed to register user token", http.StatusInternalServerError)
+		return
+	}
+	record := models.UserToken{
+		Name:                  payload.Name,
+		Workspace:             payload.Workspace,
+		EncryptedToken:        encrypted,
+		KnowledgeCollectionID: payload.KnowledgeCollectionID,
+		OpenWebUIUserID:       payload.OpenWebUIUserID,
+		Schedule:              payload.Schedule,
+		NextSyncAt:            nextSync,
+	}
+	if err := utils.DB.Create(&record).Error; err != nil {
+		http.Error(w, "Failed to register user token", http.StatusInternalServerError)
+		return
+	}
+	setAuditTarget(r, strconv.FormatUint(uint64(record.ID), 10))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(record)
+}
+
+// GetUserTokensHandler lists the registered user tokens.
+// @Summary Get user tokens
+// @Description Lists registered user tokens and their last sync (without the tokens themselves). Requires ADMIN_API_KEY.
+// @Tags usertokens
+// @Produce json
+// @Success 200 {array} models.UserToken
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Failed to retrieve user tokens"
+// @Router /usertokens [get]
+func GetUserTokensHandler(w http.ResponseWriter, r *http.Request) {
+	var records []models.UserToken
+	if err := utils.DB.Order("id").Find(&records).Error; err != nil {
+		http.Error(w, "Failed to retrieve user tokens", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+// DeleteUserTokenHandler removes a user token and the user's exported files.
+// @Summary Remove a user token
+// @Description Deletes a user token and the user's document directory. The user's knowledge collection is left unchanged. Requires ADMIN_API_KEY.
+// @Tags usertokens
+// @Param id path int true "User token ID"
+// @Success 204 "Removed"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "User token not found"
+// @Failure 500 {object} map[string]string "Failed to remove user token"
+// @Router /usertokens/{id} [delete]
+func DeleteUserTokenHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "User token not found", http.StatusNotFound)
+		return
+	}
+	var record models.UserToken
+	if err := utils.DB.First(&record, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "User token not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to remove user token", http.StatusInternalServerError)
+		return
+	}
+	if err := utils.DB.Delete(&record).Error; err != nil {
+		http.Error(w, "Failed to remove user token", http.StatusInternalServerError)
+		return
+	}
+	if err := os.RemoveAll(userDocumentsDir(record)); err != nil {
+		logging.FromContext(r.Context()).Error("Error removing documents of user token", "user", record.Name, "error", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SyncUserTokenHandler syncs the documents a registered user can read.
+// @Summary Sync a user token
+// @Description Lists the documents the user can read with their own Outline token, copies their exports into the user's directory and replaces the managed files of the user's knowledge collection. With async=true, or when the process runs in API-only mode, the sync is queued as a background job. Requires ADMIN_API_KEY.
+// @Tags usertokens
+// @Produce plain
+// @Param id path int true "User token ID"
+// @Param async query bool false "Queue the sync as a background job"
+// @Success 200 {string} string "Sync completed."
+// @Success 202 {object} models.Job
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "User token not found"
+// @Failure 500 {object} map[string]string "Sync failed"
+// @Router /usertokens/{id}/sync [post]
+func SyncUserTokenHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "User token not found", http.StatusNotFound)
+		return
+	}
+	var count int64
+	if err := utils.DB.Model(&models.UserToken{}).Where("id = ?", id).Count(&count).Error; err != nil || count == 0 {
+		http.Error(w, "User token not found", http.StatusNotFound)
+		return
+	}
+	if runInBackground(r) {
+		enqueueJob(w, r, "user.sync", userTokenParams{ID: uint(id)})
+		return
+	}
+	if err := runUserSync(context.WithoutCancel(r.Context()), uint(id)); err != nil {
+		http.Error(w, localize(r, "Sync failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeMessage(w, r, "Sync completed.")
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// UserPayload represents the expected payload for registering or updating a user.
+type UserPayload struct {
+	Email string `json:"email"` // e.g., "jane@example.com"
+	Name  string `json:"name"`  // e.g., "Jane Doe"
+	Role  string `json:"role"`  // role name, e.g., "operator"
+}
+
+// RolePayload represents the expected payload for creating a role.
+type RolePayload struct {
+	Name  string `json:"name"`  // e.g., "auditor"
+	Scope string `json:"scope"` // read, sync or admin
+}
+
+// userFromPayload validates a payload and resolves its role.
+func userFromPayload(w http.ResponseWriter, r *http.Request) (*UserPayload, *models.Role, bool) {
+	var payload UserPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || !strings.Contains(payload.Email, "@") {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	if payload.Role == "" {
+		payload.Role = models.RoleOperator
+	}
+	role, err := models.FindRoleByName(utils.DB, payload.Role)
+	if err != nil {
+		http.Error(w, "Unknown role "+payload.Role, http.StatusBadRequest)
+		return nil, nil, false
+	}
+	payload.Email = strings.ToLower(strings.TrimSpace(payload.Email))
+	return &payload, role, true
+}
+
+// CreateUserHandler registers a user.
+// @Summary Register a user
+// @Description Registers a user signing in through OIDC, matched by an email the provider verified, with a role: operator can read and trigger syncs, admin can also edit mappings and API keys. Registered users may sign in without belonging to OIDC_ADMIN_GROUP; unregistered members of the group are admins. Requires ADMIN_API_KEY or the admin role.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body UserPayload true "User payload"
+// @Success 201 {object} models.User
+// @Failure 400 {object} map[string]string "Invalid payload or unknown role"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "User already exists"
+// @Failure 500 {object} map[string]string "Failed to create user"
+// @Router /users [post]
+func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	payload, role, ok := userFromPayload(w, r)
+	if !ok {
+		return
+	}
+	if _, err := models.FindUserByEmail(utils.DB, payload.Email); err == nil {
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	}
+	user := models.User{Email: payload.Email, Name: payload.Name, RoleID: role.ID, Role: *role}
+	if err := utils.DB.Omit("Role").Create(&user).Error; err != nil {
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+	setAuditTarget(r, "user:"+user.Email)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// GetUsersHandler lists the registered users.
+// @Summary Get users
+// @Description Lists registered users with their roles and last sign-in. Requires ADMIN_API_KEY or the admin role.
+// @Tags users
+// @Produce json
+// @Success 200 {array} models.User
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Failed to retrieve users"
+// @Router /users [get]
+func GetUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := models.ListUsers(utils.DB)
+	if err != nil {
+		http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// UpdateUserHandler changes a user's name or role.
+// @Summary Update a user
+// @Description Changes the name and role of a registered user. The new role applies to running sessions right away. Requires ADMIN_API_KEY or the admin role.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param user body UserPayload true "User payload"
+// @Success 200 {object} models.User
+// @Failure 400 {object} map[string]string "Invalid payload or unknown role"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "User not found"
+// @Failure 500 {object} map[string]string "Failed to update user"
+// @Router /users/{id} [put]
+func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var user models.User
+	if err := utils.DB.First(&user, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	payload, role, ok := userFromPayload(w, r)
+	if !ok {
+		return
+	}
+	if payload.Email != user.Email {
+		http.Error(w, "The email of a user cannot be changed", http.StatusBadRequest)
+		return
+	}
+	user.Name, user.RoleID, user.Role = payload.Name, role.ID, *role
+	if err := utils.DB.Omit("Role").Save(&user).Error; err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+	setAuditTarget(r, "user:"+user.Email)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// DeleteUserHandler removes a user.
+// @Summary Remove a user
+// @Description Deletes a registered user. Unless they belong to OIDC_ADMIN_GROUP, their sessions lose access right away. Requires ADMIN_API_KEY or the admin role.
+// @Tags users
+// @Param id path int true "User ID"
+// @Success 204 "Removed"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "User not found"
+// @Failure 500 {object} map[string]string "Failed to remove user"
+// @Router /users/{id} [delete]
+func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	result := utils.DB.Delete(&models.User{}, id)
+	if result.Error != nil {
+		http.Error(w, "Failed to remove user", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateRoleHandler creates a role.
+// @Summary Create a role
+// @Description Creates a role granting one scope: read allows reporting GET requests, sync also exports, uploads and syncs, admin also manages mappings, API keys and users. The built-in operator (sync) and admin (admin) roles always exist. Requires ADMIN_API_KEY or the admin role.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param role body RolePayload true "Role payload"
+// @Success 201 {object} models.Role
+// @Failure 400 {object} map[string]string "Invalid payload"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "Role already exists"
+// @Failure 500 {object} map[string]string "Failed to create role"
+// @Router /roles [post]
+func CreateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RolePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Name == "" || !models.ValidScope(payload.Scope) {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+	if _, err := models.FindRoleByName(utils.DB, payload.Name); err == nil {
+		http.Error(w, "Role already exists", http.StatusConflict)
+		return
+	}
+	role := models.Role{Name: payload.Name, Scope: payload.Scope}
+	if err := utils.DB.Create(&role).Error; err != nil {
+		http.Error(w, "Failed to create role", http.StatusInternalServerError)
+		return
+	}
+	setAuditTarget(r, "role:"+role.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(role)
+}
+
+// GetRolesHandler lists the roles.
+// @Summary Get roles
+// @Description Lists the roles users can be given and their scopes. Requires ADMIN_API_KEY or the admin role.
+// @Tags users
+// @Produce json
+// @Success 200 {array} models.Role
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Failed to retrieve roles"
+// @Router /roles [get]
+func GetRolesHandler(w http.ResponseWriter, r *http.Request) {
+	var roles []models.Role
+	if err := utils.DB.Order("id").Find(&roles).Error; err != nil {
+		http.Error(w, "Failed to retrieve roles", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roles)
+}
+
+// DeleteRoleHandler deletes a role.
+// @Summary Delete a role
+// @Description Deletes a role no user holds. Built-in roles cannot be deleted. Requires ADMIN_API_KEY or the admin role.
+// @Tags users
+// @Param id path int true "Role ID"
+// @Success 204 "Deleted"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Role not found"
+// @Failure 409 {object} map[string]string "Role is built in or still assigned"
+// @Failure 500 {object} map[string]string "Failed to delete role"
+// @Router /roles/{id} [delete]
+func DeleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var role models.Role
+	if err := utils.DB.First(&role, mux.Vars(r)["id"]).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Role not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete role", http.StatusInternalServerError)
+		}
+		return
+	}
+	setAuditTarget(r, "role:"+role.Name)
+	if role.Builtin {
+		http.Error(w, "Built-in roles cannot be deleted", http.StatusConflict)
+		return
+	}
+	var holders int64
+	if err := utils.DB.Model(&models.User{}).Where("role_id = ?", role.ID).Count(&holders).Error; err != nil {
+		http.Error(w, "Failed to delete role", http.StatusInternalServerError)
+		return
+	}
+	if holders > 0 {
+		http.Error(w, "Role is still assigned to users", http.StatusConflict)
+		return
+	}
+	if err := utils.DB.Delete(&role).Error; err != nil {
+		http.Error(w, "Failed to delete role", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
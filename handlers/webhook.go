@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/sources"
+	"github.com/mikeshootzz/outline-rag-scraper/timings"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// errDocumentGone is returned by fetchDocument for deleted or inaccessible documents.
+var errDocumentGone = errors.New("document deleted or not accessible")
+
+// fetchDocument retrieves a single document from the docs API.
+func fetchDocument(ctx context.Context, ws config.Workspace, documentID string) (*models.Document, error) {
+	url := fmt.Sprintf("%s/documents.info", ws.APIBaseURL)
+	payloadBytes, err := json.Marshal(map[string]interface{}{"id": documentID})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+ws.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := sources.DoWithRateLimit(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden {
+		return nil, errDocumentGone
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetchDocument: unexpected status: %s", resp.Status)
+	}
+	var infoResp struct {
+		Data models.Document `json:"data"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&infoResp); err != nil {
+		return nil, err
+	}
+	return &infoResp.Data, nil
+}
+
+// findWorkspace returns the configured workspace with the given name; the
+// empty name selects the default workspace.
+func findWorkspace(name string) (config.Workspace, bool) {
+	for _, ws := range config.ConfigInstance.Workspaces {
+		if ws.Name == name {
+			return ws, true
+		}
+	}
+	return config.Workspace{}, false
+}
+
+// documentSyncParams are the parameters of a single-document sync job.
+type documentSyncParams struct {
+	Workspace  string `json:"workspace,omitempty"`
+	DocumentID string `json:"document_id"`
+	// Remove drops the document without asking Outline, e.g. after a delete event.
+	Remove bool `json:"remove,omitempty"`
+}
+
+// runDocumentSync exports one document, or removes it when it was deleted or
+// archived, and applies the result to its knowledge collections. It takes the
+// sync lock like a full sync: both read the change feed from a cursor and
+// stage runs that fold in each other's pending changes, so interleaving them
+// could publish a changeset twice or lose one.
+func runDocumentSync(ctx context.Context, params documentSyncParams) error {
+	ctx, unlock, err := lockSync(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	ws, ok := findWorkspace(params.Workspace)
+	if !ok {
+		return fmt.Errorf("unknown workspace %q", params.Workspace)
+	}
+	if !ws.IsOutline() {
+		return fmt.Errorf("workspace %q does not support single-document syncs", params.Workspace)
+	}
+	cursor, err := models.LatestDocumentChangeID(utils.DB)
+	if err != nil {
+		return fmt.Errorf("error reading change feed: %w", err)
+	}
+	ctx, recorder := timings.Start(ctx)
+	defer recorder.Stop()
+	records, err := models.ListDocumentRecords(utils.DB, params.DocumentID)
+	if err != nil {
+		return err
+	}
+	// Only this document and its attachment companions belong to the changeset.
+	ids := map[string]bool{params.DocumentID: true}
+	for _, record := range records {
+		ids[record.DocumentID] = true
+	}
+
+	remove := params.Remove
+	if !remove {
+		doc, err := fetchDocument(ctx, ws, params.DocumentID)
+		switch {
+		case errors.Is(err, errDocumentGone):
+			remove = true
+		case err != nil:
+			return err
+		case doc.ArchivedAt != nil || exportExclusion(ctx, ws, *doc) != "":
+			remove = true
+		default:
+			if err := exportAndSaveDocument(ctx, ws, *doc, ""); err != nil {
+				noteExportFailure(ctx, ws, doc.ID, err)
+				return fmt.Errorf("error exporting document %s: %w", doc.ID, err)
+			}
+			noteExportSuccess(ctx, ws, doc.ID)
+			// Pick up companions of attachments added by this export.
+			if records, err = models.ListDocumentRecords(utils.DB, params.DocumentID); err != nil {
+				return err
+			}
+			for _, record := range records {
+				ids[record.DocumentID] = true
+			}
+		}
+	}
+	if remove {
+		for _, record := range records {
+			if err := removeExportedDocument(ctx, record); err != nil {
+				return err
+			}
+		}
+	}
+
+	changed, removed, err := changesSince(cursor, func(change models.DocumentChange) bool {
+		return ids[change.DocumentID]
+	})
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+	logging.FromContext(ctx).Info("Document sync: staging changes", "document_id", params.DocumentID, "changed", len(changed), "removed", len(removed))
+	_, err = stageChanges(ctx, changed, removed, recorder.Stop(), true, "")
+	return err
+}
+
+// outlineWebhookEvent is the part of an Outline webhook delivery this tool reads.
+type outlineWebhookEvent struct {
+	Event   string `json:"event"`
+	Payload struct {
+		ID    string `json:"id"`
+		Model struct {
+			ID string `json:"id"`
+		} `json:"model"`
+	} `json:"payload"`
+}
+
+// verifyOutlineSignature checks the Outline-Signature header, formatted as
+// "t=<timestamp>,s=<hex HMAC-SHA256 of timestamp.body>".
+func verifyOutlineSignature(header string, body []byte, secret string) bool {
+	var timestamp, signature string
+	for _, field := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "s":
+			signature = value
+		}
+	}
+	if timestamp == "" || signature == "" {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// OutlineWebhookHandler queues a priority sync for the document an Outline
+// webhook reports.
+// @Summary Receive Outline webhooks
+// @Description Queues a priority sync of the document a documents.* webhook event refers to. Deleted and archived documents are removed from their knowledge collections. Priority jobs are served by reserved workers (PRIORITY_WORKERS), so they complete within seconds even while a full sync runs. When OUTLINE_WEBHOOK_SECRET is set, the Outline-Signature header is verified.
+// @Tags sync
+// @Accept json
+// @Produce json
+// @Param workspace query string false "Name of the workspace the webhook belongs to (default workspace if omitted)"
+// @Success 202 {object} models.Job
+// @Success 204 "Event ignored"
+// @Failure 400 {object} map[string]string "Invalid payload or unknown workspace"
+// @Failure 401 {object} map[string]string "Invalid signature"
+// @Failure 500 {object} map[string]string "Failed to queue job"
+// @Router /webhooks/outline [post]
+func OutlineWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	setAuditTrigger(r, models.TriggerWebhook)
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+	if secret := config.ConfigInstance.OutlineWebhookSecret; secret != "" {
+		if !verifyOutlineSignature(r.Header.Get("Outline-Signature"), body, secret) {
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+	}
+	var event outlineWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+	workspace := r.URL.Query().Get("workspace")
+	if _, ok := findWorkspace(workspace); !ok {
+		http.Error(w, "Unknown workspace", http.StatusBadRequest)
+		return
+	}
+	documentID := event.Payload.Model.ID
+	if documentID == "" {
+		documentID = event.Payload.ID
+	}
+	if !strings.HasPrefix(event.Event, "documents.") || documentID == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	params := documentSyncParams{
+		Workspace:  workspace,
+		DocumentID: documentID,
+		Remove:     event.Event == "documents.delete" || event.Event == "documents.archive",
+	}
+	setAuditTarget(r, "document:"+documentID)
+
+	// Bursts of edits to one document collapse into the job still waiting.
+	data, err := json.Marshal(params)
+	if err != nil {
+		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
+		return
+	}
+	queued, err := models.FindQueuedJob(utils.DB, "document.sync", string(data))
+	if err != nil {
+		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
+		return
+	}
+	if queued != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/jobs/"+strconv.FormatUint(uint64(queued.ID), 10))
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(queued)
+		return
+	}
+	enqueueJobWithPriority(w, r, "document.sync", params, models.PriorityHigh)
+}
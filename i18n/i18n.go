@@ -0,0 +1,103 @@
+// Package i18n translates the messages the scraper sends to people, such as
+// run summaries, using a small built-in catalog keyed by the English text.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the language messages are written in.
+const Default = "en"
+
+// catalog maps a language to the translations of English message formats.
+var catalog = map[string]map[string]string{
+	"de": {
+		"Sync completed.": "Synchronisierung abgeschlossen.",
+		"Sync run %d staged, waiting for approval.": "Synchronisierungslauf %d bereitgestellt, wartet auf Freigabe.",
+		"Sync failed: %v":                      "Synchronisierung fehlgeschlagen: %v",
+		"Upload completed.":                    "Upload abgeschlossen.",
+		"Export completed.":                    "Export abgeschlossen.",
+		"Error exporting documents: %v":        "Fehler beim Exportieren der Dokumente: %v",
+		"Permissions synced.":                  "Berechtigungen synchronisiert.",
+		"Sync run published.":                  "Synchronisierungslauf veröffentlicht.",
+		"Publish failed: %v":                   "Veröffentlichung fehlgeschlagen: %v",
+		"Sync run is not waiting for approval": "Synchronisierungslauf wartet nicht auf Freigabe",
+		"Outline account %s connected.":        "Outline-Konto %s verbunden.",
+		"This document could not be synced to the knowledge base %d times in a row. The knowledge base keeps its previous version until a sync succeeds.": "Dieses Dokument konnte %d Mal in Folge nicht mit der Wissensdatenbank synchronisiert werden. Die Wissensdatenbank behält die vorherige Version, bis eine Synchronisierung gelingt.",
+		"Administrators find the error in the logs of run %s.":                                                         "Administratoren finden den Fehler in den Logs des Laufs %s.",
+		"This document is not in the knowledge base. %s":                                                               "Dieses Dokument ist nicht in der Wissensdatenbank. %s",
+		"The document is archived in Outline. Restore it to include it.":                                               "Das Dokument ist in Outline archiviert. Stelle es wieder her, um es aufzunehmen.",
+		"The document is an unpublished draft. Publish it in Outline to include it.":                                   "Das Dokument ist ein unveröffentlichter Entwurf. Veröffentliche es in Outline, um es aufzunehmen.",
+		"The document is a template. Templates are not included.":                                                      "Das Dokument ist eine Vorlage. Vorlagen werden nicht aufgenommen.",
+		"The document does not match the export filter. Ask an administrator which collections and tags are included.": "Das Dokument entspricht nicht dem Exportfilter. Frage eine Administratorin oder einen Administrator, welche Sammlungen und Tags aufgenommen werden.",
+	},
+	"fr": {
+		"Sync completed.": "Synchronisation terminée.",
+		"Sync run %d staged, waiting for approval.": "Exécution de synchronisation %d préparée, en attente d'approbation.",
+		"Sync failed: %v":                      "Échec de la synchronisation : %v",
+		"Upload completed.":                    "Téléversement terminé.",
+		"Export completed.":                    "Exportation terminée.",
+		"Error exporting documents: %v":        "Erreur lors de l'exportation des documents : %v",
+		"Permissions synced.":                  "Autorisations synchronisées.",
+		"Sync run published.":                  "Exécution de synchronisation publiée.",
+		"Publish failed: %v":                   "Échec de la publication : %v",
+		"Sync run is not waiting for approval": "L'exécution de synchronisation n'est pas en attente d'approbation",
+		"Outline account %s connected.":        "Compte Outline %s connecté.",
+		"This document could not be synced to the knowledge base %d times in a row. The knowledge base keeps its previous version until a sync succeeds.": "Ce document n'a pas pu être synchronisé avec la base de connaissances %d fois de suite. La base de connaissances conserve sa version précédente jusqu'à ce qu'une synchronisation réussisse.",
+		"Administrators find the error in the logs of run %s.":                                                         "Les administrateurs trouvent l'erreur dans les journaux de l'exécution %s.",
+		"This document is not in the knowledge base. %s":                                                               "Ce document n'est pas dans la base de connaissances. %s",
+		"The document is archived in Outline. Restore it to include it.":                                               "Le document est archivé dans Outline. Restaurez-le pour l'inclure.",
+		"The document is an unpublished draft. Publish it in Outline to include it.":                                   "Le document est un brouillon non publié. Publiez-le dans Outline pour l'inclure.",
+		"The document is a template. Templates are not included.":                                                      "Le document est un modèle. Les modèles ne sont pas inclus.",
+		"The document does not match the export filter. Ask an administrator which collections and tags are included.": "Le document ne correspond pas au filtre d'exportation. Demandez à un administrateur quelles collections et quels tags sont inclus.",
+	},
+}
+
+// Supported reports whether messages can be shown in lang.
+func Supported(lang string) bool {
+	_, ok := catalog[lang]
+	return ok || lang == Default
+}
+
+// Sprintf formats a message in lang, falling back to English for unknown
+// languages and messages missing from the catalog.
+func Sprintf(lang, format string, args ...interface{}) string {
+	if translated, ok := catalog[lang][format]; ok {
+		format = translated
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Match picks the supported language an Accept-Language header prefers most,
+// or fallback if it names none.
+func Match(acceptLanguage, fallback string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, field := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(field), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		// Only the primary subtag matters, e.g. de-CH selects German.
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if q > 0 && Supported(lang) {
+			candidates = append(candidates, candidate{lang, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return fallback
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].lang
+}
@@ -0,0 +1,285 @@
+// Package jobs runs exports, uploads and other long-running work in the
+// background. Jobs are persisted in Postgres; a queue backend (Postgres
+// polling by default, or Redis) dispatches them to workers. Running jobs are
+// leased: their worker renews the lease while it works, and jobs whose lease
+// expired, because the worker died, are queued again. Jobs that cannot run
+// yet are deferred and handed to the queue again once they are due.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// Runner executes a job. It may report progress through the progress callback.
+type Runner func(ctx context.Context, job *models.Job, progress func(string)) error
+
+// DeferredError is returned by a runner whose job cannot run before Until,
+// e.g. during a freeze window. The job is queued again instead of failing.
+type DeferredError struct {
+	Until time.Time
+	Err   error
+}
+
+func (e *DeferredError) Error() string { return e.Err.Error() }
+
+func (e *DeferredError) Unwrap() error { return e.Err }
+
+// Defer returns an error deferring a job until the given time, for the
+// reason err.
+func Defer(until time.Time, err error) error {
+	return &DeferredError{Until: until, Err: err}
+}
+
+// Queue dispatches job IDs to workers and stores live progress.
+type Queue interface {
+	// Push makes a newly created job available to workers.
+	Push(job *models.Job) error
+	// Pop blocks until a job was claimed for this worker or ctx is done.
+	// Priority-only workers only take jobs with a priority above normal.
+	Pop(ctx context.Context, priorityOnly bool) (*models.Job, error)
+	// SetProgress records the progress note of a running job.
+	SetProgress(id uint, progress string)
+	// Progress returns the live progress note of a job, if the queue keeps one.
+	Progress(id uint) (string, bool)
+}
+
+var (
+	runnersMu sync.RWMutex
+	runners   = make(map[string]Runner)
+
+	queue Queue
+
+	// workers tracks running workers so shutdown can wait for them.
+	workers sync.WaitGroup
+)
+
+// Register makes a runner available for a job type.
+func Register(jobType string, runner Runner) {
+	runnersMu.Lock()
+	defer runnersMu.Unlock()
+	runners[jobType] = runner
+}
+
+// Init selects the queue backend from the configuration.
+func Init() {
+	switch config.ConfigInstance.JobQueue {
+	case "redis":
+		q, err := newRedisQueue(config.ConfigInstance.JobQueueRedisURL)
+		if err != nil {
+			logging.Fatal("JOB_QUEUE_REDIS_URL is invalid", "error", err)
+		}
+		queue = q
+		slog.Info("Using Redis as the job queue")
+	default:
+		queue = &postgresQueue{}
+	}
+}
+
+// Enqueue creates a job of the given type and priority and hands it to the queue.
+func Enqueue(jobType string, params interface{}, principal string, priority int) (*models.Job, error) {
+	runnersMu.RLock()
+	_, ok := runners[jobType]
+	runnersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("jobs: unknown job type %q", jobType)
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	job := &models.Job{Type: jobType, Params: string(data), Status: models.JobQueued, Principal: principal, Priority: priority}
+	if err := utils.DB.Create(job).Error; err != nil {
+		return nil, err
+	}
+	// The job is persisted; if the queue is unavailable, it is handed over
+	// by the next reclaim pass instead.
+	dispatch(job)
+	return job, nil
+}
+
+// dispatch hands a persisted job to the queue and records that it did.
+func dispatch(job *models.Job) {
+	if err := queue.Push(job); err != nil {
+		slog.Error("Error queuing job, retrying later", "job_id", job.ID, "error", err)
+		return
+	}
+	if err := models.MarkJobDispatched(utils.DB, job.ID); err != nil {
+		slog.Error("Error recording job dispatch", "job_id", job.ID, "error", err)
+	}
+}
+
+// reclaim queues the jobs of workers whose lease expired again and hands
+// queued jobs the queue never received to it. Jobs handed over more than a
+// lease timeout ago and still not claimed are handed over again, since the
+// queue may have lost them, e.g. when a claim failed after Redis popped the ID.
+func reclaim() {
+	if n, err := models.RequeueExpiredJobs(utils.DB, time.Now()); err != nil {
+		slog.Error("Error reclaiming abandoned jobs", "error", err)
+	} else if n > 0 {
+		slog.Warn("Reclaimed jobs whose worker stopped renewing their lease", "jobs", n)
+	}
+	now := time.Now()
+	pending, err := models.ListUndispatchedJobs(utils.DB, now, now.Add(-config.ConfigInstance.JobLeaseTimeout))
+	if err != nil {
+		slog.Error("Error listing undispatched jobs", "error", err)
+		return
+	}
+	for i := range pending {
+		dispatch(&pending[i])
+	}
+}
+
+// leaseUntil returns the expiry of a lease taken or renewed now.
+func leaseUntil() time.Time {
+	return time.Now().Add(config.ConfigInstance.JobLeaseTimeout)
+}
+
+// Get returns a job, overlaying the live progress kept by the queue.
+func Get(id uint) (*models.Job, error) {
+	job, err := models.GetJob(utils.DB, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status == models.JobRunning {
+		if progress, ok := queue.Progress(id); ok {
+			job.Progress = progress
+		}
+	}
+	return job, nil
+}
+
+// StartWorkers starts n workers that process jobs, highest priority first,
+// and priority more workers reserved for priority jobs, so urgent work is
+// picked up within seconds even while long jobs occupy the regular workers.
+// Workers run until ctx is done and finish their current job before stopping.
+// Abandoned and undispatched jobs are reclaimed every half lease timeout.
+func StartWorkers(ctx context.Context, n, priority int) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		ticker := time.NewTicker(config.ConfigInstance.JobLeaseTimeout / 2)
+		defer ticker.Stop()
+		for {
+			reclaim()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	for i := 0; i < n; i++ {
+		workers.Add(1)
+		go work(ctx, false)
+	}
+	for i := 0; i < priority; i++ {
+		workers.Add(1)
+		go work(ctx, true)
+	}
+	logging.FromContext(ctx).Info("Started job workers", "workers", n, "priority_workers", priority)
+}
+
+// Wait blocks until all workers stopped.
+func Wait() {
+	workers.Wait()
+}
+
+// work claims and runs jobs one at a time.
+func work(ctx context.Context, priorityOnly bool) {
+	defer workers.Done()
+	for {
+		job, err := queue.Pop(ctx, priorityOnly)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("Error fetching job", "error", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		run(ctx, job)
+	}
+}
+
+// run executes a claimed job and records its outcome. While it runs, the
+// job's lease is renewed; if the lease is lost, the runner's context is
+// cancelled, since another worker may already be running the job.
+func run(ctx context.Context, job *models.Job) {
+	runnersMu.RLock()
+	runner, ok := runners[job.Type]
+	runnersMu.RUnlock()
+
+	// The runner logs through a logger tagged with the job.
+	logger := logging.FromContext(ctx).With("job_id", job.ID, "job_type", job.Type)
+	ctx = logging.WithLogger(ctx, logger)
+	// A shutdown lets the job finish; only a lost lease stops it.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	heartbeat := make(chan struct{})
+	lost := false
+	go func() {
+		defer close(heartbeat)
+		ticker := time.NewTicker(config.ConfigInstance.JobLeaseTimeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if held, err := models.RenewJobLease(utils.DB, job.ID, leaseUntil()); err != nil {
+					logger.Error("Error renewing job lease", "error", err)
+				} else if !held {
+					logger.Warn("Lost job lease, stopping the job")
+					lost = true
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	lastProgress := ""
+	progress := func(note string) {
+		lastProgress = note
+		queue.SetProgress(job.ID, note)
+	}
+	var err error
+	if !ok {
+		err = fmt.Errorf("jobs: unknown job type %q", job.Type)
+	} else {
+		logger.Info("Running job")
+		err = runner(ctx, job, progress)
+	}
+	cancel()
+	<-heartbeat
+	// The job was reclaimed; its outcome belongs to the worker running it now.
+	if lost {
+		return
+	}
+	var deferred *DeferredError
+	if errors.As(err, &deferred) {
+		logger.Info("Job deferred", "until", deferred.Until.Format(time.RFC3339), "reason", err)
+		if err := models.DeferJob(utils.DB, job.ID, deferred.Until, "deferred: "+err.Error()); err != nil {
+			logger.Error("Error deferring job", "error", err)
+		}
+		return
+	}
+	if err != nil {
+		logger.Error("Job failed", "error", err)
+	} else {
+		logger.Info("Job succeeded")
+	}
+	if err := models.FinishJob(utils.DB, job.ID, lastProgress, err); err != nil {
+		logger.Error("Error recording job outcome", "error", err)
+	}
+}
@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// lockPollInterval is how often a waiting Lock call retries.
+const lockPollInterval = time.Second
+
+// Lock blocks until it holds the named lock, which is shared by every process
+// using the database, or ctx is done. The lease is renewed in the background
+// until the returned function releases it; if the process dies, the lock is
+// free again after JOB_LEASE_TIMEOUT. The returned context is cancelled when
+// the lease is lost to another process, so the holder stops its work.
+func Lock(ctx context.Context, name string) (context.Context, func(), error) {
+	owner, err := newOwner()
+	if err != nil {
+		return nil, nil, err
+	}
+	timeout := config.ConfigInstance.JobLeaseTimeout
+	for {
+		acquired, err := models.AcquireLock(utils.DB, name, owner, time.Now().Add(timeout))
+		if err != nil {
+			return nil, nil, fmt.Errorf("jobs: acquiring lock %s: %w", name, err)
+		}
+		if acquired {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+	lockCtx, cancel := context.WithCancel(ctx)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(timeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if held, err := models.RenewLock(utils.DB, name, owner, time.Now().Add(timeout)); err != nil {
+					logging.FromContext(ctx).Error("Error renewing lock", "lock", name, "error", err)
+				} else if !held {
+					logging.FromContext(ctx).Warn("Lost lock to another process", "lock", name)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return lockCtx, func() {
+		close(stop)
+		<-done
+		cancel()
+		if err := models.ReleaseLock(utils.DB, name, owner); err != nil {
+			logging.FromContext(ctx).Error("Error releasing lock", "lock", name, "error", err)
+		}
+	}, nil
+}
+
+// newOwner returns a random lease owner, unique per Lock call.
+func newOwner() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
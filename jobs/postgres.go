@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// pollInterval is how often idle workers poll Postgres for queued jobs;
+// priority workers poll more often to keep their latency low.
+const (
+	pollInterval         = 2 * time.Second
+	priorityPollInterval = 500 * time.Millisecond
+)
+
+// postgresQueue dispatches jobs by polling the jobs table. Rows are claimed
+// with SELECT ... FOR UPDATE SKIP LOCKED so several workers never run the
+// same job.
+type postgresQueue struct{}
+
+func (q *postgresQueue) Push(job *models.Job) error {
+	return nil
+}
+
+func (q *postgresQueue) Pop(ctx context.Context, priorityOnly bool) (*models.Job, error) {
+	interval := pollInterval
+	if priorityOnly {
+		interval = priorityPollInterval
+	}
+	for {
+		var job models.Job
+		err := utils.DB.Transaction(func(tx *gorm.DB) error {
+			query := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("status = ?", models.JobQueued).
+				Where("run_after IS NULL OR run_after <= ?", time.Now())
+			if priorityOnly {
+				query = query.Where("priority > ?", models.PriorityNormal)
+			}
+			err := query.Order("priority DESC, id").First(&job).Error
+			if err != nil {
+				return err
+			}
+			now, lease := time.Now(), leaseUntil()
+			job.Status, job.StartedAt, job.LeaseExpiresAt = models.JobRunning, &now, &lease
+			return tx.Model(&job).Updates(map[string]interface{}{"status": job.Status, "started_at": now, "lease_expires_at": lease}).Error
+		})
+		if err == nil {
+			return &job, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (q *postgresQueue) SetProgress(id uint, progress string) {
+	utils.DB.Model(&models.Job{}).Where("id = ?", id).Update("progress", progress)
+}
+
+func (q *postgresQueue) Progress(id uint) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+const (
+	// redisQueueKey and redisPriorityQueueKey are the lists job IDs are pushed to.
+	redisQueueKey         = "ors:jobs:queue"
+	redisPriorityQueueKey = "ors:jobs:queue:priority"
+	// redisProgressTTL bounds how long progress notes outlive their job.
+	redisProgressTTL = 24 * time.Hour
+)
+
+// redisQueue dispatches job IDs through a Redis list, so idle workers pick up
+// new jobs immediately instead of waiting for the next poll, and keeps live
+// progress in Redis instead of writing it to Postgres.
+type redisQueue struct {
+	client *redis.Client
+}
+
+func newRedisQueue(url string) (*redisQueue, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &redisQueue{client: redis.NewClient(opts)}, nil
+}
+
+func (q *redisQueue) Push(job *models.Job) error {
+	key := redisQueueKey
+	if job.Priority > models.PriorityNormal {
+		key = redisPriorityQueueKey
+	}
+	return q.client.LPush(context.Background(), key, job.ID).Err()
+}
+
+func (q *redisQueue) Pop(ctx context.Context, priorityOnly bool) (*models.Job, error) {
+	// BRPOP serves the first non-empty list, so priority jobs always go first.
+	keys := []string{redisPriorityQueueKey, redisQueueKey}
+	if priorityOnly {
+		keys = keys[:1]
+	}
+	for {
+		result, err := q.client.BRPop(ctx, 5*time.Second, keys...).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		id, err := strconv.ParseUint(result[1], 10, 64)
+		if err != nil {
+			logging.FromContext(ctx).Warn("Ignoring invalid job ID in queue", "job_id", result[1])
+			continue
+		}
+		// The database decides which worker owns the job.
+		claimed, err := models.ClaimJob(utils.DB, uint(id), leaseUntil())
+		if err != nil {
+			return nil, err
+		}
+		if !claimed {
+			continue
+		}
+		return models.GetJob(utils.DB, uint(id))
+	}
+}
+
+func (q *redisQueue) progressKey(id uint) string {
+	return fmt.Sprintf("ors:jobs:progress:%d", id)
+}
+
+func (q *redisQueue) SetProgress(id uint, progress string) {
+	if err := q.client.Set(context.Background(), q.progressKey(id), progress, redisProgressTTL).Err(); err != nil {
+		slog.Error("Error storing job progress", "job_id", id, "error", err)
+	}
+}
+
+func (q *redisQueue) Progress(id uint) (string, bool) {
+	progress, err := q.client.Get(context.Background(), q.progressKey(id)).Result()
+	if err != nil {
+		return "", false
+	}
+	return progress, true
+}
@@ -0,0 +1,115 @@
+// Package logging sends the service's log output through log/slog, as text or
+// JSON and filtered by level. A sync carries its logger in its context, tagged
+// with the run's correlation ID, so one document's way from export to upload
+// can be followed in a log aggregator.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+)
+
+var level = new(slog.LevelVar)
+
+// Init installs the logger: format is "text" or "json", lvl "debug", "info",
+// "warn" or "error".
+func Init(format, lvl string) error {
+	if err := level.UnmarshalText([]byte(lvl)); err != nil {
+		return err
+	}
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, options)
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// Fatal logs msg and its attributes as an error and exits, for errors that
+// leave the service unable to start.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// loggerKey is the context key of a run's logger.
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx whose log lines go to logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger of ctx, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Tee returns a logger that logs to the default logger and, as text, to w,
+// e.g. to record one sync's log lines for a debug bundle.
+func Tee(w io.Writer) *slog.Logger {
+	text := slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})
+	return slog.New(teeHandler{slog.Default().Handler(), text})
+}
+
+// teeHandler passes every record to two handlers.
+type teeHandler struct {
+	first, second slog.Handler
+}
+
+func (h teeHandler) Enabled(ctx context.Context, lvl slog.Level) bool {
+	return h.first.Enabled(ctx, lvl) || h.second.Enabled(ctx, lvl)
+}
+
+func (h teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var err error
+	if h.first.Enabled(ctx, record.Level) {
+		err = h.first.Handle(ctx, record.Clone())
+	}
+	if h.second.Enabled(ctx, record.Level) {
+		if err2 := h.second.Handle(ctx, record); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+func (h teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return teeHandler{h.first.WithAttrs(attrs), h.second.WithAttrs(attrs)}
+}
+
+func (h teeHandler) WithGroup(name string) slog.Handler {
+	return teeHandler{h.first.WithGroup(name), h.second.WithGroup(name)}
+}
+
+// NewID returns a random correlation ID for a sync or request.
+func NewID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// runIDKey is the context key of a sync's correlation ID.
+type runIDKey struct{}
+
+// WithRunID returns a copy of ctx whose log lines are tagged with the
+// correlation ID of a sync. Work running alongside the sync keeps its own
+// context and is not tagged.
+func WithRunID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, runIDKey{}, id)
+	return WithLogger(ctx, FromContext(ctx).With("run_id", id))
+}
+
+// RunID returns the correlation ID of the sync ctx belongs to, if any.
+func RunID(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	_ "github.com/mikeshootzz/outline-rag-scraper/docs" // Replace with your actual module path
 
@@ -10,23 +15,85 @@ import (
 	"github.com/joho/godotenv"
 	httpSwagger "github.com/swaggo/http-swagger"
 
+	"github.com/mikeshootzz/outline-rag-scraper/adaptive"
+	"github.com/mikeshootzz/outline-rag-scraper/cache"
 	"github.com/mikeshootzz/outline-rag-scraper/config"
 	"github.com/mikeshootzz/outline-rag-scraper/handlers"
+	"github.com/mikeshootzz/outline-rag-scraper/jobs"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
 	"github.com/mikeshootzz/outline-rag-scraper/utils" // Import the utils package for DB initialization.
 )
 
 func main() {
 	// Load environment variables from .env file.
 	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found or error loading .env file, continuing with environment variables")
+		slog.Info("No .env file found or error loading .env file, continuing with environment variables")
 	}
 
 	// Load configuration (populates config.ConfigInstance).
 	config.LoadConfig()
 
+	// Switch to structured logging with LOG_LEVEL and LOG_FORMAT.
+	if err := logging.Init(config.ConfigInstance.LogFormat, config.ConfigInstance.LogLevel); err != nil {
+		logging.Fatal("Error initializing logging", "error", err)
+	}
+
+	// Answer upstream calls from recorded fixtures instead of the network;
+	// everything that may reach an upstream runs with ctx.
+	ctx := handlers.StartSimulation(context.Background())
+
+	// Select the metadata cache backend (memory or Redis).
+	cache.Init()
+
+	// Set the export and upload concurrency caps.
+	adaptive.Init()
+
+	// Adapt to the Outline and OpenWebUI API versions (fails on unsupported versions).
+	handlers.DetectOutlineVersions(ctx)
+	handlers.DetectOpenWebUIVersion(ctx)
+
 	// Initialize the PostgreSQL database connection.
 	utils.InitDB()
 
+	// Re-encrypt stored tokens still sealed with a previous master key.
+	handlers.RotateStoredSecrets()
+
+	// "outline-rag-scraper bench" measures throughput instead of serving.
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := handlers.RunBenchmark(ctx, os.Args[2:], os.Stdout); err != nil {
+			logging.Fatal("Benchmark failed", "error", err)
+		}
+		return
+	}
+
+	jobs.Init()
+	handlers.RegisterJobRunners()
+
+	// Dedicated workers only process jobs; they serve no HTTP.
+	if config.ConfigInstance.Mode == "worker" {
+		ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		jobs.StartWorkers(ctx, config.ConfigInstance.JobWorkers, config.ConfigInstance.PriorityWorkers)
+		handlers.StartFreezeFlusher(ctx)
+		handlers.StartUpstreamMonitor(ctx)
+		<-ctx.Done()
+		slog.Info("Shutting down, waiting for running jobs to finish")
+		jobs.Wait()
+		return
+	}
+	// A lightweight API process leaves all jobs to dedicated workers.
+	if config.ConfigInstance.Mode == "all" {
+		jobs.StartWorkers(ctx, config.ConfigInstance.JobWorkers, config.ConfigInstance.PriorityWorkers)
+		handlers.StartFreezeFlusher(ctx)
+	}
+	// Scheduled syncs are queued by the HTTP process, so dedicated workers
+	// never start them twice.
+	handlers.StartScheduler(ctx)
+	// Validate stored tokens periodically and alert before they expire.
+	handlers.StartTokenMonitor(ctx)
+	// Probe Outline and OpenWebUI so sync failures can be told from outages.
+	handlers.StartUpstreamMonitor(ctx)
+
 	// Create a new router.
 	router := mux.NewRouter()
 
@@ -36,8 +103,14 @@ func main() {
 	// Serve Swagger UI at /docs (e.g., http://localhost:8080/docs/index.html)
 	router.PathPrefix("/docs/").Handler(httpSwagger.WrapHandler)
 
-	log.Printf("Server started on :%s", config.ConfigInstance.Port)
-	if err := http.ListenAndServe(":"+config.ConfigInstance.Port, router); err != nil {
-		log.Fatal(err)
+	slog.Info("Server started", "port", config.ConfigInstance.Port)
+	server := &http.Server{
+		Addr:    ":" + config.ConfigInstance.Port,
+		Handler: router,
+		// Requests run with ctx, so syncs they start stay in simulation.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	if err := server.ListenAndServe(); err != nil {
+		logging.Fatal("Server failed", "error", err)
 	}
 }
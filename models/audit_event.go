@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Trigger types recorded in the audit trail.
+const (
+	TriggerManual   = "manual"
+	TriggerSchedule = "schedule"
+	TriggerWebhook  = "webhook"
+)
+
+// AuditEvent records who triggered a job or changed configuration, from where,
+// and how it ended.
+type AuditEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	// Principal is the authenticated caller, e.g. "admin", "apikey:hr-team" or "anonymous".
+	Principal string `gorm:"index;not null" json:"principal" example:"apikey:hr-team"`
+	// SourceIP is the client address; empty for internal triggers.
+	SourceIP string `json:"source_ip,omitempty" example:"10.0.0.12"`
+	// Trigger is one of "manual", "schedule" or "webhook".
+	Trigger string `gorm:"not null" json:"trigger" example:"manual"`
+	// Action names the job or change, e.g. "export" or "mapping.create".
+	Action string `gorm:"index;not null" json:"action" example:"mapping.sync"`
+	// Target identifies the affected object, e.g. a mapping ID.
+	Target string `json:"target,omitempty" example:"3"`
+	// Status is the HTTP status (or 200/500 for internal jobs) the action ended with.
+	Status int `json:"status" example:"200"`
+}
+
+// RecordAuditEvent stores an audit event.
+func RecordAuditEvent(db *gorm.DB, event *AuditEvent) error {
+	return db.Create(event).Error
+}
+
+// AuditFilter narrows down ListAuditEvents; zero values match everything.
+type AuditFilter struct {
+	Principal string
+	Action    string
+	Trigger   string
+	Since     time.Time
+	Limit     int
+}
+
+// ListAuditEvents returns audit events matching filter, newest first.
+func ListAuditEvents(db *gorm.DB, filter AuditFilter) ([]AuditEvent, error) {
+	query := db.Order("id DESC")
+	if filter.Principal != "" {
+		query = query.Where("principal = ?", filter.Principal)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Trigger != "" {
+		query = query.Where("trigger = ?", filter.Trigger)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	var events []AuditEvent
+	if err := query.Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BrokenLink is an internal link from an exported document to an Outline
+// document that no longer exists or was archived. The links of a workspace are
+// recomputed after every complete export.
+type BrokenLink struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt time.Time `json:"detected_at"`
+
+	Workspace      string `gorm:"index" json:"workspace,omitempty"`
+	DocumentID     string `gorm:"index;not null" json:"document_id"`
+	Title          string `json:"title"`
+	URL            string `json:"url"`
+	CollectionName string `json:"collection_name"`
+	// LinkText and Target are the text and destination of the broken link.
+	LinkText string `json:"link_text"`
+	Target   string `json:"target"`
+}
+
+// ReplaceBrokenLinks replaces the broken links recorded for a workspace.
+func ReplaceBrokenLinks(db *gorm.DB, workspace string, links []BrokenLink) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace = ?", workspace).Delete(&BrokenLink{}).Error; err != nil {
+			return err
+		}
+		if len(links) == 0 {
+			return nil
+		}
+		return tx.Create(&links).Error
+	})
+}
+
+// ListBrokenLinks returns all recorded broken links ordered by collection and document.
+func ListBrokenLinks(db *gorm.DB) ([]BrokenLink, error) {
+	var links []BrokenLink
+	if err := db.Order("collection_name, title, id").Find(&links).Error; err != nil {
+		return nil, err
+	}
+	return links, nil
+}
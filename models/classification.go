@@ -0,0 +1,59 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Classification levels, from least to most sensitive.
+const (
+	ClassificationPublic       = "public"
+	ClassificationInternal     = "internal"
+	ClassificationConfidential = "confidential"
+)
+
+var classificationRank = map[string]int{
+	ClassificationPublic:       0,
+	ClassificationInternal:     1,
+	ClassificationConfidential: 2,
+}
+
+// classificationTag matches Outline hashtags such as #confidential.
+var classificationTag = regexp.MustCompile(`(?i)(?:^|\s)#(public|internal|confidential)\b`)
+
+// ValidClassification reports whether level is a known classification.
+func ValidClassification(level string) bool {
+	_, ok := classificationRank[level]
+	return ok
+}
+
+// MaxClassification returns the more sensitive of a and b. Empty or unknown
+// levels are ignored.
+func MaxClassification(a, b string) string {
+	if !ValidClassification(a) {
+		return b
+	}
+	if !ValidClassification(b) {
+		return a
+	}
+	if classificationRank[b] > classificationRank[a] {
+		return b
+	}
+	return a
+}
+
+// ClassificationAllows reports whether content classified as level may be sent
+// to a target that allows at most limit.
+func ClassificationAllows(limit, level string) bool {
+	return classificationRank[level] <= classificationRank[limit]
+}
+
+// ClassificationFromText returns the most sensitive classification tag
+// (#public, #internal or #confidential) found in text, or "" if none is present.
+func ClassificationFromText(text string) string {
+	level := ""
+	for _, m := range classificationTag.FindAllStringSubmatch(text, -1) {
+		level = MaxClassification(level, strings.ToLower(m[1]))
+	}
+	return level
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Permission subject types.
+const (
+	SubjectUser      = "user"
+	SubjectGroup     = "group"
+	SubjectWorkspace = "workspace"
+)
+
+// CollectionPermission records who may read an Outline collection, as
+// reported by collections.memberships and collections.group_memberships.
+// A "workspace" subject means every member of the workspace has access.
+type CollectionPermission struct {
+	ID       uint      `gorm:"primaryKey" json:"-"`
+	SyncedAt time.Time `gorm:"autoCreateTime" json:"synced_at"`
+
+	Workspace      string `gorm:"index" json:"workspace,omitempty"`
+	CollectionID   string `gorm:"index;not null" json:"collection_id"`
+	CollectionName string `json:"collection_name"`
+	// SubjectType is "user", "group" or "workspace".
+	SubjectType string `gorm:"not null" json:"subject_type" example:"group"`
+	SubjectID   string `json:"subject_id,omitempty"`
+	SubjectName string `json:"subject_name,omitempty"`
+	Email       string `json:"email,omitempty"`
+	// Permission is Outline's access level, e.g. "read" or "read_write".
+	Permission string `json:"permission" example:"read"`
+}
+
+// ReplaceCollectionPermissions replaces the permissions recorded for a collection.
+func ReplaceCollectionPermissions(db *gorm.DB, workspace, collectionID string, permissions []CollectionPermission) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace = ? AND collection_id = ?", workspace, collectionID).Delete(&CollectionPermission{}).Error; err != nil {
+			return err
+		}
+		if len(permissions) == 0 {
+			return nil
+		}
+		return tx.Create(&permissions).Error
+	})
+}
+
+// ListCollectionPermissions returns the recorded permissions of the
+// collections with the given ID or name, ordered by subject.
+func ListCollectionPermissions(db *gorm.DB, collection string) ([]CollectionPermission, error) {
+	var permissions []CollectionPermission
+	err := db.Where("collection_id = ? OR collection_name = ?", collection, collection).
+		Order("workspace, collection_id, subject_type, subject_name").Find(&permissions).Error
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Credential health states.
+const (
+	CredentialOK       = "ok"
+	CredentialExpiring = "expiring"
+	CredentialExpired  = "expired"
+	CredentialRevoked  = "revoked"
+	CredentialError    = "error" // The check itself failed, e.g. the server was unreachable.
+)
+
+// CredentialStatus is the result of the last health check of a token the
+// scraper uses: the Outline token of a workspace ("outline:<workspace>"), the
+// OpenWebUI token ("openwebui") or a user token ("usertoken:<id>").
+type CredentialStatus struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	UpdatedAt time.Time `json:"checked_at"`
+
+	Credential string `gorm:"uniqueIndex;not null" json:"credential" example:"outline:"`
+	// Kind is "outline", "openwebui" or "usertoken"; Name is the workspace or
+	// user token name.
+	Kind   string `gorm:"not null" json:"kind"`
+	Name   string `json:"name,omitempty"`
+	Status string `gorm:"not null" json:"status" example:"ok"`
+	// ExpiresAt is when the token expires, if the server reports it.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	// AlertedStatus is the status last alerted on, so every change is
+	// reported once.
+	AlertedStatus string `json:"-"`
+}
+
+// SaveCredentialStatus records the result of a check, keeping AlertedStatus.
+func SaveCredentialStatus(db *gorm.DB, status *CredentialStatus) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "credential"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "kind", "name", "status", "expires_at", "error"}),
+	}).Create(status).Error
+}
+
+// ClaimCredentialAlert marks the current status of a credential as alerted and
+// reports whether this call did so, so only one process sends the alert.
+func ClaimCredentialAlert(db *gorm.DB, credential, status string) (bool, error) {
+	result := db.Model(&CredentialStatus{}).
+		Where("credential = ? AND status = ? AND alerted_status <> ?", credential, status, status).
+		Update("alerted_status", status)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListCredentialStatuses returns the recorded checks ordered by credential.
+func ListCredentialStatuses(db *gorm.DB) ([]CredentialStatus, error) {
+	var statuses []CredentialStatus
+	if err := db.Order("credential").Find(&statuses).Error; err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// DeleteCredentialStatusesExcept drops the checks of credentials that no
+// longer exist, e.g. removed user tokens.
+func DeleteCredentialStatusesExcept(db *gorm.DB, credentials []string) error {
+	query := db.Model(&CredentialStatus{})
+	if len(credentials) > 0 {
+		query = query.Where("credential NOT IN ?", credentials)
+	} else {
+		query = query.Where("1 = 1")
+	}
+	return query.Delete(&CredentialStatus{}).Error
+}
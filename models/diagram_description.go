@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DiagramDescription caches the natural-language description generated for a
+// diagram, keyed by the checksum of its source so unchanged diagrams are not
+// sent to the LLM again.
+type DiagramDescription struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// SourceChecksum is the SHA-256 of the diagram language and source.
+	SourceChecksum string `gorm:"uniqueIndex;not null" json:"source_checksum"`
+	Description    string `json:"description"`
+}
+
+// GetDiagramDescription returns the cached description for a diagram source checksum.
+func GetDiagramDescription(db *gorm.DB, checksum string) (*DiagramDescription, error) {
+	var record DiagramDescription
+	if err := db.Where("source_checksum = ?", checksum).First(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// SaveDiagramDescription caches the description for a diagram source checksum.
+func SaveDiagramDescription(db *gorm.DB, checksum, description string) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "source_checksum"}},
+		DoUpdates: clause.AssignmentColumns([]string{"description"}),
+	}).Create(&DiagramDescription{SourceChecksum: checksum, Description: description}).Error
+}
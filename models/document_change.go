@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Change types recorded in the document change feed.
+const (
+	ChangeAdded   = "added"
+	ChangeUpdated = "updated"
+	ChangeRemoved = "removed"
+)
+
+// DocumentChange is an entry in the change feed consumed by external indexers.
+// Its ID is monotonically increasing and doubles as the feed cursor.
+type DocumentChange struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	// Type is one of "added", "updated" or "removed".
+	Type       string `gorm:"not null" json:"type" example:"updated"`
+	DocumentID string `gorm:"index;not null" json:"document_id"`
+	Workspace  string `json:"workspace,omitempty"`
+	Title      string `json:"title"`
+	URL        string `json:"url"`
+	FilePath   string `json:"file_path"`
+	// Checksum is the SHA-256 of the exported content; empty for removals.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// RecordDocumentChange appends an entry to the change feed.
+func RecordDocumentChange(db *gorm.DB, changeType string, record *ExportedDocument) error {
+	change := DocumentChange{
+		Type:       changeType,
+		DocumentID: record.DocumentID,
+		Workspace:  record.Workspace,
+		Title:      record.Title,
+		URL:        record.URL,
+		FilePath:   record.FilePath,
+	}
+	if changeType != ChangeRemoved {
+		change.Checksum = record.Checksum
+	}
+	return db.Create(&change).Error
+}
+
+// ListDocumentChanges returns up to limit changes with an ID greater than since.
+func ListDocumentChanges(db *gorm.DB, since uint, limit int) ([]DocumentChange, error) {
+	var changes []DocumentChange
+	if err := db.Where("id > ?", since).Order("id").Limit(limit).Find(&changes).Error; err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// LatestDocumentChangeID returns the cursor of the newest change, or 0 if the feed is empty.
+func LatestDocumentChangeID(db *gorm.DB) (uint, error) {
+	var change DocumentChange
+	err := db.Order("id DESC").Limit(1).Find(&change).Error
+	return change.ID, err
+}
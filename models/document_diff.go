@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DocumentDiff keeps the source content of a document's latest export, before
+// the export pipeline touched it, and the unified diff from the content
+// exported before that.
+type DocumentDiff struct {
+	ID         uint   `gorm:"primaryKey" json:"-"`
+	DocumentID string `gorm:"uniqueIndex;not null" json:"document_id"`
+	// Content is the source Markdown of the latest export.
+	Content string `json:"-"`
+	// Diff turns the previously exported content into Content; empty until
+	// the document changes after its first export.
+	Diff string `json:"diff"`
+	// ChangedAt is when Content was exported; PreviousChangedAt when the
+	// content Diff starts from was.
+	ChangedAt         time.Time  `json:"changed_at"`
+	PreviousChangedAt *time.Time `json:"previous_changed_at,omitempty"`
+}
+
+// GetDocumentDiff returns the stored content and diff of a document.
+func GetDocumentDiff(db *gorm.DB, documentID string) (*DocumentDiff, error) {
+	var diff DocumentDiff
+	if err := db.Where("document_id = ?", documentID).First(&diff).Error; err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// SaveDocumentDiff inserts or replaces the stored content and diff of a document.
+func SaveDocumentDiff(db *gorm.DB, diff *DocumentDiff) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "document_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"content", "diff", "changed_at", "previous_changed_at"}),
+	}).Create(diff).Error
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FeedbackFailing is the CommentedReason of a document commented on for
+// failing to export.
+const FeedbackFailing = "failing"
+
+// DocumentFeedback tracks what document authors were told in Outline about
+// a document's sync, so every problem is commented on once.
+type DocumentFeedback struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Workspace  string `gorm:"index" json:"workspace,omitempty"`
+	DocumentID string `gorm:"uniqueIndex;not null" json:"document_id"`
+	// CommentedReason is "failing" or the exclusion reason the last comment
+	// was about, empty once the problem is gone.
+	CommentedReason string     `gorm:"index" json:"commented_reason,omitempty"`
+	CommentedAt     *time.Time `json:"commented_at,omitempty"`
+}
+
+// GetDocumentFeedback returns the feedback record of a document.
+func GetDocumentFeedback(db *gorm.DB, documentID string) (*DocumentFeedback, error) {
+	var feedback DocumentFeedback
+	if err := db.Where("document_id = ?", documentID).First(&feedback).Error; err != nil {
+		return nil, err
+	}
+	return &feedback, nil
+}
+
+// ClearCommentedReason marks the problem a document was commented on for as
+// gone, if the last comment was about reason, so a recurrence is commented
+// on again.
+func ClearCommentedReason(db *gorm.DB, documentID, reason string) error {
+	return db.Model(&DocumentFeedback{}).
+		Where("document_id = ? AND commented_reason = ?", documentID, reason).
+		Update("commented_reason", "").Error
+}
+
+// ListCommentedFeedback returns the feedback records of a workspace whose
+// comment is about one of reasons.
+func ListCommentedFeedback(db *gorm.DB, workspace string, reasons []string) ([]DocumentFeedback, error) {
+	var records []DocumentFeedback
+	if err := db.Where("workspace = ? AND commented_reason IN ?", workspace, reasons).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// SetCommentedReason records what the last comment on a document was about;
+// an empty reason marks the problem as gone.
+func SetCommentedReason(db *gorm.DB, workspace, documentID, reason string) error {
+	feedback := DocumentFeedback{Workspace: workspace, DocumentID: documentID, CommentedReason: reason}
+	assignments := map[string]interface{}{"commented_reason": reason, "updated_at": time.Now()}
+	if reason != "" {
+		now := time.Now()
+		feedback.CommentedAt = &now
+		assignments["commented_at"] = now
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "document_id"}},
+		DoUpdates: clause.Assignments(assignments),
+	}).Create(&feedback).Error
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DocumentQuestions caches the questions generated for a document, keyed by
+// the checksum of the model, question count and content, so unchanged
+// documents are not sent to the LLM again.
+type DocumentQuestions struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// ContentChecksum is the SHA-256 of the model, count and document content.
+	ContentChecksum string `gorm:"uniqueIndex;not null" json:"content_checksum"`
+	// Questions holds one question per line.
+	Questions string `gorm:"type:text" json:"questions"`
+}
+
+// GetDocumentQuestions returns the cached questions for a content checksum.
+func GetDocumentQuestions(db *gorm.DB, checksum string) ([]string, error) {
+	var record DocumentQuestions
+	if err := db.Where("content_checksum = ?", checksum).First(&record).Error; err != nil {
+		return nil, err
+	}
+	return strings.Split(record.Questions, "\n"), nil
+}
+
+// SaveDocumentQuestions caches the questions for a content checksum.
+func SaveDocumentQuestions(db *gorm.DB, checksum string, questions []string) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "content_checksum"}},
+		DoUpdates: clause.AssignmentColumns([]string{"questions"}),
+	}).Create(&DocumentQuestions{ContentChecksum: checksum, Questions: strings.Join(questions, "\n")}).Error
+}
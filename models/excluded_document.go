@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExcludedDocument is an Outline document kept out of the knowledge base,
+// with the reason. The exclusions of a workspace are recomputed after every
+// complete export.
+type ExcludedDocument struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt time.Time `json:"detected_at"`
+
+	Workspace      string `gorm:"index" json:"workspace,omitempty"`
+	DocumentID     string `gorm:"index;not null" json:"document_id"`
+	Title          string `json:"title"`
+	URL            string `json:"url"`
+	CollectionName string `gorm:"index" json:"collection_name"`
+	Author         string `json:"author,omitempty"`
+	// Reason is "archived", "draft", "template" or "filtered"; Detail tells
+	// the document owner how to get the document included.
+	Reason string `gorm:"index" json:"reason"`
+	Detail string `json:"detail"`
+}
+
+// ReplaceExcludedDocuments replaces the exclusions recorded for a workspace.
+func ReplaceExcludedDocuments(db *gorm.DB, workspace string, docs []ExcludedDocument) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace = ?", workspace).Delete(&ExcludedDocument{}).Error; err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&docs, 500).Error
+	})
+}
+
+// ListExcludedDocuments returns the recorded exclusions ordered by collection
+// and title, optionally limited to one collection and reason.
+func ListExcludedDocuments(db *gorm.DB, collection, reason string) ([]ExcludedDocument, error) {
+	query := db.Order("collection_name, title, id")
+	if collection != "" {
+		query = query.Where("collection_name = ?", collection)
+	}
+	if reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+	var docs []ExcludedDocument
+	if err := query.Find(&docs).Error; err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExportCheckpoint persists the progress of a full export so that a run that
+// crashes midway can resume where it stopped instead of starting from offset 0.
+type ExportCheckpoint struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Workspace is the name of the Outline workspace being exported.
+	Workspace string `gorm:"index" json:"workspace,omitempty"`
+	// StartedAt is when the run began. Documents exported at or after this
+	// time belong to the current run and are skipped when resuming.
+	StartedAt time.Time `gorm:"not null" json:"started_at"`
+	// CollectionID is the collection being paged in collection traversal mode.
+	CollectionID string `json:"collection_id,omitempty"`
+	// Offset is the documents.list offset of the next page to fetch.
+	Offset int `gorm:"not null;default:0" json:"offset"`
+	// Watermark is the updatedAt of the last document processed.
+	Watermark time.Time `json:"watermark"`
+	// CompletedAt is set once the run finished; nil while it is in progress.
+	CompletedAt *time.Time `gorm:"index" json:"completed_at,omitempty"`
+}
+
+// ResumeOrStartCheckpoint returns the workspace's unfinished checkpoint if one
+// exists, or starts a new one. The boolean reports whether an existing run is resumed.
+func ResumeOrStartCheckpoint(db *gorm.DB, workspace string) (*ExportCheckpoint, bool, error) {
+	var checkpoint ExportCheckpoint
+	err := db.Where("workspace = ? AND completed_at IS NULL", workspace).Order("started_at DESC").First(&checkpoint).Error
+	if err == nil {
+		return &checkpoint, true, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+	checkpoint = ExportCheckpoint{Workspace: workspace, StartedAt: time.Now()}
+	if err := db.Create(&checkpoint).Error; err != nil {
+		return nil, false, err
+	}
+	return &checkpoint, false, nil
+}
+
+// AbandonCheckpoints marks all unfinished checkpoints as completed so the next
+// run starts from the beginning.
+func AbandonCheckpoints(db *gorm.DB) error {
+	return db.Model(&ExportCheckpoint{}).Where("completed_at IS NULL").Update("completed_at", time.Now()).Error
+}
+
+// ExportedVersion identifies the revision of a document that was exported.
+type ExportedVersion struct {
+	UpdatedAt time.Time
+	Revision  int
+	FilePath  string
+}
+
+// Matches reports whether doc is the exported revision. Revisions are only
+// compared when both sides know theirs.
+func (v ExportedVersion) Matches(doc Document) bool {
+	if !v.UpdatedAt.Equal(doc.UpdatedAt) {
+		return false
+	}
+	return v.Revision == 0 || doc.Revision == 0 || v.Revision == doc.Revision
+}
+
+// ExportedSince returns the IDs of documents of a workspace exported at or
+// after since, mapped to the version they had when exported. A zero since
+// returns every exported document of the workspace.
+func ExportedSince(db *gorm.DB, workspace string, since time.Time) (map[string]ExportedVersion, error) {
+	var records []ExportedDocument
+	if err := db.Where("workspace = ? AND exported_at >= ?", workspace, since).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[string]ExportedVersion, len(records))
+	for _, record := range records {
+		result[record.DocumentID] = ExportedVersion{
+			UpdatedAt: record.DocumentUpdatedAt,
+			Revision:  record.Revision,
+			FilePath:  record.FilePath,
+		}
+	}
+	return result, nil
+}
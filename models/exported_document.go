@@ -0,0 +1,182 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExportedDocument records the file an Outline document was last exported to,
+// along with the SHA-256 checksum of the content written at export time. The
+// uploader verifies the checksum before sending a file to OpenWebUI.
+type ExportedDocument struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// DocumentID is the Outline document ID.
+	DocumentID string `gorm:"uniqueIndex;not null" json:"document_id"`
+	// Workspace is the name of the Outline workspace the document came from.
+	Workspace string `gorm:"index" json:"workspace,omitempty"`
+	// FilePath is the path of the exported Markdown file.
+	FilePath string `gorm:"index;not null" json:"file_path"`
+	// Checksum is the hex-encoded SHA-256 of the exported file content.
+	Checksum string `gorm:"not null" json:"checksum"`
+	// DocumentUpdatedAt is the Outline updatedAt of the exported revision.
+	DocumentUpdatedAt time.Time `json:"document_updated_at"`
+	// Revision is the Outline revision number of the exported content.
+	Revision int `gorm:"not null;default:0" json:"revision"`
+	// ExportedAt is when the file was last written.
+	ExportedAt time.Time `gorm:"index" json:"exported_at"`
+
+	// Title and URL identify the document for citations.
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	// URLID is the Outline urlId internal links refer to the document by.
+	URLID string `gorm:"index" json:"url_id,omitempty"`
+	// Icon and Color are the document's visual cues in Outline.
+	Icon  string `json:"icon,omitempty"`
+	Color string `json:"color,omitempty"`
+	// CollectionID, CollectionName, CollectionIcon and CollectionColor describe
+	// the Outline collection the document belongs to.
+	CollectionID    string `gorm:"index" json:"collection_id,omitempty"`
+	CollectionName  string `json:"collection_name,omitempty"`
+	CollectionIcon  string `json:"collection_icon,omitempty"`
+	CollectionColor string `json:"collection_color,omitempty"`
+	// ParentDocumentID is set on text extracted from an attachment and names
+	// the Outline document the attachment belongs to.
+	ParentDocumentID string `gorm:"index" json:"parent_document_id,omitempty"`
+	// ParentPageID is the Outline document a nested page sits under.
+	ParentPageID string `json:"parent_page_id,omitempty"`
+	// Classification is the effective sensitivity label (public, internal or confidential).
+	Classification string `json:"classification"`
+	// Tags are the document's hashtags, comma-separated, for routing rules.
+	Tags string `json:"tags,omitempty"`
+	// Questions are the LLM-generated questions the document answers, one
+	// per line, stored with the chunks of vector stores.
+	Questions string `gorm:"type:text" json:"questions,omitempty"`
+	// GlossaryTerms are the glossary terms the file uses, one per line, as
+	// found in the file and glossary identified by GlossaryKey.
+	GlossaryTerms string `gorm:"type:text" json:"-"`
+	GlossaryKey   string `json:"-"`
+
+	// SyncCount is how many times the file was uploaded to OpenWebUI.
+	SyncCount int `gorm:"not null;default:0" json:"sync_count"`
+}
+
+// IsGenerated reports whether the record is a document generated locally,
+// such as a glossary, collection overview or table of contents, rather than
+// an exported one.
+func (d ExportedDocument) IsGenerated() bool {
+	for _, prefix := range []string{"glossary:", "overview:", "index:"} {
+		if strings.HasPrefix(d.DocumentID, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// exportedDocumentColumns are the columns refreshed when a document is re-exported.
+var exportedDocumentColumns = []string{
+	"updated_at", "workspace", "file_path", "checksum", "document_updated_at", "revision", "exported_at",
+	"title", "url", "url_id", "icon", "color",
+	"collection_id", "collection_name", "collection_icon", "collection_color",
+	"classification", "tags", "parent_document_id", "parent_page_id", "questions",
+}
+
+// SaveExportedDocument inserts or updates the export record for a document.
+func SaveExportedDocument(db *gorm.DB, record *ExportedDocument) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "document_id"}},
+		DoUpdates: clause.AssignmentColumns(exportedDocumentColumns),
+	}).Create(record).Error
+}
+
+// GetExportedDocumentByPath returns the most recent export record for a file path.
+func GetExportedDocumentByPath(db *gorm.DB, filePath string) (*ExportedDocument, error) {
+	var record ExportedDocument
+	if err := db.Where("file_path = ?", filePath).Order("exported_at DESC").First(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// FindExportedDocumentByURLID returns the export record of the document with
+// an Outline urlId, excluding attachment companions.
+func FindExportedDocumentByURLID(db *gorm.DB, workspace, urlID string) (*ExportedDocument, error) {
+	var record ExportedDocument
+	err := db.Where("workspace = ? AND url_id = ? AND parent_document_id = ''", workspace, urlID).First(&record).Error
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// UpdateExportedContent records new content written to an exported file.
+func UpdateExportedContent(db *gorm.DB, documentID, checksum string) error {
+	return db.Model(&ExportedDocument{}).Where("document_id = ?", documentID).
+		Updates(map[string]interface{}{"checksum": checksum, "exported_at": time.Now()}).Error
+}
+
+// SetGlossaryTerms records the glossary terms a document uses.
+func SetGlossaryTerms(db *gorm.DB, documentID, terms, key string) error {
+	return db.Model(&ExportedDocument{}).Where("document_id = ?", documentID).
+		Updates(map[string]interface{}{"glossary_terms": terms, "glossary_key": key}).Error
+}
+
+// ListExportedDocuments returns all export records ordered by collection and title.
+func ListExportedDocuments(db *gorm.DB) ([]ExportedDocument, error) {
+	var records []ExportedDocument
+	if err := db.Order("collection_name, title").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// GetExportedDocument returns the export record for an Outline document ID.
+func GetExportedDocument(db *gorm.DB, documentID string) (*ExportedDocument, error) {
+	var record ExportedDocument
+	if err := db.Where("document_id = ?", documentID).First(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// IncrementSyncCount counts an upload of the file at filePath.
+func IncrementSyncCount(db *gorm.DB, filePath string) error {
+	return db.Model(&ExportedDocument{}).Where("file_path = ?", filePath).
+		UpdateColumn("sync_count", gorm.Expr("sync_count + 1")).Error
+}
+
+// ListWorkspaceDocuments returns the export records of a workspace.
+func ListWorkspaceDocuments(db *gorm.DB, workspace string) ([]ExportedDocument, error) {
+	var records []ExportedDocument
+	if err := db.Where("workspace = ?", workspace).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// ListDocumentRecords returns the export record of a document together with
+// the records of its attachment companions.
+func ListDocumentRecords(db *gorm.DB, documentID string) ([]ExportedDocument, error) {
+	var records []ExportedDocument
+	if err := db.Where("document_id = ? OR parent_document_id = ?", documentID, documentID).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// DeleteExportedDocument removes the export record of a document, its stored
+// diff and its review.
+func DeleteExportedDocument(db *gorm.DB, documentID string) error {
+	if err := db.Where("document_id = ?", documentID).Delete(&DocumentDiff{}).Error; err != nil {
+		return err
+	}
+	if err := db.Where("document_id = ?", documentID).Delete(&ReviewItem{}).Error; err != nil {
+		return err
+	}
+	return db.Where("document_id = ?", documentID).Delete(&ExportedDocument{}).Error
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FailureStreak counts the consecutive failures of a document export
+// ("document:<id>") or of the uploads to a knowledge collection
+// ("knowledge:<id>"). It is deleted on the next success.
+type FailureStreak struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt time.Time `json:"first_failed_at"`
+	UpdatedAt time.Time `json:"last_failed_at"`
+
+	Subject   string `gorm:"uniqueIndex;not null" json:"subject"`
+	Failures  int    `gorm:"not null;default:0" json:"failures"`
+	LastError string `json:"last_error"`
+	// TicketKey and TicketURL identify the ticket opened for the streak.
+	TicketKey string `json:"ticket_key,omitempty"`
+	TicketURL string `json:"ticket_url,omitempty"`
+}
+
+// RecordFailure counts a failure of subject and returns its streak.
+func RecordFailure(db *gorm.DB, subject, lastError string) (*FailureStreak, error) {
+	streak := FailureStreak{Subject: subject, Failures: 1, LastError: lastError}
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "subject"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":   gorm.Expr("failure_streaks.failures + 1"),
+			"last_error": lastError,
+			"updated_at": time.Now(),
+		}),
+	}).Create(&streak).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Where("subject = ?", subject).First(&streak).Error; err != nil {
+		return nil, err
+	}
+	return &streak, nil
+}
+
+// EndFailureStreak forgets the failures of subject after a success and
+// returns the ended streak, or nil if there was none.
+func EndFailureStreak(db *gorm.DB, subject string) (*FailureStreak, error) {
+	var streaks []FailureStreak
+	if err := db.Clauses(clause.Returning{}).Where("subject = ?", subject).Delete(&streaks).Error; err != nil {
+		return nil, err
+	}
+	if len(streaks) == 0 {
+		return nil, nil
+	}
+	return &streaks[0], nil
+}
+
+// SetStreakTicket records the ticket opened for a streak.
+func SetStreakTicket(db *gorm.DB, subject, key, url string) error {
+	return db.Model(&FailureStreak{}).Where("subject = ?", subject).
+		Updates(map[string]interface{}{"ticket_key": key, "ticket_url": url}).Error
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ImageText caches the OCR result for an Outline image attachment. Attachments
+// are immutable, so each image only needs to be recognized once.
+type ImageText struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// AttachmentID is the Outline attachment ID of the image.
+	AttachmentID string `gorm:"uniqueIndex;not null" json:"attachment_id"`
+	// Text is the recognized text; empty if the image holds none.
+	Text string `json:"text"`
+}
+
+// GetImageText returns the cached OCR result for an attachment.
+func GetImageText(db *gorm.DB, attachmentID string) (*ImageText, error) {
+	var record ImageText
+	if err := db.Where("attachment_id = ?", attachmentID).First(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// SaveImageText caches the OCR result for an attachment.
+func SaveImageText(db *gorm.DB, attachmentID, text string) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "attachment_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"text"}),
+	}).Create(&ImageText{AttachmentID: attachmentID, Text: text}).Error
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IntegrityReport stores the integrity check written after a sync run was
+// published. Report holds the exact JSON bytes that Signature signs.
+type IntegrityReport struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	SyncRunID uint   `gorm:"index;not null" json:"sync_run_id"`
+	Passed    bool   `gorm:"not null" json:"passed"`
+	Report    string `gorm:"type:text;not null" json:"report"`
+	// Signature is the base64 ed25519 signature of Report; empty when unsigned.
+	Signature string `json:"signature,omitempty"`
+}
+
+// GetIntegrityReport returns the newest integrity report of a sync run.
+func GetIntegrityReport(db *gorm.DB, syncRunID uint) (*IntegrityReport, error) {
+	var report IntegrityReport
+	if err := db.Where("sync_run_id = ?", syncRunID).Order("id DESC").First(&report).Error; err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
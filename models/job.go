@@ -0,0 +1,149 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Job priorities. Priority jobs are served by reserved workers first.
+const (
+	PriorityNormal = 0
+	PriorityHigh   = 10
+)
+
+// Job states.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job is a unit of background work such as an export or an upload. The
+// database row is the source of truth for a job's state; the queue backend
+// only dispatches job IDs to workers.
+type Job struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Type selects the runner, e.g. "export" or "upload".
+	Type string `gorm:"index;not null" json:"type" example:"export"`
+	// Params holds the runner's JSON-encoded parameters.
+	Params string `json:"params,omitempty"`
+	// Priority orders queued jobs; higher runs first.
+	Priority int `gorm:"index;not null;default:0" json:"priority"`
+	// Status is one of queued, running, succeeded or failed.
+	Status string `gorm:"index;not null" json:"status" example:"queued"`
+	// Progress is a short human-readable progress note.
+	Progress string `json:"progress,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Principal is who enqueued the job (see the audit trail).
+	Principal  string     `json:"principal,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// LeaseExpiresAt is when a running job is considered abandoned unless its
+	// worker renews the lease.
+	LeaseExpiresAt *time.Time `gorm:"index" json:"lease_expires_at,omitempty"`
+	// DispatchedAt is when the job was handed to the queue; queued jobs
+	// without it are handed over again.
+	DispatchedAt *time.Time `json:"-"`
+	// RunAfter holds a queued job back until then, e.g. a sync deferred to
+	// the end of a freeze window.
+	RunAfter *time.Time `gorm:"index" json:"run_after,omitempty"`
+}
+
+// GetJob returns a job by ID.
+func GetJob(db *gorm.DB, id uint) (*Job, error) {
+	var job Job
+	if err := db.First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListJobs returns up to limit jobs, newest first, optionally filtered by status.
+func ListJobs(db *gorm.DB, status string, limit int) ([]Job, error) {
+	query := db.Order("id DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var jobs []Job
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// FindQueuedJob returns a job of the given type and JSON parameters that is
+// still waiting to run, or nil if there is none.
+func FindQueuedJob(db *gorm.DB, jobType, params string) (*Job, error) {
+	var jobs []Job
+	err := db.Where("type = ? AND params = ? AND status = ?", jobType, params, JobQueued).Limit(1).Find(&jobs).Error
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// ClaimJob marks a queued job as running, leased until leaseUntil. It reports
+// false if another worker claimed the job first.
+func ClaimJob(db *gorm.DB, id uint, leaseUntil time.Time) (bool, error) {
+	now := time.Now()
+	result := db.Model(&Job{}).Where("id = ? AND status = ?", id, JobQueued).
+		Updates(map[string]interface{}{"status": JobRunning, "started_at": now, "lease_expires_at": leaseUntil})
+	return result.RowsAffected == 1, result.Error
+}
+
+// RenewJobLease extends the lease of a running job. It reports false if the
+// job is no longer running, e.g. because it was reclaimed after its lease
+// expired.
+func RenewJobLease(db *gorm.DB, id uint, leaseUntil time.Time) (bool, error) {
+	result := db.Model(&Job{}).Where("id = ? AND status = ?", id, JobRunning).
+		Update("lease_expires_at", leaseUntil)
+	return result.RowsAffected == 1, result.Error
+}
+
+// RequeueExpiredJobs puts running jobs whose lease expired back in the queue
+// and returns how many there were.
+func RequeueExpiredJobs(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Model(&Job{}).Where("status = ? AND lease_expires_at < ?", JobRunning, now).
+		Updates(map[string]interface{}{"status": JobQueued, "lease_expires_at": nil, "dispatched_at": nil, "started_at": nil})
+	return result.RowsAffected, result.Error
+}
+
+// ListUndispatchedJobs returns the queued jobs due at now that were never
+// handed to the queue, or handed over before staleBefore and still not
+// claimed, oldest first.
+func ListUndispatchedJobs(db *gorm.DB, now, staleBefore time.Time) ([]Job, error) {
+	var jobs []Job
+	err := db.Where("status = ?", JobQueued).
+		Where("dispatched_at IS NULL OR dispatched_at < ?", staleBefore).
+		Where("run_after IS NULL OR run_after <= ?", now).Order("id").Find(&jobs).Error
+	return jobs, err
+}
+
+// MarkJobDispatched records that a job was handed to the queue.
+func MarkJobDispatched(db *gorm.DB, id uint) error {
+	return db.Model(&Job{}).Where("id = ?", id).Update("dispatched_at", time.Now()).Error
+}
+
+// DeferJob queues a running job again to run at runAfter.
+func DeferJob(db *gorm.DB, id uint, runAfter time.Time, progress string) error {
+	return db.Model(&Job{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status": JobQueued, "run_after": runAfter, "progress": progress,
+		"started_at": nil, "lease_expires_at": nil, "dispatched_at": nil,
+	}).Error
+}
+
+// FinishJob records the outcome of a job.
+func FinishJob(db *gorm.DB, id uint, progress string, jobErr error) error {
+	now := time.Now()
+	updates := map[string]interface{}{"status": JobSucceeded, "finished_at": now, "progress": progress, "lease_expires_at": nil}
+	if jobErr != nil {
+		updates["status"] = JobFailed
+		updates["error"] = jobErr.Error()
+	}
+	return db.Model(&Job{}).Where("id = ?", id).Updates(updates).Error
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Lock is a named lease shared by every process using the database. Its
+// owner must renew it before ExpiresAt, or another process may take it over.
+type Lock struct {
+	Name      string    `gorm:"primaryKey"`
+	Owner     string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+}
+
+// AcquireLock takes the lock name for owner until expiresAt. It reports false
+// if another owner holds an unexpired lease.
+func AcquireLock(db *gorm.DB, name, owner string, expiresAt time.Time) (bool, error) {
+	lock := Lock{Name: name, Owner: owner, ExpiresAt: expiresAt}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&lock)
+	if result.Error != nil || result.RowsAffected == 1 {
+		return result.Error == nil, result.Error
+	}
+	result = db.Model(&Lock{}).Where("name = ? AND (owner = ? OR expires_at < ?)", name, owner, time.Now()).
+		Updates(map[string]interface{}{"owner": owner, "expires_at": expiresAt})
+	return result.RowsAffected == 1, result.Error
+}
+
+// RenewLock extends a lease owner holds. It reports false if the lease was
+// lost to another owner.
+func RenewLock(db *gorm.DB, name, owner string, expiresAt time.Time) (bool, error) {
+	result := db.Model(&Lock{}).Where("name = ? AND owner = ?", name, owner).Update("expires_at", expiresAt)
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReleaseLock gives up a lease owner holds.
+func ReleaseLock(db *gorm.DB, name, owner string) error {
+	return db.Where("name = ? AND owner = ?", name, owner).Delete(&Lock{}).Error
+}
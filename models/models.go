@@ -2,6 +2,7 @@
 package models
 
 import (
+	"encoding/json"
 	"strings"
 	"time"
 
@@ -10,10 +11,38 @@ import (
 
 // Document represents a single document.
 type Document struct {
-	ID           string `json:"id"`
-	Title        string `json:"title"`
-	URLId        string `json:"urlId"`
-	CollectionId string `json:"collectionId"` // Added to track Outline collection ID
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	URLId        string    `json:"urlId"`
+	CollectionId string    `json:"collectionId"` // Added to track Outline collection ID
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	Revision     int       `json:"revision"`
+	// CreatedBy is the author of the document.
+	CreatedBy struct {
+		Name string `json:"name"`
+	} `json:"createdBy"`
+	Emoji string `json:"emoji"` // Deprecated by Outline in favour of icon, still set on older documents.
+	Icon  string `json:"icon"`
+	Color string `json:"color"`
+	// ArchivedAt is set once the document was archived in Outline.
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	// PublishedAt is nil for drafts.
+	PublishedAt *time.Time `json:"publishedAt,omitempty"`
+	// Template is set for document templates.
+	Template bool `json:"template"`
+	// Text is the Markdown body as listed; the export itself uses documents.export.
+	Text string `json:"text"`
+	// ParentDocumentId is the document a nested page sits under.
+	ParentDocumentId string `json:"parentDocumentId"`
+}
+
+// DisplayIcon returns the document icon, falling back to the legacy emoji field.
+func (d Document) DisplayIcon() string {
+	if d.Icon != "" {
+		return d.Icon
+	}
+	return d.Emoji
 }
 
 // DocumentsResponse represents the API response when listing documents.
@@ -21,20 +50,64 @@ type DocumentsResponse struct {
 	Data []Document `json:"data"`
 }
 
+// Collection represents a single Outline collection.
+type Collection struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+	Color       string `json:"color"`
+	// Permission is the access every workspace member has ("read",
+	// "read_write"); empty for private collections.
+	Permission string `json:"permission"`
+}
+
+// CollectionsResponse represents the API response when listing collections.
+type CollectionsResponse struct {
+	Data []Collection `json:"data"`
+}
+
 // ExportResponse represents the API response from the export endpoint.
 type ExportResponse struct {
 	Data string `json:"data"`
 }
 
+// KnowledgeFile is a file attached to an OpenWebUI knowledge collection.
+type KnowledgeFile struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	// Hash is the SHA-256 OpenWebUI computed for the file content.
+	Hash string `json:"hash"`
+	Meta struct {
+		Name string `json:"name"`
+	} `json:"meta"`
+}
+
+// Name returns the original file name, preferring the name stored in meta.
+func (f KnowledgeFile) Name() string {
+	if f.Meta.Name != "" {
+		return f.Meta.Name
+	}
+	return f.Filename
+}
+
 // KnowledgeResponse represents the response from the OpenWebUI knowledge collection GET.
 type KnowledgeResponse struct {
-	Files []struct {
-		ID string `json:"id"`
-	} `json:"files"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// AccessControl is passed back unchanged when the collection is updated.
+	AccessControl json.RawMessage `json:"access_control"`
+	Files         []KnowledgeFile `json:"files"`
+	// Data holds the file IDs on OpenWebUI releases before 0.4.
+	Data struct {
+		FileIDs []string `json:"file_ids"`
+	} `json:"data"`
 }
 
 // CollectionMapping maps an Outline collection (identified by its sanitized name)
 // to one or more OpenWebUI knowledge collection IDs (stored as a comma-separated string).
+// A mapping with a Source only applies to the collection of that workspace, so
+// equally named collections of several Outline instances can be routed apart.
 type CollectionMapping struct {
 	// ID is the primary key.
 	ID uint `gorm:"primaryKey" json:"id" example:"1"`
@@ -46,13 +119,114 @@ type CollectionMapping struct {
 	// The swaggerignore tag tells swag to skip this field in the documentation.
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty" swaggerignore:"true"`
 
+	// Source is the name of the workspace the collection belongs to; empty
+	// matches the collection in every workspace without a mapping of its own.
+	Source string `gorm:"uniqueIndex:idx_mapping_source_collection;not null;default:''" json:"source,omitempty" example:"sales"`
 	// OutlineCollection should match the sanitized subdirectory name.
-	OutlineCollection string `gorm:"uniqueIndex;not null" json:"outline_collection" example:"Human_Resources"`
+	OutlineCollection string `gorm:"uniqueIndex:idx_mapping_source_collection;not null" json:"outline_collection" example:"Human_Resources"`
 	// OpenWebUICollections is a comma-separated list of OpenWebUI knowledge collection IDs.
 	OpenWebUICollections string `gorm:"not null" json:"openwebui_collections" example:"collectionID1,collectionID2"`
+
+	// UploadExtension overrides the file extension used when uploading (e.g. ".txt").
+	UploadExtension string `json:"upload_extension,omitempty" example:".txt"`
+	// UploadContentType overrides the MIME type sent with the uploaded file.
+	UploadContentType string `json:"upload_content_type,omitempty" example:"text/plain"`
+	// ConvertToPlainText strips Markdown syntax from the content before uploading.
+	ConvertToPlainText bool `gorm:"not null;default:false" json:"convert_to_plain_text"`
+	// MaxClassification is the most sensitive classification the mapped
+	// knowledge collections may receive; empty uses KNOWLEDGE_MAX_CLASSIFICATION.
+	MaxClassification string `json:"max_classification,omitempty" example:"internal"`
+	// Transforms is a comma-separated list of transform names (from
+	// TRANSFORM_COMMANDS or TRANSFORM_WASM_MODULES) every exported document of
+	// the collection is piped through, in order.
+	Transforms string `json:"transforms,omitempty" example:"redact,fix_tables"`
+	// AutoCreate creates missing knowledge collections before uploading and
+	// stores their IDs in place of the missing ones; nil uses AUTO_CREATE_KNOWLEDGE.
+	AutoCreate *bool `json:"auto_create,omitempty"`
+	// Models is a comma-separated list of OpenWebUI model IDs the mapped
+	// knowledge collections are attached to after every upload.
+	Models string `json:"models,omitempty" example:"support-bot,hr-assistant"`
+}
+
+// ModelIDs splits the comma-separated list of OpenWebUI model IDs.
+func (m CollectionMapping) ModelIDs() []string {
+	var ids []string
+	for _, id := range strings.Split(m.Models, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// TransformNames splits the comma-separated list of transforms.
+func (m CollectionMapping) TransformNames() []string {
+	var names []string
+	for _, name := range strings.Split(m.Transforms, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// MappingKey identifies a mapping in the maps of GetCollectionMappingRecords:
+// the collection, prefixed with the source for mappings of one workspace.
+func MappingKey(source, outlineCollection string) string {
+	if source == "" {
+		return outlineCollection
+	}
+	return source + "/" + outlineCollection
+}
+
+// Key returns the MappingKey of the mapping.
+func (m CollectionMapping) Key() string {
+	return MappingKey(m.Source, m.OutlineCollection)
 }
 
-// GetCollectionMappings returns a map where the key is the Outline collection (subdirectory)
+// LookupMapping returns the mapping that applies to a collection of a
+// workspace: its own mapping, else the one without a source.
+func LookupMapping(mappings map[string]CollectionMapping, source, outlineCollection string) (CollectionMapping, bool) {
+	if mapping, ok := mappings[MappingKey(source, outlineCollection)]; ok {
+		return mapping, true
+	}
+	mapping, ok := mappings[outlineCollection]
+	return mapping, ok
+}
+
+// FindCollectionMapping returns the mapping that applies to a collection of
+// a workspace, or nil if it is not mapped. Without a source, the mapping
+// without one is preferred over those of single workspaces.
+func FindCollectionMapping(db *gorm.DB, source, outlineCollection string) (*CollectionMapping, error) {
+	var mappings []CollectionMapping
+	query := db.Where("outline_collection = ?", outlineCollection)
+	if source != "" {
+		query = query.Where("source IN ?", []string{source, ""})
+	}
+	// The empty source sorts first.
+	order := "source"
+	if source != "" {
+		order = "source DESC"
+	}
+	if err := query.Order(order).Limit(1).Find(&mappings).Error; err != nil {
+		return nil, err
+	}
+	if len(mappings) == 0 {
+		return nil, nil
+	}
+	return &mappings[0], nil
+}
+
+// AutoCreates reports whether missing knowledge collections are created for
+// the mapping, given the configured default.
+func (m CollectionMapping) AutoCreates(defaultValue bool) bool {
+	if m.AutoCreate != nil {
+		return *m.AutoCreate
+	}
+	return defaultValue
+}
+
+// GetCollectionMappings returns a map where the key is the MappingKey of a mapping
 // and the value is a slice of OpenWebUI knowledge collection IDs.
 func GetCollectionMappings(db *gorm.DB) (map[string][]string, error) {
 	var mappings []CollectionMapping
@@ -62,12 +236,33 @@ func GetCollectionMappings(db *gorm.DB) (map[string][]string, error) {
 
 	result := make(map[string][]string)
 	for _, mapping := range mappings {
-		// Split the comma-separated list and trim any extra spaces.
-		ids := strings.Split(mapping.OpenWebUICollections, ",")
-		for i := range ids {
-			ids[i] = strings.TrimSpace(ids[i])
+		result[mapping.Key()] = mapping.KnowledgeIDs()
+	}
+	return result, nil
+}
+
+// KnowledgeIDs splits the comma-separated list of OpenWebUI knowledge
+// collection IDs, trimming spaces and dropping empty entries.
+func (m CollectionMapping) KnowledgeIDs() []string {
+	var ids []string
+	for _, id := range strings.Split(m.OpenWebUICollections, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
 		}
-		result[mapping.OutlineCollection] = ids
+	}
+	return ids
+}
+
+// GetCollectionMappingRecords returns all mappings keyed by their MappingKey;
+// use LookupMapping to find the one of a file.
+func GetCollectionMappingRecords(db *gorm.DB) (map[string]CollectionMapping, error) {
+	var mappings []CollectionMapping
+	if err := db.Find(&mappings).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[string]CollectionMapping, len(mappings))
+	for _, mapping := range mappings {
+		result[mapping.Key()] = mapping
 	}
 	return result, nil
 }
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PendingChange is a local change held back during a freeze window. It is
+// pushed to the knowledge collections once the freeze ends; later changes to
+// the same file replace earlier ones.
+type PendingChange struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	FilePath  string    `gorm:"uniqueIndex;not null" json:"file_path"`
+	Removed   bool      `gorm:"not null" json:"removed"`
+}
+
+// QueuePendingChanges records changed and removed files for a later flush.
+func QueuePendingChanges(db *gorm.DB, changed, removed map[string]bool) error {
+	var changes []PendingChange
+	for filePath := range changed {
+		changes = append(changes, PendingChange{FilePath: filePath})
+	}
+	for filePath := range removed {
+		changes = append(changes, PendingChange{FilePath: filePath, Removed: true})
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"removed", "created_at"}),
+	}).Create(&changes).Error
+}
+
+// TakePendingChanges removes and returns all pending changes. Deleting and
+// returning in one statement lets only one process flush each change.
+func TakePendingChanges(db *gorm.DB) ([]PendingChange, error) {
+	var changes []PendingChange
+	err := db.Clauses(clause.Returning{}).Where("1 = 1").Delete(&changes).Error
+	return changes, err
+}
+
+// CountPendingChanges returns the number of changes waiting for a flush.
+func CountPendingChanges(db *gorm.DB) (int64, error) {
+	var count int64
+	err := db.Model(&PendingChange{}).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PinnedDocument freezes the exported and uploaded version of a document:
+// upstream edits are ignored until the pin is removed.
+type PinnedDocument struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt time.Time `json:"pinned_at"`
+
+	DocumentID string `gorm:"uniqueIndex;not null" json:"document_id"`
+	// Reason explains the pin, e.g. "restructuring in progress".
+	Reason string `json:"reason,omitempty"`
+	// PinnedBy is the principal that pinned the document.
+	PinnedBy string `json:"pinned_by"`
+}
+
+// IsDocumentPinned reports whether a document is pinned.
+func IsDocumentPinned(db *gorm.DB, documentID string) (bool, error) {
+	var count int64
+	err := db.Model(&PinnedDocument{}).Where("document_id = ?", documentID).Count(&count).Error
+	return count > 0, err
+}
+
+// ListPinnedDocuments returns all pins, oldest first.
+func ListPinnedDocuments(db *gorm.DB) ([]PinnedDocument, error) {
+	var pins []PinnedDocument
+	if err := db.Order("id").Find(&pins).Error; err != nil {
+		return nil, err
+	}
+	return pins, nil
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Review statuses of a held document change.
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// ReviewItem holds back the export of a document whose latest change is
+// larger than REVIEW_DIFF_LINES until a reviewer approves it. The local file
+// and everything published from it keep the previous version meanwhile.
+type ReviewItem struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	DocumentID string `gorm:"uniqueIndex;not null" json:"document_id"`
+	FilePath   string `json:"file_path"`
+	Title      string `json:"title"`
+	Collection string `json:"collection,omitempty"`
+	// ChangedLines counts the added and removed lines of the change.
+	ChangedLines int `json:"changed_lines"`
+	// ChangedAt identifies the change under review: the ChangedAt of the
+	// document's DocumentDiff.
+	ChangedAt time.Time `json:"changed_at"`
+	// Status is one of "pending", "approved" or "rejected".
+	Status     string     `gorm:"index;not null" json:"status" example:"pending"`
+	ReviewedBy string     `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// GetReviewItem returns the review of a document's latest large change.
+func GetReviewItem(db *gorm.DB, documentID string) (*ReviewItem, error) {
+	var item ReviewItem
+	if err := db.Where("document_id = ?", documentID).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// QueueReviewItem puts a change up for review, replacing the review of an
+// earlier change of the document.
+func QueueReviewItem(db *gorm.DB, item *ReviewItem) error {
+	item.Status, item.ReviewedBy, item.ReviewedAt = ReviewPending, "", nil
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "document_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"updated_at", "file_path", "title", "collection", "changed_lines", "changed_at",
+			"status", "reviewed_by", "reviewed_at",
+		}),
+	}).Create(item).Error
+}
+
+// ListReviewItems returns the reviews with a status, or all of them if status
+// is empty, oldest first.
+func ListReviewItems(db *gorm.DB, status string) ([]ReviewItem, error) {
+	query := db.Order("id")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var items []ReviewItem
+	if err := query.Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// scheduleSlotRetention is how long claimed slots are remembered.
+const scheduleSlotRetention = 7 * 24 * time.Hour
+
+// ScheduleSlot records that a scheduler queued the run of a schedule due at
+// Slot. The composite primary key makes claiming a slot atomic across every
+// process running the scheduler.
+type ScheduleSlot struct {
+	Schedule  string    `gorm:"primaryKey"`
+	Slot      time.Time `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
+
+// ClaimScheduleSlot claims the run of schedule due at slot. It reports false
+// if another scheduler claimed it first. Slots older than a week are pruned.
+func ClaimScheduleSlot(db *gorm.DB, schedule string, slot time.Time) (bool, error) {
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&ScheduleSlot{Schedule: schedule, Slot: slot.UTC()})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	db.Where("slot < ?", time.Now().Add(-scheduleSlotRetention)).Delete(&ScheduleSlot{})
+	return result.RowsAffected == 1, nil
+}
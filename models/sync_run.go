@@ -0,0 +1,134 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sync run states.
+const (
+	SyncRunStaged     = "staged"     // Waiting for manual approval.
+	SyncRunHeld       = "held"       // Failed a gate rule; needs manual approval.
+	SyncRunPublished  = "published"  // Pushed to the knowledge collections.
+	SyncRunRejected   = "rejected"   // Discarded by a reviewer.
+	SyncRunSuperseded = "superseded" // Folded into a newer run before publishing.
+	SyncRunFailed     = "failed"     // Publishing failed.
+	SyncRunDeferred   = "deferred"   // Queued until a freeze window ends.
+)
+
+// StagedFile is a local file changed or removed by a sync run. Checksum is
+// the content that was validated; publishing refuses files changed since.
+type StagedFile struct {
+	Path     string `json:"path"`
+	Removed  bool   `json:"removed,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// GateCheck is the outcome of one validation rule.
+type GateCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// StageTiming summarizes the time spent in one stage of a sync run. Count is
+// the number of timed operations (listed pages, documents, uploaded files or
+// collection changes); the percentiles are over those operations.
+type StageTiming struct {
+	Stage   string `json:"stage" example:"export"`
+	Count   int    `json:"count"`
+	TotalMS int64  `json:"total_ms"`
+	P50MS   int64  `json:"p50_ms"`
+	P95MS   int64  `json:"p95_ms"`
+	MaxMS   int64  `json:"max_ms"`
+}
+
+// SyncRun is the staged result of a sync's build phase (export and content
+// pipeline). Its files are pushed to the knowledge collections in the
+// publish phase once the validation gate lets it through.
+type SyncRun struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Status  string `gorm:"index;not null" json:"status" example:"staged"`
+	Changed int    `json:"changed"`
+	Removed int    `json:"removed"`
+	// CorrelationID is the run_id of the run's log lines.
+	CorrelationID string `gorm:"index" json:"correlation_id,omitempty" example:"9f86d081884c7d65"`
+	// FilesJSON, ChecksJSON and TimingsJSON hold the staged files, gate
+	// results and stage timings.
+	FilesJSON   string `gorm:"type:text" json:"-"`
+	ChecksJSON  string `gorm:"type:text" json:"-"`
+	TimingsJSON string `gorm:"type:text" json:"-"`
+	// Files, Checks and Timings are decoded from their JSON columns.
+	Files   []StagedFile  `gorm:"-" json:"files,omitempty"`
+	Checks  []GateCheck   `gorm:"-" json:"checks"`
+	Timings []StageTiming `gorm:"-" json:"timings,omitempty"`
+
+	// ReviewedBy is the principal that approved or rejected the run.
+	ReviewedBy  string     `json:"reviewed_by,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// BeforeSave encodes the staged files, gate results and stage timings.
+func (r *SyncRun) BeforeSave(tx *gorm.DB) error {
+	files, err := json.Marshal(r.Files)
+	if err != nil {
+		return err
+	}
+	checks, err := json.Marshal(r.Checks)
+	if err != nil {
+		return err
+	}
+	timings, err := json.Marshal(r.Timings)
+	if err != nil {
+		return err
+	}
+	r.FilesJSON, r.ChecksJSON, r.TimingsJSON = string(files), string(checks), string(timings)
+	return nil
+}
+
+// AfterFind decodes the staged files, gate results and stage timings.
+func (r *SyncRun) AfterFind(tx *gorm.DB) error {
+	if r.FilesJSON != "" {
+		if err := json.Unmarshal([]byte(r.FilesJSON), &r.Files); err != nil {
+			return err
+		}
+	}
+	if r.ChecksJSON != "" {
+		if err := json.Unmarshal([]byte(r.ChecksJSON), &r.Checks); err != nil {
+			return err
+		}
+	}
+	if r.TimingsJSON != "" {
+		return json.Unmarshal([]byte(r.TimingsJSON), &r.Timings)
+	}
+	return nil
+}
+
+// ListSyncRuns returns the newest sync runs first, optionally filtered by status.
+func ListSyncRuns(db *gorm.DB, status string, limit int) ([]SyncRun, error) {
+	query := db.Order("id DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var runs []SyncRun
+	if err := query.Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// ListPendingSyncRuns returns the runs whose changes were never published,
+// those waiting for approval and those whose publishing failed, oldest first.
+func ListPendingSyncRuns(db *gorm.DB) ([]SyncRun, error) {
+	var runs []SyncRun
+	if err := db.Where("status IN ?", []string{SyncRunStaged, SyncRunHeld, SyncRunFailed}).Order("id").Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UploadedFile tracks a file attached to an OpenWebUI knowledge collection.
+// Files the scraper uploaded (or adopted on first run) are managed and may be
+// replaced or removed by later syncs. Files that were already present and did
+// not match any exported document are recorded as unmanaged and never touched.
+type UploadedFile struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// KnowledgeID is the OpenWebUI knowledge collection the file belongs to.
+	KnowledgeID string `gorm:"index;not null" json:"knowledge_id"`
+	// FileID is the OpenWebUI file ID.
+	FileID string `gorm:"index;not null" json:"file_id"`
+	// FilePath is the local exported file; empty for unmanaged files.
+	FilePath string `gorm:"index" json:"file_path,omitempty"`
+	// Name is the file name the content was uploaded under.
+	Name string `json:"name,omitempty"`
+	// Checksum is the SHA-256 of the uploaded content.
+	Checksum string `json:"checksum,omitempty"`
+	// Managed is false for pre-existing files the scraper must leave alone.
+	Managed bool `gorm:"not null" json:"managed"`
+	// Adopted is set for pre-existing files matched to a document on first run.
+	Adopted bool `gorm:"not null;default:false" json:"adopted"`
+}
+
+// ListUploadedFiles returns all tracked files of a knowledge collection.
+func ListUploadedFiles(db *gorm.DB, knowledgeID string) ([]UploadedFile, error) {
+	var files []UploadedFile
+	if err := db.Where("knowledge_id = ?", knowledgeID).Order("id").Find(&files).Error; err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// CountUploadedFiles returns how many files are tracked for a knowledge collection.
+func CountUploadedFiles(db *gorm.DB, knowledgeID string) (int64, error) {
+	var count int64
+	err := db.Model(&UploadedFile{}).Where("knowledge_id = ?", knowledgeID).Count(&count).Error
+	return count, err
+}
+
+// DeleteUploadedFile stops tracking a file of a knowledge collection.
+func DeleteUploadedFile(db *gorm.DB, knowledgeID, fileID string) error {
+	return db.Where("knowledge_id = ? AND file_id = ?", knowledgeID, fileID).Delete(&UploadedFile{}).Error
+}
+
+// DeleteUploadedFiles stops tracking every file of a knowledge collection.
+func DeleteUploadedFiles(db *gorm.DB, knowledgeID string) error {
+	return db.Where("knowledge_id = ?", knowledgeID).Delete(&UploadedFile{}).Error
+}
+
+// ListTrackedKnowledgeIDs returns every knowledge collection with tracked files.
+func ListTrackedKnowledgeIDs(db *gorm.DB) ([]string, error) {
+	var ids []string
+	err := db.Model(&UploadedFile{}).Distinct().Order("knowledge_id").Pluck("knowledge_id", &ids).Error
+	return ids, err
+}
+
+// ListKnowledgeIDsByPath returns the knowledge collections a local file path
+// is tracked in, i.e. where it was routed when uploaded.
+func ListKnowledgeIDsByPath(db *gorm.DB, filePath string) ([]string, error) {
+	var ids []string
+	err := db.Model(&UploadedFile{}).Where("file_path = ?", filePath).Distinct().Order("knowledge_id").Pluck("knowledge_id", &ids).Error
+	return ids, err
+}
+
+// ListUploadedFilesByPath returns the files tracked in a knowledge collection
+// for a local file path; a pre-chunked document has several.
+func ListUploadedFilesByPath(db *gorm.DB, knowledgeID, filePath string) ([]UploadedFile, error) {
+	var files []UploadedFile
+	if err := db.Where("knowledge_id = ? AND file_path = ?", knowledgeID, filePath).Find(&files).Error; err != nil {
+		return nil, err
+	}
+	return files, nil
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Built-in roles, created at startup and never deleted.
+const (
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// Role grants its users an API key scope: operators hold sync and may
+// trigger syncs, admins hold admin and may also edit mappings and tokens.
+type Role struct {
+	ID        uint      `gorm:"primaryKey" json:"id" example:"1"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Name string `gorm:"uniqueIndex;not null" json:"name" example:"operator"`
+	// Scope is read, sync or admin.
+	Scope   string `gorm:"not null" json:"scope" example:"sync"`
+	Builtin bool   `gorm:"not null;default:false" json:"builtin"`
+}
+
+// User is a person signing in through OIDC, matched by email, and their role.
+type User struct {
+	ID        uint      `gorm:"primaryKey" json:"id" example:"1"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Email is stored in lower case.
+	Email       string     `gorm:"uniqueIndex;not null" json:"email" example:"jane@example.com"`
+	Name        string     `json:"name,omitempty" example:"Jane Doe"`
+	RoleID      uint       `gorm:"not null;index" json:"role_id"`
+	Role        Role       `json:"role"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// EnsureBuiltinRoles creates the operator and admin roles if they are missing.
+func EnsureBuiltinRoles(db *gorm.DB) error {
+	roles := []Role{
+		{Name: RoleOperator, Scope: ScopeSync, Builtin: true},
+		{Name: RoleAdmin, Scope: ScopeAdmin, Builtin: true},
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&roles).Error
+}
+
+// FindRoleByName returns the role with the given name.
+func FindRoleByName(db *gorm.DB, name string) (*Role, error) {
+	var role Role
+	if err := db.Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// FindUserByEmail returns the user with an email address, with their role.
+func FindUserByEmail(db *gorm.DB, email string) (*User, error) {
+	var user User
+	if err := db.Preload("Role").Where("email = ?", strings.ToLower(email)).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListUsers returns all users with their roles, ordered by email.
+func ListUsers(db *gorm.DB) ([]User, error) {
+	var users []User
+	if err := db.Preload("Role").Order("email").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+// UserToken is the Outline API token of a user (or of a service user that
+// stands for a group). Exports run with it only see what that user may read
+// and are uploaded to a knowledge collection of their own. The token is
+// either registered by an admin or obtained through Outline's OAuth consent
+// screen, and stored encrypted with the TOKEN_ENCRYPTION_KEY master key.
+type UserToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id" example:"1"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Name identifies the user or group and names its export directory.
+	Name string `gorm:"uniqueIndex;not null" json:"name" example:"hr-team"`
+	// Workspace is the configured Outline workspace the token belongs to.
+	Workspace string `json:"workspace,omitempty"`
+	// EncryptedToken is the AES-GCM encrypted Outline API token.
+	EncryptedToken string `gorm:"not null" json:"-"`
+	// OAuth is set for tokens obtained through the Outline OAuth flow. They
+	// expire at TokenExpiresAt and are refreshed with EncryptedRefreshToken.
+	OAuth                 bool       `gorm:"not null;default:false" json:"oauth"`
+	EncryptedRefreshToken string     `json:"-"`
+	TokenExpiresAt        *time.Time `json:"token_expires_at,omitempty"`
+	// OutlineUserID is the Outline user who connected their account; they
+	// reconnect to the same record.
+	OutlineUserID string `gorm:"index" json:"outline_user_id,omitempty"`
+	// KnowledgeCollectionID is the OpenWebUI knowledge collection the user's
+	// accessible documents are uploaded to.
+	KnowledgeCollectionID string `gorm:"not null" json:"knowledge_collection_id"`
+	// Provisioned is set when the knowledge collection was created by this
+	// service; it is created again if it goes missing.
+	Provisioned bool `gorm:"not null;default:false" json:"provisioned"`
+	// OpenWebUIUserID is the OpenWebUI user a provisioned collection is
+	// shared with; everyone else cannot see it.
+	OpenWebUIUserID string `json:"openwebui_user_id,omitempty"`
+	// Schedule syncs the token at fixed times, in the SYNC_SCHEDULE format.
+	Schedule string `json:"schedule,omitempty" example:"Mon-Fri 06:00"`
+	// NextSyncAt is the next scheduled sync.
+	NextSyncAt *time.Time `json:"next_sync_at,omitempty"`
+	// LastSyncedAt and LastError describe the most recent sync.
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	// Documents is the number of documents the user could access at the last sync.
+	Documents int `gorm:"not null;default:0" json:"documents"`
+}
@@ -0,0 +1,182 @@
+// Package remotesync pushes the exported documents directory to a remote
+// location after an export, for setups where the uploader or other consumers
+// run on a different host.
+package remotesync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// manifestName is the file in the documents directory that records what was
+// last pushed to a WebDAV target, so unchanged files are not sent again. It
+// lives outside the pushed tree, which is a new directory for every corpus
+// snapshot when CORPUS_DIR is set.
+const manifestName = ".remote-sync.json"
+
+// Push syncs dir to the configured remote target. It is a no-op when no
+// target is configured.
+func Push(ctx context.Context, dir string) error {
+	cfg := config.ConfigInstance
+	if cfg.RemoteSyncTarget == "" {
+		return nil
+	}
+	switch cfg.RemoteSyncMethod {
+	case "rsync":
+		return pushRsync(ctx, dir, cfg.RemoteSyncTarget, cfg.RemoteSyncRsyncArgs)
+	case "webdav":
+		return pushWebDAV(ctx, dir, cfg.RemoteSyncTarget, cfg.RemoteSyncUser, cfg.RemoteSyncPassword)
+	default:
+		return fmt.Errorf("remotesync: unsupported method %q", cfg.RemoteSyncMethod)
+	}
+}
+
+// pushRsync mirrors dir to target using the rsync binary. Targets of the form
+// user@host:/path use SSH as transport; rsync:// targets talk to a daemon.
+func pushRsync(ctx context.Context, dir, target string, extraArgs []string) error {
+	args := []string{"-a", "--delete", "--exclude", manifestName, "--exclude", ".*.tmp-*"}
+	args = append(args, extraArgs...)
+	// The trailing slash copies the directory contents rather than the directory itself.
+	args = append(args, strings.TrimSuffix(dir, "/")+"/", target)
+	cmd := exec.CommandContext(ctx, "rsync", args...)
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := utils.Run(ctx, cmd); err != nil {
+		return fmt.Errorf("remotesync: rsync failed: %v: %s", err, strings.TrimSpace(output.String()))
+	}
+	logging.FromContext(ctx).Info("Pushed via rsync", "dir", dir, "target", target)
+	return nil
+}
+
+// pushWebDAV uploads new and changed files to a WebDAV collection and deletes
+// files that no longer exist locally.
+func pushWebDAV(ctx context.Context, dir, target, user, password string) error {
+	base, err := url.Parse(strings.TrimSuffix(target, "/") + "/")
+	if err != nil {
+		return fmt.Errorf("remotesync: invalid target: %w", err)
+	}
+	manifestPath := filepath.Join(config.ConfigInstance.DocumentsDir, manifestName)
+	previous := make(map[string]string)
+	if data, err := os.ReadFile(manifestPath); err == nil {
+		if err := json.Unmarshal(data, &previous); err != nil {
+			logging.FromContext(ctx).Warn("remotesync: ignoring unreadable manifest", "error", err)
+		}
+	}
+
+	current := make(map[string]string)
+	madeDirs := make(map[string]bool)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		sum := utils.Checksum(content)
+		current[rel] = sum
+		if previous[rel] == sum {
+			return nil
+		}
+		if err := mkcolAll(ctx, base, path.Dir(rel), user, password, madeDirs); err != nil {
+			return err
+		}
+		if err := davRequest(ctx, "PUT", base, rel, user, password, content, http.StatusOK, http.StatusCreated, http.StatusNoContent); err != nil {
+			return err
+		}
+		logging.FromContext(ctx).Info("Pushed to WebDAV", "path", rel)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var removed []string
+	for rel := range previous {
+		if _, ok := current[rel]; !ok {
+			removed = append(removed, rel)
+		}
+	}
+	sort.Strings(removed)
+	for _, rel := range removed {
+		if err := davRequest(ctx, "DELETE", base, rel, user, password, nil, http.StatusOK, http.StatusNoContent, http.StatusNotFound); err != nil {
+			return err
+		}
+		logging.FromContext(ctx).Info("Removed from WebDAV", "path", rel)
+	}
+
+	data, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(manifestPath, data, 0644)
+}
+
+// mkcolAll creates the collection rel and all of its parents on the server.
+func mkcolAll(ctx context.Context, base *url.URL, rel, user, password string, made map[string]bool) error {
+	if rel == "." || rel == "" || made[rel] {
+		return nil
+	}
+	if err := mkcolAll(ctx, base, path.Dir(rel), user, password, made); err != nil {
+		return err
+	}
+	// 405 Method Not Allowed means the collection already exists.
+	if err := davRequest(ctx, "MKCOL", base, rel+"/", user, password, nil, http.StatusCreated, http.StatusMethodNotAllowed); err != nil {
+		return err
+	}
+	made[rel] = true
+	return nil
+}
+
+// davRequest sends a WebDAV request for rel below base and checks the status.
+func davRequest(ctx context.Context, method string, base *url.URL, rel, user, password string, body []byte, okStatuses ...int) error {
+	segments := strings.Split(rel, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	ref, err := url.Parse(strings.Join(segments, "/"))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base.ResolveReference(ref).String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	resp, err := utils.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	for _, status := range okStatuses {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	return fmt.Errorf("remotesync: %s %s: unexpected status: %s", method, rel, resp.Status)
+}
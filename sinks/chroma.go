@@ -0,0 +1,196 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// chromaPageSize is how many records are listed per request.
+const chromaPageSize = 300
+
+// Chroma collection IDs by name.
+var (
+	chromaCollections   = make(map[string]string)
+	chromaCollectionsMu sync.Mutex
+)
+
+// chromaRequest sends a JSON request to the Chroma v2 API below the
+// configured tenant and database and decodes the answer into result, if given.
+func chromaRequest(ctx context.Context, method, path string, payload, result interface{}) error {
+	body := &bytes.Buffer{}
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			return err
+		}
+	}
+	cfg := config.ConfigInstance
+	base := fmt.Sprintf("%s/api/v2/tenants/%s/databases/%s", cfg.ChromaURL, url.PathEscape(cfg.ChromaTenant), url.PathEscape(cfg.ChromaDatabase))
+	req, err := http.NewRequestWithContext(ctx, method, base+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.ChromaToken != "" {
+		req.Header.Set("X-Chroma-Token", cfg.ChromaToken)
+	}
+	resp, err := utils.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("chromaRequest: %s %s: unexpected status: %s, body: %s", method, path, resp.Status, string(respBody))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// chromaCollectionID returns the ID of the Chroma collection named after a
+// knowledge ID, creating it on first use.
+func chromaCollectionID(ctx context.Context, knowledgeID string) (string, error) {
+	chromaCollectionsMu.Lock()
+	defer chromaCollectionsMu.Unlock()
+	if id, ok := chromaCollections[knowledgeID]; ok {
+		return id, nil
+	}
+	var collection struct {
+		ID string `json:"id"`
+	}
+	err := chromaRequest(ctx, "POST", "/collections", map[string]interface{}{
+		"name":          knowledgeID,
+		"get_or_create": true,
+		"metadata":      map[string]interface{}{"hnsw:space": "cosine", "source": "outline-rag-scraper"},
+	}, &collection)
+	if err != nil {
+		return "", err
+	}
+	if collection.ID == "" {
+		return "", fmt.Errorf("chromaCollectionID: collection ID not found in response")
+	}
+	chromaCollections[knowledgeID] = collection.ID
+	return collection.ID, nil
+}
+
+// chromaMetadata flattens metadata into the scalar values Chroma accepts.
+func chromaMetadata(metadata map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{}, len(metadata))
+	for key, value := range metadata {
+		switch v := value.(type) {
+		case []string:
+			flat[key] = strings.Join(v, ",")
+		case time.Time:
+			if !v.IsZero() {
+				flat[key] = v.UTC().Format(time.RFC3339)
+			}
+		case string:
+			if v != "" {
+				flat[key] = v
+			}
+		default:
+			flat[key] = v
+		}
+	}
+	return flat
+}
+
+// chromaStore stores the chunks of every knowledge ID in a Chroma collection
+// of that name, so each mapping's targets become Chroma collections.
+type chromaStore struct{}
+
+func (chromaStore) listFiles(ctx context.Context, knowledgeID string) (map[string]string, error) {
+	id, err := chromaCollectionID(ctx, knowledgeID)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	for offset := 0; ; offset += chromaPageSize {
+		var page struct {
+			IDs       []string `json:"ids"`
+			Metadatas []struct {
+				FilePath string `json:"file_path"`
+				Checksum string `json:"checksum"`
+			} `json:"metadatas"`
+		}
+		err := chromaRequest(ctx, "POST", "/collections/"+id+"/get", map[string]interface{}{
+			"include": []string{"metadatas"},
+			"limit":   chromaPageSize,
+			"offset":  offset,
+		}, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, metadata := range page.Metadatas {
+			files[metadata.FilePath] = metadata.Checksum
+		}
+		if len(page.IDs) < chromaPageSize {
+			return files, nil
+		}
+	}
+}
+
+func (chromaStore) deleteFiles(ctx context.Context, knowledgeID string, filePaths []string) error {
+	if len(filePaths) == 0 {
+		return nil
+	}
+	id, err := chromaCollectionID(ctx, knowledgeID)
+	if err != nil {
+		return err
+	}
+	return chromaRequest(ctx, "POST", "/collections/"+id+"/delete", map[string]interface{}{
+		"where": map[string]interface{}{"file_path": map[string]interface{}{"$in": filePaths}},
+	}, nil)
+}
+
+func (chromaStore) deleteChunksAfter(ctx context.Context, knowledgeID, filePath string, keep int) error {
+	id, err := chromaCollectionID(ctx, knowledgeID)
+	if err != nil {
+		return err
+	}
+	return chromaRequest(ctx, "POST", "/collections/"+id+"/delete", map[string]interface{}{
+		"where": map[string]interface{}{"$and": []interface{}{
+			map[string]interface{}{"file_path": map[string]interface{}{"$eq": filePath}},
+			map[string]interface{}{"chunk": map[string]interface{}{"$gt": keep}},
+		}},
+	}, nil)
+}
+
+func (chromaStore) dropCollection(ctx context.Context, knowledgeID string) error {
+	chromaCollectionsMu.Lock()
+	defer chromaCollectionsMu.Unlock()
+	delete(chromaCollections, knowledgeID)
+	return chromaRequest(ctx, "DELETE", "/collections/"+url.PathEscape(knowledgeID), nil, nil)
+}
+
+func (chromaStore) upsertChunks(ctx context.Context, knowledgeID string, chunks []vectorChunk) error {
+	id, err := chromaCollectionID(ctx, knowledgeID)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, len(chunks))
+	embeddings := make([][]float32, len(chunks))
+	documents := make([]string, len(chunks))
+	metadatas := make([]map[string]interface{}, len(chunks))
+	for i, c := range chunks {
+		ids[i], embeddings[i], documents[i], metadatas[i] = c.ID, c.Vector, c.Text, chromaMetadata(c.Metadata)
+	}
+	return chromaRequest(ctx, "POST", "/collections/"+id+"/upsert", map[string]interface{}{
+		"ids":        ids,
+		"embeddings": embeddings,
+		"documents":  documents,
+		"metadatas":  metadatas,
+	}, nil)
+}
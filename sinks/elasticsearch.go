@@ -0,0 +1,287 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// elasticsearchBulkSize is how many documents are sent per _bulk request.
+const elasticsearchBulkSize = 200
+
+// elasticsearchReady is set once the index template is installed.
+var (
+	elasticsearchReady   bool
+	elasticsearchReadyMu sync.Mutex
+)
+
+// elasticsearchRequest sends a request to Elasticsearch or OpenSearch and
+// decodes the answer into result, if given.
+func elasticsearchRequest(ctx context.Context, method, path, contentType string, body io.Reader, result interface{}) error {
+	cfg := config.ConfigInstance
+	req, err := http.NewRequestWithContext(ctx, method, cfg.ElasticsearchURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	switch {
+	case cfg.ElasticsearchAPIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+cfg.ElasticsearchAPIKey)
+	case cfg.ElasticsearchUsername != "":
+		req.SetBasicAuth(cfg.ElasticsearchUsername, cfg.ElasticsearchPassword)
+	}
+	resp, err := utils.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("elasticsearchRequest: %s %s: unexpected status: %s, body: %s", method, path, resp.Status, string(respBody))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// elasticsearchJSON sends a JSON payload with elasticsearchRequest.
+func elasticsearchJSON(ctx context.Context, method, path string, payload, result interface{}) error {
+	body := &bytes.Buffer{}
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			return err
+		}
+	}
+	return elasticsearchRequest(ctx, method, path, "application/json", body, result)
+}
+
+// ensureElasticsearchTemplate installs the index template of
+// ELASTICSEARCH_INDEX, so the index gets its mappings when the first bulk
+// request creates it. The template is put on every start to pick up changes;
+// an index created before it keeps its mappings until it is recreated.
+func ensureElasticsearchTemplate(ctx context.Context) error {
+	elasticsearchReadyMu.Lock()
+	defer elasticsearchReadyMu.Unlock()
+	if elasticsearchReady {
+		return nil
+	}
+	keyword := map[string]interface{}{"type": "keyword"}
+	index := config.ConfigInstance.ElasticsearchIndex
+	err := elasticsearchJSON(ctx, "PUT", "/_index_template/"+index, map[string]interface{}{
+		"index_patterns": []string{index},
+		"priority":       100,
+		"template": map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"dynamic": false,
+				"properties": map[string]interface{}{
+					"title": map[string]interface{}{
+						"type":   "text",
+						"fields": map[string]interface{}{"raw": keyword},
+					},
+					"collection":     keyword,
+					"body":           map[string]interface{}{"type": "text"},
+					"updatedAt":      map[string]interface{}{"type": "date"},
+					"url":            keyword,
+					"documentId":     keyword,
+					"workspace":      keyword,
+					"tags":           keyword,
+					"classification": keyword,
+					"knowledgeId":    keyword,
+					"filePath":       keyword,
+					"checksum":       keyword,
+				},
+			},
+		},
+		"_meta": map[string]interface{}{"managed_by": "outline-rag-scraper"},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("Installed index template", "index", index)
+	elasticsearchReady = true
+	return nil
+}
+
+// elasticsearchFilter matches the documents of a knowledge collection,
+// restricted to filePaths if any are given.
+func elasticsearchFilter(knowledgeID string, filePaths []string) map[string]interface{} {
+	filter := []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"knowledgeId": knowledgeID}},
+	}
+	if len(filePaths) > 0 {
+		filter = append(filter, map[string]interface{}{"terms": map[string]interface{}{"filePath": filePaths}})
+	}
+	return map[string]interface{}{"bool": map[string]interface{}{"filter": filter}}
+}
+
+// elasticsearchDocument maps a chunk onto the fields of the index template.
+func elasticsearchDocument(c vectorChunk) map[string]interface{} {
+	doc := map[string]interface{}{"body": c.Text}
+	fields := map[string]string{
+		"title":          "title",
+		"collection":     "collection",
+		"url":            "url",
+		"document_id":    "documentId",
+		"workspace":      "workspace",
+		"tags":           "tags",
+		"classification": "classification",
+		"knowledge_id":   "knowledgeId",
+		"file_path":      "filePath",
+		"checksum":       "checksum",
+	}
+	for key, field := range fields {
+		if value, ok := c.Metadata[key]; ok && value != "" {
+			doc[field] = value
+		}
+	}
+	if updated, ok := c.Metadata["updated_at"].(time.Time); ok && !updated.IsZero() {
+		doc["updatedAt"] = updated.UTC().Format(time.RFC3339)
+	}
+	return doc
+}
+
+// elasticsearchStore indexes every exported document as one document of
+// ELASTICSEARCH_INDEX for keyword search, with the knowledge ID as a field.
+// It works with Elasticsearch 7.8+ and OpenSearch.
+type elasticsearchStore struct{}
+
+func (elasticsearchStore) keywordOnly() {}
+
+func (elasticsearchStore) listFiles(ctx context.Context, knowledgeID string) (map[string]string, error) {
+	files := make(map[string]string)
+	var after []interface{}
+	for {
+		var page struct {
+			Hits struct {
+				Hits []struct {
+					Source struct {
+						FilePath string `json:"filePath"`
+						Checksum string `json:"checksum"`
+					} `json:"_source"`
+					Sort []interface{} `json:"sort"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		query := map[string]interface{}{
+			"query":   elasticsearchFilter(knowledgeID, nil),
+			"_source": []string{"filePath", "checksum"},
+			"size":    1000,
+			"sort":    []interface{}{map[string]interface{}{"filePath": "asc"}},
+		}
+		if after != nil {
+			query["search_after"] = after
+		}
+		err := elasticsearchJSON(ctx, "POST", "/"+config.ConfigInstance.ElasticsearchIndex+"/_search?ignore_unavailable=true", query, &page)
+		if err != nil {
+			return nil, err
+		}
+		hits := page.Hits.Hits
+		for _, hit := range hits {
+			files[hit.Source.FilePath] = hit.Source.Checksum
+		}
+		if len(hits) < 1000 {
+			return files, nil
+		}
+		after = hits[len(hits)-1].Sort
+	}
+}
+
+func (elasticsearchStore) deleteFiles(ctx context.Context, knowledgeID string, filePaths []string) error {
+	if len(filePaths) == 0 {
+		return nil
+	}
+	return elasticsearchJSON(ctx, "POST", "/"+config.ConfigInstance.ElasticsearchIndex+"/_delete_by_query?ignore_unavailable=true&refresh=true&conflicts=proceed", map[string]interface{}{
+		"query": elasticsearchFilter(knowledgeID, filePaths),
+	}, nil)
+}
+
+// deleteChunksAfter has nothing to do: every file is a single document,
+// overwritten in place.
+func (elasticsearchStore) deleteChunksAfter(ctx context.Context, knowledgeID, filePath string, keep int) error {
+	return nil
+}
+
+// bulkError reports the items of a _bulk request that failed while the rest
+// of the batch was indexed.
+type bulkError struct {
+	// Failed maps the IDs of failed chunks to their error.
+	Failed map[string]string
+	Total  int
+}
+
+func (e *bulkError) Error() string {
+	ids := make([]string, 0, len(e.Failed))
+	for id := range e.Failed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return fmt.Sprintf("elasticsearchStore: %d of %d documents failed, first: %s: %s", len(e.Failed), e.Total, ids[0], e.Failed[ids[0]])
+}
+
+// upsertChunks indexes chunks in bulk. Items the bulk API rejects are
+// returned as a *bulkError; the others stay indexed.
+func (elasticsearchStore) upsertChunks(ctx context.Context, knowledgeID string, chunks []vectorChunk) error {
+	if err := ensureElasticsearchTemplate(ctx); err != nil {
+		return err
+	}
+	failed := make(map[string]string)
+	for start := 0; start < len(chunks); start += elasticsearchBulkSize {
+		end := start + elasticsearchBulkSize
+		if end > len(chunks) {
+			end = len(chunks)
+		}
+		body := &bytes.Buffer{}
+		encoder := json.NewEncoder(body)
+		for _, c := range chunks[start:end] {
+			action := map[string]interface{}{"index": map[string]interface{}{"_id": c.ID}}
+			if err := encoder.Encode(action); err != nil {
+				return err
+			}
+			if err := encoder.Encode(elasticsearchDocument(c)); err != nil {
+				return err
+			}
+		}
+		var result struct {
+			Errors bool `json:"errors"`
+			Items  []map[string]struct {
+				ID    string `json:"_id"`
+				Error *struct {
+					Type   string `json:"type"`
+					Reason string `json:"reason"`
+				} `json:"error"`
+			} `json:"items"`
+		}
+		err := elasticsearchRequest(ctx, "POST", "/"+config.ConfigInstance.ElasticsearchIndex+"/_bulk?refresh=wait_for", "application/x-ndjson", body, &result)
+		if err != nil {
+			return err
+		}
+		if !result.Errors {
+			continue
+		}
+		for _, item := range result.Items {
+			for _, outcome := range item {
+				if outcome.Error == nil {
+					continue
+				}
+				failed[outcome.ID] = strings.TrimSpace(outcome.Error.Type + ": " + outcome.Error.Reason)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return &bulkError{Failed: failed, Total: len(chunks)}
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/adaptive"
+	"github.com/mikeshootzz/outline-rag-scraper/cache"
+	"github.com/mikeshootzz/outline-rag-scraper/chunk"
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/timings"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// OpenWebUIKnowledgeCacheKey is the cache key of a knowledge collection's file listing.
+func OpenWebUIKnowledgeCacheKey(knowledgeID string) string {
+	return "openwebui:knowledge:" + config.ConfigInstance.OpenWebUIAPIURL + ":" + knowledgeID
+}
+
+// convertContent converts content to plain text if requested.
+func convertContent(content []byte, plainText bool) []byte {
+	if plainText {
+		return []byte(utils.MarkdownToPlainText(string(content)))
+	}
+	return content
+}
+
+// OpenWebUIPart is one file sent to OpenWebUI for a local document.
+type OpenWebUIPart struct {
+	Name    string
+	Content []byte
+}
+
+// OpenWebUIParts returns the files a document is uploaded as. Without
+// CHUNK_SIZE or CHUNK_STRATEGY=heading that is the whole document; otherwise
+// the body is pre-chunked so tables and code blocks stay intact, and every
+// part repeats the document header so citations still point at the source
+// document. Parts record their position and section, and parts containing
+// code are tagged with the code's languages.
+func OpenWebUIParts(doc Document) []OpenWebUIPart {
+	content, name := doc.Content, doc.Name
+	size := config.ConfigInstance.ChunkSize
+	// HTML and JSON exports have no Markdown body to chunk.
+	if ext := filepath.Ext(doc.Path); ext == ".html" || ext == ".json" ||
+		(size <= 0 && config.ConfigInstance.ChunkStrategy != "heading") {
+		return []OpenWebUIPart{{Name: name, Content: convertContent(content, doc.PlainText)}}
+	}
+	header, body, found := strings.Cut(string(content), "\n\n")
+	if !found {
+		header, body = "", header
+	}
+	chunks := chunk.SplitWith(body, chunk.Options{
+		Strategy:     config.ConfigInstance.ChunkStrategy,
+		Size:         size,
+		Overlap:      config.ConfigInstance.ChunkOverlap,
+		HeadingLevel: config.ConfigInstance.ChunkHeadingLevel,
+	})
+	if len(chunks) <= 1 {
+		return []OpenWebUIPart{{Name: name, Content: convertContent(content, doc.PlainText)}}
+	}
+	extension := filepath.Ext(name)
+	base := strings.TrimSuffix(name, extension)
+	parts := make([]OpenWebUIPart, 0, len(chunks))
+	for i, c := range chunks {
+		// Tag parts holding code so retrieval can match on the language.
+		partHeader := header
+		if utils.HasFrontMatter(partHeader) {
+			partHeader = utils.AddFrontMatterField(partHeader, "chunk", i+1)
+			partHeader = utils.AddFrontMatterField(partHeader, "chunks", len(chunks))
+			partHeader = utils.AddFrontMatterField(partHeader, "section", c.Section)
+		}
+		if len(c.Languages) > 0 && utils.HasFrontMatter(partHeader) {
+			partHeader = utils.AddFrontMatterField(partHeader, "code_languages", c.Languages)
+		} else if len(c.Languages) > 0 {
+			partHeader = strings.TrimPrefix(partHeader+"\nCode Languages: "+strings.Join(c.Languages, ", "), "\n")
+		}
+		text := c.Text
+		if partHeader != "" {
+			text = partHeader + "\n\n" + text
+		}
+		parts = append(parts, OpenWebUIPart{
+			Name:    fmt.Sprintf("%s.part%03d%s", base, i+1, extension),
+			Content: convertContent([]byte(text), doc.PlainText),
+		})
+	}
+	return parts
+}
+
+// replaceManagedFile brings the files tracked for a local path in line with
+// its prepared parts. Unchanged documents are left in place; otherwise the
+// parts are uploaded first and the previous version is removed afterwards, so
+// a failed upload never leaves the document missing from the collection. It
+// reports whether anything was uploaded.
+func replaceManagedFile(ctx context.Context, knowledgeID, filePath string, parts []OpenWebUIPart, contentType string) (bool, error) {
+	tracked, err := models.ListUploadedFilesByPath(utils.DB, knowledgeID, filePath)
+	if err != nil {
+		return false, err
+	}
+	if partsUploaded(tracked, parts) {
+		return false, nil
+	}
+	if err := UploadOpenWebUIParts(ctx, filePath, knowledgeID, parts, contentType); err != nil {
+		return true, err
+	}
+	for _, file := range tracked {
+		if !file.Managed {
+			continue
+		}
+		if err := RemoveOpenWebUIFile(ctx, knowledgeID, file.FileID); err != nil {
+			logging.FromContext(ctx).Error("Error removing file", "file_id", file.FileID, "error", err)
+			continue
+		}
+		if err := models.DeleteUploadedFile(utils.DB, knowledgeID, file.FileID); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// partsUploaded reports whether the tracked files of a path hold exactly the
+// given parts. Names are only compared where they were recorded.
+func partsUploaded(tracked []models.UploadedFile, parts []OpenWebUIPart) bool {
+	if len(tracked) != len(parts) {
+		return false
+	}
+	uploaded := make(map[string]string, len(tracked))
+	for _, file := range tracked {
+		if !file.Managed || file.Checksum == "" {
+			return false
+		}
+		uploaded[file.Checksum] = file.Name
+	}
+	for _, part := range parts {
+		name, ok := uploaded[utils.Checksum(part.Content)]
+		if !ok || (name != "" && name != part.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoveOpenWebUIFile removes a file from an OpenWebUI knowledge collection.
+func RemoveOpenWebUIFile(ctx context.Context, knowledgeID, fileID string) error {
+	defer timings.Since(ctx, timings.Knowledge, time.Now())
+	url := fmt.Sprintf("%s/knowledge/%s/file/remove", config.ConfigInstance.OpenWebUIAPIURL, knowledgeID)
+	payload := map[string]interface{}{
+		"file_id": fileID,
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := utils.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("RemoveOpenWebUIFile: failed with status %s", resp.Status)
+	}
+	cache.Delete(OpenWebUIKnowledgeCacheKey(knowledgeID))
+	logging.FromContext(ctx).Info("Removed file from knowledge collection", "file_id", fileID)
+	return nil
+}
+
+// UploadOpenWebUIParts uploads the prepared parts of the document at
+// filePath to a knowledge collection and records them as managed files.
+func UploadOpenWebUIParts(ctx context.Context, filePath, knowledgeID string, parts []OpenWebUIPart, contentType string) error {
+	for _, part := range parts {
+		if err := uploadOpenWebUIPart(ctx, filePath, knowledgeID, part, contentType); err != nil {
+			return err
+		}
+	}
+	countSync(ctx, filePath)
+	return nil
+}
+
+// uploadOpenWebUIPart uploads a single file, adds it to the knowledge
+// collection and records it as managed.
+func uploadOpenWebUIPart(ctx context.Context, filePath, knowledgeID string, upload OpenWebUIPart, contentType string) error {
+	content, name := upload.Content, upload.Name
+	fileID, err := PostOpenWebUIFile(ctx, name, content, contentType)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("Uploaded file", "file", filePath, "name", name, "file_id", fileID)
+	if err := addOpenWebUIFile(ctx, knowledgeID, fileID); err != nil {
+		return err
+	}
+	return utils.DB.Create(&models.UploadedFile{
+		KnowledgeID: knowledgeID,
+		FileID:      fileID,
+		FilePath:    filePath,
+		Name:        name,
+		Checksum:    utils.Checksum(content),
+		Managed:     true,
+	}).Error
+}
+
+// PostOpenWebUIFile uploads a file via multipart form data and returns its ID.
+func PostOpenWebUIFile(ctx context.Context, name string, content []byte, contentType string) (string, error) {
+	defer timings.Since(ctx, timings.Upload, time.Now())
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, name))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return "", err
+	}
+	if _, err = part.Write(content); err != nil {
+		return "", err
+	}
+	writer.Close()
+
+	url := fmt.Sprintf("%s/files/", config.ConfigInstance.OpenWebUIAPIURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	started := time.Now()
+	resp, err := utils.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		adaptive.OpenWebUI.Throttled()
+	} else {
+		adaptive.OpenWebUI.Observe(time.Since(started))
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("uploadToOpenWebUI: unexpected status: %s, body: %s", resp.Status, string(respBody))
+	}
+	var uploadResp map[string]interface{}
+	if err = json.NewDecoder(resp.Body).Decode(&uploadResp); err != nil {
+		return "", err
+	}
+	fileID, ok := uploadResp["id"].(string)
+	if !ok || fileID == "" {
+		return "", fmt.Errorf("uploadToOpenWebUI: file ID not found in response")
+	}
+	return fileID, nil
+}
+
+// addOpenWebUIFile adds an uploaded file to a knowledge collection.
+func addOpenWebUIFile(ctx context.Context, knowledgeID, fileID string) error {
+	defer timings.Since(ctx, timings.Knowledge, time.Now())
+	url := fmt.Sprintf("%s/knowledge/%s/file/add", config.ConfigInstance.OpenWebUIAPIURL, knowledgeID)
+	payload := map[string]interface{}{
+		"file_id": fileID,
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.ConfigInstance.OpenWebUIAPIToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := utils.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("addOpenWebUIFile: failed with status %s", resp.Status)
+	}
+	cache.Delete(OpenWebUIKnowledgeCacheKey(knowledgeID))
+	logging.FromContext(ctx).Info("Added file to knowledge collection", "file_id", fileID, "knowledge_id", knowledgeID)
+	return nil
+}
+
+// openWebUISink uploads documents as files of OpenWebUI knowledge
+// collections and tracks them as managed files.
+type openWebUISink struct{}
+
+// Upload leaves documents whose parts were already uploaded alone.
+// Documents are uploaded concurrently, as many at once as the adaptive
+// OpenWebUI limit allows.
+func (openWebUISink) Upload(ctx context.Context, knowledgeID string, docs []Document) (int, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	uploaded := 0
+	var errs []error
+	for _, doc := range docs {
+		adaptive.OpenWebUI.Acquire()
+		wg.Add(1)
+		go func(doc Document) {
+			defer wg.Done()
+			defer adaptive.OpenWebUI.Release()
+			changed, err := replaceManagedFile(ctx, knowledgeID, doc.Path, OpenWebUIParts(doc), doc.ContentType)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error uploading file %s: %w", doc.Path, err))
+				return
+			}
+			if changed {
+				uploaded++
+			}
+		}(doc)
+	}
+	wg.Wait()
+	return uploaded, errors.Join(errs...)
+}
+
+// Remove removes the managed files of paths; unmanaged files stay.
+func (openWebUISink) Remove(ctx context.Context, knowledgeID string, filePaths []string) error {
+	for _, filePath := range filePaths {
+		tracked, err := models.ListUploadedFilesByPath(utils.DB, knowledgeID, filePath)
+		if err != nil {
+			return err
+		}
+		for _, file := range tracked {
+			if !file.Managed {
+				continue
+			}
+			if err := RemoveOpenWebUIFile(ctx, knowledgeID, file.FileID); err != nil {
+				logging.FromContext(ctx).Error("Error removing file", "file_id", file.FileID, "error", err)
+				continue
+			}
+			if err := models.DeleteUploadedFile(utils.DB, knowledgeID, file.FileID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Clear removes every file tracked for a knowledge collection, managed or
+// adopted. Files the scraper never tracked stay.
+func (openWebUISink) Clear(ctx context.Context, knowledgeID string) error {
+	tracked, err := models.ListUploadedFiles(utils.DB, knowledgeID)
+	if err != nil {
+		return err
+	}
+	for _, file := range tracked {
+		if err := RemoveOpenWebUIFile(ctx, knowledgeID, file.FileID); err != nil {
+			return err
+		}
+	}
+	return models.DeleteUploadedFiles(utils.DB, knowledgeID)
+}
+
+// List returns the paths of managed files only, so manually curated files
+// are never considered stale.
+func (openWebUISink) List(ctx context.Context, knowledgeID string) (map[string]string, error) {
+	tracked, err := models.ListUploadedFiles(utils.DB, knowledgeID)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	for _, file := range tracked {
+		if file.Managed {
+			files[file.FilePath] = file.Checksum
+		}
+	}
+	return files, nil
+}
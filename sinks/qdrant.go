@@ -0,0 +1,226 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// qdrantReady is set once the collection and its payload indexes exist;
+// qdrantSize is then the vector size of the collection.
+var (
+	qdrantReady   bool
+	qdrantSize    int
+	qdrantReadyMu sync.Mutex
+)
+
+// qdrantRequest sends a JSON request to the Qdrant REST API and decodes the
+// "result" field of the answer into result, if given.
+func qdrantRequest(ctx context.Context, method, path string, payload, result interface{}) error {
+	body := &bytes.Buffer{}
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, config.ConfigInstance.QdrantURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if config.ConfigInstance.QdrantAPIKey != "" {
+		req.Header.Set("api-key", config.ConfigInstance.QdrantAPIKey)
+	}
+	resp, err := utils.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return &qdrantError{Status: resp.StatusCode, Message: fmt.Sprintf("qdrantRequest: %s %s: unexpected status: %s, body: %s", method, path, resp.Status, string(respBody))}
+	}
+	if result == nil {
+		return nil
+	}
+	envelope := struct {
+		Result interface{} `json:"result"`
+	}{result}
+	return json.NewDecoder(resp.Body).Decode(&envelope)
+}
+
+// qdrantError is a non-200 answer from Qdrant.
+type qdrantError struct {
+	Status  int
+	Message string
+}
+
+func (e *qdrantError) Error() string { return e.Message }
+
+// qdrantCollectionPath is the API path of the configured collection.
+func qdrantCollectionPath() string {
+	return "/collections/" + config.ConfigInstance.QdrantCollection
+}
+
+// ensureQdrantCollection creates the collection with vectors of size
+// dimensions, and keyword indexes on the fields points are filtered by, if it
+// does not exist yet. An existing collection whose vectors have another size,
+// e.g. after switching EMBEDDING_MODEL, is refused with an error naming both
+// sizes instead of failing every upsert.
+func ensureQdrantCollection(ctx context.Context, dimensions int) error {
+	qdrantReadyMu.Lock()
+	defer qdrantReadyMu.Unlock()
+	if qdrantReady {
+		return checkQdrantSize(dimensions)
+	}
+	var info struct {
+		Config struct {
+			Params struct {
+				Vectors json.RawMessage `json:"vectors"`
+			} `json:"params"`
+		} `json:"config"`
+	}
+	err := qdrantRequest(ctx, "GET", qdrantCollectionPath(), nil, &info)
+	var qerr *qdrantError
+	if errors.As(err, &qerr) && qerr.Status == http.StatusNotFound {
+		err = qdrantRequest(ctx, "PUT", qdrantCollectionPath(), map[string]interface{}{
+			"vectors": map[string]interface{}{"size": dimensions, "distance": "Cosine"},
+		}, nil)
+		if err != nil {
+			return err
+		}
+		for _, field := range []string{"knowledge_id", "file_path", "document_id", "collection"} {
+			err := qdrantRequest(ctx, "PUT", qdrantCollectionPath()+"/index?wait=true", map[string]interface{}{
+				"field_name":   field,
+				"field_schema": "keyword",
+			}, nil)
+			if err != nil {
+				return err
+			}
+		}
+		logging.FromContext(ctx).Info("Created Qdrant collection", "collection", config.ConfigInstance.QdrantCollection, "dimensions", dimensions)
+		qdrantSize = dimensions
+	} else if err != nil {
+		return err
+	} else {
+		// The collection holds a single unnamed vector per point.
+		var vectors struct {
+			Size int `json:"size"`
+		}
+		if err := json.Unmarshal(info.Config.Params.Vectors, &vectors); err != nil || vectors.Size == 0 {
+			return fmt.Errorf("Qdrant collection %s has no single unnamed vector; it was not created by the scraper", config.ConfigInstance.QdrantCollection)
+		}
+		qdrantSize = vectors.Size
+	}
+	qdrantReady = true
+	return checkQdrantSize(dimensions)
+}
+
+// checkQdrantSize fails if embeddings of dimensions do not fit the collection.
+func checkQdrantSize(dimensions int) error {
+	if dimensions != qdrantSize {
+		return fmt.Errorf("Qdrant collection %s stores vectors of size %d, but the embedding model returns %d; use another QDRANT_COLLECTION or recreate it", config.ConfigInstance.QdrantCollection, qdrantSize, dimensions)
+	}
+	return nil
+}
+
+// qdrantFilter matches the points of a knowledge collection, restricted to
+// filePaths if any are given.
+func qdrantFilter(knowledgeID string, filePaths []string) map[string]interface{} {
+	must := []interface{}{
+		map[string]interface{}{"key": "knowledge_id", "match": map[string]interface{}{"value": knowledgeID}},
+	}
+	if len(filePaths) > 0 {
+		must = append(must, map[string]interface{}{"key": "file_path", "match": map[string]interface{}{"any": filePaths}})
+	}
+	return map[string]interface{}{"must": must}
+}
+
+// qdrantStore stores chunks as points of QDRANT_COLLECTION, with the
+// knowledge ID in their payload.
+type qdrantStore struct{}
+
+func (qdrantStore) listFiles(ctx context.Context, knowledgeID string) (map[string]string, error) {
+	files := make(map[string]string)
+	var offset interface{}
+	for {
+		var page struct {
+			Points []struct {
+				Payload struct {
+					FilePath string `json:"file_path"`
+					Checksum string `json:"checksum"`
+				} `json:"payload"`
+			} `json:"points"`
+			NextPageOffset interface{} `json:"next_page_offset"`
+		}
+		err := qdrantRequest(ctx, "POST", qdrantCollectionPath()+"/points/scroll", map[string]interface{}{
+			"filter":       qdrantFilter(knowledgeID, nil),
+			"limit":        256,
+			"offset":       offset,
+			"with_payload": []string{"file_path", "checksum"},
+			"with_vector":  false,
+		}, &page)
+		var qerr *qdrantError
+		if errors.As(err, &qerr) && qerr.Status == http.StatusNotFound {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, point := range page.Points {
+			files[point.Payload.FilePath] = point.Payload.Checksum
+		}
+		if page.NextPageOffset == nil {
+			return files, nil
+		}
+		offset = page.NextPageOffset
+	}
+}
+
+func (qdrantStore) deleteFiles(ctx context.Context, knowledgeID string, filePaths []string) error {
+	if len(filePaths) == 0 {
+		return nil
+	}
+	return qdrantRequest(ctx, "POST", qdrantCollectionPath()+"/points/delete?wait=true", map[string]interface{}{
+		"filter": qdrantFilter(knowledgeID, filePaths),
+	}, nil)
+}
+
+func (qdrantStore) deleteChunksAfter(ctx context.Context, knowledgeID, filePath string, keep int) error {
+	filter := qdrantFilter(knowledgeID, []string{filePath})
+	filter["must"] = append(filter["must"].([]interface{}),
+		map[string]interface{}{"key": "chunk", "range": map[string]interface{}{"gt": keep}})
+	return qdrantRequest(ctx, "POST", qdrantCollectionPath()+"/points/delete?wait=true", map[string]interface{}{
+		"filter": filter,
+	}, nil)
+}
+
+func (qdrantStore) upsertChunks(ctx context.Context, knowledgeID string, chunks []vectorChunk) error {
+	if err := ensureQdrantCollection(ctx, len(chunks[0].Vector)); err != nil {
+		return err
+	}
+	type point struct {
+		ID      string                 `json:"id"`
+		Vector  []float32              `json:"vector"`
+		Payload map[string]interface{} `json:"payload"`
+	}
+	points := make([]point, len(chunks))
+	for i, c := range chunks {
+		payload := make(map[string]interface{}, len(c.Metadata)+1)
+		for key, value := range c.Metadata {
+			payload[key] = value
+		}
+		payload["text"] = c.Text
+		points[i] = point{ID: c.ID, Vector: c.Vector, Payload: payload}
+	}
+	return qdrantRequest(ctx, "PUT", qdrantCollectionPath()+"/points?wait=true", map[string]interface{}{"points": points}, nil)
+}
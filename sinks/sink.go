@@ -0,0 +1,103 @@
+// Package sinks delivers exported documents to the systems they are retrieved
+// from. Targets are knowledge collection IDs, as mappings and routing rules
+// produce them; every sink maps them onto its own collections, filters or
+// indexes.
+package sinks
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// Document is an exported file prepared for delivery.
+type Document struct {
+	// Path is the local path of the export and identifies the document in
+	// every sink.
+	Path string
+	// Checksum is the checksum of the export as written, so sinks can skip
+	// documents they already hold.
+	Checksum string
+	// Content is the verified export with stripped sections removed and
+	// glossary terms expanded.
+	Content []byte
+	// Metadata describes the document (collection and, from its export
+	// record, document_id, workspace, title, url, classification, updated_at,
+	// tags and questions). Values are strings, string slices or times.
+	Metadata map[string]interface{}
+	// Name, ContentType and PlainText control how file-based sinks present
+	// the document.
+	Name        string
+	ContentType string
+	PlainText   bool
+}
+
+// Sink stores documents for retrieval.
+type Sink interface {
+	// Upload stores docs in a target, replacing their previous versions and
+	// skipping those already stored unchanged. A document that fails keeps
+	// its previous version; the others are still stored. It returns how many
+	// documents were stored and the failures of the rest.
+	Upload(ctx context.Context, target string, docs []Document) (int, error)
+	// Remove removes the documents of paths from a target.
+	Remove(ctx context.Context, target string, paths []string) error
+	// Clear removes every document from a target.
+	Clear(ctx context.Context, target string) error
+	// List returns the checksum of every document the scraper stored in a
+	// target, keyed by path.
+	List(ctx context.Context, target string) (map[string]string, error)
+}
+
+// Dropper is a Sink that keeps every target in a container of its own, such
+// as a Chroma collection. Drop deletes the container with its documents.
+type Dropper interface {
+	Drop(ctx context.Context, target string) error
+}
+
+// uncountedKey marks a context whose uploads are not counted.
+type uncountedKey struct{}
+
+// WithoutSyncCounts returns a copy of ctx whose uploads leave the sync counts
+// of the export records alone, as benchmark uploads must.
+func WithoutSyncCounts(ctx context.Context) context.Context {
+	return context.WithValue(ctx, uncountedKey{}, true)
+}
+
+// countSync counts an upload of the file at filePath.
+func countSync(ctx context.Context, filePath string) {
+	if ctx.Value(uncountedKey{}) != nil {
+		return
+	}
+	if err := models.IncrementSyncCount(utils.DB, filePath); err != nil {
+		logging.FromContext(ctx).Error("Error counting sync", "file", filePath, "error", err)
+	}
+}
+
+var (
+	sinksMu sync.RWMutex
+	sinks   = map[string]Sink{
+		"qdrant":        vectorSink{qdrantStore{}},
+		"chroma":        vectorSink{chromaStore{}},
+		"elasticsearch": vectorSink{elasticsearchStore{}},
+		"opensearch":    vectorSink{elasticsearchStore{}},
+		"openwebui":     openWebUISink{},
+	}
+)
+
+// Register makes a sink available under a name, for sinks implemented
+// outside this package.
+func Register(name string, sink Sink) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	sinks[name] = sink
+}
+
+// Get returns the sink registered under name, or nil.
+func Get(name string) Sink {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	return sinks[name]
+}
@@ -0,0 +1,291 @@
+package sinks
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/chunk"
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/embedding"
+	"github.com/mikeshootzz/outline-rag-scraper/timings"
+)
+
+// VectorChunkSize bounds chunks sent to vector stores when CHUNK_SIZE is not
+// set, since the whole document rarely fits an embedding model's context.
+const VectorChunkSize = 1500
+
+// vectorChunk is an embedded chunk of a file, ready for a vector store.
+type vectorChunk struct {
+	ID     string
+	Vector []float32
+	Text   string
+	// Metadata describes the chunk and its document; values are strings,
+	// ints, string slices or times.
+	Metadata map[string]interface{}
+}
+
+// vectorStore is a store that keeps embedded chunks itself instead of
+// receiving files.
+type vectorStore interface {
+	// listFiles returns the checksum indexed for every file of a knowledge
+	// collection, keyed by file path.
+	listFiles(ctx context.Context, knowledgeID string) (map[string]string, error)
+	// deleteFiles removes the chunks of filePaths from a knowledge collection.
+	deleteFiles(ctx context.Context, knowledgeID string, filePaths []string) error
+	// upsertChunks stores chunks in a knowledge collection.
+	upsertChunks(ctx context.Context, knowledgeID string, chunks []vectorChunk) error
+	// deleteChunksAfter removes the chunks of filePath numbered above keep,
+	// those left over from a longer previous version.
+	deleteChunksAfter(ctx context.Context, knowledgeID, filePath string, keep int) error
+}
+
+// keywordStore is a vectorStore that indexes whole documents for keyword
+// search: every file becomes a single chunk without a vector.
+type keywordStore interface {
+	vectorStore
+	keywordOnly()
+}
+
+// collectionStore is a vectorStore that keeps every knowledge ID in a
+// collection of its own.
+type collectionStore interface {
+	vectorStore
+	// dropCollection deletes the collection of a knowledge ID.
+	dropCollection(ctx context.Context, knowledgeID string) error
+}
+
+// vectorSink chunks and embeds documents into a vector store.
+type vectorSink struct {
+	store vectorStore
+}
+
+// vectorChunkID derives a stable UUID for a chunk, so re-indexing a document
+// overwrites its chunks instead of duplicating them.
+func vectorChunkID(knowledgeID, filePath string, index int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s\x00%s\x00%d", knowledgeID, filePath, index)))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// vectorText returns the text of an exported file that is embedded: the body
+// of Markdown and plain text exports, the content of JSON envelopes and HTML
+// exports as a whole.
+func vectorText(filePath string, content []byte) (string, error) {
+	switch filepath.Ext(filePath) {
+	case ".json":
+		var envelope struct {
+			Content string `json:"content"`
+		}
+		if err := json.Unmarshal(content, &envelope); err != nil {
+			return "", err
+		}
+		return envelope.Content, nil
+	case ".html":
+		return string(content), nil
+	}
+	_, body, found := strings.Cut(string(content), "\n\n")
+	if !found {
+		return string(content), nil
+	}
+	return body, nil
+}
+
+// prepareChunks chunks and embeds a document for a knowledge collection;
+// keyword stores get the whole text unembedded. The metadata of every chunk
+// carries its position and section and the document metadata.
+func (s vectorSink) prepareChunks(ctx context.Context, knowledgeID string, doc Document) ([]vectorChunk, error) {
+	text, err := vectorText(doc.Path, doc.Content)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []chunk.Chunk
+	vectors := [][]float32{nil}
+	if _, ok := s.store.(keywordStore); ok {
+		if strings.TrimSpace(text) == "" {
+			return nil, nil
+		}
+		chunks = []chunk.Chunk{{Text: text}}
+	} else {
+		size := config.ConfigInstance.ChunkSize
+		if size <= 0 {
+			size = VectorChunkSize
+		}
+		chunks = chunk.SplitWith(text, chunk.Options{
+			Strategy:     config.ConfigInstance.ChunkStrategy,
+			Size:         size,
+			Overlap:      config.ConfigInstance.ChunkOverlap,
+			HeadingLevel: config.ConfigInstance.ChunkHeadingLevel,
+		})
+		if len(chunks) == 0 {
+			return nil, nil
+		}
+		texts := make([]string, len(chunks))
+		for i, c := range chunks {
+			texts[i] = c.Text
+		}
+		if vectors, err = embedding.Embed(ctx, texts); err != nil {
+			return nil, err
+		}
+	}
+
+	prepared := make([]vectorChunk, len(chunks))
+	for i, c := range chunks {
+		metadata := make(map[string]interface{}, len(doc.Metadata)+7)
+		for key, value := range doc.Metadata {
+			metadata[key] = value
+		}
+		metadata["knowledge_id"] = knowledgeID
+		metadata["file_path"] = doc.Path
+		metadata["checksum"] = doc.Checksum
+		metadata["chunk"] = i + 1
+		metadata["chunks"] = len(chunks)
+		if c.Section != "" {
+			metadata["section"] = c.Section
+		}
+		if len(c.Languages) > 0 {
+			metadata["code_languages"] = c.Languages
+		}
+		prepared[i] = vectorChunk{
+			ID:       vectorChunkID(knowledgeID, doc.Path, i),
+			Vector:   vectors[i],
+			Text:     c.Text,
+			Metadata: metadata,
+		}
+	}
+	return prepared, nil
+}
+
+// replaceFile swaps the chunks of a file for new ones. Chunk IDs are stable,
+// so the new chunks overwrite the previous ones in place and only the surplus
+// of a longer previous version is deleted afterwards; a failed upsert leaves
+// the file searchable.
+func (s vectorSink) replaceFile(ctx context.Context, knowledgeID, filePath string, chunks []vectorChunk) error {
+	defer timings.Since(ctx, timings.Knowledge, time.Now())
+	if len(chunks) == 0 {
+		return s.store.deleteFiles(ctx, knowledgeID, []string{filePath})
+	}
+	if err := s.store.upsertChunks(ctx, knowledgeID, chunks); err != nil {
+		return err
+	}
+	if err := s.store.deleteChunksAfter(ctx, knowledgeID, filePath, len(chunks)); err != nil {
+		return err
+	}
+	countSync(ctx, filePath)
+	return nil
+}
+
+// replaceFiles swaps the chunks of every prepared file and returns how many
+// files were indexed. Other stores take one file at a time, so a failure
+// only affects that file; keyword stores index all files in bulk, overwriting
+// their single chunk in place.
+func (s vectorSink) replaceFiles(ctx context.Context, knowledgeID string, prepared map[string][]vectorChunk) (int, error) {
+	if _, ok := s.store.(keywordStore); !ok {
+		indexed := 0
+		var errs []error
+		for filePath, chunks := range prepared {
+			if err := s.replaceFile(ctx, knowledgeID, filePath, chunks); err != nil {
+				errs = append(errs, fmt.Errorf("error indexing file %s: %w", filePath, err))
+				continue
+			}
+			indexed++
+		}
+		return indexed, errors.Join(errs...)
+	}
+	defer timings.Since(ctx, timings.Knowledge, time.Now())
+	var empty []string
+	var chunks []vectorChunk
+	for filePath, fileChunks := range prepared {
+		if len(fileChunks) == 0 {
+			empty = append(empty, filePath)
+		}
+		chunks = append(chunks, fileChunks...)
+	}
+	if err := s.store.deleteFiles(ctx, knowledgeID, empty); err != nil {
+		return 0, fmt.Errorf("error removing empty files: %w", err)
+	}
+	if len(chunks) == 0 {
+		return 0, nil
+	}
+	// A bulk error names the chunks that failed; every other file is indexed.
+	var rejected map[string]string
+	err := s.store.upsertChunks(ctx, knowledgeID, chunks)
+	var bulkErr *bulkError
+	if errors.As(err, &bulkErr) {
+		rejected, err = bulkErr.Failed, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error indexing %d files: %w", len(prepared), err)
+	}
+	var errs []error
+	for _, c := range chunks {
+		filePath := c.Metadata["file_path"].(string)
+		if reason, ok := rejected[c.ID]; ok {
+			errs = append(errs, fmt.Errorf("error indexing file %s: %s", filePath, reason))
+			continue
+		}
+		countSync(ctx, filePath)
+	}
+	return len(chunks) - len(rejected), errors.Join(errs...)
+}
+
+// Upload re-embeds only documents whose checksum differs from the indexed one.
+func (s vectorSink) Upload(ctx context.Context, knowledgeID string, docs []Document) (int, error) {
+	indexed, err := s.store.listFiles(ctx, knowledgeID)
+	if err != nil {
+		return 0, fmt.Errorf("error listing indexed files: %w", err)
+	}
+	prepared := make(map[string][]vectorChunk)
+	var errs []error
+	for _, doc := range docs {
+		if indexed[doc.Path] == doc.Checksum {
+			continue
+		}
+		started := time.Now()
+		chunks, err := s.prepareChunks(ctx, knowledgeID, doc)
+		timings.Since(ctx, timings.Upload, started)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error preparing file %s: %w", doc.Path, err))
+			continue
+		}
+		prepared[doc.Path] = chunks
+	}
+	stored, err := s.replaceFiles(ctx, knowledgeID, prepared)
+	return stored, errors.Join(append(errs, err)...)
+}
+
+func (s vectorSink) Remove(ctx context.Context, knowledgeID string, filePaths []string) error {
+	defer timings.Since(ctx, timings.Knowledge, time.Now())
+	return s.store.deleteFiles(ctx, knowledgeID, filePaths)
+}
+
+func (s vectorSink) Clear(ctx context.Context, knowledgeID string) error {
+	indexed, err := s.store.listFiles(ctx, knowledgeID)
+	if err != nil {
+		return err
+	}
+	filePaths := make([]string, 0, len(indexed))
+	for filePath := range indexed {
+		filePaths = append(filePaths, filePath)
+	}
+	return s.store.deleteFiles(ctx, knowledgeID, filePaths)
+}
+
+// Drop deletes the collection of a knowledge ID, or its chunks in stores
+// that share one collection between knowledge IDs.
+func (s vectorSink) Drop(ctx context.Context, knowledgeID string) error {
+	if store, ok := s.store.(collectionStore); ok {
+		return store.dropCollection(ctx, knowledgeID)
+	}
+	return s.Clear(ctx, knowledgeID)
+}
+
+func (s vectorSink) List(ctx context.Context, knowledgeID string) (map[string]string, error) {
+	return s.store.listFiles(ctx, knowledgeID)
+}
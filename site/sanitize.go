@@ -0,0 +1,104 @@
+package site
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowedElements are the elements the Markdown renderer emits. Others are
+// replaced by their content.
+var allowedElements = map[atom.Atom]bool{
+	atom.P: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Em: true, atom.Strong: true, atom.Del: true, atom.Code: true, atom.Pre: true, atom.Blockquote: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.A: true, atom.Img: true, atom.Hr: true, atom.Br: true, atom.Sup: true, atom.Div: true,
+	atom.Table: true, atom.Thead: true, atom.Tbody: true, atom.Tr: true, atom.Th: true, atom.Td: true,
+}
+
+// droppedElements are removed together with their content.
+var droppedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Object: true, atom.Embed: true,
+	atom.Form: true, atom.Textarea: true, atom.Select: true, atom.Template: true, atom.Noscript: true,
+}
+
+// allowedAttributes are kept on allowed elements; href and src only with a
+// safe URL.
+var allowedAttributes = map[string]bool{
+	"href": true, "src": true, "alt": true, "title": true, "id": true, "class": true,
+	"align": true, "start": true, "rel": true,
+}
+
+// Sanitize keeps only the elements and attributes rendered Markdown consists
+// of, and drops links and images whose URL is not http, https, mailto or
+// relative, so a document cannot run script in a reader's browser.
+func Sanitize(fragment []byte) []byte {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(bytes.NewReader(fragment), body)
+	if err != nil {
+		return []byte(html.EscapeString(string(fragment)))
+	}
+	var buf bytes.Buffer
+	for _, node := range nodes {
+		for _, clean := range sanitizeNode(node) {
+			html.Render(&buf, clean)
+		}
+	}
+	return buf.Bytes()
+}
+
+// sanitizeNode returns the sanitized replacement of node: the node itself,
+// its sanitized children, or nothing.
+func sanitizeNode(node *html.Node) []*html.Node {
+	var children []*html.Node
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+		node.RemoveChild(child)
+		children = append(children, sanitizeNode(child)...)
+		child = next
+	}
+	switch node.Type {
+	case html.TextNode:
+		return []*html.Node{node}
+	case html.ElementNode:
+		if droppedElements[node.DataAtom] {
+			return nil
+		}
+		if !allowedElements[node.DataAtom] {
+			return children
+		}
+	default:
+		return nil
+	}
+	attrs := node.Attr[:0]
+	for _, attr := range node.Attr {
+		if attr.Namespace != "" || !allowedAttributes[attr.Key] {
+			continue
+		}
+		if (attr.Key == "href" || attr.Key == "src") && !safeURL(attr.Val) {
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	node.Attr = attrs
+	for _, child := range children {
+		node.AppendChild(child)
+	}
+	return []*html.Node{node}
+}
+
+// safeURL reports whether u is relative or uses http, https or mailto.
+func safeURL(u string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(u))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+// Package site renders the exported Markdown corpus into a small static HTML
+// site with collection navigation, giving readers without Outline access a
+// read-only mirror of exactly what the assistant sees.
+package site
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// page is a single rendered document.
+type page struct {
+	Title string
+	Href  string // Relative to the site root.
+}
+
+// collection groups the pages rendered from one subdirectory.
+type collection struct {
+	Name  string
+	Pages []page
+}
+
+// renderer drops raw HTML embedded in documents and links to untrusted
+// protocols so the mirror cannot serve scripts smuggled into wiki pages.
+var renderer = blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+	Flags: blackfriday.CommonHTMLFlags | blackfriday.SkipHTML | blackfriday.Safelink,
+})
+
+var layout = template.Must(template.New("layout").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { margin: 0; font-family: system-ui, sans-serif; display: flex; }
+nav { width: 18rem; padding: 1rem; background: #f6f7f9; min-height: 100vh; box-sizing: border-box; }
+nav h2 { font-size: 0.9rem; text-transform: uppercase; color: #555; margin-top: 1.5rem; }
+nav ul { list-style: none; padding: 0; margin: 0; }
+nav li { margin: 0.25rem 0; }
+main { flex: 1; padding: 1rem 2rem; max-width: 60rem; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.25rem 0.5rem; }
+pre { background: #f6f7f9; padding: 0.75rem; overflow-x: auto; }
+</style>
+</head>
+<body>
+<nav>
+<a href="{{.Root}}index.html"><strong>Corpus</strong></a>
+{{range .Collections}}<h2>{{.Name}}</h2>
+<ul>{{range .Pages}}<li><a href="{{$.Root}}{{.Href}}">{{.Title}}</a></li>{{end}}</ul>
+{{end}}</nav>
+<main>
+{{.Body}}
+</main>
+</body>
+</html>
+`))
+
+// RenderHTML renders Markdown to sanitized HTML, dropping embedded raw HTML.
+func RenderHTML(markdown []byte) []byte {
+	return Sanitize(blackfriday.Run(markdown, blackfriday.WithRenderer(renderer)))
+}
+
+// Generate renders every Markdown file below srcDir into outDir. The site is
+// built in a temporary directory next to outDir and swapped into place, so the
+// served site is never half-written.
+func Generate(srcDir, outDir string) error {
+	collections, err := scan(srcDir)
+	if err != nil {
+		return err
+	}
+
+	tmpDir := outDir + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	for _, c := range collections {
+		for _, p := range c.Pages {
+			source := filepath.Join(srcDir, filepath.FromSlash(strings.TrimSuffix(p.Href, ".html")+".md"))
+			markdown, err := os.ReadFile(source)
+			if err != nil {
+				return err
+			}
+			body := template.HTML(RenderHTML(markdown))
+			if err := render(filepath.Join(tmpDir, filepath.FromSlash(p.Href)), p.Title, rootFor(p.Href), body, collections); err != nil {
+				return err
+			}
+		}
+	}
+
+	var index strings.Builder
+	index.WriteString("<h1>Exported corpus</h1>\n")
+	for _, c := range collections {
+		fmt.Fprintf(&index, "<h2>%s</h2>\n<p>%d documents</p>\n", template.HTMLEscapeString(c.Name), len(c.Pages))
+	}
+	if err := render(filepath.Join(tmpDir, "index.html"), "Exported corpus", "", template.HTML(index.String()), collections); err != nil {
+		return err
+	}
+
+	oldDir := outDir + ".old"
+	if err := os.RemoveAll(oldDir); err != nil {
+		return err
+	}
+	if err := os.Rename(outDir, oldDir); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(tmpDir, outDir); err != nil {
+		return err
+	}
+	return os.RemoveAll(oldDir)
+}
+
+// scan collects the Markdown files below srcDir grouped by their top-level
+// directory. Files directly in srcDir are grouped under "Uncategorized".
+func scan(srcDir string) ([]collection, error) {
+	byName := make(map[string]*collection)
+	err := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != srcDir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".md") {
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		name := "Uncategorized"
+		if i := strings.Index(rel, "/"); i >= 0 {
+			name = strings.ReplaceAll(rel[:i], "_", " ")
+		}
+		c, ok := byName[name]
+		if !ok {
+			c = &collection{Name: name}
+			byName[name] = c
+		}
+		title := strings.ReplaceAll(strings.TrimSuffix(d.Name(), ".md"), "_", " ")
+		c.Pages = append(c.Pages, page{Title: title, Href: strings.TrimSuffix(rel, ".md") + ".html"})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	collections := make([]collection, 0, len(byName))
+	for _, c := range byName {
+		sort.Slice(c.Pages, func(i, j int) bool { return c.Pages[i].Title < c.Pages[j].Title })
+		collections = append(collections, *c)
+	}
+	sort.Slice(collections, func(i, j int) bool { return collections[i].Name < collections[j].Name })
+	return collections, nil
+}
+
+// rootFor returns the relative path from a page back to the site root.
+func rootFor(href string) string {
+	return strings.Repeat("../", strings.Count(href, "/"))
+}
+
+// render writes a single HTML page using the shared layout.
+func render(path, title, root string, body template.HTML, collections []collection) error {
+	var buf bytes.Buffer
+	err := layout.Execute(&buf, struct {
+		Title       string
+		Root        string
+		Body        template.HTML
+		Collections []collection
+	}{title, root, body, collections})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
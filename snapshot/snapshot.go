@@ -0,0 +1,227 @@
+// Package snapshot publishes the exported corpus as per-run directories.
+// After a successful export the working directory is copied into a temporary
+// run directory (with hard links, so unchanged files take no extra space) and
+// the corpus path, a symlink, is atomically swapped to it. Consumers therefore
+// never read a half-written corpus, and earlier runs stay on disk for
+// rollback and for diffing corpus states. Exports only ever replace files by
+// renaming, so the hard links of earlier runs keep their content. Because the
+// working directory may be written to while it is copied, callers pass a
+// verify function that checks the copy before it is published.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// runNameLayout names run directories so they sort chronologically.
+const runNameLayout = "20060102T150405Z"
+
+// Latest is the symlink in the runs directory pointing at the newest run.
+// Unlike the corpus symlink it is not moved by a rollback.
+const Latest = "latest"
+
+// ErrNoPreviousRun is returned by Rollback when no earlier run is on disk.
+var ErrNoPreviousRun = errors.New("no previous corpus run to roll back to")
+
+// ErrUnknownRun is returned by Rollback when the named run is not on disk.
+var ErrUnknownRun = errors.New("no such corpus run")
+
+// Publish copies workDir into a new run directory below runsDir, points
+// corpus and the Latest symlink at it and removes all but the keep newest
+// runs. It returns the new run directory. Unless verify is nil, it is called
+// with the copy before anything is published, and an error discards the copy.
+func Publish(workDir, corpus, runsDir string, keep int, verify func(dir string) error) (string, error) {
+	if err := os.MkdirAll(runsDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	runsDir, err := filepath.Abs(runsDir)
+	if err != nil {
+		return "", err
+	}
+	name := time.Now().UTC().Format(runNameLayout)
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(filepath.Join(runsDir, name)); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s-%d", time.Now().UTC().Format(runNameLayout), i)
+	}
+	run := filepath.Join(runsDir, name)
+	tmp := run + ".tmp"
+	if err := copyTree(workDir, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return "", fmt.Errorf("snapshot: copying %s: %w", workDir, err)
+	}
+	if verify != nil {
+		if err := verify(tmp); err != nil {
+			os.RemoveAll(tmp)
+			return "", fmt.Errorf("snapshot: %w", err)
+		}
+	}
+	if err := os.Rename(tmp, run); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	if err := swap(corpus, run); err != nil {
+		return "", err
+	}
+	if err := swap(filepath.Join(runsDir, Latest), name); err != nil {
+		return "", err
+	}
+	return run, prune(runsDir, keep)
+}
+
+// Rollback points corpus at the named run, or at the newest run published
+// before the current one when name is empty. It returns that run directory.
+func Rollback(corpus, runsDir, name string) (string, error) {
+	current := Current(corpus)
+	runs, err := Runs(runsDir)
+	if err != nil {
+		return "", err
+	}
+	target := ""
+	for _, run := range runs {
+		if name != "" {
+			if filepath.Base(run) == name {
+				target = run
+			}
+		} else if run < current || current == "" {
+			target = run
+		}
+	}
+	if name != "" && target == "" {
+		return "", ErrUnknownRun
+	}
+	if target == "" || target == current {
+		return "", ErrNoPreviousRun
+	}
+	return target, swap(corpus, target)
+}
+
+// Current returns the run directory corpus points at, or "" when it is not
+// a symlink yet.
+func Current(corpus string) string {
+	target, err := os.Readlink(corpus)
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+// Runs lists the complete run directories below runsDir, oldest first.
+func Runs(runsDir string) ([]string, error) {
+	runsDir, err := filepath.Abs(runsDir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(runsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var runs []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasSuffix(entry.Name(), ".tmp") {
+			runs = append(runs, filepath.Join(runsDir, entry.Name()))
+		}
+	}
+	sort.Strings(runs)
+	return runs, nil
+}
+
+// swap atomically points the symlink path at target by renaming a new
+// symlink over it.
+func swap(path, target string) error {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("snapshot: %s exists and is not a symlink; move it away to publish runs there", path)
+	}
+	link := path + ".swap"
+	os.Remove(link)
+	if err := os.Symlink(target, link); err != nil {
+		return err
+	}
+	if err := os.Rename(link, path); err != nil {
+		os.Remove(link)
+		return err
+	}
+	return utils.SyncDir(filepath.Dir(path))
+}
+
+// prune removes all but the keep newest runs, along with leftovers of
+// interrupted snapshots.
+func prune(runsDir string, keep int) error {
+	runs, err := Runs(runsDir)
+	if err != nil {
+		return err
+	}
+	kept := make(map[string]bool, keep)
+	for i := len(runs) - 1; i >= 0 && i >= len(runs)-keep; i-- {
+		kept[runs[i]] = true
+	}
+	entries, err := os.ReadDir(runsDir)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, entry := range entries {
+		path := filepath.Join(runsDir, entry.Name())
+		if entry.IsDir() && !kept[path] {
+			errs = append(errs, os.RemoveAll(path))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// copyTree recreates src below dst, hard-linking files where possible and
+// copying them otherwise (e.g. across volumes). Temporary files of writes in
+// progress are skipped.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, os.ModePerm)
+		}
+		if name := entry.Name(); strings.HasPrefix(name, ".") && strings.Contains(name, ".tmp-") {
+			return nil
+		}
+		if err := os.Link(path, target); err == nil {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
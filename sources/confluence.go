@@ -0,0 +1,230 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/adaptive"
+	"github.com/mikeshootzz/outline-rag-scraper/cache"
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/timings"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// Confluence reads pages from a Confluence Cloud site through its REST API.
+// Spaces are its collections, keyed by space key.
+type Confluence struct {
+	Workspace config.Workspace
+}
+
+// confluenceSpace is a space as the REST API returns it.
+type confluenceSpace struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Description struct {
+		Plain struct {
+			Value string `json:"value"`
+		} `json:"plain"`
+	} `json:"description"`
+}
+
+// collection converts a space to a collection.
+func (s confluenceSpace) collection() models.Collection {
+	return models.Collection{ID: s.Key, Name: s.Name, Description: s.Description.Plain.Value}
+}
+
+// confluencePage is a page as the REST API returns it.
+type confluencePage struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Space struct {
+		Key string `json:"key"`
+	} `json:"space"`
+	History struct {
+		CreatedDate time.Time `json:"createdDate"`
+		CreatedBy   struct {
+			DisplayName string `json:"displayName"`
+		} `json:"createdBy"`
+	} `json:"history"`
+	Version struct {
+		Number int       `json:"number"`
+		When   time.Time `json:"when"`
+	} `json:"version"`
+	Body struct {
+		Storage struct {
+			Value string `json:"value"`
+		} `json:"storage"`
+	} `json:"body"`
+}
+
+// confluenceSort maps EXPORT_SORT onto CQL fields.
+var confluenceSort = map[string]string{
+	"updatedAt": "lastmodified",
+	"createdAt": "created",
+	"title":     "title",
+}
+
+// get calls a REST endpoint below /rest/api and decodes the JSON response
+// into result. Rate-limited requests are retried after Retry-After seconds.
+func (c Confluence) get(ctx context.Context, path string, query url.Values, result interface{}) error {
+	endpoint := c.Workspace.APIBaseURL + "/rest/api" + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	limiter := adaptive.Source(endpoint)
+	for {
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(c.Workspace.Username, c.Workspace.APIToken)
+		req.Header.Set("Accept", "application/json")
+		started := time.Now()
+		resp, err := utils.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			limiter.Throttled()
+			wait := time.Second
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				wait = time.Duration(seconds) * time.Second
+			}
+			resp.Body.Close()
+			logging.FromContext(ctx).Info("Confluence rate limited: waiting before retrying", "wait", wait)
+			time.Sleep(wait)
+			continue
+		}
+		limiter.Observe(time.Since(started))
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			return fmt.Errorf("unexpected status: %s, body: %s", resp.Status, body)
+		}
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+}
+
+// spaceFilter returns the CQL restricting a search to a space, or to the
+// configured spaces.
+func (c Confluence) spaceFilter(collectionID string) string {
+	quote := func(key string) string { return strconv.Quote(key) }
+	if collectionID != "" {
+		return " AND space = " + quote(collectionID)
+	}
+	if len(c.Workspace.Spaces) == 0 {
+		return ""
+	}
+	keys := make([]string, len(c.Workspace.Spaces))
+	for i, key := range c.Workspace.Spaces {
+		keys[i] = quote(key)
+	}
+	return " AND space IN (" + strings.Join(keys, ",") + ")"
+}
+
+// ListDocuments searches current pages with CQL, in the configured sort order.
+func (c Confluence) ListDocuments(ctx context.Context, offset int, collectionID string) ([]models.Document, error) {
+	defer timings.Since(ctx, timings.List, time.Now())
+	cql := "type = page" + c.spaceFilter(collectionID) +
+		" ORDER BY " + confluenceSort[config.ConfigInstance.ExportSort] + " " + config.ConfigInstance.ExportDirection
+	var result struct {
+		Results []confluencePage `json:"results"`
+	}
+	err := c.get(ctx, "/content/search", url.Values{
+		"cql":    {cql},
+		"start":  {strconv.Itoa(offset)},
+		"limit":  {strconv.Itoa(config.ConfigInstance.Limit)},
+		"expand": {"space,history,version"},
+	}, &result)
+	if err != nil {
+		return nil, fmt.Errorf("ListDocuments: %w", err)
+	}
+	docs := make([]models.Document, len(result.Results))
+	for i, page := range result.Results {
+		created := page.History.CreatedDate
+		docs[i] = models.Document{
+			ID:           page.ID,
+			Title:        page.Title,
+			URLId:        page.ID,
+			CollectionId: page.Space.Key,
+			CreatedAt:    created,
+			UpdatedAt:    page.Version.When,
+			Revision:     page.Version.Number,
+			// Only current pages are searched, so every page is published.
+			PublishedAt: &created,
+		}
+		docs[i].CreatedBy.Name = page.History.CreatedBy.DisplayName
+	}
+	return docs, nil
+}
+
+// ExportDocument converts a page's storage format to Markdown.
+func (c Confluence) ExportDocument(ctx context.Context, documentID string) (string, error) {
+	defer timings.Since(ctx, timings.Export, time.Now())
+	var page confluencePage
+	if err := c.get(ctx, "/content/"+url.PathEscape(documentID), url.Values{"expand": {"body.storage"}}, &page); err != nil {
+		return "", fmt.Errorf("ExportDocument: %w", err)
+	}
+	return storageToMarkdown(page.Body.Storage.Value)
+}
+
+// ListCollections lists the global spaces, or the configured ones.
+func (c Confluence) ListCollections(ctx context.Context) ([]models.Collection, error) {
+	defer timings.Since(ctx, timings.List, time.Now())
+	var collections []models.Collection
+	for start := 0; ; start += config.ConfigInstance.Limit {
+		query := url.Values{
+			"start":  {strconv.Itoa(start)},
+			"limit":  {strconv.Itoa(config.ConfigInstance.Limit)},
+			"expand": {"description.plain"},
+		}
+		if len(c.Workspace.Spaces) > 0 {
+			query["spaceKey"] = c.Workspace.Spaces
+		} else {
+			query.Set("type", "global")
+		}
+		var result struct {
+			Results []confluenceSpace `json:"results"`
+		}
+		if err := c.get(ctx, "/space", query, &result); err != nil {
+			return nil, fmt.Errorf("ListCollections: %w", err)
+		}
+		if len(result.Results) == 0 {
+			return collections, nil
+		}
+		for _, space := range result.Results {
+			collections = append(collections, space.collection())
+		}
+	}
+}
+
+// Collection looks up a single space. It uses caching to avoid duplicate API
+// calls.
+func (c Confluence) Collection(ctx context.Context, collectionID string) (models.Collection, error) {
+	cacheKey := "confluence:space:" + c.Workspace.APIBaseURL + ":" + collectionID
+	var cached models.Collection
+	if cache.Get(cacheKey, &cached) {
+		return cached, nil
+	}
+	var space confluenceSpace
+	if err := c.get(ctx, "/space/"+url.PathEscape(collectionID), url.Values{"expand": {"description.plain"}}, &space); err != nil {
+		return models.Collection{}, fmt.Errorf("Collection: %w", err)
+	}
+	collection := space.collection()
+	cache.Set(cacheKey, collection)
+	return collection, nil
+}
+
+// DocumentURL returns the address of a page.
+func (c Confluence) DocumentURL(doc models.Document) string {
+	return c.Workspace.DocsBaseURL + "/pages/viewpage.action?pageId=" + url.QueryEscape(doc.ID)
+}
@@ -0,0 +1,430 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/timings"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// Git reads Markdown files from a Git repository (docs-as-code). Top-level
+// directories are its collections; Markdown files at the repository root
+// are not exported. Documents are keyed by their path in the repository (see
+// gitDocumentID) and dated by the commits that touched them. The clone is
+// fetched once per sync, by Refresh.
+type Git struct {
+	Workspace config.Workspace
+	// wiki, when set, makes the clone a wiki whose pages, at any depth, all
+	// belong to the collection of that ID.
+	wiki string
+}
+
+// gitFile is a Markdown file of a clone.
+type gitFile struct {
+	Path       string
+	Collection string
+	Title      string
+	Author     string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// gitClone is what the last fetch of a repository found.
+type gitClone struct {
+	files map[string]gitFile
+}
+
+var (
+	gitMu     sync.Mutex
+	gitClones = map[string]*gitClone{}
+)
+
+// run runs a git command. Credentials are passed through the environment,
+// so they neither show up in the process list nor end up in the clone's
+// configuration.
+func (g Git) run(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if g.Workspace.APIToken != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(g.Workspace.Username + ":" + g.Workspace.APIToken))
+		cmd.Env = append(cmd.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+credentials,
+		)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := utils.Run(ctx, cmd); err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// gitDocumentID returns the document ID of a path. Paths contain slashes,
+// which routes such as /documents/{id}/diff cannot match, so they are
+// base64url-encoded.
+func gitDocumentID(path string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(path))
+}
+
+// gitDocumentPath returns the path a document ID encodes.
+func gitDocumentPath(documentID string) (string, error) {
+	path, err := base64.RawURLEncoding.DecodeString(documentID)
+	if err != nil {
+		return "", fmt.Errorf("invalid document ID %q", documentID)
+	}
+	return string(path), nil
+}
+
+// Refresh clones the repository or fetches its branch. A sync calls it once
+// before listing, so every page of the listing sees the same commit.
+func (g Git) Refresh(ctx context.Context) error {
+	_, err := g.refresh(ctx)
+	return err
+}
+
+// files returns the Markdown files found by the last refresh, refreshing
+// only if the repository was not fetched yet.
+func (g Git) files(ctx context.Context) (map[string]gitFile, error) {
+	gitMu.Lock()
+	clone, ok := gitClones[g.Workspace.CheckoutDir]
+	gitMu.Unlock()
+	if ok {
+		return clone.files, nil
+	}
+	return g.refresh(ctx)
+}
+
+// refresh clones the repository or fetches its branch and returns the
+// Markdown files of the clone.
+func (g Git) refresh(ctx context.Context) (map[string]gitFile, error) {
+	gitMu.Lock()
+	defer gitMu.Unlock()
+	dir := g.Workspace.CheckoutDir
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		args := []string{"clone", "--quiet"}
+		if g.Workspace.Branch != "" {
+			args = append(args, "--branch", g.Workspace.Branch)
+		}
+		if _, err := g.run(ctx, append(args, "--", g.Workspace.APIBaseURL, dir)...); err != nil {
+			return nil, err
+		}
+	} else {
+		ref := g.Workspace.Branch
+		if ref == "" {
+			ref = "HEAD"
+		}
+		if _, err := g.run(ctx, "-C", dir, "fetch", "--quiet", "origin", ref); err != nil {
+			return nil, err
+		}
+		if _, err := g.run(ctx, "-C", dir, "reset", "--quiet", "--hard", "FETCH_HEAD"); err != nil {
+			return nil, err
+		}
+	}
+	files, err := g.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gitClones[dir] = &gitClone{files: files}
+	return files, nil
+}
+
+// scan collects the Markdown files of the clone's top-level directories and
+// dates them from a single pass over the history: the newest commit touching
+// a file is its update, the oldest its creation.
+func (g Git) scan(ctx context.Context) (map[string]gitFile, error) {
+	dir := g.Workspace.CheckoutDir
+	output, err := g.run(ctx, "-C", dir, "-c", "core.quotePath=false", "log", "--format=%x00%cI%x09%an", "--name-only")
+	if err != nil {
+		return nil, err
+	}
+	type history struct {
+		created, updated time.Time
+		author           string
+	}
+	histories := make(map[string]*history)
+	for _, entry := range strings.Split(string(output), "\x00") {
+		lines := strings.Split(strings.TrimSpace(entry), "\n")
+		date, author, _ := strings.Cut(lines[0], "\t")
+		when, err := time.Parse(time.RFC3339, date)
+		if err != nil {
+			continue
+		}
+		for _, path := range lines[1:] {
+			if path = strings.TrimSpace(path); path == "" {
+				continue
+			}
+			h, ok := histories[path]
+			if !ok {
+				h = &history{updated: when}
+				histories[path] = h
+			}
+			h.created, h.author = when, author
+		}
+	}
+
+	files := make(map[string]gitFile)
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") && path != dir {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Symlinks could point anywhere on the host, e.g. at its secrets.
+		if entry.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if entry.IsDir() || (ext != ".md" && ext != ".markdown") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		collection, _, nested := strings.Cut(rel, "/")
+		if g.wiki != "" {
+			// Sidebars and footers frame every page rather than being one.
+			if name := filepath.Base(rel); strings.HasPrefix(name, "_") {
+				return nil
+			}
+			collection, nested = g.wiki, true
+		}
+		if !nested {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		file := gitFile{Path: rel, Collection: collection, Title: markdownTitle(rel, string(content))}
+		if g.wiki != "" {
+			file.Title = wikiTitle(rel, string(content))
+		}
+		if h, ok := histories[rel]; ok {
+			file.CreatedAt, file.UpdatedAt, file.Author = h.created, h.updated, h.author
+		} else if info, err := entry.Info(); err == nil {
+			file.CreatedAt, file.UpdatedAt = info.ModTime(), info.ModTime()
+		}
+		files[rel] = file
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// splitFrontMatter separates a leading YAML front matter block from the
+// Markdown body.
+func splitFrontMatter(content string) (string, string) {
+	if !strings.HasPrefix(content, "---\n") {
+		return "", content
+	}
+	end := strings.Index(content[4:], "\n---")
+	if end < 0 {
+		return "", content
+	}
+	body := content[4+end+4:]
+	if i := strings.IndexByte(body, '\n'); i >= 0 {
+		body = body[i+1:]
+	} else {
+		body = ""
+	}
+	return content[4 : 4+end], body
+}
+
+// markdownTitle returns the title of a Markdown file: the title of its front
+// matter, else its first level-one heading, else its file name.
+func markdownTitle(path, content string) string {
+	front, body := splitFrontMatter(content)
+	if title := frontMatterTitle(front); title != "" {
+		return title
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if title, ok := strings.CutPrefix(line, "# "); ok && strings.TrimSpace(title) != "" {
+			return strings.TrimSpace(title)
+		}
+	}
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// wikiTitle returns the title of a wiki page: the title of its front matter,
+// else its file name with dashes read as spaces, as wikis display it.
+func wikiTitle(path, content string) string {
+	front, _ := splitFrontMatter(content)
+	if title := frontMatterTitle(front); title != "" {
+		return title
+	}
+	return strings.ReplaceAll(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), "-", " ")
+}
+
+// frontMatterTitle returns the title field of YAML front matter.
+func frontMatterTitle(front string) string {
+	for _, line := range strings.Split(front, "\n") {
+		if value, ok := strings.CutPrefix(line, "title:"); ok {
+			if title := strings.Trim(strings.TrimSpace(value), `"'`); title != "" {
+				return title
+			}
+		}
+	}
+	return ""
+}
+
+// document converts a file to a document with the given ID.
+func (f gitFile) document(id string) models.Document {
+	created := f.CreatedAt
+	doc := models.Document{
+		ID:           id,
+		Title:        f.Title,
+		URLId:        id,
+		CollectionId: f.Collection,
+		CreatedAt:    created,
+		UpdatedAt:    f.UpdatedAt,
+		// Every committed file is published.
+		PublishedAt: &created,
+	}
+	doc.CreatedBy.Name = f.Author
+	return doc
+}
+
+// ListDocuments returns a page of the repository's Markdown files in the
+// configured sort order.
+func (g Git) ListDocuments(ctx context.Context, offset int, collectionID string) ([]models.Document, error) {
+	defer timings.Since(ctx, timings.List, time.Now())
+	files, err := g.files(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListDocuments: %w", err)
+	}
+	var docs []models.Document
+	for _, file := range files {
+		if collectionID == "" || file.Collection == collectionID {
+			docs = append(docs, file.document(gitDocumentID(file.Path)))
+		}
+	}
+	return pageDocuments(docs, offset), nil
+}
+
+// pageDocuments sorts documents in the configured order and returns the page
+// starting at offset.
+func pageDocuments(docs []models.Document, offset int) []models.Document {
+	sort.Slice(docs, func(i, j int) bool {
+		a, b := docs[i], docs[j]
+		if config.ConfigInstance.ExportDirection == "DESC" {
+			a, b = b, a
+		}
+		switch config.ConfigInstance.ExportSort {
+		case "updatedAt":
+			if !a.UpdatedAt.Equal(b.UpdatedAt) {
+				return a.UpdatedAt.Before(b.UpdatedAt)
+			}
+		case "createdAt":
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+		case "title":
+			if a.Title != b.Title {
+				return a.Title < b.Title
+			}
+		}
+		return a.ID < b.ID
+	})
+	if offset >= len(docs) {
+		return nil
+	}
+	end := offset + config.ConfigInstance.Limit
+	if end > len(docs) {
+		end = len(docs)
+	}
+	return docs[offset:end]
+}
+
+// ExportDocument returns a file's Markdown without its front matter.
+func (g Git) ExportDocument(ctx context.Context, documentID string) (string, error) {
+	path, err := gitDocumentPath(documentID)
+	if err != nil {
+		return "", fmt.Errorf("ExportDocument: %w", err)
+	}
+	return g.exportFile(ctx, path)
+}
+
+// exportFile returns the Markdown of the file at path, as listed by the last
+// refresh, without its front matter.
+func (g Git) exportFile(ctx context.Context, path string) (string, error) {
+	defer timings.Since(ctx, timings.Export, time.Now())
+	files, err := g.files(ctx)
+	if err != nil {
+		return "", fmt.Errorf("ExportDocument: %w", err)
+	}
+	if _, ok := files[path]; !ok {
+		return "", fmt.Errorf("ExportDocument: %s is not a Markdown file of a collection", path)
+	}
+	filePath := filepath.Join(g.Workspace.CheckoutDir, filepath.FromSlash(path))
+	// The checkout may have changed since the listing; never follow a link.
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		return "", fmt.Errorf("ExportDocument: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("ExportDocument: %s is not a regular file", path)
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("ExportDocument: %w", err)
+	}
+	_, body := splitFrontMatter(string(content))
+	return body, nil
+}
+
+// ListCollections returns the top-level directories holding Markdown files.
+func (g Git) ListCollections(ctx context.Context) ([]models.Collection, error) {
+	defer timings.Since(ctx, timings.List, time.Now())
+	files, err := g.files(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListCollections: %w", err)
+	}
+	seen := make(map[string]bool)
+	var collections []models.Collection
+	for _, file := range files {
+		if !seen[file.Collection] {
+			seen[file.Collection] = true
+			collections = append(collections, models.Collection{ID: file.Collection, Name: file.Collection})
+		}
+	}
+	sort.Slice(collections, func(i, j int) bool { return collections[i].ID < collections[j].ID })
+	return collections, nil
+}
+
+// DocumentURL returns the address of a file below GIT_DOCS_BASE_URL, or
+// nothing when it is not set.
+func (g Git) DocumentURL(doc models.Document) string {
+	path, err := gitDocumentPath(doc.ID)
+	if g.Workspace.DocsBaseURL == "" || err != nil {
+		return ""
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return g.Workspace.DocsBaseURL + "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,232 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/adaptive"
+	"github.com/mikeshootzz/outline-rag-scraper/cache"
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/timings"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// Outline reads documents from an Outline workspace through its API.
+type Outline struct {
+	Workspace config.Workspace
+}
+
+// DoWithRateLimit sends a request to the Outline API and respects rate limiting.
+// If a 429 status code is returned, it reads the "Retry-After" header (which
+// specifies the number of milliseconds to wait) before retrying. Latency and
+// rate limiting feed the adaptive export concurrency.
+func DoWithRateLimit(req *http.Request) (*http.Response, error) {
+	limiter := adaptive.Source(req.URL.String())
+	for {
+		started := time.Now()
+		resp, err := utils.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		// If we are not rate-limited, return the response.
+		if resp.StatusCode != http.StatusTooManyRequests {
+			limiter.Observe(time.Since(started))
+			return resp, nil
+		}
+		limiter.Throttled()
+
+		// Otherwise, read the Retry-After header.
+		retryAfterStr := resp.Header.Get("Retry-After")
+		var waitDuration time.Duration
+		if retryAfterStr != "" {
+			ms, err := strconv.Atoi(retryAfterStr)
+			if err != nil {
+				waitDuration = 1 * time.Second
+			} else {
+				waitDuration = time.Duration(ms) * time.Millisecond
+			}
+		} else {
+			waitDuration = 1 * time.Second
+		}
+		logging.FromContext(req.Context()).Info("Rate limited: waiting before retrying", "wait", waitDuration)
+		resp.Body.Close() // Make sure to close the response body before sleeping.
+		time.Sleep(waitDuration)
+	}
+}
+
+// ListDocuments retrieves a page of documents from documents.list, using the
+// configured sort order.
+func (o Outline) ListDocuments(ctx context.Context, offset int, collectionID string) ([]models.Document, error) {
+	defer timings.Since(ctx, timings.List, time.Now())
+	url := fmt.Sprintf("%s/documents.list", o.Workspace.APIBaseURL)
+	payload := map[string]interface{}{
+		"offset":    offset,
+		"limit":     config.ConfigInstance.Limit,
+		"sort":      config.ConfigInstance.ExportSort,
+		"direction": config.ConfigInstance.ExportDirection,
+	}
+	if collectionID != "" {
+		payload["collectionId"] = collectionID
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+o.Workspace.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := DoWithRateLimit(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ListDocuments: unexpected status: %s", resp.Status)
+	}
+	var docsResp models.DocumentsResponse
+	if err = json.NewDecoder(resp.Body).Decode(&docsResp); err != nil {
+		return nil, err
+	}
+	return docsResp.Data, nil
+}
+
+// ListCollections retrieves all collections from collections.list.
+func (o Outline) ListCollections(ctx context.Context) ([]models.Collection, error) {
+	defer timings.Since(ctx, timings.List, time.Now())
+	var collections []models.Collection
+	for offset := 0; ; offset += config.ConfigInstance.Limit {
+		url := fmt.Sprintf("%s/collections.list", o.Workspace.APIBaseURL)
+		payload := map[string]interface{}{
+			"offset": offset,
+			"limit":  config.ConfigInstance.Limit,
+		}
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+o.Workspace.APIToken)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := DoWithRateLimit(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("ListCollections: unexpected status: %s", resp.Status)
+		}
+		var collResp models.CollectionsResponse
+		err = json.NewDecoder(resp.Body).Decode(&collResp)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(collResp.Data) == 0 {
+			return collections, nil
+		}
+		collections = append(collections, collResp.Data...)
+	}
+}
+
+// Collection retrieves the collection info (name, icon, color) for a given
+// collectionID from collections.info. It uses caching to avoid duplicate API
+// calls.
+func (o Outline) Collection(ctx context.Context, collectionID string) (models.Collection, error) {
+	// Check if the collection is already in the cache.
+	cacheKey := "outline:collection:" + o.Workspace.APIBaseURL + ":" + collectionID
+	var cached models.Collection
+	if cache.Get(cacheKey, &cached) {
+		return cached, nil
+	}
+
+	// Make API call to fetch the collection info.
+	url := fmt.Sprintf("%s/collections.info", o.Workspace.APIBaseURL)
+	payload := map[string]interface{}{
+		"id": collectionID,
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return models.Collection{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return models.Collection{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+o.Workspace.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := DoWithRateLimit(req)
+	if err != nil {
+		return models.Collection{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return models.Collection{}, fmt.Errorf("Collection: unexpected status: %s", resp.Status)
+	}
+
+	var collResp struct {
+		Data models.Collection `json:"data"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&collResp); err != nil {
+		return models.Collection{}, err
+	}
+
+	// Cache the collection for future lookups.
+	cache.Set(cacheKey, collResp.Data)
+
+	return collResp.Data, nil
+}
+
+// ExportDocument exports a document's Markdown from documents.export.
+func (o Outline) ExportDocument(ctx context.Context, documentID string) (string, error) {
+	defer timings.Since(ctx, timings.Export, time.Now())
+	url := fmt.Sprintf("%s/documents.export", o.Workspace.APIBaseURL)
+	payload := map[string]interface{}{
+		"id": documentID,
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+o.Workspace.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := DoWithRateLimit(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("ExportDocument: unexpected status: %s", resp.Status)
+	}
+	var expResp models.ExportResponse
+	if err = json.NewDecoder(resp.Body).Decode(&expResp); err != nil {
+		return "", err
+	}
+	return expResp.Data, nil
+}
+
+// DocumentURL returns the Outline URL of a document.
+func (o Outline) DocumentURL(doc models.Document) string {
+	return fmt.Sprintf("%s/%s-%s", o.Workspace.DocsBaseURL, utils.SanitizeURLTitle(doc.Title), doc.URLId)
+}
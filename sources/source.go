@@ -0,0 +1,78 @@
+// Package sources reads documents from the wikis the scraper exports. Every
+// configured workspace is backed by a Source; the export pipeline only sees
+// documents, collections and exported Markdown, so other wikis can be added
+// next to Outline.
+package sources
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+)
+
+// Source lists and exports the documents of a workspace.
+type Source interface {
+	// ListDocuments returns a page of documents, starting at offset and
+	// holding at most config.Limit documents; an empty page ends the listing.
+	// If collectionID is set, only that collection is listed.
+	ListDocuments(ctx context.Context, offset int, collectionID string) ([]models.Document, error)
+	// ExportDocument returns the Markdown of a document.
+	ExportDocument(ctx context.Context, documentID string) (string, error)
+	// ListCollections returns every collection of the workspace.
+	ListCollections(ctx context.Context) ([]models.Collection, error)
+	// DocumentURL returns the address of a document in the wiki.
+	DocumentURL(doc models.Document) string
+}
+
+// collectionGetter is implemented by sources that look up a single
+// collection cheaper than listing them all.
+type collectionGetter interface {
+	Collection(ctx context.Context, collectionID string) (models.Collection, error)
+}
+
+// refresher is implemented by sources that read a local mirror of the wiki,
+// which is updated once per sync rather than on every listing.
+type refresher interface {
+	Refresh(ctx context.Context) error
+}
+
+// Refresh updates the local mirror of a source, if it reads one. A sync calls
+// it before listing, so every page of the listing sees the same state.
+func Refresh(ctx context.Context, src Source) error {
+	if r, ok := src.(refresher); ok {
+		return r.Refresh(ctx)
+	}
+	return nil
+}
+
+// For returns the source of a workspace.
+func For(ws config.Workspace) Source {
+	switch ws.Kind {
+	case "confluence":
+		return Confluence{Workspace: ws}
+	case "git":
+		return Git{Workspace: ws}
+	case "github-wiki", "gitlab-wiki":
+		return Wiki{Workspace: ws}
+	}
+	return Outline{Workspace: ws}
+}
+
+// Collection returns a collection of a source.
+func Collection(ctx context.Context, src Source, collectionID string) (models.Collection, error) {
+	if getter, ok := src.(collectionGetter); ok {
+		return getter.Collection(ctx, collectionID)
+	}
+	collections, err := src.ListCollections(ctx)
+	if err != nil {
+		return models.Collection{}, err
+	}
+	for _, collection := range collections {
+		if collection.ID == collectionID {
+			return collection, nil
+		}
+	}
+	return models.Collection{}, fmt.Errorf("collection %s not found", collectionID)
+}
@@ -0,0 +1,347 @@
+package sources
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// blankLines matches runs of blank lines left between blocks.
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// selfClosing matches self-closing ac: and ri: elements, which HTML parsing
+// would leave open around the content that follows them.
+var selfClosing = regexp.MustCompile(`<((?:ac|ri):[a-z-]+)([^<>]*?)\s*/>`)
+
+// cdata matches CDATA sections, which HTML parsing would cut at the first ">".
+var cdata = regexp.MustCompile(`(?s)<!\[CDATA\[(.*?)\]\]>`)
+
+// storageToMarkdown converts Confluence storage format (XHTML with ac: and
+// ri: elements) to Markdown. Code, panel and expand macros are kept; other
+// macros keep their body; images and attachments are dropped.
+func storageToMarkdown(storage string) (string, error) {
+	storage = selfClosing.ReplaceAllString(storage, "<$1$2></$1>")
+	storage = cdata.ReplaceAllStringFunc(storage, func(section string) string {
+		return html.EscapeString(cdata.FindStringSubmatch(section)[1])
+	})
+	nodes, err := html.ParseFragment(strings.NewReader(storage), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	w := storageWriter{out: &b}
+	for _, n := range nodes {
+		w.block(n)
+	}
+	markdown := blankLines.ReplaceAllString(b.String(), "\n\n")
+	return strings.TrimSpace(markdown) + "\n", nil
+}
+
+// storageWriter renders storage format nodes as Markdown.
+type storageWriter struct {
+	out *strings.Builder
+	// lists holds the markers of the enclosing lists, innermost last.
+	lists []string
+}
+
+// attr returns an attribute of a node.
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// child returns the first child element of a node with the given name and,
+// if set, ac:name attribute.
+func child(n *html.Node, name, acName string) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == name && (acName == "" || attr(c, "ac:name") == acName) {
+			return c
+		}
+	}
+	return nil
+}
+
+// rawText returns the text below a node as is.
+func rawText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(rawText(c))
+	}
+	return b.String()
+}
+
+// inline renders the inline content below a node on a single line.
+func (w *storageWriter) inline(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(w.inlineNode(c))
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func (w *storageWriter) inlineNode(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return n.Data
+	case html.ElementNode:
+	default:
+		return ""
+	}
+	text := func() string { return strings.TrimSpace(w.inline(n)) }
+	switch n.Data {
+	case "strong", "b":
+		if t := text(); t != "" {
+			return "**" + t + "**"
+		}
+	case "em", "i":
+		if t := text(); t != "" {
+			return "*" + t + "*"
+		}
+	case "s", "del":
+		if t := text(); t != "" {
+			return "~~" + t + "~~"
+		}
+	case "code":
+		return "`" + rawText(n) + "`"
+	case "br":
+		return " "
+	case "a":
+		if href := attr(n, "href"); href != "" {
+			return fmt.Sprintf("[%s](%s)", text(), href)
+		}
+		return text()
+	case "ac:link":
+		// Links to pages and attachments keep their text; the target lives
+		// in another document.
+		if body := child(n, "ac:link-body", ""); body != nil {
+			return w.inline(body)
+		}
+		if body := child(n, "ac:plain-text-link-body", ""); body != nil {
+			return rawText(body)
+		}
+		if page := child(n, "ri:page", ""); page != nil {
+			return attr(page, "ri:content-title")
+		}
+		return ""
+	case "ac:image", "ac:parameter", "ac:emoticon":
+		return ""
+	case "ac:structured-macro":
+		if body := child(n, "ac:rich-text-body", ""); body != nil {
+			return w.inline(body)
+		}
+		return ""
+	}
+	return w.inline(n)
+}
+
+// line writes a paragraph-like block followed by a blank line.
+func (w *storageWriter) line(text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	w.out.WriteString(text)
+	w.out.WriteString("\n\n")
+}
+
+// block renders a block-level node.
+func (w *storageWriter) block(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.line(strings.Join(strings.Fields(n.Data), " "))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		w.line(strings.Repeat("#", int(n.Data[1]-'0')) + " " + w.inline(n))
+	case "p":
+		w.line(w.inline(n))
+	case "hr":
+		w.line("---")
+	case "pre":
+		w.code("", rawText(n))
+	case "blockquote":
+		w.quote(n, "")
+	case "ul", "ol", "ac:task-list":
+		w.list(n)
+		if len(w.lists) == 0 {
+			w.out.WriteString("\n")
+		}
+	case "table":
+		w.table(n)
+	case "ac:structured-macro":
+		w.macro(n)
+	case "ac:image", "ac:parameter":
+	default:
+		w.children(n)
+	}
+}
+
+func (w *storageWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.block(c)
+	}
+}
+
+// code writes a fenced code block.
+func (w *storageWriter) code(language, text string) {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	w.line(fence + language + "\n" + strings.TrimRight(text, "\n") + "\n" + fence)
+}
+
+// quote renders the blocks below n as a blockquote, led by label.
+func (w *storageWriter) quote(n *html.Node, label string) {
+	var b strings.Builder
+	inner := storageWriter{out: &b}
+	inner.children(n)
+	text := strings.TrimSpace(b.String())
+	if label != "" {
+		text = "**" + label + ":** " + text
+	}
+	if text == "" {
+		return
+	}
+	w.line("> " + strings.ReplaceAll(text, "\n", "\n> "))
+}
+
+// macro renders a structured macro.
+func (w *storageWriter) macro(n *html.Node) {
+	name := attr(n, "ac:name")
+	switch name {
+	case "code", "noformat":
+		language := ""
+		if param := child(n, "ac:parameter", "language"); param != nil {
+			language = rawText(param)
+		}
+		if body := child(n, "ac:plain-text-body", ""); body != nil {
+			w.code(language, rawText(body))
+		}
+	case "info", "note", "tip", "warning", "panel":
+		if body := child(n, "ac:rich-text-body", ""); body != nil {
+			label := ""
+			if name != "panel" {
+				label = strings.ToUpper(name[:1]) + name[1:]
+			}
+			if param := child(n, "ac:parameter", "title"); param != nil {
+				label = rawText(param)
+			}
+			w.quote(body, label)
+		}
+	case "expand":
+		if param := child(n, "ac:parameter", "title"); param != nil {
+			w.line("**" + rawText(param) + "**")
+		}
+		fallthrough
+	default:
+		if body := child(n, "ac:rich-text-body", ""); body != nil {
+			w.children(body)
+		}
+	}
+}
+
+// list renders list items, indenting nested lists.
+func (w *storageWriter) list(n *html.Node) {
+	marker := "-"
+	switch n.Data {
+	case "ol":
+		marker = "1."
+	case "ac:task-list":
+		marker = "- [ ]"
+	}
+	w.lists = append(w.lists, marker)
+	defer func() { w.lists = w.lists[:len(w.lists)-1] }()
+	indent := strings.Repeat("  ", len(w.lists)-1)
+	for item := n.FirstChild; item != nil; item = item.NextSibling {
+		if item.Type != html.ElementNode || (item.Data != "li" && item.Data != "ac:task") {
+			continue
+		}
+		itemMarker := marker
+		body := item
+		if item.Data == "ac:task" {
+			if status := child(item, "ac:task-status", ""); status != nil && rawText(status) == "complete" {
+				itemMarker = "- [x]"
+			}
+			if body = child(item, "ac:task-body", ""); body == nil {
+				continue
+			}
+		}
+		// Text and inline elements form the item line; nested lists follow it.
+		var text strings.Builder
+		var nested []*html.Node
+		for c := body.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && (c.Data == "ul" || c.Data == "ol" || c.Data == "ac:task-list") {
+				nested = append(nested, c)
+				continue
+			}
+			if c.Type == html.ElementNode && c.Data == "p" {
+				text.WriteString(" " + w.inline(c) + " ")
+				continue
+			}
+			text.WriteString(w.inlineNode(c))
+		}
+		w.out.WriteString(indent + itemMarker + " " + strings.Join(strings.Fields(text.String()), " ") + "\n")
+		for _, list := range nested {
+			w.list(list)
+		}
+	}
+}
+
+// table renders a table with its first row as the header.
+func (w *storageWriter) table(n *html.Node) {
+	var rows [][]string
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if c.Data != "tr" {
+				collect(c)
+				continue
+			}
+			var row []string
+			for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.Data == "th" || cell.Data == "td") {
+					row = append(row, strings.ReplaceAll(w.inline(cell), "|", `\|`))
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	collect(n)
+	if len(rows) == 0 {
+		return
+	}
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	var b strings.Builder
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			b.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+		}
+	}
+	w.line(strings.TrimRight(b.String(), "\n"))
+}
@@ -0,0 +1,177 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/cache"
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+	"github.com/mikeshootzz/outline-rag-scraper/timings"
+	"github.com/mikeshootzz/outline-rag-scraper/utils"
+)
+
+// Wiki reads the project wikis of a GitHub or GitLab host (workspace kinds
+// "github-wiki" and "gitlab-wiki"). Every project is a collection. Pages are
+// read from the wiki's Git repository, since GitHub has no wiki API and
+// GitLab's does not date pages; the REST APIs describe the projects.
+// Documents are keyed by project and page path, e.g. acme/ops/Home.md,
+// encoded like Git document IDs.
+type Wiki struct {
+	Workspace config.Workspace
+}
+
+// clone returns the Git source of a project's wiki repository.
+func (w Wiki) clone(project string) Git {
+	ws := w.Workspace
+	ws.APIBaseURL = w.Workspace.DocsBaseURL + "/" + project + ".wiki.git"
+	ws.CheckoutDir = filepath.Join(w.Workspace.CheckoutDir, utils.SanitizeFilename(strings.ReplaceAll(project, "/", "__")))
+	return Git{Workspace: ws, wiki: project}
+}
+
+// project splits a document ID into its project and page path.
+func (w Wiki) project(documentID string) (string, string, bool) {
+	path, err := gitDocumentPath(documentID)
+	if err != nil {
+		return "", "", false
+	}
+	best := ""
+	for _, project := range w.Workspace.Projects {
+		if strings.HasPrefix(path, project+"/") && len(project) > len(best) {
+			best = project
+		}
+	}
+	return best, strings.TrimPrefix(path, best+"/"), best != ""
+}
+
+// Refresh clones or fetches every wiki, once per sync like Git.Refresh.
+func (w Wiki) Refresh(ctx context.Context) error {
+	for _, project := range w.Workspace.Projects {
+		if err := w.clone(project).Refresh(ctx); err != nil {
+			return fmt.Errorf("%s: %w", project, err)
+		}
+	}
+	return nil
+}
+
+// ListDocuments returns a page of the pages of every wiki, or the one of
+// collectionID, in the configured sort order.
+func (w Wiki) ListDocuments(ctx context.Context, offset int, collectionID string) ([]models.Document, error) {
+	defer timings.Since(ctx, timings.List, time.Now())
+	var docs []models.Document
+	for _, project := range w.Workspace.Projects {
+		if collectionID != "" && project != collectionID {
+			continue
+		}
+		files, err := w.clone(project).files(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("ListDocuments: %s: %w", project, err)
+		}
+		for _, file := range files {
+			docs = append(docs, file.document(gitDocumentID(project+"/"+file.Path)))
+		}
+	}
+	return pageDocuments(docs, offset), nil
+}
+
+// ExportDocument returns a page's Markdown without its front matter.
+func (w Wiki) ExportDocument(ctx context.Context, documentID string) (string, error) {
+	project, path, ok := w.project(documentID)
+	if !ok {
+		return "", fmt.Errorf("ExportDocument: %s belongs to no configured project", documentID)
+	}
+	return w.clone(project).exportFile(ctx, path)
+}
+
+// ListCollections describes every configured project.
+func (w Wiki) ListCollections(ctx context.Context) ([]models.Collection, error) {
+	defer timings.Since(ctx, timings.List, time.Now())
+	collections := make([]models.Collection, len(w.Workspace.Projects))
+	for i, project := range w.Workspace.Projects {
+		collections[i], _ = w.Collection(ctx, project)
+	}
+	return collections, nil
+}
+
+// Collection describes a project from the host's REST API, falling back to
+// its path when the API cannot be reached. It uses caching to avoid
+// duplicate API calls.
+func (w Wiki) Collection(ctx context.Context, collectionID string) (models.Collection, error) {
+	cacheKey := w.Workspace.Kind + ":project:" + w.Workspace.APIBaseURL + ":" + collectionID
+	var cached models.Collection
+	if cache.Get(cacheKey, &cached) {
+		return cached, nil
+	}
+	collection := models.Collection{ID: collectionID, Name: collectionID}
+	var project struct {
+		FullName          string `json:"full_name"`
+		NameWithNamespace string `json:"name_with_namespace"`
+		Description       string `json:"description"`
+	}
+	endpoint := w.Workspace.APIBaseURL + "/repos/" + collectionID
+	if w.Workspace.Kind == "gitlab-wiki" {
+		endpoint = w.Workspace.APIBaseURL + "/projects/" + url.PathEscape(collectionID)
+	}
+	if err := w.get(ctx, endpoint, &project); err != nil {
+		logging.FromContext(ctx).Error("Error describing wiki project", "project", collectionID, "error", err)
+		return collection, nil
+	}
+	if name := project.FullName + project.NameWithNamespace; name != "" {
+		collection.Name = name
+	}
+	collection.Description = project.Description
+	cache.Set(cacheKey, collection)
+	return collection, nil
+}
+
+// get calls a REST endpoint of the host and decodes the JSON response into
+// result.
+func (w Wiki) get(ctx context.Context, endpoint string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if w.Workspace.APIToken != "" {
+		if w.Workspace.Kind == "gitlab-wiki" {
+			req.Header.Set("PRIVATE-TOKEN", w.Workspace.APIToken)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+w.Workspace.APIToken)
+		}
+	}
+	resp, err := utils.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status: %s, body: %s", resp.Status, body)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// DocumentURL returns the address of a page in the wiki.
+func (w Wiki) DocumentURL(doc models.Document) string {
+	project, path, ok := w.project(doc.ID)
+	if !ok {
+		return ""
+	}
+	segments := strings.Split(strings.TrimSuffix(path, filepath.Ext(path)), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	wiki := "/wiki/"
+	if w.Workspace.Kind == "gitlab-wiki" {
+		wiki = "/-/wikis/"
+	}
+	return w.Workspace.DocsBaseURL + "/" + project + wiki + strings.Join(segments, "/")
+}
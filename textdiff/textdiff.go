@@ -0,0 +1,197 @@
+// Package textdiff renders line-based unified diffs, as produced by
+// diff -u, for reviewing how documents changed between exports.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxEdits bounds the edit distance searched for a minimal diff. Texts that
+// differ by more lines are rendered as replacing every differing line, which
+// is still a correct diff, only a longer one.
+const maxEdits = 1000
+
+// op is a line of an edit script: kept (' '), removed ('-') or added ('+').
+type op struct {
+	kind byte
+	line string
+}
+
+// splitLines splits text into lines that keep their line endings.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Unified returns the unified diff turning a into b with context lines of
+// context around every change, or "" when they are equal.
+func Unified(oldName, newName, a, b string, context int) string {
+	if a == b {
+		return ""
+	}
+	ops := edits(splitLines(a), splitLines(b))
+
+	// Line numbers before every op, for hunk headers.
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	for i, o := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if o.kind != '+' {
+			aPos[i+1]++
+		}
+		if o.kind != '-' {
+			bPos[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+		start := max(i-context, 0)
+		end := i
+		// Merge changes separated by less than two contexts into one hunk.
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next < len(ops) && next-end <= 2*context {
+				end = next
+				continue
+			}
+			break
+		}
+		stop := min(end+context, len(ops))
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aPos[start], aPos[stop]-aPos[start]), hunkRange(bPos[start], bPos[stop]-bPos[start]))
+		for _, o := range ops[start:stop] {
+			out.WriteByte(o.kind)
+			out.WriteString(o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+	return out.String()
+}
+
+// hunkRange formats the start and length of a hunk side; an empty side
+// names the line it follows.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// edits returns an edit script turning a into b, using Myers' algorithm on
+// the lines between their common prefix and suffix.
+func edits(a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var ops []op
+	for _, line := range a[:prefix] {
+		ops = append(ops, op{' ', line})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, op{' ', line})
+	}
+	return ops
+}
+
+// myers finds a shortest edit script of at most maxEdits edits, keeping the
+// furthest reaching paths of every step for backtracking.
+func myers(a, b []string) []op {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	// trace[d] holds v[-d-1..d+1] as it was before step d.
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+	ops := make([]op, 0, n+m)
+	for _, line := range a {
+		ops = append(ops, op{'-', line})
+	}
+	for _, line := range b {
+		ops = append(ops, op{'+', line})
+	}
+	return ops
+}
+
+// backtrack walks the paths of trace back from the end of both texts.
+func backtrack(trace [][]int, a, b []string) []op {
+	x, y := len(a), len(b)
+	var reversed []op
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, op{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, op{'+', b[y-1]})
+			} else {
+				reversed = append(reversed, op{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	ops := make([]op, len(reversed))
+	for i, o := range reversed {
+		ops[len(reversed)-1-i] = o
+	}
+	return ops
+}
@@ -0,0 +1,139 @@
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{
+			name: "equal",
+			a:    "one\ntwo\n",
+			b:    "one\ntwo\n",
+			want: "",
+		},
+		{
+			name:    "changed line",
+			a:       "one\ntwo\nthree\n",
+			b:       "one\n2\nthree\n",
+			context: 1,
+			want:    "--- a\n+++ b\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n",
+		},
+		{
+			name:    "added lines",
+			a:       "one\n",
+			b:       "one\ntwo\nthree\n",
+			context: 3,
+			want:    "--- a\n+++ b\n@@ -1 +1,3 @@\n one\n+two\n+three\n",
+		},
+		{
+			name:    "removed line without context",
+			a:       "one\ntwo\nthree\n",
+			b:       "one\nthree\n",
+			context: 0,
+			want:    "--- a\n+++ b\n@@ -2 +1,0 @@\n-two\n",
+		},
+		{
+			name:    "from empty",
+			a:       "",
+			b:       "new\n",
+			context: 3,
+			want:    "--- a\n+++ b\n@@ -0,0 +1 @@\n+new\n",
+		},
+		{
+			name:    "no newline at end",
+			a:       "one\ntwo",
+			b:       "one\ntwo\n",
+			context: 1,
+			want:    "--- a\n+++ b\n@@ -1,2 +1,2 @@\n one\n-two\n\\ No newline at end of file\n+two\n",
+		},
+		{
+			name:    "separate hunks",
+			a:       "1\n2\n3\n4\n5\n6\n7\n8\n",
+			b:       "x\n2\n3\n4\n5\n6\n7\ny\n",
+			context: 1,
+			want:    "--- a\n+++ b\n@@ -1,2 +1,2 @@\n-1\n+x\n 2\n@@ -7,2 +7,2 @@\n 7\n-8\n+y\n",
+		},
+		{
+			name:    "merged hunks",
+			a:       "1\n2\n3\n4\n",
+			b:       "x\n2\n3\ny\n",
+			context: 1,
+			want:    "--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n-4\n+y\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("a", "b", tt.a, tt.b, tt.context); got != tt.want {
+				t.Errorf("Unified() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestUnifiedApplies checks that the diff of larger texts, including ones
+// beyond maxEdits, turns a into b when applied.
+func TestUnifiedApplies(t *testing.T) {
+	lines := func(n, every int, prefix string) string {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			if every > 0 && i%every == 0 {
+				fmt.Fprintf(&b, "%s%d\n", prefix, i)
+			} else {
+				fmt.Fprintf(&b, "line %d\n", i)
+			}
+		}
+		return b.String()
+	}
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"scattered changes", lines(200, 0, ""), lines(200, 7, "changed ")},
+		{"beyond maxEdits", lines(3000, 0, ""), lines(3000, 2, "changed ")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := apply(t, tt.a, Unified("a", "b", tt.a, tt.b, 3)); got != tt.b {
+				t.Errorf("applying the diff does not yield b")
+			}
+		})
+	}
+}
+
+// apply applies a unified diff of newline-terminated texts to a.
+func apply(t *testing.T, a, diff string) string {
+	t.Helper()
+	old := splitLines(a)
+	var out []string
+	pos := 0
+	for _, line := range splitLines(diff)[2:] {
+		switch line[0] {
+		case '@':
+			var start int
+			if _, err := fmt.Sscanf(line, "@@ -%d", &start); err != nil {
+				t.Fatalf("bad hunk header %q", line)
+			}
+			if !strings.Contains(strings.Fields(line)[1], ",0") {
+				start--
+			}
+			out = append(out, old[pos:start]...)
+			pos = start
+		case ' ':
+			out = append(out, old[pos])
+			pos++
+		case '-':
+			pos++
+		case '+':
+			out = append(out, line[1:])
+		}
+	}
+	return strings.Join(append(out, old[pos:]...), "")
+}
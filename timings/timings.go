@@ -0,0 +1,158 @@
+// Package timings measures how long the stages of a sync take (listing and
+// exporting from Outline, the content pipeline, uploading and knowledge
+// collection changes), per run for run reports and cumulatively for metrics.
+package timings
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mikeshootzz/outline-rag-scraper/models"
+)
+
+// Stages of a sync.
+const (
+	List      = "list"      // Listing documents and collections.
+	Export    = "export"    // Exporting a document.
+	Pipeline  = "pipeline"  // Rendering and saving an exported document.
+	Upload    = "upload"    // Uploading or embedding a file.
+	Knowledge = "knowledge" // Adding files to or removing them from a collection.
+)
+
+// Buckets are the upper bounds, in seconds, of the cumulative histograms.
+var Buckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Histogram is the cumulative distribution of a stage's durations since start.
+type Histogram struct {
+	// Counts holds the observations per bucket, not cumulated; the last
+	// entry counts those above every bound.
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+// Recorder collects the durations observed through its context until it is
+// stopped.
+type Recorder struct {
+	mu        sync.Mutex
+	stopped   bool
+	durations map[string][]time.Duration
+}
+
+var (
+	mu         sync.Mutex
+	histograms = make(map[string]*Histogram)
+)
+
+// recorderKey is the context key of a run's recorder.
+type recorderKey struct{}
+
+// Start begins recording the stages observed through the returned context
+// until Stop. Work running concurrently with other contexts is not recorded.
+func Start(ctx context.Context) (context.Context, *Recorder) {
+	r := &Recorder{durations: make(map[string][]time.Duration)}
+	return context.WithValue(ctx, recorderKey{}, r), r
+}
+
+// Stop ends recording and summarizes the durations per stage.
+func (r *Recorder) Stop() []models.StageTiming {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = true
+	var stages []models.StageTiming
+	for stage, durations := range r.durations {
+		stages = append(stages, summarize(stage, durations))
+	}
+	sort.Slice(stages, func(i, j int) bool { return stageOrder(stages[i].Stage) < stageOrder(stages[j].Stage) })
+	return stages
+}
+
+// Observe records that a stage took d, in the cumulative histograms and the
+// recorder of ctx.
+func Observe(ctx context.Context, stage string, d time.Duration) {
+	mu.Lock()
+	h := histograms[stage]
+	if h == nil {
+		h = &Histogram{Counts: make([]uint64, len(Buckets)+1)}
+		histograms[stage] = h
+	}
+	i := sort.SearchFloat64s(Buckets, d.Seconds())
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+	mu.Unlock()
+	if r, ok := ctx.Value(recorderKey{}).(*Recorder); ok {
+		r.mu.Lock()
+		if !r.stopped {
+			r.durations[stage] = append(r.durations[stage], d)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Since records that a stage took from start until now; it suits defer.
+func Since(ctx context.Context, stage string, start time.Time) {
+	Observe(ctx, stage, time.Since(start))
+}
+
+// Histograms returns a copy of the cumulative histograms by stage.
+func Histograms() map[string]Histogram {
+	mu.Lock()
+	defer mu.Unlock()
+	copied := make(map[string]Histogram, len(histograms))
+	for stage, h := range histograms {
+		copied[stage] = Histogram{Counts: append([]uint64{}, h.Counts...), Count: h.Count, Sum: h.Sum}
+	}
+	return copied
+}
+
+// Merge replaces the stages of base that timings also holds and adds the
+// others, keeping stage order.
+func Merge(base, timings []models.StageTiming) []models.StageTiming {
+	byStage := make(map[string]models.StageTiming, len(base)+len(timings))
+	for _, t := range base {
+		byStage[t.Stage] = t
+	}
+	for _, t := range timings {
+		byStage[t.Stage] = t
+	}
+	merged := make([]models.StageTiming, 0, len(byStage))
+	for _, t := range byStage {
+		merged = append(merged, t)
+	}
+	sort.Slice(merged, func(i, j int) bool { return stageOrder(merged[i].Stage) < stageOrder(merged[j].Stage) })
+	return merged
+}
+
+// summarize computes the total and percentiles of a stage's durations.
+func summarize(stage string, durations []time.Duration) models.StageTiming {
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	percentile := func(p float64) int64 {
+		return sorted[int(p*float64(len(sorted)-1)+0.5)].Milliseconds()
+	}
+	return models.StageTiming{
+		Stage:   stage,
+		Count:   len(sorted),
+		TotalMS: total.Milliseconds(),
+		P50MS:   percentile(0.5),
+		P95MS:   percentile(0.95),
+		MaxMS:   sorted[len(sorted)-1].Milliseconds(),
+	}
+}
+
+// stageOrder sorts stages in the order a sync runs them.
+func stageOrder(stage string) int {
+	for i, s := range []string{List, Export, Pipeline, Upload, Knowledge} {
+		if s == stage {
+			return i
+		}
+	}
+	return 5
+}
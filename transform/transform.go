@@ -0,0 +1,78 @@
+// Package transform runs operator-provided executables as pipeline stages on
+// exported documents, e.g. for company-specific redaction or format fixes.
+//
+// Each stage receives the full exported Markdown file (header, blank line,
+// body) on stdin and must write the transformed file to stdout and exit 0.
+// Document details are passed in ORS_* environment variables. Stages are
+// either executables (TRANSFORM_COMMANDS) or WASI command modules
+// (TRANSFORM_WASM_MODULES) following the same contract, which run sandboxed
+// with no file system or network access and limited memory. Stages are only
+// configured by the operator; mappings refer to them by name.
+package transform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+)
+
+// Known reports whether a transform of that name is configured.
+func Known(name string) bool {
+	_, isCommand := config.ConfigInstance.TransformCommands[name]
+	_, isModule := config.ConfigInstance.TransformModules[name]
+	return isCommand || isModule
+}
+
+// Apply pipes content through the named transforms in order. env is added to
+// each command's environment. A stage that fails, times out or writes
+// nothing aborts the pipeline.
+func Apply(names []string, content []byte, env map[string]string) ([]byte, error) {
+	for _, name := range names {
+		var err error
+		if content, err = run(name, content, env); err != nil {
+			return nil, err
+		}
+	}
+	return content, nil
+}
+
+// run executes a single transform.
+func run(name string, content []byte, env map[string]string) ([]byte, error) {
+	timeout := config.ConfigInstance.TransformTimeout
+	if _, ok := config.ConfigInstance.TransformModules[name]; ok {
+		timeout = config.ConfigInstance.WasmTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if args, ok := config.ConfigInstance.TransformCommands[name]; ok {
+		cmd = exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Env = os.Environ()
+		for key, value := range env {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	} else if module, ok := config.ConfigInstance.TransformModules[name]; ok {
+		cmd = wasmCommand(ctx, module, env)
+	} else {
+		return nil, fmt.Errorf("transform: unknown transform %q", name)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, fmt.Errorf("transform: %s failed: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("transform: %s produced no output", name)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,34 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+
+	"github.com/mikeshootzz/outline-rag-scraper/config"
+)
+
+// wasmCommand runs a WASI module in the configured runtime. The module sees
+// only stdin, stdout, stderr and the given environment: no directories are
+// preopened, no sockets are granted and host variables are not inherited.
+// The runtime enforces the configured memory, fuel and time limits.
+func wasmCommand(ctx context.Context, module string, env map[string]string) *exec.Cmd {
+	runtime := config.ConfigInstance.WasmRuntime
+	args := append([]string{}, runtime[1:]...)
+	args = append(args, "-W", fmt.Sprintf("max-memory-size=%d", config.ConfigInstance.WasmMaxMemoryMB<<20))
+	args = append(args, "-W", fmt.Sprintf("timeout=%dms", config.ConfigInstance.WasmTimeout.Milliseconds()))
+	if config.ConfigInstance.WasmFuel > 0 {
+		args = append(args, "-W", fmt.Sprintf("fuel=%d", config.ConfigInstance.WasmFuel))
+	}
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--env", key+"="+env[key])
+	}
+	args = append(args, module)
+	return exec.CommandContext(ctx, runtime[0], args...)
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// KeyID identifies the key derived from a passphrase without revealing it.
+// Ciphertexts are prefixed with it so rotation knows which key sealed them.
+func KeyID(passphrase string) string {
+	sum := sha256.Sum256([]byte("key-id:" + passphrase))
+	return hex.EncodeToString(sum[:4])
+}
+
+// splitKeyID separates the key ID prefix from a ciphertext. Values written
+// before key IDs were introduced have none.
+func splitKeyID(encoded string) (string, string) {
+	if id, sealed, found := strings.Cut(encoded, ":"); found {
+		return id, sealed
+	}
+	return "", encoded
+}
+
+// newGCM derives an AES-256-GCM cipher from a passphrase.
+func newGCM(passphrase string) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errors.New("no encryption key configured")
+	}
+	key := sha256.Sum256([]byte(passphrase))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptString encrypts plaintext with AES-256-GCM under a key derived from
+// passphrase and returns the key ID and the base64-encoded nonce and
+// ciphertext, separated by a colon.
+func EncryptString(passphrase, plaintext string) (string, error) {
+	gcm, err := newGCM(passphrase)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return KeyID(passphrase) + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString reverses EncryptString.
+func DecryptString(passphrase, encoded string) (string, error) {
+	gcm, err := newGCM(passphrase)
+	if err != nil {
+		return "", err
+	}
+	_, encoded = splitKeyID(encoded)
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("DecryptString: ciphertext too short")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// DecryptWithKeys decrypts a value sealed with any of passphrases, e.g. the
+// current key and those being rotated out. It also reports whether the value
+// was sealed with the first (current) key.
+func DecryptWithKeys(passphrases []string, encoded string) (string, bool, error) {
+	id, _ := splitKeyID(encoded)
+	if len(passphrases) == 0 {
+		return "", false, errors.New("no encryption key configured")
+	}
+	err := errors.New("DecryptWithKeys: sealed with unknown key " + id)
+	for i, passphrase := range passphrases {
+		// Values without a key ID are tried against every key.
+		if id != "" && id != KeyID(passphrase) {
+			continue
+		}
+		var plaintext string
+		if plaintext, err = DecryptString(passphrase, encoded); err == nil {
+			return plaintext, i == 0 && id != "", nil
+		}
+	}
+	return "", false, err
+}
@@ -2,12 +2,13 @@
 package utils
 
 import (
-	"log"
+	"log/slog"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
 	"github.com/mikeshootzz/outline-rag-scraper/config"
+	"github.com/mikeshootzz/outline-rag-scraper/logging"
 	"github.com/mikeshootzz/outline-rag-scraper/models"
 )
 
@@ -17,16 +18,54 @@ var DB *gorm.DB
 // InitDB initializes the PostgreSQL database connection using GORM.
 func InitDB() {
 	dsn := config.ConfigInstance.DatabaseURL // e.g.: "host=localhost user=youruser password=yourpassword dbname=yourdb port=5432 sslmode=disable"
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+		logging.Fatal("Failed to connect to database", "error", err)
 	}
 	DB = db
 
-	// Automatically migrate the CollectionMapping model.
-	if err := db.AutoMigrate(&models.CollectionMapping{}); err != nil {
-		log.Fatalf("failed to auto-migrate database: %v", err)
+	// Automatically migrate the models.
+	if err := db.AutoMigrate(
+		&models.CollectionMapping{},
+		&models.ExportedDocument{},
+		&models.ExportCheckpoint{},
+		&models.DocumentChange{},
+		&models.UploadedFile{},
+		&models.APIKey{},
+		&models.AuditEvent{},
+		&models.ImageText{},
+		&models.DiagramDescription{},
+		&models.BrokenLink{},
+		&models.Job{},
+		&models.PendingChange{},
+		&models.UserToken{},
+		&models.PinnedDocument{},
+		&models.CollectionPermission{},
+		&models.SyncRun{},
+		&models.IntegrityReport{},
+		&models.ExcludedDocument{},
+		&models.CredentialStatus{},
+		&models.DocumentDiff{},
+		&models.ReviewItem{},
+		&models.DocumentFeedback{},
+		&models.FailureStreak{},
+		&models.Role{},
+		&models.User{},
+		&models.DocumentQuestions{},
+		&models.Lock{},
+		&models.ScheduleSlot{},
+	); err != nil {
+		logging.Fatal("Failed to auto-migrate database", "error", err)
+	}
+	// Mappings used to be unique per collection; now per source and collection.
+	if db.Migrator().HasIndex(&models.CollectionMapping{}, "idx_collection_mappings_outline_collection") {
+		if err := db.Migrator().DropIndex(&models.CollectionMapping{}, "idx_collection_mappings_outline_collection"); err != nil {
+			logging.Fatal("Failed to migrate collection mapping index", "error", err)
+		}
+	}
+	if err := models.EnsureBuiltinRoles(db); err != nil {
+		logging.Fatal("Failed to create built-in roles", "error", err)
 	}
 
-	log.Println("Database connection initialized.")
+	slog.Info("Database connection initialized")
 }
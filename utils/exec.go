@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"context"
+	"os/exec"
+)
+
+// CommandRunner runs external commands that reach upstream systems, such as
+// git and rsync.
+type CommandRunner interface {
+	Run(cmd *exec.Cmd) error
+}
+
+// commandRunnerKey is the context key of the command runner a run uses.
+type commandRunnerKey struct{}
+
+// WithCommandRunner returns a copy of ctx whose upstream commands go through
+// runner, e.g. to answer them from fixtures.
+func WithCommandRunner(ctx context.Context, runner CommandRunner) context.Context {
+	return context.WithValue(ctx, commandRunnerKey{}, runner)
+}
+
+// Run runs cmd with the command runner of ctx, or directly. Output goes to
+// cmd.Stdout and cmd.Stderr as usual.
+func Run(ctx context.Context, cmd *exec.Cmd) error {
+	if runner, ok := ctx.Value(commandRunnerKey{}).(CommandRunner); ok {
+		return runner.Run(cmd)
+	}
+	return cmd.Run()
+}
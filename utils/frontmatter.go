@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// hashtagRe matches Outline hashtags such as #onboarding; headings ("# Title")
+// do not match because the tag must follow the hash directly.
+var hashtagRe = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}][\p{L}\p{N}_-]*)`)
+
+// FrontMatter builds a YAML front matter block. Values are written as JSON
+// scalars and flow sequences, which are valid YAML and never span lines, so
+// the block contains no blank line and the body still starts after the first
+// "\n\n" of the file.
+type FrontMatter struct {
+	lines []string
+}
+
+// Set adds a field; empty strings, empty lists and zero times are left out.
+func (f *FrontMatter) Set(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return
+		}
+	case []string:
+		if len(v) == 0 {
+			return
+		}
+	case time.Time:
+		if v.IsZero() {
+			return
+		}
+		value = v.UTC().Format(time.RFC3339)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	f.lines = append(f.lines, key+": "+string(data))
+}
+
+// String renders the block, including its --- delimiters and a final newline.
+func (f *FrontMatter) String() string {
+	return "---\n" + strings.Join(f.lines, "\n") + "\n---\n"
+}
+
+// Fields returns the fields as JSON values keyed by name.
+func (f *FrontMatter) Fields() map[string]json.RawMessage {
+	fields := make(map[string]json.RawMessage, len(f.lines))
+	for _, line := range f.lines {
+		key, value, _ := strings.Cut(line, ": ")
+		fields[key] = json.RawMessage(value)
+	}
+	return fields
+}
+
+// HasFrontMatter reports whether a document header is a front matter block.
+func HasFrontMatter(header string) bool {
+	return strings.HasPrefix(header, "---\n") && strings.HasSuffix(header, "\n---")
+}
+
+// AddFrontMatterField adds a field to the front matter block of a document
+// header (the part before the first blank line).
+func AddFrontMatterField(header, key string, value interface{}) string {
+	var field FrontMatter
+	field.Set(key, value)
+	if len(field.lines) == 0 || !HasFrontMatter(header) {
+		return header
+	}
+	return strings.TrimSuffix(header, "---") + field.lines[0] + "\n---"
+}
+
+// Hashtags returns the distinct hashtags in text, lower-cased and sorted.
+func Hashtags(text string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, m := range hashtagRe.FindAllStringSubmatch(text, -1) {
+		tag := strings.ToLower(m[1])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
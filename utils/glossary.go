@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// glossaryEntryRe matches "TERM: definition" and "TERM - definition" lines,
+// optionally as list items with a bold term.
+var glossaryEntryRe = regexp.MustCompile(`^(?:[-*+]\s+)?(?:\*\*|__)?([^:|*_]{1,40}?)(?:\*\*|__)?\s*(?::|\s[-–—]\s)\s*(.+)$`)
+
+// Glossary holds term definitions and a matcher finding every term in one
+// pass over a text.
+type Glossary struct {
+	Definitions map[string]string
+	// Checksum identifies the glossary text the definitions were read from.
+	Checksum string
+	matcher  *regexp.Regexp
+}
+
+// ParseGlossary reads term definitions from a glossary. Entries are either
+// "TERM: definition" lines (optionally list items with a bold term) or rows of
+// a two-column Markdown table.
+func ParseGlossary(text string) *Glossary {
+	definitions := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "|") {
+			cells := strings.Split(strings.Trim(line, "|"), "|")
+			if len(cells) < 2 {
+				continue
+			}
+			term := strings.Trim(strings.TrimSpace(cells[0]), "*_")
+			definition := strings.TrimSpace(cells[1])
+			if term == "" || definition == "" || strings.Trim(term, "-: ") == "" {
+				continue
+			}
+			definitions[term] = definition
+			continue
+		}
+		if m := glossaryEntryRe.FindStringSubmatch(line); m != nil {
+			definitions[strings.TrimSpace(m[1])] = strings.TrimSpace(m[2])
+		}
+	}
+	// Drop the header row of a glossary table.
+	for term := range definitions {
+		if strings.EqualFold(term, "term") || strings.EqualFold(term, "acronym") {
+			delete(definitions, term)
+		}
+	}
+	return &Glossary{Definitions: definitions, Checksum: Checksum([]byte(text)), matcher: termsRe(definitions)}
+}
+
+// termsRe matches any of the terms as a whole word, preferring the longest.
+func termsRe(definitions map[string]string) *regexp.Regexp {
+	if len(definitions) == 0 {
+		return nil
+	}
+	terms := make([]string, 0, len(definitions))
+	for term := range definitions {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if len(terms[i]) != len(terms[j]) {
+			return len(terms[i]) > len(terms[j])
+		}
+		return terms[i] < terms[j]
+	})
+	for i, term := range terms {
+		terms[i] = regexp.QuoteMeta(term)
+	}
+	return regexp.MustCompile(`(?:^|[^\w])(` + strings.Join(terms, "|") + `)\b`)
+}
+
+// Terms returns the glossary terms occurring in text as whole words, sorted.
+func (g *Glossary) Terms(text string) []string {
+	if g.matcher == nil {
+		return nil
+	}
+	found := make(map[string]bool)
+	for _, m := range g.matcher.FindAllStringSubmatch(text, -1) {
+		found[m[1]] = true
+	}
+	terms := make([]string, 0, len(found))
+	for term := range found {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+// ExpandAcronyms spells out the first occurrence of every glossary term in
+// content, e.g. "SLA" becomes "SLA (Service Level Agreement)". Only the first
+// sentence of a definition is inserted. Fenced code blocks are left alone.
+func (g *Glossary) ExpandAcronyms(content string) string {
+	if g.matcher == nil {
+		return content
+	}
+	expanded := make(map[string]bool)
+	lines := strings.Split(content, "\n")
+	inFence := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, loc := range g.matcher.FindAllStringSubmatchIndex(line, -1) {
+			term, end := line[loc[2]:loc[3]], loc[3]
+			if expanded[term] {
+				continue
+			}
+			expanded[term] = true
+			// Skip terms the author already spelled out.
+			if strings.HasPrefix(line[end:], " (") {
+				continue
+			}
+			b.WriteString(line[last:end])
+			b.WriteString(" (" + shortDefinition(g.Definitions[term]) + ")")
+			last = end
+		}
+		if last > 0 {
+			b.WriteString(line[last:])
+			lines[i] = b.String()
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// shortDefinition returns the first sentence of a definition.
+func shortDefinition(definition string) string {
+	if i := strings.Index(definition, ". "); i > 0 {
+		return definition[:i]
+	}
+	return strings.TrimSuffix(definition, ".")
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+)
+
+// httpClientKey is the context key of the HTTP client a run uses.
+type httpClientKey struct{}
+
+// WithHTTPClient returns a copy of ctx whose upstream calls go through client,
+// e.g. to record them for a debug bundle or answer them from fixtures.
+func WithHTTPClient(ctx context.Context, client *http.Client) context.Context {
+	return context.WithValue(ctx, httpClientKey{}, client)
+}
+
+// HTTPClient returns the HTTP client of ctx, or http.DefaultClient.
+func HTTPClient(ctx context.Context) *http.Client {
+	if client, ok := ctx.Value(httpClientKey{}).(*http.Client); ok {
+		return client
+	}
+	return http.DefaultClient
+}
+
+// Do sends req with the HTTP client of its context.
+func Do(req *http.Request) (*http.Response, error) {
+	return HTTPClient(req.Context()).Do(req)
+}
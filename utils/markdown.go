@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	mdImageRe      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLinkRe       = regexp.MustCompile(`\[([^\]]+)\]\(([^)]*)\)`)
+	mdHeadingRe    = regexp.MustCompile(`(?m)^#{1,6}\s+`)
+	mdBlockquoteRe = regexp.MustCompile(`(?m)^>\s?`)
+	mdFenceRe      = regexp.MustCompile("(?m)^(```|~~~).*$\n?")
+	mdEmphasisRe   = regexp.MustCompile(`(\*\*|__|~~)(.+?)(\*\*|__|~~)`)
+	mdStarItalicRe = regexp.MustCompile(`(^|[^\w*])\*([^\s*][^*\n]*)\*`)
+	mdUndItalicRe  = regexp.MustCompile(`(^|[^\w_])_([^\s_][^_\n]*)_($|[^\w_])`)
+	mdInlineCodeRe = regexp.MustCompile("`([^`]*)`")
+	mdRuleRe       = regexp.MustCompile(`(?m)^\s*([-*_]\s*){3,}$`)
+	mdTableSepRe   = regexp.MustCompile(`(?m)^\s*\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?\s*$\n?`)
+	mdBlankLinesRe = regexp.MustCompile(`\n{3,}`)
+)
+
+// MarkdownToPlainText strips Markdown syntax from content while keeping its
+// text. Links keep their target in parentheses so citations remain usable;
+// table rows become pipe-free lines.
+func MarkdownToPlainText(content string) string {
+	text := mdFenceRe.ReplaceAllString(content, "")
+	text = mdImageRe.ReplaceAllString(text, "$1")
+	text = mdLinkRe.ReplaceAllString(text, "$1 ($2)")
+	text = mdHeadingRe.ReplaceAllString(text, "")
+	text = mdBlockquoteRe.ReplaceAllString(text, "")
+	text = mdRuleRe.ReplaceAllString(text, "")
+	text = mdTableSepRe.ReplaceAllString(text, "")
+	text = mdEmphasisRe.ReplaceAllString(text, "$2")
+	text = mdStarItalicRe.ReplaceAllString(text, "$1$2")
+	text = mdUndItalicRe.ReplaceAllString(text, "$1$2$3")
+	text = mdInlineCodeRe.ReplaceAllString(text, "$1")
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "|") && strings.HasSuffix(trimmed, "|") {
+			cells := strings.Split(strings.Trim(trimmed, "|"), "|")
+			for j := range cells {
+				cells[j] = strings.TrimSpace(cells[j])
+			}
+			lines[i] = strings.Join(cells, " - ")
+		}
+	}
+	text = strings.Join(lines, "\n")
+	return strings.TrimSpace(mdBlankLinesRe.ReplaceAllString(text, "\n\n")) + "\n"
+}
+
+// StripSections removes every section whose heading matches one of headings
+// (case-insensitively), up to the next heading of the same or a higher level.
+// Headings inside fenced code blocks are ignored.
+func StripSections(content string, headings []string) string {
+	if len(headings) == 0 {
+		return content
+	}
+	strip := make(map[string]bool, len(headings))
+	for _, heading := range headings {
+		strip[strings.ToLower(strings.TrimSpace(heading))] = true
+	}
+
+	var out []string
+	inFence := false
+	skipLevel := 0 // level of the heading being stripped; 0 when keeping lines
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		} else if !inFence && strings.HasPrefix(trimmed, "#") {
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			title := strings.TrimSpace(trimmed[level:])
+			if level <= 6 && (title == "" || trimmed[level] == ' ' || trimmed[level] == '\t') {
+				if skipLevel > 0 && level <= skipLevel {
+					skipLevel = 0
+				}
+				if skipLevel == 0 && strip[strings.ToLower(strings.TrimRight(title, " #"))] {
+					skipLevel = level
+				}
+			}
+		}
+		if skipLevel == 0 {
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// Summary returns the first sentence of the first prose paragraph of a
+// Markdown document as plain text, cut at a word boundary to at most limit
+// characters. Headings, code blocks, tables, lists and images are skipped.
+func Summary(content string, limit int) string {
+	inFence := false
+	var paragraph []string
+lines:
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		if trimmed == "" {
+			if len(paragraph) > 0 {
+				break lines
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(trimmed, "#"), strings.HasPrefix(trimmed, "|"), strings.HasPrefix(trimmed, "!["),
+			strings.HasPrefix(trimmed, "- "), strings.HasPrefix(trimmed, "* "), strings.HasPrefix(trimmed, "+ "),
+			mdRuleRe.MatchString(trimmed):
+			if len(paragraph) > 0 {
+				break lines
+			}
+			continue
+		}
+		paragraph = append(paragraph, strings.TrimPrefix(strings.TrimPrefix(trimmed, ">"), " "))
+	}
+	text := strings.Join(paragraph, " ")
+	text = mdImageRe.ReplaceAllString(text, "")
+	text = mdLinkRe.ReplaceAllString(text, "$1")
+	text = mdEmphasisRe.ReplaceAllString(text, "$2")
+	text = mdStarItalicRe.ReplaceAllString(text, "$1$2")
+	text = mdUndItalicRe.ReplaceAllString(text, "$1$2$3")
+	text = mdInlineCodeRe.ReplaceAllString(text, "$1")
+	text = strings.Join(strings.Fields(text), " ")
+	if end := strings.Index(text, ". "); end >= 0 {
+		text = text[:end+1]
+	}
+	if runes := []rune(text); len(runes) > limit {
+		cut := string(runes[:limit])
+		if space := strings.LastIndex(cut, " "); space > 0 {
+			cut = cut[:space]
+		}
+		text = strings.TrimRight(cut, " ,;:") + "…"
+	}
+	return text
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	// shingleSize is the number of words per shingle.
+	shingleSize = 5
+	// MinHashSize is the number of hash functions in a MinHash signature.
+	MinHashSize = 64
+	// minHashBands and minHashRows split signatures for locality-sensitive
+	// hashing; documents sharing a band become candidate pairs. 16 bands of 4
+	// rows surface pairs from roughly 50% similarity upwards.
+	minHashBands = 16
+	minHashRows  = MinHashSize / minHashBands
+)
+
+// MinHash computes a MinHash signature over the word shingles of text. The
+// fraction of equal positions in two signatures estimates the Jaccard
+// similarity of the texts.
+func MinHash(text string) []uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	signature := make([]uint64, MinHashSize)
+	for i := range signature {
+		signature[i] = math.MaxUint64
+	}
+	if len(words) == 0 {
+		return signature
+	}
+	n := shingleSize
+	if len(words) < n {
+		n = len(words)
+	}
+	for i := 0; i+n <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+n], " ")))
+		base := h.Sum64()
+		for j := range signature {
+			// Derive the j-th hash function by mixing in a per-function seed.
+			v := mix64(base ^ (uint64(j+1) * 0x9e3779b97f4a7c15))
+			if v < signature[j] {
+				signature[j] = v
+			}
+		}
+	}
+	return signature
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// MinHashSimilarity estimates the Jaccard similarity of two signatures.
+func MinHashSimilarity(a, b []uint64) float64 {
+	equal := 0
+	for i := range a {
+		if a[i] == b[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(a))
+}
+
+// MinHashCandidates returns the index pairs (i < j) of signatures sharing at
+// least one LSH band, i.e. the pairs worth comparing.
+func MinHashCandidates(signatures [][]uint64) [][2]int {
+	seen := make(map[[2]int]bool)
+	var pairs [][2]int
+	for band := 0; band < minHashBands; band++ {
+		buckets := make(map[uint64][]int)
+		for i, signature := range signatures {
+			h := fnv.New64a()
+			for _, v := range signature[band*minHashRows : (band+1)*minHashRows] {
+				var b [8]byte
+				for k := range b {
+					b[k] = byte(v >> (8 * k))
+				}
+				h.Write(b[:])
+			}
+			key := h.Sum64()
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, bucket := range buckets {
+			for x := 0; x < len(bucket); x++ {
+				for y := x + 1; y < len(bucket); y++ {
+					pair := [2]int{bucket[x], bucket[y]}
+					if !seen[pair] {
+						seen[pair] = true
+						pairs = append(pairs, pair)
+					}
+				}
+			}
+		}
+	}
+	return pairs
+}
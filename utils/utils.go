@@ -19,3 +19,12 @@ func SanitizeFilename(title string) string {
 	re := regexp.MustCompile(`[^a-zA-Z0-9_-]`)
 	return re.ReplaceAllString(title, "")
 }
+
+// NormalizeExtension ensures a non-empty file extension starts with a dot.
+func NormalizeExtension(ext string) string {
+	ext = strings.TrimSpace(ext)
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}